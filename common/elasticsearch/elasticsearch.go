@@ -20,6 +20,7 @@ import (
 	"time"
 
 	"github.com/golang/glog"
+	"golang.org/x/net/context"
 
 	"errors"
 	"os"
@@ -52,6 +53,11 @@ func (esSvc *ElasticSearchService) FlushData() error {
 
 // SaveDataIntoES save metrics and events to ES by using ES client
 func (esSvc *ElasticSearchService) SaveData(date time.Time, typeName string, sinkData []interface{}) error {
+	return esSvc.SaveDataContext(context.Background(), date, typeName, sinkData)
+}
+
+// SaveDataContext is SaveData with the index and alias requests bound to ctx.
+func (esSvc *ElasticSearchService) SaveDataContext(ctx context.Context, date time.Time, typeName string, sinkData []interface{}) error {
 	if typeName == "" || len(sinkData) == 0 {
 		return nil
 	}
@@ -59,14 +65,14 @@ func (esSvc *ElasticSearchService) SaveData(date time.Time, typeName string, sin
 	indexName := esSvc.Index(date)
 
 	// Use the IndexExists service to check if a specified index exists.
-	exists, err := esSvc.EsClient.IndexExists(indexName)
+	exists, err := esSvc.EsClient.IndexExists(ctx, indexName)
 	if err != nil {
 		return err
 	}
 
 	if !exists {
 		// Create a new index.
-		createIndex, err := esSvc.EsClient.CreateIndex(indexName, mapping)
+		createIndex, err := esSvc.EsClient.CreateIndex(ctx, indexName, mapping)
 		if err != nil {
 			return err
 		}
@@ -83,7 +89,7 @@ func (esSvc *ElasticSearchService) SaveData(date time.Time, typeName string, sin
 		}
 	}
 
-	aliases, err := esSvc.EsClient.GetAliases(indexName)
+	aliases, err := esSvc.EsClient.GetAliases(ctx, indexName)
 	if err != nil {
 		return err
 	}
@@ -97,7 +103,7 @@ func (esSvc *ElasticSearchService) SaveData(date time.Time, typeName string, sin
 		hasAlias = a.Indices[indexName].HasAlias(aliasName)
 	}
 	if !hasAlias {
-		createAlias, err := esSvc.EsClient.AddAlias(indexName, esSvc.IndexAlias(typeName))
+		createAlias, err := esSvc.EsClient.AddAlias(ctx, indexName, esSvc.IndexAlias(typeName))
 		if err != nil {
 			return err
 		}
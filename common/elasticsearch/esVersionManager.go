@@ -78,45 +78,58 @@ func newEsClientV2(startupFns []elastic2.ClientOptionFunc, bulkWorkers int) (*es
 	return &esClient{version: 2, clientV2: client, bulkProcessorV2: bps}, nil
 }
 
-func (es *esClient) IndexExists(indices ...string) (bool, error) {
+func (es *esClient) IndexExists(ctx context.Context, indices ...string) (bool, error) {
 	switch es.version {
 	case 2:
+		// The v2 client can't cancel requests.
+		if err := ctx.Err(); err != nil {
+			return false, err
+		}
 		return es.clientV2.IndexExists(indices...).Do()
 	case 5:
-		return es.clientV5.IndexExists(indices...).Do(context.Background())
+		return es.clientV5.IndexExists(indices...).Do(ctx)
 	default:
 		return false, UnsupportedVersion{}
 	}
 }
 
-func (es *esClient) CreateIndex(name string, mapping string) (interface{}, error) {
+func (es *esClient) CreateIndex(ctx context.Context, name string, mapping string) (interface{}, error) {
 	switch es.version {
 	case 2:
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
 		return es.clientV2.CreateIndex(name).BodyString(mapping).Do()
 	case 5:
-		return es.clientV5.CreateIndex(name).BodyString(mapping).Do(context.Background())
+		return es.clientV5.CreateIndex(name).BodyString(mapping).Do(ctx)
 	default:
 		return nil, UnsupportedVersion{}
 	}
 }
 
-func (es *esClient) GetAliases(index string) (interface{}, error) {
+func (es *esClient) GetAliases(ctx context.Context, index string) (interface{}, error) {
 	switch es.version {
 	case 2:
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
 		return es.clientV2.Aliases().Index(index).Do()
 	case 5:
-		return es.clientV5.Aliases().Index(index).Do(context.Background())
+		return es.clientV5.Aliases().Index(index).Do(ctx)
 	default:
 		return nil, UnsupportedVersion{}
 	}
 }
 
-func (es *esClient) AddAlias(index string, alias string) (interface{}, error) {
+func (es *esClient) AddAlias(ctx context.Context, index string, alias string) (interface{}, error) {
 	switch es.version {
 	case 2:
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
 		return es.clientV2.Alias().Add(index, alias).Do()
 	case 5:
-		return es.clientV5.Alias().Add(index, alias).Do(context.Background())
+		return es.clientV5.Alias().Add(index, alias).Do(ctx)
 	default:
 		return nil, UnsupportedVersion{}
 	}
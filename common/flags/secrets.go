@@ -0,0 +1,171 @@
+// Copyright 2018 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package flags
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"strings"
+)
+
+const (
+	// FileSuffix marks options whose value is read from a file, e.g.
+	// pw_file=/etc/influxdb/password stands for pw=<content of the file>.
+	FileSuffix = "_file"
+	// EnvSuffix marks options whose value is read from an environment
+	// variable, e.g. pw_env=INFLUXDB_PASSWORD stands for pw=$INFLUXDB_PASSWORD.
+	EnvSuffix = "_env"
+
+	redacted = "xxxxx"
+)
+
+// secretWords are the words of option names holding secrets, like pw,
+// password or access_token.
+var secretWords = map[string]bool{
+	"pw":          true,
+	"pwd":         true,
+	"passwd":      true,
+	"password":    true,
+	"secret":      true,
+	"token":       true,
+	"key":         true,
+	"apikey":      true,
+	"writekey":    true,
+	"auth":        true,
+	"credentials": true,
+	"sign":        true,
+}
+
+// secretPathKeys are the keys of uris whose path holds a secret, like the
+// token at the end of a slack webhook URL.
+var secretPathKeys = map[string]bool{
+	"slack": true,
+	"teams": true,
+}
+
+// ResolveOptions replaces the options of the uri given as <name>_file or
+// <name>_env by <name>, with the content of the file, trailing newlines
+// trimmed, or the value of the environment variable. Of several forms of an
+// option, the file wins over the environment variable, which wins over the
+// plain value. Options in keep are left as is, for the sinks that read their
+// own <name>_file options, like ca_file.
+func ResolveOptions(uri *url.URL, keep ...string) error {
+	opts := uri.Query()
+	kept := make(map[string]bool, len(keep))
+	for _, name := range keep {
+		kept[name] = true
+	}
+	resolved := false
+	// Environment variables first, so that files override them.
+	for _, suffix := range []string{EnvSuffix, FileSuffix} {
+		for option, values := range opts {
+			name := strings.TrimSuffix(option, suffix)
+			if name == option || name == "" || kept[option] || len(values) == 0 {
+				continue
+			}
+			value, err := resolveOption(option, values[0], suffix)
+			if err != nil {
+				return err
+			}
+			opts[name] = []string{value}
+			delete(opts, option)
+			resolved = true
+		}
+	}
+	if resolved {
+		uri.RawQuery = opts.Encode()
+	}
+	return nil
+}
+
+func resolveOption(option, source, suffix string) (string, error) {
+	if suffix == EnvSuffix {
+		value, ok := os.LookupEnv(source)
+		if !ok {
+			return "", fmt.Errorf("%s: environment variable %s is not set", option, source)
+		}
+		return value, nil
+	}
+	data, err := ioutil.ReadFile(source)
+	if err != nil {
+		return "", fmt.Errorf("%s: %v", option, err)
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+// IsSecretOption tells whether the option holds a secret, going by its name.
+// Options naming where a secret comes from, like pw_file, don't.
+func IsSecretOption(name string) bool {
+	if strings.HasSuffix(name, FileSuffix) || strings.HasSuffix(name, EnvSuffix) {
+		return false
+	}
+	for _, word := range strings.FieldsFunc(strings.ToLower(name), func(r rune) bool { return r == '_' || r == '-' }) {
+		if secretWords[word] {
+			return true
+		}
+	}
+	return false
+}
+
+// Redacted returns the uri as String does, with the password of the user
+// info, the values of secret options and the path of webhook URLs masked,
+// for logging.
+func (u *Uri) Redacted() string {
+	val := u.Val
+	redactPath(u.Key, &val)
+	if val.User != nil {
+		if _, ok := val.User.Password(); ok {
+			val.User = url.UserPassword(val.User.Username(), redacted)
+		}
+	}
+	opts := val.Query()
+	masked := false
+	for name, values := range opts {
+		if !IsSecretOption(name) {
+			continue
+		}
+		for i := range values {
+			values[i] = redacted
+		}
+		masked = true
+	}
+	if masked {
+		val.RawQuery = opts.Encode()
+	}
+	return (&Uri{Key: u.Key, Val: val}).String()
+}
+
+// redactPath masks the path of the uri value if the key is in
+// secretPathKeys. The value of a sink wrapping another one, like
+// circuitbreaker:slack:https://..., is the opaque uri of the wrapped sink.
+func redactPath(key string, val *url.URL) {
+	if secretPathKeys[key] {
+		if val.Path != "" {
+			val.Path, val.RawPath = "/"+redacted, ""
+		}
+		return
+	}
+	if val.Scheme == "" || val.Opaque == "" {
+		return
+	}
+	wrapped, err := url.Parse(val.Opaque)
+	if err != nil {
+		return
+	}
+	redactPath(val.Scheme, wrapped)
+	val.Opaque = wrapped.String()
+}
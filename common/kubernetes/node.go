@@ -0,0 +1,50 @@
+// Copyright 2018 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kubernetes
+
+import (
+	"fmt"
+	"os"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kubeclient "k8s.io/client-go/kubernetes"
+	kube_rest "k8s.io/client-go/rest"
+)
+
+// NodeNameEnv is the environment variable holding the name of the node the
+// pod runs on, to be set to spec.nodeName through the downward API.
+const NodeNameEnv = "NODE_NAME"
+
+// NodeLabel returns the value of label on the node the pod runs on, read
+// from the API server with the in-cluster config.
+func NodeLabel(label string) (string, error) {
+	name := os.Getenv(NodeNameEnv)
+	if name == "" {
+		return "", fmt.Errorf("%s isn't set, it should be set to spec.nodeName through the downward API", NodeNameEnv)
+	}
+	kubeConfig, err := kube_rest.InClusterConfig()
+	if err != nil {
+		return "", err
+	}
+	kubeClient, err := kubeclient.NewForConfig(kubeConfig)
+	if err != nil {
+		return "", err
+	}
+	node, err := kubeClient.CoreV1().Nodes().Get(name, metav1.GetOptions{})
+	if err != nil {
+		return "", fmt.Errorf("failed to get node %s: %v", name, err)
+	}
+	return node.Labels[label], nil
+}
@@ -0,0 +1,86 @@
+// Copyright 2018 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reconnect
+
+import (
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/golang/glog"
+	"k8s.io/client-go/util/flowcontrol"
+)
+
+const (
+	DefaultInitialBackoff = time.Second
+	DefaultMaxBackoff     = 2 * time.Minute
+)
+
+// Reconnector throttles the reconnection attempts of a sink that lost its
+// connection, backing off exponentially up to a maximum between failed
+// attempts.
+type Reconnector struct {
+	name     string
+	backoff  *flowcontrol.Backoff
+	attempts int
+}
+
+func NewReconnector(name string, maxBackoff time.Duration) *Reconnector {
+	initial := DefaultInitialBackoff
+	if initial > maxBackoff {
+		initial = maxBackoff
+	}
+	return &Reconnector{
+		name:    name,
+		backoff: flowcontrol.NewBackOff(initial, maxBackoff),
+	}
+}
+
+// ParseMaxBackoff parses the max_backoff option, defaulting to DefaultMaxBackoff.
+func ParseMaxBackoff(opts url.Values) (time.Duration, error) {
+	if len(opts["max_backoff"]) == 0 {
+		return DefaultMaxBackoff, nil
+	}
+	maxBackoff, err := time.ParseDuration(opts["max_backoff"][0])
+	if err != nil || maxBackoff <= 0 {
+		return 0, fmt.Errorf("max_backoff must be a positive duration, got %q", opts["max_backoff"][0])
+	}
+	return maxBackoff, nil
+}
+
+// Attempt calls connect unless the previous attempt failed too recently,
+// and tells whether the sink is connected again. A nil Reconnector doesn't
+// throttle attempts.
+func (r *Reconnector) Attempt(connect func() error) bool {
+	if r == nil {
+		return connect() == nil
+	}
+	now := r.backoff.Clock.Now()
+	if r.backoff.IsInBackOffSinceUpdate(r.name, now) {
+		glog.V(2).Infof("Not reconnecting %s yet, backing off for %v", r.name, r.backoff.Get(r.name))
+		return false
+	}
+
+	r.attempts++
+	if err := connect(); err != nil {
+		r.backoff.Next(r.name, now)
+		glog.Warningf("Reconnect attempt %d of %s failed, next attempt in %v: %v", r.attempts, r.name, r.backoff.Get(r.name), err)
+		return false
+	}
+	glog.Infof("Reconnected %s after %d attempt(s)", r.name, r.attempts)
+	r.attempts = 0
+	r.backoff.Reset(r.name)
+	return true
+}
@@ -0,0 +1,74 @@
+// Copyright 2018 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reconnect
+
+import (
+	"fmt"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/util/clock"
+	"k8s.io/client-go/util/flowcontrol"
+)
+
+func TestAttemptBacksOff(t *testing.T) {
+	fakeClock := clock.NewFakeClock(time.Now())
+	r := &Reconnector{
+		name:    "test",
+		backoff: flowcontrol.NewFakeBackOff(time.Second, 4*time.Second, fakeClock),
+	}
+	calls := 0
+	failing := func() error {
+		calls++
+		return fmt.Errorf("connection refused")
+	}
+
+	assert.False(t, r.Attempt(failing))
+	// Backing off, connect isn't called.
+	assert.False(t, r.Attempt(failing))
+	assert.Equal(t, 1, calls)
+
+	fakeClock.Step(time.Second)
+	assert.False(t, r.Attempt(failing))
+	assert.Equal(t, 2, calls)
+	assert.Equal(t, 2*time.Second, r.backoff.Get("test"))
+
+	// The backoff is capped.
+	for i := 0; i < 5; i++ {
+		fakeClock.Step(4 * time.Second)
+		r.Attempt(failing)
+	}
+	assert.Equal(t, 4*time.Second, r.backoff.Get("test"))
+
+	fakeClock.Step(4 * time.Second)
+	assert.True(t, r.Attempt(func() error { return nil }))
+	assert.Equal(t, time.Duration(0), r.backoff.Get("test"))
+	assert.Equal(t, 0, r.attempts)
+}
+
+func TestParseMaxBackoff(t *testing.T) {
+	maxBackoff, err := ParseMaxBackoff(url.Values{})
+	assert.NoError(t, err)
+	assert.Equal(t, DefaultMaxBackoff, maxBackoff)
+
+	maxBackoff, err = ParseMaxBackoff(url.Values{"max_backoff": {"30s"}})
+	assert.NoError(t, err)
+	assert.Equal(t, 30*time.Second, maxBackoff)
+
+	_, err = ParseMaxBackoff(url.Values{"max_backoff": {"0s"}})
+	assert.Error(t, err)
+}
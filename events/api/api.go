@@ -22,7 +22,7 @@ import (
 )
 
 func init() {
-	healthz.InstallHandler(http.DefaultServeMux, healthzChecker())
+	healthz.InstallHandler(http.DefaultServeMux, healthzChecker(), sinksChecker())
 
 	http.Handle("/metrics", prometheus.UninstrumentedHandler())
 }
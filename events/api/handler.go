@@ -18,6 +18,7 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"sync"
 	"time"
 
 	"github.com/golang/glog"
@@ -30,8 +31,29 @@ const (
 	MaxEventsScrapeDelay = 3 * time.Minute
 )
 
+// standby is set while the eventer waits to be elected leader, and gets no
+// events.
+var standby struct {
+	sync.RWMutex
+	waiting bool
+}
+
+// SetStandby tells whether the eventer waits to be elected leader, the
+// healthz check then doesn't expect event batches.
+func SetStandby(waiting bool) {
+	standby.Lock()
+	defer standby.Unlock()
+	standby.waiting = waiting
+}
+
 func healthzChecker() healthz.HealthzChecker {
 	return healthz.NamedCheck("healthz", func(r *http.Request) error {
+		standby.RLock()
+		waiting := standby.waiting
+		standby.RUnlock()
+		if waiting {
+			return nil
+		}
 		if time.Since(manager.LatestScrapeTime) > MaxEventsScrapeDelay {
 			msg := fmt.Sprintf(
 				"No event batch within %s (latest: %s)",
@@ -45,3 +67,33 @@ func healthzChecker() healthz.HealthzChecker {
 		return nil
 	})
 }
+
+// sinkHealth is the check of the sinks, set once they are running.
+var sinkHealth struct {
+	sync.RWMutex
+	check func() error
+}
+
+// SetSinkHealthCheck makes /healthz fail, and /healthz/sinks tell why, when
+// the check returns an error.
+func SetSinkHealthCheck(check func() error) {
+	sinkHealth.Lock()
+	defer sinkHealth.Unlock()
+	sinkHealth.check = check
+}
+
+func sinksChecker() healthz.HealthzChecker {
+	return healthz.NamedCheck("sinks", func(r *http.Request) error {
+		sinkHealth.RLock()
+		check := sinkHealth.check
+		sinkHealth.RUnlock()
+		if check == nil {
+			return nil
+		}
+		if err := check(); err != nil {
+			glog.Warning(err)
+			return err
+		}
+		return nil
+	})
+}
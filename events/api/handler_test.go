@@ -0,0 +1,144 @@
+// Copyright 2018 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/heapster/events/core"
+	"k8s.io/heapster/events/sinks"
+)
+
+var errFake = errors.New("connection refused")
+
+// flakySink fails its exports while err is set.
+type flakySink struct {
+	sync.Mutex
+	name    string
+	err     error
+	exports int
+}
+
+func (s *flakySink) Name() string { return s.name }
+func (s *flakySink) Stop()        {}
+
+func (s *flakySink) ExportEvents(batch *core.EventBatch) {
+	s.ExportEventsWithError(batch)
+}
+
+func (s *flakySink) ExportEventsWithError(*core.EventBatch) error {
+	s.Lock()
+	defer s.Unlock()
+	s.exports++
+	return s.err
+}
+
+func (s *flakySink) setErr(err error) {
+	s.Lock()
+	defer s.Unlock()
+	s.err = err
+}
+
+func (s *flakySink) exported() int {
+	s.Lock()
+	defer s.Unlock()
+	return s.exports
+}
+
+func healthzCode(path string) (int, string) {
+	recorder := httptest.NewRecorder()
+	http.DefaultServeMux.ServeHTTP(recorder, httptest.NewRequest("GET", path, nil))
+	return recorder.Code, recorder.Body.String()
+}
+
+// exportAndWait exports a batch and waits for the sinks to be done with it.
+func exportAndWait(t *testing.T, manager core.EventSink, flaky ...*flakySink) {
+	want := make([]int, len(flaky))
+	for i, sink := range flaky {
+		want[i] = sink.exported() + 1
+	}
+	manager.ExportEvents(&core.EventBatch{})
+	deadline := time.Now().Add(5 * time.Second)
+	for i, sink := range flaky {
+		for sink.exported() < want[i] {
+			if time.Now().After(deadline) {
+				t.Fatalf("%s didn't export in time", sink.name)
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+	// The status is recorded right after the export returns.
+	time.Sleep(20 * time.Millisecond)
+}
+
+func TestSinksHealthz(t *testing.T) {
+	first := &flakySink{name: "first"}
+	second := &flakySink{name: "second"}
+	manager, _ := sinks.NewEventSinkManager([]core.EventSink{first, second}, time.Second, time.Second, 0)
+	defer manager.Stop()
+	policy := sinks.HealthPolicy{MaxFailures: 3}
+	SetSinkHealthCheck(func() error {
+		return policy.Check(manager.(sinks.SinkStatusReporter).SinkStatuses(), time.Now())
+	})
+	defer SetSinkHealthCheck(nil)
+
+	code, _ := healthzCode("/healthz")
+	assert.Equal(t, http.StatusOK, code)
+
+	// A failure streak of one sink degrades the eventer, which stays healthy.
+	first.setErr(errFake)
+	for i := 0; i < 3; i++ {
+		exportAndWait(t, manager, first, second)
+	}
+	code, _ = healthzCode("/healthz")
+	assert.Equal(t, http.StatusOK, code)
+
+	// Once every sink fails, it is unhealthy.
+	second.setErr(errFake)
+	for i := 0; i < 2; i++ {
+		exportAndWait(t, manager, first, second)
+		code, _ = healthzCode("/healthz")
+		assert.Equal(t, http.StatusOK, code, "after %d failures of second", i+1)
+	}
+	exportAndWait(t, manager, first, second)
+	code, body := healthzCode("/healthz")
+	assert.Equal(t, http.StatusInternalServerError, code)
+	assert.Contains(t, body, "[-]sinks failed")
+	code, body = healthzCode("/healthz/sinks")
+	assert.Equal(t, http.StatusInternalServerError, code)
+	assert.Contains(t, body, "failing sinks: first, second")
+
+	// A single successful export recovers.
+	second.setErr(nil)
+	exportAndWait(t, manager, first, second)
+	code, _ = healthzCode("/healthz")
+	assert.Equal(t, http.StatusOK, code)
+
+	// In strict mode, the failing first sink is enough.
+	policy.Strict = true
+	code, body = healthzCode("/healthz/sinks")
+	assert.Equal(t, http.StatusInternalServerError, code)
+	assert.Contains(t, body, "failing sinks: first")
+	first.setErr(nil)
+	exportAndWait(t, manager, first, second)
+	code, _ = healthzCode("/healthz")
+	assert.Equal(t, http.StatusOK, code)
+}
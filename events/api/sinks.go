@@ -0,0 +1,47 @@
+// Copyright 2018 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/golang/glog"
+	"k8s.io/heapster/events/core"
+	"k8s.io/heapster/events/sinks"
+)
+
+// SinksPath is where the status of the sinks is served.
+const SinksPath = "/api/v1/sinks"
+
+type sinksResponse struct {
+	Sinks []sinks.SinkStatus `json:"sinks"`
+}
+
+// NewSinksHandler serves the status of the sinks of reporter as JSON, along
+// with the URIs uri returns for them. Statuses are recorded as exports
+// complete, so serving them never waits for a sink.
+func NewSinksHandler(reporter sinks.SinkStatusReporter, uri func(core.EventSink) string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		statuses := reporter.SinkStatuses()
+		for i := range statuses {
+			statuses[i].URI = uri(statuses[i].Sink())
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(sinksResponse{Sinks: statuses}); err != nil {
+			glog.Errorf("Failed to write sinks status: %v", err)
+		}
+	})
+}
@@ -0,0 +1,133 @@
+// Copyright 2018 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/heapster/events/core"
+	"k8s.io/heapster/events/sinks"
+	"k8s.io/heapster/events/util"
+)
+
+// failingSink fails every export.
+type failingSink struct{}
+
+func (failingSink) Name() string { return "failing" }
+func (failingSink) Stop()        {}
+
+func (failingSink) ExportEvents(*core.EventBatch) {}
+
+func (failingSink) ExportEventsWithError(*core.EventBatch) error {
+	return errors.New("connection refused")
+}
+
+type statusJSON struct {
+	Name                string     `json:"name"`
+	URI                 string     `json:"uri"`
+	LastExportTime      *time.Time `json:"lastExportTime"`
+	LastExportResult    string     `json:"lastExportResult"`
+	LastError           string     `json:"lastError"`
+	ConsecutiveFailures int        `json:"consecutiveFailures"`
+	ReportsErrors       bool       `json:"reportsErrors"`
+	QueueDepth          *int       `json:"queueDepth"`
+	QueueCapacity       int        `json:"queueCapacity"`
+}
+
+func getSinks(t *testing.T, handler http.Handler) []statusJSON {
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest("GET", SinksPath, nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "application/json", recorder.Header().Get("Content-Type"))
+	var response struct {
+		Sinks []statusJSON `json:"sinks"`
+	}
+	assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+	return response.Sinks
+}
+
+func TestSinksHandler(t *testing.T) {
+	ok := util.NewDummySink("ok", 0)
+	failing := failingSink{}
+	manager, _ := sinks.NewEventSinkManager([]core.EventSink{ok, failing}, time.Second, time.Second, 0)
+	defer manager.Stop()
+	uris := map[core.EventSink]string{
+		ok:      "memory:",
+		failing: "influxdb:http://influxdb:8086?pw=xxxxx",
+	}
+	handler := NewSinksHandler(manager.(sinks.SinkStatusReporter), func(sink core.EventSink) string { return uris[sink] })
+
+	// Nothing was exported yet.
+	statuses := getSinks(t, handler)
+	if assert.Len(t, statuses, 2) {
+		assert.Equal(t, statusJSON{Name: "ok", URI: "memory:"}, statuses[0])
+		assert.True(t, statuses[1].ReportsErrors)
+	}
+
+	start := time.Now()
+	manager.ExportEvents(&core.EventBatch{})
+	manager.ExportEvents(&core.EventBatch{})
+	// Exports complete after the batches were handed over.
+	deadline := time.Now().Add(5 * time.Second)
+	for statuses = getSinks(t, handler); statuses[1].ConsecutiveFailures < 2 || ok.GetExportCount() < 2; statuses = getSinks(t, handler) {
+		if time.Now().After(deadline) {
+			t.Fatal("exports didn't complete in time")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// The dummy sink doesn't report failures, so how its exports went is
+	// unknown.
+	assert.Equal(t, "ok", statuses[0].Name)
+	assert.Equal(t, sinks.ExportUnknown, statuses[0].LastExportResult)
+	assert.False(t, statuses[0].ReportsErrors)
+	assert.Equal(t, 0, statuses[0].ConsecutiveFailures)
+	assert.Empty(t, statuses[0].LastError)
+	if assert.NotNil(t, statuses[0].LastExportTime) {
+		assert.False(t, statuses[0].LastExportTime.Before(start.Truncate(time.Second)))
+	}
+
+	assert.Equal(t, "failing", statuses[1].Name)
+	assert.Equal(t, "influxdb:http://influxdb:8086?pw=xxxxx", statuses[1].URI)
+	assert.Equal(t, sinks.ExportFailed, statuses[1].LastExportResult)
+	assert.True(t, statuses[1].ReportsErrors)
+	assert.Equal(t, "connection refused", statuses[1].LastError)
+	assert.Equal(t, 2, statuses[1].ConsecutiveFailures)
+	assert.NotNil(t, statuses[1].LastExportTime)
+	// The manager doesn't queue batches.
+	assert.Nil(t, statuses[1].QueueDepth)
+}
+
+func TestSinksHandlerQueueDepth(t *testing.T) {
+	manager, _ := sinks.NewEventSinkManagerWithOptions([]core.EventSink{util.NewDummySink("queued", 0)}, sinks.SinkManagerOptions{
+		ExportTimeout: time.Second,
+		StopTimeout:   time.Second,
+		QueueDepth:    10,
+	})
+	defer manager.Stop()
+	handler := NewSinksHandler(manager.(sinks.SinkStatusReporter), func(core.EventSink) string { return "" })
+
+	statuses := getSinks(t, handler)
+	if assert.Len(t, statuses, 1) && assert.NotNil(t, statuses[0].QueueDepth) {
+		assert.Equal(t, 0, *statuses[0].QueueDepth)
+		assert.Equal(t, 10, statuses[0].QueueCapacity)
+	}
+}
@@ -0,0 +1,73 @@
+// Copyright 2018 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+)
+
+const (
+	// ClusterNameEnv is the environment variable the cluster name is read
+	// from when a sink isn't given one.
+	ClusterNameEnv = "CLUSTER_NAME"
+	// DefaultClusterNodeLabel is the node label the cluster name is read
+	// from with cluster_from_node.
+	DefaultClusterNodeLabel = "cluster"
+)
+
+// ErrNoClusterName is returned by ClusterName when no cluster name is set.
+var ErrNoClusterName = errors.New("you must provide cluster name, with the cluster option, the " + ClusterNameEnv + " environment variable or cluster_from_node")
+
+// NodeLabelFunc returns the value of a label of the node heapster runs on.
+type NodeLabelFunc func(label string) (string, error)
+
+// ClusterName resolves the cluster name of a sink: the cluster option, then
+// the CLUSTER_NAME environment variable, then, if cluster_from_node is set,
+// the cluster_node_label label of the node heapster runs on. It returns
+// ErrNoClusterName if none of them is set.
+func ClusterName(opts url.Values, nodeLabel NodeLabelFunc) (string, error) {
+	if cluster := opts.Get("cluster"); cluster != "" {
+		return cluster, nil
+	}
+	if cluster := os.Getenv(ClusterNameEnv); cluster != "" {
+		return cluster, nil
+	}
+
+	fromNode := false
+	if len(opts["cluster_from_node"]) >= 1 {
+		var err error
+		if fromNode, err = strconv.ParseBool(opts["cluster_from_node"][0]); err != nil {
+			return "", fmt.Errorf("cluster_from_node must be a boolean, got %q", opts["cluster_from_node"][0])
+		}
+	}
+	if fromNode {
+		label := DefaultClusterNodeLabel
+		if len(opts["cluster_node_label"]) >= 1 && opts["cluster_node_label"][0] != "" {
+			label = opts["cluster_node_label"][0]
+		}
+		cluster, err := nodeLabel(label)
+		if err != nil {
+			return "", fmt.Errorf("failed to read the cluster name from node label %s: %v", label, err)
+		}
+		if cluster != "" {
+			return cluster, nil
+		}
+	}
+	return "", ErrNoClusterName
+}
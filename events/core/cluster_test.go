@@ -0,0 +1,73 @@
+// Copyright 2018 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClusterName(t *testing.T) {
+	defer os.Setenv(ClusterNameEnv, os.Getenv(ClusterNameEnv))
+	var asked []string
+	nodeLabels := map[string]string{DefaultClusterNodeLabel: "from-node", "topology/cluster": "from-custom-label"}
+	nodeLabel := func(label string) (string, error) {
+		asked = append(asked, label)
+		return nodeLabels[label], nil
+	}
+
+	tests := []struct {
+		name     string
+		query    string
+		env      string
+		expected string
+	}{
+		{"option", "cluster=from-option", "from-env", "from-option"},
+		{"environment", "", "from-env", "from-env"},
+		{"environment before node", "cluster_from_node=true", "from-env", "from-env"},
+		{"node", "cluster_from_node=true", "", "from-node"},
+		{"custom node label", "cluster_from_node=true&cluster_node_label=topology/cluster", "", "from-custom-label"},
+		{"node not asked", "", "", ""},
+		{"node without label", "cluster_from_node=true&cluster_node_label=missing", "", ""},
+		{"node disabled", "cluster_from_node=false", "", ""},
+	}
+	for _, test := range tests {
+		os.Setenv(ClusterNameEnv, test.env)
+		opts, err := url.ParseQuery(test.query)
+		assert.NoError(t, err)
+
+		cluster, err := ClusterName(opts, nodeLabel)
+		if test.expected == "" {
+			assert.Equal(t, ErrNoClusterName, err, test.name)
+			continue
+		}
+		assert.NoError(t, err, test.name)
+		assert.Equal(t, test.expected, cluster, test.name)
+	}
+	assert.Equal(t, []string{DefaultClusterNodeLabel, "topology/cluster", "missing"}, asked)
+
+	os.Setenv(ClusterNameEnv, "")
+	failing := func(string) (string, error) { return "", fmt.Errorf("not in a cluster") }
+	_, err := ClusterName(url.Values{"cluster_from_node": {"true"}}, failing)
+	assert.Error(t, err)
+	assert.NotEqual(t, ErrNoClusterName, err)
+	_, err = ClusterName(url.Values{"cluster_from_node": {"maybe"}}, nodeLabel)
+	assert.Error(t, err)
+	assert.NotEqual(t, ErrNoClusterName, err)
+}
@@ -0,0 +1,104 @@
+// Copyright 2018 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import (
+	"fmt"
+	"hash/fnv"
+	"regexp"
+	"strings"
+
+	kube_api "k8s.io/api/core/v1"
+)
+
+const identityFieldDelimiter = "\x1f"
+
+// identityFieldOrder is the canonical order in which identity fields are
+// hashed, so the identity doesn't depend on the order fields are given in.
+var identityFieldOrder = []string{"type", "kind", "namespace", "name", "reason", "message"}
+
+var identityFields = map[string]func(*kube_api.Event) string{
+	"type":      func(e *kube_api.Event) string { return e.Type },
+	"kind":      func(e *kube_api.Event) string { return e.InvolvedObject.Kind },
+	"namespace": func(e *kube_api.Event) string { return e.Namespace },
+	"name":      func(e *kube_api.Event) string { return e.InvolvedObject.Name },
+	"reason":    func(e *kube_api.Event) string { return e.Reason },
+	"message":   func(e *kube_api.Event) string { return NormalizeMessage(e.Message) },
+}
+
+// DefaultIdentityFields are the fields events used to be deduplicated on,
+// the message included. Variations in the message text are normalized away,
+// a list without message, like type,namespace,name,reason, ignores it.
+var DefaultIdentityFields = []string{"type", "namespace", "name", "reason", "message"}
+
+var (
+	uuidRE   = regexp.MustCompile(`[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}`)
+	ipRE     = regexp.MustCompile(`\b\d{1,3}(\.\d{1,3}){3}(:\d+)?\b`)
+	numberRE = regexp.MustCompile(`\d+`)
+)
+
+// NormalizeMessage replaces the UUIDs, IP addresses and numbers in an event
+// message, which vary between otherwise identical events, with placeholders.
+// The message is normalized this way whenever it is an identity field.
+func NormalizeMessage(message string) string {
+	message = uuidRE.ReplaceAllString(message, "<uuid>")
+	message = ipRE.ReplaceAllString(message, "<ip>")
+	return numberRE.ReplaceAllString(message, "<n>")
+}
+
+// ParseIdentityFields validates a comma-separated list of identity fields and
+// returns them in canonical order.
+func ParseIdentityFields(value string) ([]string, error) {
+	selected := make(map[string]bool)
+	for _, field := range strings.Split(value, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		if _, ok := identityFields[field]; !ok {
+			return nil, fmt.Errorf("unknown event identity field %q", field)
+		}
+		selected[field] = true
+	}
+	if len(selected) == 0 {
+		return nil, fmt.Errorf("at least one event identity field is required")
+	}
+
+	fields := make([]string, 0, len(selected))
+	for _, field := range identityFieldOrder {
+		if selected[field] {
+			fields = append(fields, field)
+		}
+	}
+	return fields, nil
+}
+
+// IdentityHash hashes the given identity fields of the event. Every field is
+// written with its name and a delimiter, so values can't run into each other.
+func IdentityHash(fields []string, event *kube_api.Event) uint64 {
+	h := fnv.New64a()
+	for _, field := range fields {
+		h.Write([]byte(field))
+		h.Write([]byte("="))
+		h.Write([]byte(identityFields[field](event)))
+		h.Write([]byte(identityFieldDelimiter))
+	}
+	return h.Sum64()
+}
+
+// IdentityKey is the hex encoded IdentityHash, suitable as a cache key.
+func IdentityKey(fields []string, event *kube_api.Event) string {
+	return fmt.Sprintf("%016x", IdentityHash(fields, event))
+}
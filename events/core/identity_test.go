@@ -0,0 +1,59 @@
+// Copyright 2018 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	kube_api "k8s.io/api/core/v1"
+)
+
+func TestIdentityKey(t *testing.T) {
+	event := func(name, reason, message string) *kube_api.Event {
+		return &kube_api.Event{
+			Reason:         reason,
+			Message:        message,
+			InvolvedObject: kube_api.ObjectReference{Kind: "Pod", Namespace: "default", Name: name},
+		}
+	}
+
+	assert.Equal(t,
+		IdentityKey(DefaultIdentityFields, event("web-0", "BackOff", "attempt 1")),
+		IdentityKey(DefaultIdentityFields, event("web-0", "BackOff", "attempt 2")))
+	assert.NotEqual(t,
+		IdentityKey([]string{"name", "reason"}, event("ab", "c", "")),
+		IdentityKey([]string{"name", "reason"}, event("a", "bc", "")))
+	assert.Len(t, IdentityKey(DefaultIdentityFields, event("web-0", "BackOff", "")), 16)
+	assert.NotEqual(t,
+		IdentityKey(DefaultIdentityFields, event("web-0", "BackOff", "pulling image")),
+		IdentityKey(DefaultIdentityFields, event("web-0", "BackOff", "restarting container")))
+}
+
+func TestNormalizeMessage(t *testing.T) {
+	assert.Equal(t, "volume <uuid> failed on <ip> after <n>s",
+		NormalizeMessage("volume 3f2b8c1e-9a4d-4e6f-8b2a-1c5d7e9f0a3b failed on 192.168.1.20:8080 after 30s"))
+}
+
+func TestParseIdentityFields(t *testing.T) {
+	fields, err := ParseIdentityFields("message,type")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"type", "message"}, fields)
+
+	_, err = ParseIdentityFields("type,uid")
+	assert.Error(t, err)
+	_, err = ParseIdentityFields("")
+	assert.Error(t, err)
+}
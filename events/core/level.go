@@ -0,0 +1,88 @@
+// Copyright 2018 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import (
+	"fmt"
+
+	kube_api "k8s.io/api/core/v1"
+)
+
+// Event levels, ordered by severity. Events of unknown type have level 0.
+const (
+	LevelNormal  int = 1
+	LevelWarning int = 2
+)
+
+// EventLevel scores the event type, the higher the more severe.
+func EventLevel(eventType string) int {
+	score := 0
+	switch eventType {
+	case kube_api.EventTypeWarning:
+		score += 2
+	case kube_api.EventTypeNormal:
+		score += 1
+	default:
+		//score will remain 0
+	}
+	return score
+}
+
+// ParseLevel is like EventLevel, but rejects unknown levels.
+func ParseLevel(level string) (int, error) {
+	score := EventLevel(level)
+	if score == 0 {
+		return 0, fmt.Errorf("unknown event level %q, must be %s or %s", level, kube_api.EventTypeNormal, kube_api.EventTypeWarning)
+	}
+	return score, nil
+}
+
+// IsLevelAtLeast tells whether the event type is at least as severe as the
+// given level.
+func IsLevelAtLeast(eventType string, level int) bool {
+	return EventLevel(eventType) >= level
+}
+
+// Level modes, selecting how event levels are compared to the configured one.
+const (
+	LevelModeAtLeast = "atleast"
+	LevelModeExact   = "exact"
+	LevelModeAtMost  = "atmost"
+)
+
+// ParseLevelMode validates a level mode.
+func ParseLevelMode(mode string) (string, error) {
+	switch mode {
+	case LevelModeAtLeast, LevelModeExact, LevelModeAtMost:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("level_mode must be %s, %s or %s, got %q", LevelModeAtLeast, LevelModeExact, LevelModeAtMost, mode)
+	}
+}
+
+// IsLevelMatching compares the level of the event type to the given level
+// according to mode. Events of unknown type only match in atleast mode with
+// a level of 0.
+func IsLevelMatching(eventType string, level int, mode string) bool {
+	score := EventLevel(eventType)
+	switch mode {
+	case LevelModeExact:
+		return score > 0 && score == level
+	case LevelModeAtMost:
+		return score > 0 && score <= level
+	default:
+		return score >= level
+	}
+}
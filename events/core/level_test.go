@@ -0,0 +1,57 @@
+// Copyright 2018 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	kube_api "k8s.io/api/core/v1"
+)
+
+func TestLevels(t *testing.T) {
+	assert.Equal(t, LevelWarning, EventLevel(kube_api.EventTypeWarning))
+	assert.Equal(t, LevelNormal, EventLevel(kube_api.EventTypeNormal))
+	assert.Equal(t, 0, EventLevel(""))
+
+	assert.True(t, IsLevelAtLeast(kube_api.EventTypeWarning, LevelNormal))
+	assert.False(t, IsLevelAtLeast(kube_api.EventTypeNormal, LevelWarning))
+
+	_, err := ParseLevel("Error")
+	assert.Error(t, err)
+}
+
+func TestLevelModes(t *testing.T) {
+	types := []string{kube_api.EventTypeWarning, kube_api.EventTypeNormal, ""}
+	matching := func(level int, mode string) []string {
+		var matched []string
+		for _, eventType := range types {
+			if IsLevelMatching(eventType, level, mode) {
+				matched = append(matched, eventType)
+			}
+		}
+		return matched
+	}
+
+	assert.Equal(t, []string{kube_api.EventTypeWarning, kube_api.EventTypeNormal}, matching(LevelNormal, LevelModeAtLeast))
+	assert.Equal(t, []string{kube_api.EventTypeWarning}, matching(LevelWarning, LevelModeAtLeast))
+	assert.Equal(t, []string{kube_api.EventTypeNormal}, matching(LevelNormal, LevelModeExact))
+	assert.Equal(t, []string{kube_api.EventTypeWarning}, matching(LevelWarning, LevelModeExact))
+	assert.Equal(t, []string{kube_api.EventTypeNormal}, matching(LevelNormal, LevelModeAtMost))
+	assert.Equal(t, []string{kube_api.EventTypeWarning, kube_api.EventTypeNormal}, matching(LevelWarning, LevelModeAtMost))
+
+	_, err := ParseLevelMode("below")
+	assert.Error(t, err)
+}
@@ -15,6 +15,7 @@
 package core
 
 import (
+	"context"
 	"time"
 
 	kube_api "k8s.io/api/core/v1"
@@ -44,3 +45,85 @@ type EventSink interface {
 	// Stops the sink at earliest convenience.
 	Stop()
 }
+
+// EventSinkWithError may be implemented by sinks that are able to report
+// whether an export failed. ExportEvents of such sinks usually just logs the
+// error returned by ExportEventsWithError.
+type EventSinkWithError interface {
+	EventSink
+	ExportEventsWithError(*EventBatch) error
+}
+
+// ExportEvents exports the batch to the sink and returns the export error if
+// the sink reports one.
+func ExportEvents(sink EventSink, batch *EventBatch) error {
+	if s, ok := sink.(EventSinkWithError); ok {
+		return s.ExportEventsWithError(batch)
+	}
+	sink.ExportEvents(batch)
+	return nil
+}
+
+// EventSinkWithContext may be implemented by sinks whose export can be
+// cancelled, e.g. to abort in-flight requests on shutdown.
+type EventSinkWithContext interface {
+	EventSink
+	ExportEventsContext(context.Context, *EventBatch) error
+}
+
+// ExportEventsContext exports the batch to the sink, cancelling the export
+// when ctx is done if the sink supports it. Other sinks are exported to as
+// usual unless ctx is already done.
+func ExportEventsContext(ctx context.Context, sink EventSink, batch *EventBatch) error {
+	if s, ok := sink.(EventSinkWithContext); ok {
+		return s.ExportEventsContext(ctx, batch)
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return ExportEvents(sink, batch)
+}
+
+// EventSinkWrapper is implemented by sinks passing batches on to other sinks,
+// so that the capabilities of the sinks they wrap can be checked.
+type EventSinkWrapper interface {
+	WrappedSinks() []EventSink
+}
+
+// ReportsErrors tells whether failed exports to the sink are reported: the
+// sink implements EventSinkWithError and so do all the sinks it wraps.
+func ReportsErrors(sink EventSink) bool {
+	if _, ok := sink.(EventSinkWithError); !ok {
+		return false
+	}
+	if wrapper, ok := sink.(EventSinkWrapper); ok {
+		for _, wrapped := range wrapper.WrappedSinks() {
+			if !ReportsErrors(wrapped) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// SupportsContext tells whether exports to the sink can be cancelled: the sink
+// implements EventSinkWithContext and so do all the sinks it wraps.
+func SupportsContext(sink EventSink) bool {
+	if _, ok := sink.(EventSinkWithContext); !ok {
+		return false
+	}
+	if wrapper, ok := sink.(EventSinkWrapper); ok {
+		for _, wrapped := range wrapper.WrappedSinks() {
+			if !SupportsContext(wrapped) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// EventSinkHealthChecker may be implemented by sinks that can cheaply check
+// whether the storage they export to is reachable.
+type EventSinkHealthChecker interface {
+	HealthCheck() error
+}
@@ -0,0 +1,58 @@
+// Copyright 2018 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type plainSink struct{}
+
+func (plainSink) Name() string             { return "plain" }
+func (plainSink) ExportEvents(*EventBatch) {}
+func (plainSink) Stop()                    {}
+
+type reportingSink struct {
+	plainSink
+}
+
+func (reportingSink) ExportEventsWithError(*EventBatch) error { return nil }
+
+func (reportingSink) ExportEventsContext(context.Context, *EventBatch) error { return nil }
+
+type wrapperSink struct {
+	reportingSink
+	sinks []EventSink
+}
+
+func (w wrapperSink) WrappedSinks() []EventSink { return w.sinks }
+
+func TestReportsErrors(t *testing.T) {
+	assert.False(t, ReportsErrors(plainSink{}))
+	assert.True(t, ReportsErrors(reportingSink{}))
+	assert.True(t, ReportsErrors(wrapperSink{sinks: []EventSink{reportingSink{}}}))
+	assert.False(t, ReportsErrors(wrapperSink{sinks: []EventSink{reportingSink{}, plainSink{}}}))
+	assert.False(t, ReportsErrors(wrapperSink{sinks: []EventSink{wrapperSink{sinks: []EventSink{plainSink{}}}}}))
+}
+
+func TestSupportsContext(t *testing.T) {
+	assert.False(t, SupportsContext(plainSink{}))
+	assert.True(t, SupportsContext(reportingSink{}))
+	assert.True(t, SupportsContext(wrapperSink{sinks: []EventSink{reportingSink{}}}))
+	assert.False(t, SupportsContext(wrapperSink{sinks: []EventSink{reportingSink{}, plainSink{}}}))
+}
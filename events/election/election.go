@@ -0,0 +1,154 @@
+// Copyright 2018 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package election elects the eventer replica exporting the events, so that
+// replicas run for availability don't export every event several times.
+package election
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/golang/glog"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/uuid"
+	kubeclient "k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+	"k8s.io/client-go/tools/record"
+)
+
+const (
+	DefaultNamespace     = "kube-system"
+	DefaultName          = "eventer"
+	DefaultLockType      = LeasesResourceLock
+	DefaultLeaseDuration = 15 * time.Second
+	DefaultRenewDeadline = 10 * time.Second
+	DefaultRetryPeriod   = 2 * time.Second
+)
+
+// Config configures the leader election.
+type Config struct {
+	// LockType is the kind of object holding the lock, leases, configmaps
+	// or endpoints.
+	LockType  string
+	Namespace string
+	Name      string
+	// LeaseDuration is how long standby replicas wait before taking over
+	// the lock of a leader that stopped renewing it.
+	LeaseDuration time.Duration
+	// RenewDeadline is how long the leader retries renewing the lock before
+	// giving up the leadership.
+	RenewDeadline time.Duration
+	// RetryPeriod is the time between attempts to acquire or renew the lock.
+	RetryPeriod time.Duration
+}
+
+// Validate checks the lock type and that the durations let the leader renew
+// its lock before standby replicas take it over.
+func (c Config) Validate() error {
+	switch c.LockType {
+	case LeasesResourceLock, resourcelock.ConfigMapsResourceLock, resourcelock.EndpointsResourceLock:
+	default:
+		return fmt.Errorf("leader election lock must be %s, %s or %s, got %q", LeasesResourceLock, resourcelock.ConfigMapsResourceLock, resourcelock.EndpointsResourceLock, c.LockType)
+	}
+	if c.RetryPeriod <= 0 {
+		return fmt.Errorf("leader election retry period must be positive, got %v", c.RetryPeriod)
+	}
+	if c.LeaseDuration <= c.RenewDeadline {
+		return fmt.Errorf("leader election lease duration must be greater than the renew deadline, got %v and %v", c.LeaseDuration, c.RenewDeadline)
+	}
+	if c.RenewDeadline <= time.Duration(leaderelection.JitterFactor*float64(c.RetryPeriod)) {
+		return fmt.Errorf("leader election renew deadline must be greater than %v times the retry period, got %v and %v", leaderelection.JitterFactor, c.RenewDeadline, c.RetryPeriod)
+	}
+	return nil
+}
+
+// NewLock returns the lock of the config, identifying this replica by its
+// hostname. Leadership changes are logged rather than recorded as events of
+// the lock object, which the eventer would export itself.
+func NewLock(client kubeclient.Interface, config Config) (resourcelock.Interface, error) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get hostname: %v", err)
+	}
+	lockConfig := resourcelock.ResourceLockConfig{
+		Identity:      hostname + "_" + string(uuid.NewUUID()),
+		EventRecorder: logRecorder{},
+	}
+	if config.LockType == LeasesResourceLock {
+		return &LeaseLock{
+			LeaseMeta:  metav1.ObjectMeta{Namespace: config.Namespace, Name: config.Name},
+			Client:     client.CoreV1().RESTClient(),
+			LockConfig: lockConfig,
+		}, nil
+	}
+	return resourcelock.New(config.LockType, config.Namespace, config.Name, client.CoreV1(), lockConfig)
+}
+
+// logRecorder logs the events of the lock instead of recording them.
+type logRecorder struct{}
+
+var _ record.EventRecorder = logRecorder{}
+
+func (logRecorder) Event(object runtime.Object, eventType, reason, message string) {
+	glog.V(2).Infof("%s: %s", reason, message)
+}
+
+func (r logRecorder) Eventf(object runtime.Object, eventType, reason, messageFmt string, args ...interface{}) {
+	r.Event(object, eventType, reason, fmt.Sprintf(messageFmt, args...))
+}
+
+func (r logRecorder) PastEventf(object runtime.Object, timestamp metav1.Time, eventType, reason, messageFmt string, args ...interface{}) {
+	r.Event(object, eventType, reason, fmt.Sprintf(messageFmt, args...))
+}
+
+// WaitForLeadership blocks until this replica holds the lock and returns a
+// context cancelled as soon as it lost the leadership, having failed to
+// renew the lock within the renew deadline. A replica never leads again once
+// it lost the leadership.
+func WaitForLeadership(lock resourcelock.Interface, config Config) (context.Context, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	leading := make(chan struct{})
+	elector, err := leaderelection.NewLeaderElector(leaderelection.LeaderElectionConfig{
+		Lock:          lock,
+		LeaseDuration: config.LeaseDuration,
+		RenewDeadline: config.RenewDeadline,
+		RetryPeriod:   config.RetryPeriod,
+		Callbacks: leaderelection.LeaderCallbacks{
+			OnStartedLeading: func(stop <-chan struct{}) {
+				glog.Infof("Elected leader with %s lock %s", config.LockType, lock.Describe())
+				close(leading)
+			},
+			OnStoppedLeading: func() {
+				glog.Warningf("Lost the leadership of lock %s", lock.Describe())
+				cancel()
+			},
+			OnNewLeader: func(identity string) {
+				glog.Infof("Leader of lock %s is %s", lock.Describe(), identity)
+			},
+		},
+	})
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	glog.Infof("Waiting to be elected leader as %s", lock.Identity())
+	go elector.Run()
+	<-leading
+	return ctx, nil
+}
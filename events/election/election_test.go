@@ -0,0 +1,195 @@
+// Copyright 2018 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package election
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	kube_api "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	kubeclient "k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+	"k8s.io/heapster/events/core"
+	"k8s.io/heapster/events/manager"
+	"k8s.io/heapster/events/util"
+)
+
+// lockStore holds the leader election record shared by the fake locks of
+// the replicas.
+type lockStore struct {
+	sync.Mutex
+	record *resourcelock.LeaderElectionRecord
+}
+
+// fakeLock is the lock of a replica, which can be cut off from the store.
+type fakeLock struct {
+	store    *lockStore
+	identity string
+	sync.Mutex
+	partitioned bool
+}
+
+var errPartitioned = errors.New("connection refused")
+
+func (l *fakeLock) reachable() bool {
+	l.Lock()
+	defer l.Unlock()
+	return !l.partitioned
+}
+
+func (l *fakeLock) partition() {
+	l.Lock()
+	defer l.Unlock()
+	l.partitioned = true
+}
+
+func (l *fakeLock) Get() (*resourcelock.LeaderElectionRecord, error) {
+	if !l.reachable() {
+		return nil, errPartitioned
+	}
+	l.store.Lock()
+	defer l.store.Unlock()
+	if l.store.record == nil {
+		return nil, apierrors.NewNotFound(schema.GroupResource{Resource: "configmaps"}, DefaultName)
+	}
+	record := *l.store.record
+	return &record, nil
+}
+
+func (l *fakeLock) Create(record resourcelock.LeaderElectionRecord) error {
+	return l.Update(record)
+}
+
+func (l *fakeLock) Update(record resourcelock.LeaderElectionRecord) error {
+	if !l.reachable() {
+		return errPartitioned
+	}
+	l.store.Lock()
+	defer l.store.Unlock()
+	l.store.record = &record
+	return nil
+}
+
+func (l *fakeLock) RecordEvent(string) {}
+func (l *fakeLock) Identity() string   { return l.identity }
+func (l *fakeLock) Describe() string   { return "test/" + DefaultName }
+
+var testConfig = Config{
+	LockType:      DefaultLockType,
+	Namespace:     "test",
+	Name:          DefaultName,
+	LeaseDuration: 600 * time.Millisecond,
+	RenewDeadline: 300 * time.Millisecond,
+	RetryPeriod:   50 * time.Millisecond,
+}
+
+// startPipeline exports to a new sink every 100ms until ctx is cancelled.
+func startPipeline(ctx context.Context) (manager.Manager, *util.DummySink) {
+	batch := &core.EventBatch{Timestamp: time.Now(), Events: []*kube_api.Event{}}
+	sink := util.NewDummySink("sink", time.Millisecond)
+	pipeline, _ := manager.NewManagerWithContext(ctx, util.NewDummySource(batch), sink, 100*time.Millisecond)
+	pipeline.Start()
+	return pipeline, sink
+}
+
+func TestExportOnlyWhileLeading(t *testing.T) {
+	store := &lockStore{}
+	first := &fakeLock{store: store, identity: "first"}
+	second := &fakeLock{store: store, identity: "second"}
+
+	firstCtx, err := WaitForLeadership(first, testConfig)
+	assert.NoError(t, err)
+	firstPipeline, firstSink := startPipeline(firstCtx)
+
+	elected := make(chan context.Context, 1)
+	go func() {
+		ctx, err := WaitForLeadership(second, testConfig)
+		assert.NoError(t, err)
+		elected <- ctx
+	}()
+
+	// The second replica stands by while the first one renews the lock.
+	select {
+	case <-elected:
+		t.Fatal("Second replica elected while the first one leads")
+	case <-time.After(time.Second):
+	}
+	assert.True(t, firstSink.GetExportCount() > 0)
+
+	// Cut off from the store, the first replica stops exporting within the
+	// renew deadline, and the second one takes over after the lease duration.
+	first.partition()
+	select {
+	case <-firstCtx.Done():
+	case <-time.After(time.Second):
+		t.Fatal("First replica still leading")
+	}
+	firstPipeline.Stop()
+	stoppedCount := firstSink.GetExportCount()
+	assert.True(t, firstSink.IsStopped())
+
+	var secondCtx context.Context
+	select {
+	case secondCtx = <-elected:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Second replica wasn't elected")
+	}
+	secondPipeline, secondSink := startPipeline(secondCtx)
+	time.Sleep(500 * time.Millisecond)
+	secondPipeline.Stop()
+
+	assert.True(t, secondSink.GetExportCount() > 0)
+	assert.Equal(t, stoppedCount, firstSink.GetExportCount())
+	assert.Nil(t, secondCtx.Err())
+}
+
+func TestLockEventsAreNotRecorded(t *testing.T) {
+	// Events recorded in the lock namespace would be exported by the
+	// eventer itself.
+	lock, err := NewLock(&kubeclient.Clientset{}, testConfig)
+	assert.NoError(t, err)
+	if assert.IsType(t, &LeaseLock{}, lock) {
+		assert.Equal(t, logRecorder{}, lock.(*LeaseLock).LockConfig.EventRecorder)
+	}
+
+	config := testConfig
+	config.LockType = resourcelock.ConfigMapsResourceLock
+	lock, err = NewLock(&kubeclient.Clientset{}, config)
+	assert.NoError(t, err)
+	if assert.IsType(t, &resourcelock.ConfigMapLock{}, lock) {
+		assert.Equal(t, logRecorder{}, lock.(*resourcelock.ConfigMapLock).LockConfig.EventRecorder)
+	}
+}
+
+func TestValidateConfig(t *testing.T) {
+	assert.NoError(t, testConfig.Validate())
+
+	for _, invalid := range []func(*Config){
+		func(c *Config) { c.LockType = "secrets" },
+		func(c *Config) { c.LeaseDuration = c.RenewDeadline },
+		func(c *Config) { c.RetryPeriod = c.RenewDeadline },
+		func(c *Config) { c.RetryPeriod = 0 },
+	} {
+		config := testConfig
+		invalid(&config)
+		assert.Error(t, config.Validate())
+	}
+}
@@ -0,0 +1,188 @@
+// Copyright 2018 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package election
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	kube_api "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+)
+
+// LeasesResourceLock is the type of the locks held by a Lease.
+const LeasesResourceLock = "leases"
+
+// leasesAPIPath is the API path of the coordination.k8s.io/v1 Leases.
+const leasesAPIPath = "/apis/coordination.k8s.io/v1"
+
+// lease is a coordination.k8s.io/v1 Lease, missing from the vendored API.
+type lease struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+	Spec              leaseSpec `json:"spec,omitempty"`
+}
+
+type leaseSpec struct {
+	HolderIdentity       *string           `json:"holderIdentity,omitempty"`
+	LeaseDurationSeconds *int32            `json:"leaseDurationSeconds,omitempty"`
+	AcquireTime          *metav1.MicroTime `json:"acquireTime,omitempty"`
+	RenewTime            *metav1.MicroTime `json:"renewTime,omitempty"`
+	LeaseTransitions     *int32            `json:"leaseTransitions,omitempty"`
+}
+
+func (l *lease) DeepCopyObject() runtime.Object {
+	out := &lease{TypeMeta: l.TypeMeta}
+	l.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	// The spec is rebuilt from records, never modified in place.
+	out.Spec = l.Spec
+	return out
+}
+
+// LeaseLock is a lock held by a Lease, like the LeaseLock of later client-go
+// versions. Leases are read and written as JSON through the REST client of
+// the core API, whatever its content type, as they aren't registered with
+// the vendored client scheme.
+type LeaseLock struct {
+	// LeaseMeta holds the name and namespace of the Lease.
+	LeaseMeta  metav1.ObjectMeta
+	Client     rest.Interface
+	LockConfig resourcelock.ResourceLockConfig
+	lease      *lease
+}
+
+var _ resourcelock.Interface = &LeaseLock{}
+
+// Get returns the election record of the Lease.
+func (ll *LeaseLock) Get() (*resourcelock.LeaderElectionRecord, error) {
+	out := &lease{}
+	if err := ll.do(ll.Client.Get().AbsPath(leasesAPIPath, "namespaces", ll.LeaseMeta.Namespace, "leases", ll.LeaseMeta.Name), nil, out); err != nil {
+		return nil, err
+	}
+	ll.lease = out
+	return leaseSpecToRecord(&out.Spec), nil
+}
+
+// Create creates the Lease with the election record.
+func (ll *LeaseLock) Create(ler resourcelock.LeaderElectionRecord) error {
+	in := &lease{
+		TypeMeta: metav1.TypeMeta{APIVersion: "coordination.k8s.io/v1", Kind: "Lease"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      ll.LeaseMeta.Name,
+			Namespace: ll.LeaseMeta.Namespace,
+		},
+		Spec: recordToLeaseSpec(&ler),
+	}
+	out := &lease{}
+	if err := ll.do(ll.Client.Post().AbsPath(leasesAPIPath, "namespaces", ll.LeaseMeta.Namespace, "leases"), in, out); err != nil {
+		return err
+	}
+	ll.lease = out
+	return nil
+}
+
+// Update updates the Lease with the election record.
+func (ll *LeaseLock) Update(ler resourcelock.LeaderElectionRecord) error {
+	if ll.lease == nil {
+		return errors.New("lease not initialized, call get or create first")
+	}
+	in := ll.lease.DeepCopyObject().(*lease)
+	in.Spec = recordToLeaseSpec(&ler)
+	out := &lease{}
+	if err := ll.do(ll.Client.Put().AbsPath(leasesAPIPath, "namespaces", ll.LeaseMeta.Namespace, "leases", ll.LeaseMeta.Name), in, out); err != nil {
+		return err
+	}
+	ll.lease = out
+	return nil
+}
+
+// do sends the request with the lease in, if any, and decodes the returned
+// lease into out.
+func (ll *LeaseLock) do(req *rest.Request, in, out *lease) error {
+	if in != nil {
+		body, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		req = req.SetHeader("Content-Type", "application/json").Body(body)
+	}
+	data, err := req.SetHeader("Accept", "application/json").Do().Raw()
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, out)
+}
+
+// RecordEvent records an event of the Lease.
+func (ll *LeaseLock) RecordEvent(s string) {
+	if ll.LockConfig.EventRecorder == nil {
+		return
+	}
+	events := fmt.Sprintf("%v %v", ll.LockConfig.Identity, s)
+	object := &lease{ObjectMeta: ll.LeaseMeta}
+	if ll.lease != nil {
+		object.ObjectMeta = ll.lease.ObjectMeta
+	}
+	ll.LockConfig.EventRecorder.Event(object, kube_api.EventTypeNormal, "LeaderElection", events)
+}
+
+// Describe returns the namespace and name of the Lease.
+func (ll *LeaseLock) Describe() string {
+	return fmt.Sprintf("%v/%v", ll.LeaseMeta.Namespace, ll.LeaseMeta.Name)
+}
+
+// Identity returns the identity of this replica.
+func (ll *LeaseLock) Identity() string {
+	return ll.LockConfig.Identity
+}
+
+func leaseSpecToRecord(spec *leaseSpec) *resourcelock.LeaderElectionRecord {
+	record := &resourcelock.LeaderElectionRecord{}
+	if spec.HolderIdentity != nil {
+		record.HolderIdentity = *spec.HolderIdentity
+	}
+	if spec.LeaseDurationSeconds != nil {
+		record.LeaseDurationSeconds = int(*spec.LeaseDurationSeconds)
+	}
+	if spec.LeaseTransitions != nil {
+		record.LeaderTransitions = int(*spec.LeaseTransitions)
+	}
+	if spec.AcquireTime != nil {
+		record.AcquireTime = metav1.NewTime(spec.AcquireTime.Time)
+	}
+	if spec.RenewTime != nil {
+		record.RenewTime = metav1.NewTime(spec.RenewTime.Time)
+	}
+	return record
+}
+
+func recordToLeaseSpec(ler *resourcelock.LeaderElectionRecord) leaseSpec {
+	holderIdentity := ler.HolderIdentity
+	leaseDurationSeconds := int32(ler.LeaseDurationSeconds)
+	leaseTransitions := int32(ler.LeaderTransitions)
+	acquireTime := metav1.NewMicroTime(ler.AcquireTime.Time)
+	renewTime := metav1.NewMicroTime(ler.RenewTime.Time)
+	return leaseSpec{
+		HolderIdentity:       &holderIdentity,
+		LeaseDurationSeconds: &leaseDurationSeconds,
+		AcquireTime:          &acquireTime,
+		RenewTime:            &renewTime,
+		LeaseTransitions:     &leaseTransitions,
+	}
+}
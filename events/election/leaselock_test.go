@@ -0,0 +1,111 @@
+// Copyright 2018 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package election
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kubeclient "k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+// leaseServer serves the Lease of testConfig.
+type leaseServer struct {
+	sync.Mutex
+	lease        *lease
+	contentTypes []string
+}
+
+func (s *leaseServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.Lock()
+	defer s.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	const leases = leasesAPIPath + "/namespaces/test/leases"
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == leases+"/"+DefaultName:
+		if s.lease == nil {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(metav1.Status{
+				TypeMeta: metav1.TypeMeta{Kind: "Status", APIVersion: "v1"},
+				Status:   metav1.StatusFailure,
+				Reason:   metav1.StatusReasonNotFound,
+				Code:     http.StatusNotFound,
+			})
+			return
+		}
+	case r.Method == http.MethodPost && r.URL.Path == leases,
+		r.Method == http.MethodPut && r.URL.Path == leases+"/"+DefaultName:
+		s.contentTypes = append(s.contentTypes, r.Header.Get("Content-Type"))
+		in := &lease{}
+		if err := json.NewDecoder(r.Body).Decode(in); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		s.lease = in
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	json.NewEncoder(w).Encode(s.lease)
+}
+
+func (s *leaseServer) holder() string {
+	s.Lock()
+	defer s.Unlock()
+	if s.lease == nil || s.lease.Spec.HolderIdentity == nil {
+		return ""
+	}
+	return *s.lease.Spec.HolderIdentity
+}
+
+func TestLeaseLock(t *testing.T) {
+	server := &leaseServer{}
+	httpServer := httptest.NewServer(server)
+	defer httpServer.Close()
+
+	// Leases are sent as JSON even if the client prefers protobuf.
+	client, err := kubeclient.NewForConfig(&rest.Config{
+		Host:          httpServer.URL,
+		ContentConfig: rest.ContentConfig{ContentType: "application/vnd.kubernetes.protobuf"},
+	})
+	assert.NoError(t, err)
+	config := testConfig
+	config.LockType = LeasesResourceLock
+	lock, err := NewLock(client, config)
+	assert.NoError(t, err)
+	assert.Equal(t, "test/"+DefaultName, lock.Describe())
+
+	_, err = WaitForLeadership(lock, config)
+	assert.NoError(t, err)
+	assert.Equal(t, lock.Identity(), server.holder())
+	record, err := lock.Get()
+	assert.NoError(t, err)
+	assert.Equal(t, lock.Identity(), record.HolderIdentity)
+	assert.Equal(t, int(config.LeaseDuration.Seconds()), record.LeaseDurationSeconds)
+	assert.False(t, record.RenewTime.IsZero())
+
+	server.Lock()
+	defer server.Unlock()
+	assert.NotEmpty(t, server.contentTypes)
+	for _, contentType := range server.contentTypes {
+		assert.Equal(t, "application/json", contentType)
+	}
+}
@@ -0,0 +1,202 @@
+// Copyright 2018 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package enrich
+
+import (
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	kube_api "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/informers"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/heapster/events/core"
+)
+
+const (
+	DefaultMetadataCacheTTL = 5 * time.Minute
+
+	KindPod  = "Pod"
+	KindNode = "Node"
+)
+
+// ObjectKey identifies an object an event may refer to.
+type ObjectKey struct {
+	Kind      string
+	Namespace string
+	Name      string
+}
+
+func InvolvedObjectKey(event *kube_api.Event) ObjectKey {
+	return ObjectKey{
+		Kind:      event.InvolvedObject.Kind,
+		Namespace: event.InvolvedObject.Namespace,
+		Name:      event.InvolvedObject.Name,
+	}
+}
+
+// Object is the metadata of an involved object.
+type Object struct {
+	metav1.ObjectMeta
+	// The node a pod is scheduled on, empty for other kinds.
+	NodeName string
+}
+
+// MetadataGetter looks up the metadata of a single object of one kind.
+type MetadataGetter interface {
+	Get(namespace, name string) (*Object, error)
+}
+
+// MetadataGetterFunc adapts a function to the MetadataGetter interface.
+type MetadataGetterFunc func(namespace, name string) (*Object, error)
+
+func (f MetadataGetterFunc) Get(namespace, name string) (*Object, error) {
+	return f(namespace, name)
+}
+
+// NewListerGetters returns informer backed getters for pods and nodes, so that
+// lookups are served from the local cache instead of the API server. The
+// informers are registered on the factory; the caller is responsible for
+// starting it.
+func NewListerGetters(factory informers.SharedInformerFactory) map[string]MetadataGetter {
+	podLister := factory.Core().V1().Pods().Lister()
+	nodeLister := factory.Core().V1().Nodes().Lister()
+	return map[string]MetadataGetter{
+		KindPod:  podGetter{podLister},
+		KindNode: nodeGetter{nodeLister},
+	}
+}
+
+type podGetter struct {
+	lister corelisters.PodLister
+}
+
+func (g podGetter) Get(namespace, name string) (*Object, error) {
+	pod, err := g.lister.Pods(namespace).Get(name)
+	if err != nil {
+		return nil, err
+	}
+	return &Object{ObjectMeta: pod.ObjectMeta, NodeName: pod.Spec.NodeName}, nil
+}
+
+type nodeGetter struct {
+	lister corelisters.NodeLister
+}
+
+func (g nodeGetter) Get(_, name string) (*Object, error) {
+	node, err := g.lister.Get(name)
+	if err != nil {
+		return nil, err
+	}
+	return &Object{ObjectMeta: node.ObjectMeta}, nil
+}
+
+type cacheEntry struct {
+	object    *Object
+	expiresAt time.Time
+}
+
+// Fetcher resolves the metadata of the objects involved in an event batch.
+// Every distinct object is looked up at most once per batch, and results
+// (including misses) are cached for ttl so that event storms about the same
+// objects don't translate into API load.
+type Fetcher struct {
+	sync.Mutex
+	getters map[string]MetadataGetter
+	ttl     time.Duration
+	cache   map[ObjectKey]cacheEntry
+	now     func() time.Time
+}
+
+func NewFetcher(getters map[string]MetadataGetter, ttl time.Duration) *Fetcher {
+	return &Fetcher{
+		getters: getters,
+		ttl:     ttl,
+		cache:   make(map[ObjectKey]cacheEntry),
+		now:     time.Now,
+	}
+}
+
+// Prefetch collects the distinct involved objects of the batch, looks up the
+// ones that aren't cached and returns the metadata of every object that was
+// found. The nodes that involved pods are scheduled on are resolved as well
+// when there is a node getter. Objects of kinds without a getter are skipped.
+func (f *Fetcher) Prefetch(batch *core.EventBatch) map[ObjectKey]*Object {
+	f.Lock()
+	defer f.Unlock()
+
+	now := f.now()
+	result := make(map[ObjectKey]*Object)
+	seen := make(map[ObjectKey]bool)
+	lookups := 0
+	for _, event := range batch.Events {
+		key := InvolvedObjectKey(event)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		if !f.resolve(key, now, result, &lookups) {
+			continue
+		}
+		if nodeName := result[key].NodeName; nodeName != "" {
+			nodeKey := ObjectKey{Kind: KindNode, Name: nodeName}
+			if !seen[nodeKey] {
+				seen[nodeKey] = true
+				f.resolve(nodeKey, now, result, &lookups)
+			}
+		}
+	}
+	f.expire(now)
+
+	glog.V(4).Infof("Prefetched metadata for %d distinct objects with %d lookups", len(seen), lookups)
+	return result
+}
+
+// resolve adds the object to result if it is cached or can be looked up, and
+// reports whether it was found. Must be called with the lock held.
+func (f *Fetcher) resolve(key ObjectKey, now time.Time, result map[ObjectKey]*Object, lookups *int) bool {
+	getter, found := f.getters[key.Kind]
+	if !found || key.Name == "" {
+		return false
+	}
+
+	entry, cached := f.cache[key]
+	if !cached || now.After(entry.expiresAt) {
+		*lookups++
+		object, err := getter.Get(key.Namespace, key.Name)
+		if err != nil {
+			glog.V(4).Infof("Failed to fetch metadata of %s %s/%s: %v", key.Kind, key.Namespace, key.Name, err)
+			object = nil
+		}
+		entry = cacheEntry{object: object, expiresAt: now.Add(f.ttl)}
+		f.cache[key] = entry
+	}
+	if entry.object == nil {
+		return false
+	}
+	result[key] = entry.object
+	return true
+}
+
+// expire drops outdated cache entries so the cache doesn't grow with every
+// object ever seen.
+func (f *Fetcher) expire(now time.Time) {
+	for key, entry := range f.cache {
+		if now.After(entry.expiresAt) {
+			delete(f.cache, key)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+// Copyright 2018 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package enrich
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	kube_api "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/heapster/events/core"
+)
+
+type countingGetter struct {
+	lookups int
+}
+
+func (g *countingGetter) Get(namespace, name string) (*Object, error) {
+	g.lookups++
+	if name == "missing" {
+		return nil, fmt.Errorf("not found")
+	}
+	object := &Object{ObjectMeta: metav1.ObjectMeta{
+		Namespace: namespace,
+		Name:      name,
+		Labels:    map[string]string{"app": name},
+	}}
+	if namespace != "" {
+		object.NodeName = "node-" + name
+	}
+	return object, nil
+}
+
+func podEventBatch(names ...string) *core.EventBatch {
+	batch := &core.EventBatch{Timestamp: time.Now()}
+	for _, name := range names {
+		batch.Events = append(batch.Events, &kube_api.Event{
+			InvolvedObject: kube_api.ObjectReference{Kind: "Pod", Namespace: "default", Name: name},
+		})
+	}
+	return batch
+}
+
+func TestPrefetchLooksUpDistinctObjectsOnce(t *testing.T) {
+	getter := &countingGetter{}
+	fetcher := NewFetcher(map[string]MetadataGetter{"Pod": getter}, time.Minute)
+
+	// 6 events about 3 distinct pods.
+	result := fetcher.Prefetch(podEventBatch("a", "b", "a", "c", "b", "a"))
+	assert.Equal(t, 3, getter.lookups)
+	assert.Len(t, result, 3)
+	assert.Equal(t, "b", result[ObjectKey{Kind: "Pod", Namespace: "default", Name: "b"}].Labels["app"])
+
+	// Cache hits don't cause further lookups.
+	fetcher.Prefetch(podEventBatch("a", "b", "d"))
+	assert.Equal(t, 4, getter.lookups)
+}
+
+func TestPrefetchCachesMissesAndExpires(t *testing.T) {
+	now := time.Now()
+	getter := &countingGetter{}
+	fetcher := NewFetcher(map[string]MetadataGetter{"Pod": getter}, time.Minute)
+	fetcher.now = func() time.Time { return now }
+
+	result := fetcher.Prefetch(podEventBatch("missing", "missing"))
+	assert.Empty(t, result)
+	fetcher.Prefetch(podEventBatch("missing"))
+	assert.Equal(t, 1, getter.lookups)
+
+	now = now.Add(2 * time.Minute)
+	fetcher.Prefetch(podEventBatch("missing"))
+	assert.Equal(t, 2, getter.lookups)
+}
+
+func TestPrefetchSkipsUnknownKinds(t *testing.T) {
+	getter := &countingGetter{}
+	fetcher := NewFetcher(map[string]MetadataGetter{"Pod": getter}, time.Minute)
+
+	batch := &core.EventBatch{Events: []*kube_api.Event{{
+		InvolvedObject: kube_api.ObjectReference{Kind: "Deployment", Namespace: "default", Name: "web"},
+	}}}
+	assert.Empty(t, fetcher.Prefetch(batch))
+	assert.Equal(t, 0, getter.lookups)
+}
+
+func TestPrefetchResolvesNodesOfPods(t *testing.T) {
+	pods := &countingGetter{}
+	nodes := &countingGetter{}
+	fetcher := NewFetcher(map[string]MetadataGetter{"Pod": pods, "Node": nodes}, time.Minute)
+
+	batch := podEventBatch("a", "b", "a")
+	batch.Events = append(batch.Events, &kube_api.Event{
+		InvolvedObject: kube_api.ObjectReference{Kind: "Node", Name: "node-a"},
+	})
+	result := fetcher.Prefetch(batch)
+	assert.Equal(t, 2, pods.lookups)
+	// node-a is looked up once, although both a pod and an event refer to it.
+	assert.Equal(t, 2, nodes.lookups)
+	assert.Len(t, result, 4)
+	assert.Equal(t, "node-b", result[ObjectKey{Kind: "Node", Name: "node-b"}].Labels["app"])
+
+	// Without a node getter, only the pods are resolved.
+	pods = &countingGetter{}
+	fetcher = NewFetcher(map[string]MetadataGetter{"Pod": pods}, time.Minute)
+	assert.Len(t, fetcher.Prefetch(podEventBatch("a", "b")), 2)
+}
@@ -17,39 +17,61 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"net"
 	"net/http"
 	"os"
+	"os/signal"
 	"runtime"
 	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/golang/glog"
 	"k8s.io/apiserver/pkg/util/logs"
+	kubeclient "k8s.io/client-go/kubernetes"
 	"k8s.io/heapster/common/flags"
+	kubeconfig "k8s.io/heapster/common/kubernetes"
 	"k8s.io/heapster/events/api"
+	"k8s.io/heapster/events/election"
 	"k8s.io/heapster/events/manager"
 	"k8s.io/heapster/events/sinks"
 	"k8s.io/heapster/events/sources"
+	"k8s.io/heapster/events/tracing"
 	"k8s.io/heapster/version"
 )
 
 var (
-	argFrequency   = flag.Duration("frequency", 30*time.Second, "The resolution at which Eventer pushes events to sinks")
-	argMaxProcs    = flag.Int("max_procs", 0, "max number of CPUs that can be used simultaneously. Less than 1 for default (number of cores)")
-	argSources     flags.Uris
-	argSinks       flags.Uris
-	argVersion     bool
-	argHealthzIP   = flag.String("healthz-ip", "0.0.0.0", "ip eventer health check service uses")
-	argHealthzPort = flag.Uint("healthz-port", 8084, "port eventer health check listens on")
+	argFrequency    = flag.Duration("frequency", 30*time.Second, "The resolution at which Eventer pushes events to sinks")
+	argMaxProcs     = flag.Int("max_procs", 0, "max number of CPUs that can be used simultaneously. Less than 1 for default (number of cores)")
+	argSources      flags.Uris
+	argSinks        flags.Uris
+	argVersion      bool
+	argHealthzIP    = flag.String("healthz-ip", "0.0.0.0", "ip eventer health check service uses")
+	argHealthzPort  = flag.Uint("healthz-port", 8084, "port eventer health check listens on")
+	argStopTimeout  = flag.Duration("sink-stop-timeout", sinks.DefaultSinkStopTimeout, "max time to wait for all sinks to flush the pending events and stop on shutdown")
+	argOtelEndpoint = flag.String("otel-endpoint", "", "OTLP/HTTP endpoint of an OpenTelemetry collector to export sink pipeline traces to, e.g. otel-collector:4318. Tracing is disabled if empty")
+	argMaxInFlight  = flag.Int("sink-max-inflight", 0, "max number of sink exports running concurrently across all sinks. Less than 1 for no limit")
+	argQueueDepth   = flag.Int("sink-queue-depth", sinks.DefaultSinkQueueDepth, "max number of batches queued per sink, the exports no longer block on slow sinks. Less than 1 to hand batches to the sinks directly")
+	argDropPolicy   = flag.String("sink-queue-drop-policy", sinks.DropOldest, "batch dropped when the queue of a sink is full, drop_oldest or drop_newest")
+	argDrainTimeout = flag.Duration("sink-drain-timeout", sinks.DefaultSinkDrainTimeout, "max time spent exporting the queued batches on shutdown, within --sink-stop-timeout")
+	argSinkConfig   = flag.String("sink-config", "", "YAML file listing sinks, with their options or in the --sink format. They are built in addition to those of --sink, a sink given in both is built twice. Reloaded on SIGHUP")
+	argFailureLimit = flag.String("sink-failure-threshold", sinks.DefaultFailureThreshold, "consecutive failed exports and/or time without a successful export after which a sink is failing, like 5,10m. Healthz fails once all sinks are failing. Sinks that don't report failed exports are left out")
+	argHealthStrict = flag.Bool("sink-health-strict", false, "fail healthz as soon as any sink is failing, rather than all of them")
+	argLeaderElect  = flag.Bool("leader-elect", false, "run the pipeline only while elected leader among the eventer replicas, so that the events are exported once. The standby replicas take over when the leader stops renewing its lock")
+	argLockType     = flag.String("leader-elect-resource-lock", election.DefaultLockType, "kind of object holding the leader election lock, leases, configmaps or endpoints. Leases require Kubernetes 1.14 or later")
+	argLockNs       = flag.String("leader-elect-namespace", election.DefaultNamespace, "namespace of the leader election lock")
+	argLockName     = flag.String("leader-elect-name", election.DefaultName, "name of the leader election lock")
+	argLeaseDur     = flag.Duration("leader-elect-lease-duration", election.DefaultLeaseDuration, "time standby replicas wait before taking over the lock of a leader that stopped renewing it")
+	argRenewDl      = flag.Duration("leader-elect-renew-deadline", election.DefaultRenewDeadline, "time the leader retries renewing its lock before it stops exporting, less than --leader-elect-lease-duration")
+	argRetryPeriod  = flag.Duration("leader-elect-retry-period", election.DefaultRetryPeriod, "time between attempts to acquire or renew the leader election lock")
+	argValidate     = flag.Bool("validate-sinks", false, "build every sink, check the reachability of those supporting it, print the results and exit, non-zero if any sink failed")
 )
 
 func main() {
-	quitChannel := make(chan struct{}, 0)
-
 	flag.Var(&argSources, "source", "source(s) to read events from")
 	flag.Var(&argSinks, "sink", "external sink(s) that receive events")
 	flag.BoolVar(&argVersion, "version", false, "print version info and exit")
@@ -60,6 +82,15 @@ func main() {
 		os.Exit(0)
 	}
 
+	// exitCode is set when the eventer stops on its own rather than on a
+	// signal. It is deferred first so that the logs and traces are flushed
+	// before exiting.
+	exitCode := 0
+	defer func() {
+		if exitCode != 0 {
+			os.Exit(exitCode)
+		}
+	}()
 	logs.InitLogs()
 	defer logs.FlushLogs()
 
@@ -71,10 +102,56 @@ func main() {
 		glog.Fatal(err)
 	}
 
-	// sources
+	sinkUris, err := loadSinkUris()
+	if err != nil {
+		glog.Fatal(err)
+	}
+
+	if *argValidate {
+		errs := sinks.NewSinkFactory().ValidateAll(sinkUris)
+		passed := sinks.PrintValidation(os.Stdout, sinkUris, errs)
+		logs.FlushLogs()
+		if !passed {
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
 	if len(argSources) != 1 {
 		glog.Fatal("Wrong number of sources specified")
 	}
+
+	// tracing
+	if *argOtelEndpoint != "" {
+		exporter, err := tracing.NewOTLPExporter(*argOtelEndpoint, "eventer")
+		if err != nil {
+			glog.Fatalf("Failed to create trace exporter: %v", err)
+		}
+		defer exporter.Stop()
+		tracing.SetExporter(exporter)
+		glog.Infof("Exporting traces to %s", exporter.Endpoint)
+	}
+
+	go startHTTPServer()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+
+	// ctx is cancelled once the leadership is lost.
+	ctx := context.Background()
+	if *argLeaderElect {
+		var sig os.Signal
+		if ctx, sig = waitForLeadership(signals); sig != nil {
+			glog.Infof("Received %v, stopping eventer", sig)
+			return
+		}
+		// The sinks may have changed while standing by.
+		if sinkUris, err = loadSinkUris(); err != nil {
+			glog.Fatal(err)
+		}
+	}
+
+	// sources
 	sourceFactory := sources.NewSourceFactory()
 	sources, err := sourceFactory.BuildAll(argSources)
 	if err != nil {
@@ -85,22 +162,37 @@ func main() {
 	}
 
 	// sinks
-	sinksFactory := sinks.NewSinkFactory()
-	sinkList := sinksFactory.BuildAll(argSinks)
-	if len([]flags.Uri(argSinks)) != 0 && len(sinkList) == 0 {
+	sinkSet := sinks.NewSinkSet(sinks.NewSinkFactory())
+	sinkList := sinkSet.Update(sinkUris)
+	if len([]flags.Uri(sinkUris)) != 0 && len(sinkList) == 0 {
 		glog.Fatal("No available sink to use")
 	}
 
 	for _, sink := range sinkList {
 		glog.Infof("Starting with %s sink", sink.Name())
 	}
-	sinkManager, err := sinks.NewEventSinkManager(sinkList, sinks.DefaultSinkExportEventsTimeout, sinks.DefaultSinkStopTimeout)
+	sinkManager, err := sinks.NewEventSinkManagerWithOptions(sinkList, sinks.SinkManagerOptions{
+		ExportTimeout: sinks.DefaultSinkExportEventsTimeout,
+		StopTimeout:   *argStopTimeout,
+		MaxInFlight:   *argMaxInFlight,
+		QueueDepth:    *argQueueDepth,
+		DropPolicy:    *argDropPolicy,
+		DrainTimeout:  *argDrainTimeout,
+		Context:       ctx,
+	})
 	if err != nil {
 		glog.Fatalf("Failed to create sink manager: %v", err)
 	}
 
+	http.Handle(api.SinksPath, api.NewSinksHandler(sinkManager.(sinks.SinkStatusReporter), sinkSet.RedactedUri))
+	healthPolicy, _ := sinks.ParseFailureThreshold(*argFailureLimit)
+	healthPolicy.Strict = *argHealthStrict
+	api.SetSinkHealthCheck(func() error {
+		return healthPolicy.Check(sinkManager.(sinks.SinkStatusReporter).SinkStatuses(), time.Now())
+	})
+
 	// main manager
-	manager, err := manager.NewManager(sources[0], sinkManager, *argFrequency)
+	manager, err := manager.NewManagerWithContext(ctx, sources[0], sinkManager, *argFrequency)
 	if err != nil {
 		glog.Fatalf("Failed to create main manager: %v", err)
 	}
@@ -108,9 +200,104 @@ func main() {
 	manager.Start()
 	glog.Infof("Starting eventer")
 
-	go startHTTPServer()
+	for {
+		select {
+		case sig := <-signals:
+			if sig == syscall.SIGHUP {
+				reloadSinks(sinkSet, sinkManager.(sinks.ReconfigurableSink))
+				continue
+			}
+			glog.Infof("Received %v, stopping eventer", sig)
+			manager.Stop()
+			glog.Flush()
+			return
+		case <-ctx.Done():
+			// Another replica exports the events from now on. Exiting
+			// restarts this one as a standby.
+			glog.Warningf("Lost the leadership, stopping eventer")
+			manager.Stop()
+			exitCode = 1
+			return
+		}
+	}
+}
+
+// waitForLeadership blocks until this replica is elected leader and returns
+// a context cancelled once the leadership is lost, or the signal stopping the
+// eventer while standing by.
+func waitForLeadership(signals <-chan os.Signal) (context.Context, os.Signal) {
+	config := leaderElectionConfig()
+	kubeConfig, err := kubeconfig.GetKubeClientConfig(&argSources[0].Val)
+	if err != nil {
+		glog.Fatalf("Failed to create leader election client: %v", err)
+	}
+	kubeClient, err := kubeclient.NewForConfig(kubeConfig)
+	if err != nil {
+		glog.Fatalf("Failed to create leader election client: %v", err)
+	}
+	lock, err := election.NewLock(kubeClient, config)
+	if err != nil {
+		glog.Fatalf("Failed to create leader election lock: %v", err)
+	}
 
-	<-quitChannel
+	api.SetStandby(true)
+	defer api.SetStandby(false)
+	elected := make(chan context.Context, 1)
+	go func() {
+		ctx, err := election.WaitForLeadership(lock, config)
+		if err != nil {
+			glog.Fatalf("Failed to run leader election: %v", err)
+		}
+		elected <- ctx
+	}()
+	for {
+		select {
+		case ctx := <-elected:
+			return ctx, nil
+		case sig := <-signals:
+			if sig == syscall.SIGHUP {
+				glog.Infof("Standing by, the sinks are loaded once elected leader")
+				continue
+			}
+			return nil, sig
+		}
+	}
+}
+
+func leaderElectionConfig() election.Config {
+	return election.Config{
+		LockType:      *argLockType,
+		Namespace:     *argLockNs,
+		Name:          *argLockName,
+		LeaseDuration: *argLeaseDur,
+		RenewDeadline: *argRenewDl,
+		RetryPeriod:   *argRetryPeriod,
+	}
+}
+
+// loadSinkUris returns the sinks given by --sink and listed in --sink-config.
+func loadSinkUris() (flags.Uris, error) {
+	uris := append(flags.Uris{}, argSinks...)
+	if *argSinkConfig != "" {
+		configured, err := sinks.ReadSinkConfig(*argSinkConfig)
+		if err != nil {
+			return nil, err
+		}
+		uris = append(uris, configured...)
+	}
+	return uris, nil
+}
+
+// reloadSinks rebuilds the sinks whose configuration changed and swaps them
+// into the sink manager. The others keep running untouched.
+func reloadSinks(sinkSet *sinks.SinkSet, sinkManager sinks.ReconfigurableSink) {
+	glog.Infof("Reloading sinks")
+	uris, err := loadSinkUris()
+	if err != nil {
+		glog.Errorf("Failed to reload sinks, keeping the current ones: %v", err)
+		return
+	}
+	sinkManager.SetSinks(sinkSet.Update(uris))
 }
 
 func startHTTPServer() {
@@ -132,6 +319,20 @@ func validateFlags() error {
 			api.MaxEventsScrapeDelay, *argFrequency)
 	}
 
+	if _, err := sinks.ParseDropPolicy(*argDropPolicy); err != nil {
+		return err
+	}
+
+	if _, err := sinks.ParseFailureThreshold(*argFailureLimit); err != nil {
+		return err
+	}
+
+	if *argLeaderElect {
+		if err := leaderElectionConfig().Validate(); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
@@ -15,6 +15,7 @@
 package manager
 
 import (
+	"context"
 	"time"
 
 	"github.com/golang/glog"
@@ -49,26 +50,50 @@ type realManager struct {
 	source    core.EventSource
 	sink      core.EventSink
 	frequency time.Duration
-	stopChan  chan struct{}
+	// Cancelling ctx stops housekeeping without exporting the pending events.
+	ctx      context.Context
+	stopChan chan struct{}
+	// Closed once the sink has been stopped.
+	stoppedChan chan struct{}
 }
 
 func NewManager(source core.EventSource, sink core.EventSink, frequency time.Duration) (Manager, error) {
+	return NewManagerWithContext(context.Background(), source, sink, frequency)
+}
+
+// NewManagerWithContext creates a manager that stops housekeeping as soon as
+// ctx is cancelled, dropping the events gathered since the last housekeeping
+// rather than exporting them, and stops the sink. The sink should abort its
+// exports on the same context.
+func NewManagerWithContext(ctx context.Context, source core.EventSource, sink core.EventSink, frequency time.Duration) (Manager, error) {
 	manager := realManager{
-		source:    source,
-		sink:      sink,
-		frequency: frequency,
-		stopChan:  make(chan struct{}),
+		source:      source,
+		sink:        sink,
+		frequency:   frequency,
+		ctx:         ctx,
+		stopChan:    make(chan struct{}),
+		stoppedChan: make(chan struct{}),
 	}
 
 	return &manager, nil
 }
 
 func (rm *realManager) Start() {
+	// Events are only expected from now on, the eventer may have been
+	// waiting to be elected leader.
+	LatestScrapeTime = time.Now()
 	go rm.Housekeep()
 }
 
+// Stop stops housekeeping and waits for the sink to be stopped. The events
+// gathered since the last housekeeping are exported first, unless the
+// context of the manager was cancelled.
 func (rm *realManager) Stop() {
-	rm.stopChan <- struct{}{}
+	select {
+	case rm.stopChan <- struct{}{}:
+	case <-rm.stoppedChan:
+	}
+	<-rm.stoppedChan
 }
 
 func (rm *realManager) Housekeep() {
@@ -83,12 +108,25 @@ func (rm *realManager) Housekeep() {
 		case <-time.After(timeToNextSync):
 			rm.housekeep()
 		case <-rm.stopChan:
-			rm.sink.Stop()
+			if rm.ctx.Err() == nil {
+				glog.Infof("Exporting pending events before stopping")
+				rm.housekeep()
+			}
+			rm.stopSink()
+			return
+		case <-rm.ctx.Done():
+			glog.Infof("Stopping without exporting pending events: %v", rm.ctx.Err())
+			rm.stopSink()
 			return
 		}
 	}
 }
 
+func (rm *realManager) stopSink() {
+	rm.sink.Stop()
+	close(rm.stoppedChan)
+}
+
 func (rm *realManager) housekeep() {
 	defer func() {
 		lastHousekeepTimestamp.Set(float64(time.Now().Unix()))
@@ -15,6 +15,7 @@
 package manager
 
 import (
+	"context"
 	"testing"
 	"time"
 
@@ -35,11 +36,56 @@ func TestFlow(t *testing.T) {
 	manager, _ := NewManager(source, sink, time.Second)
 	manager.Start()
 
-	// 4-5 cycles
+	// 4-5 cycles, plus the final export on stop
 	time.Sleep(time.Millisecond * 4500)
 	manager.Stop()
 
-	if sink.GetExportCount() < 4 || sink.GetExportCount() > 5 {
+	if sink.GetExportCount() < 5 || sink.GetExportCount() > 6 {
 		t.Fatalf("Wrong number of exports executed: %d", sink.GetExportCount())
 	}
 }
+
+func TestStopExportsPendingEvents(t *testing.T) {
+	batch := &core.EventBatch{
+		Timestamp: time.Now(),
+		Events:    []*kube_api.Event{},
+	}
+
+	source := util.NewDummySource(batch)
+	sink := util.NewDummySink("sink", time.Millisecond)
+
+	manager, _ := NewManager(source, sink, time.Hour)
+	manager.Start()
+	manager.Stop()
+
+	if sink.GetExportCount() != 1 {
+		t.Fatalf("Pending events weren't exported on stop: %d exports", sink.GetExportCount())
+	}
+	if !sink.IsStopped() {
+		t.Fatal("Sink wasn't stopped")
+	}
+}
+
+func TestCancelStopsWithoutExporting(t *testing.T) {
+	batch := &core.EventBatch{
+		Timestamp: time.Now(),
+		Events:    []*kube_api.Event{},
+	}
+
+	source := util.NewDummySource(batch)
+	sink := util.NewDummySink("sink", time.Millisecond)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	manager, _ := NewManagerWithContext(ctx, source, sink, time.Hour)
+	manager.Start()
+	cancel()
+	// Stop waits for the sink to be stopped.
+	manager.Stop()
+
+	if sink.GetExportCount() != 0 {
+		t.Fatalf("Pending events were exported after cancellation: %d exports", sink.GetExportCount())
+	}
+	if !sink.IsStopped() {
+		t.Fatal("Sink wasn't stopped")
+	}
+}
@@ -0,0 +1,100 @@
+// Copyright 2018 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package alertmanager
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+const (
+	AffectedObjectsAnnotation     = "affected_objects"
+	AffectedObjectCountAnnotation = "affected_object_count"
+
+	// MAX_AFFECTED_OBJECTS caps the objects listed in an aggregated alert.
+	MAX_AFFECTED_OBJECTS = 20
+)
+
+// aggregateKeyFields group the events of objects of the same kind in a
+// namespace failing for the same reason, see aggregate.
+var aggregateKeyFields = []string{"kind", "namespace", "reason"}
+
+// alertGroup is the alert of the events of a batch sharing their group key.
+// An alert of a single object is left as it is.
+type alertGroup struct {
+	alert   *Alert
+	reason  string
+	objects []string
+	seen    map[string]bool
+	count   int
+}
+
+func newAlertGroup(alert *Alert, event *v1.Event) *alertGroup {
+	object := event.InvolvedObject.Name
+	return &alertGroup{
+		alert:   alert,
+		reason:  event.Reason,
+		objects: []string{object},
+		seen:    map[string]bool{object: true},
+		count:   eventCount(event),
+	}
+}
+
+// add adds the object of event to the group. It reports false if the object
+// already is part of it.
+func (g *alertGroup) add(event *v1.Event) bool {
+	object := event.InvolvedObject.Name
+	if g.seen[object] {
+		return false
+	}
+	g.seen[object] = true
+	g.objects = append(g.objects, object)
+	g.count += eventCount(event)
+	return true
+}
+
+// finish turns the alert of a group of several objects into the alert of
+// the group: it is named after the reason, loses the labels of the first
+// object and lists the affected objects.
+func (a *AlertmanagerSink) finishGroup(g *alertGroup) {
+	if len(g.objects) < 2 {
+		return
+	}
+	alert := g.alert
+	for _, label := range []string{AlertInstanceLabel, AlertObjectNameLabel, AlertFieldPathLabel, AlertHostLabel} {
+		delete(alert.Labels, a.labelName(label))
+	}
+	alert.Labels[a.labelName(AlertNameLabel)] = g.reason
+	delete(alert.Annotations, AlertEventNameAnnotation)
+
+	objects := g.objects
+	if len(objects) > MAX_AFFECTED_OBJECTS {
+		objects = append(objects[:MAX_AFFECTED_OBJECTS:MAX_AFFECTED_OBJECTS], fmt.Sprintf("+%d more", len(g.objects)-MAX_AFFECTED_OBJECTS))
+	}
+	setAnnotation(alert, AffectedObjectsAnnotation, strings.Join(objects, ","))
+	setAnnotation(alert, AffectedObjectCountAnnotation, strconv.Itoa(len(g.objects)))
+	setAnnotation(alert, AlertCountAnnotation, strconv.Itoa(g.count))
+}
+
+// labelName returns the configured name of a generated label.
+func (a *AlertmanagerSink) labelName(label string) string {
+	if name, ok := a.labelNames[label]; ok {
+		return name
+	}
+	return label
+}
@@ -0,0 +1,126 @@
+// Copyright 2018 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package alertmanager
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/heapster/events/core"
+)
+
+// exportTwice exports the batch twice, as first occurrences are only
+// recorded, and returns the alerts received keyed by alertname.
+func exportTwice(t *testing.T, query string, batch *core.EventBatch) map[string]*Alert {
+	am := newFakeAlertmanager(nil)
+	defer am.server.Close()
+	sink := newTestSink(t, am.host(), query)
+	sink.ExportEvents(batch)
+	sink.ExportEvents(batch)
+
+	alerts := make(map[string]*Alert)
+	for _, chunk := range am.received() {
+		for _, alert := range chunk {
+			alerts[alert.Labels[AlertNameLabel]] = alert
+		}
+	}
+	return alerts
+}
+
+func TestAggregateGroups(t *testing.T) {
+	var events []*v1.Event
+	for i := 0; i < 3; i++ {
+		events = append(events, podEvent(fmt.Sprintf("web-%d", i), "ErrImagePull", fmt.Sprintf("Failed to pull image for web-%d", i)))
+	}
+	// The same object showing up twice is only listed once.
+	events = append(events, events[1])
+	events = append(events, podEvent("db-0", "BackOff", "Back-off restarting failed container"))
+	batch := &core.EventBatch{Events: events}
+
+	alerts := exportTwice(t, "aggregate=true", batch)
+	assert.Len(t, alerts, 2)
+
+	group := alerts["ErrImagePull"]
+	if assert.NotNil(t, group) {
+		assert.Equal(t, "ErrImagePull", group.Labels[AlertReasonLabel])
+		assert.Equal(t, "Pod", group.Labels[AlertKindLabel])
+		assert.Equal(t, "default", group.Labels[AlertObjectNamespaceLabel])
+		assert.NotContains(t, group.Labels, AlertObjectNameLabel)
+		assert.NotContains(t, group.Labels, AlertInstanceLabel)
+		assert.Equal(t, "web-0,web-1,web-2", group.Annotations[AffectedObjectsAnnotation])
+		assert.Equal(t, "3", group.Annotations[AffectedObjectCountAnnotation])
+		assert.Equal(t, "3", group.Annotations[AlertCountAnnotation])
+	}
+
+	// A group of a single object looks just like the alert sent without
+	// aggregate.
+	plain := exportTwice(t, "", &core.EventBatch{Events: events[4:]})
+	assert.Equal(t, plain["Back-off restarting failed container"], alerts["Back-off restarting failed container"])
+}
+
+func TestAggregateCapsAffectedObjects(t *testing.T) {
+	var events []*v1.Event
+	for i := 0; i < MAX_AFFECTED_OBJECTS+5; i++ {
+		events = append(events, podEvent(fmt.Sprintf("web-%02d", i), "ErrImagePull", "Failed to pull image"))
+	}
+	alerts := exportTwice(t, "aggregate=true", &core.EventBatch{Events: events})
+
+	group := alerts["ErrImagePull"]
+	if assert.NotNil(t, group) {
+		objects := strings.Split(group.Annotations[AffectedObjectsAnnotation], ",")
+		assert.Len(t, objects, MAX_AFFECTED_OBJECTS+1)
+		assert.Equal(t, "web-00", objects[0])
+		assert.Equal(t, "+5 more", objects[MAX_AFFECTED_OBJECTS])
+		assert.Equal(t, fmt.Sprint(MAX_AFFECTED_OBJECTS+5), group.Annotations[AffectedObjectCountAnnotation])
+	}
+}
+
+func TestAggregateMixedBatch(t *testing.T) {
+	event := func(kind, namespace, name, reason string) *v1.Event {
+		e := podEvent(name, reason, reason+" "+name)
+		e.Namespace = namespace
+		e.InvolvedObject.Kind = kind
+		e.InvolvedObject.Namespace = namespace
+		return e
+	}
+	batch := &core.EventBatch{Events: []*v1.Event{
+		event("Pod", "default", "web-0", "BackOff"),
+		event("Pod", "default", "web-1", "BackOff"),
+		event("Pod", "default", "web-2", "FailedMount"),
+		event("Pod", "default", "web-3", "FailedMount"),
+		event("Pod", "kube-system", "dns-0", "BackOff"),
+		event("Node", "default", "node-0", "BackOff"),
+	}}
+	alerts := exportTwice(t, "aggregate=true", batch)
+
+	var summary []string
+	for name, alert := range alerts {
+		summary = append(summary, name+": "+alert.Annotations[AffectedObjectsAnnotation])
+	}
+	sort.Strings(summary)
+	assert.Equal(t, []string{
+		"BackOff dns-0: ",
+		"BackOff node-0: ",
+		"BackOff: web-0,web-1",
+		"FailedMount: web-2,web-3",
+	}, summary)
+
+	_, err := NewAlertmanagerSink(mustParseURL("http://localhost:9093?cluster=test&aggregate=sometimes"))
+	assert.Error(t, err)
+}
@@ -2,24 +2,34 @@ package alertmanager
 
 import (
 	"bytes"
-	"encoding/json"
+	"context"
 	"fmt"
+	"math/rand"
 	"net/http"
 	"net/url"
+	"regexp"
+	"strconv"
 	"strings"
+	"sync"
+	"text/template"
 	"time"
 
 	"github.com/facebookarchive/inmem"
 	"github.com/golang/glog"
 	v1 "k8s.io/api/core/v1"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/client-go/util/flowcontrol"
+	kubeconfig "k8s.io/heapster/common/kubernetes"
 	"k8s.io/heapster/events/core"
+	"k8s.io/heapster/events/tracing"
+	"k8s.io/heapster/version"
 )
 
 const (
-	ALERTMANAGER_SINK     = "alertmanager"
-	WARNING           int = 2
-	NORMAL            int = 1
-	CONTENT_TYPE_JSON     = "application/json"
+	ALERTMANAGER_SINK = "alertmanager"
+	WARNING           = core.LevelWarning
+	NORMAL            = core.LevelNormal
+	CONTENT_TYPE_JSON = "application/json"
 
 	// AlertNameLabel is the name of the label containing the an alert's name.
 	AlertNameLabel     = "alertname"
@@ -29,20 +39,215 @@ const (
 	AlertInstanceLabel = "instance"
 	AlertReasonLabel   = "reason"
 
-	MAX_RECORDER              = 500
-	MSG_RECORDER_KEY_TEMPLATE = "%s%s%s%s%s"
+	// Labels describing the object an event is about.
+	AlertKindLabel            = "kind"
+	AlertObjectNamespaceLabel = "object_namespace"
+	AlertObjectNameLabel      = "object_name"
+	AlertFieldPathLabel       = "field_path"
+
+	// Labels describing what reported an event.
+	AlertComponentLabel = "component"
+	AlertHostLabel      = "host"
+
+	AlertMessageAnnotation   = "message"
+	AlertEventNameAnnotation = "event_name"
+	// When the event was first and last seen, in RFC 3339.
+	AlertFirstSeenAnnotation = "first_seen"
+	AlertLastSeenAnnotation  = "last_seen"
+
+	// MAX_RECORDER is the default number of dedup keys remembered per sink.
+	MAX_RECORDER = 500
+	// recorderEntryBytes is a rough per-entry cost of the dedup recorder:
+	// the key, the list element and the map bucket.
+	recorderEntryBytes = 200
+	DEFAULT_BATCH_SIZE = 100
+	// DEDUP_WINDOW is how long dedup keys are remembered by default.
+	DEDUP_WINDOW = 300 * time.Second
+
+	HEALTH_CHECK_TIMEOUT = 5 * time.Second
+
+	// DEFAULT_MAX_EVENT_AGE is how old events may be before they are
+	// dropped as stale.
+	DEFAULT_MAX_EVENT_AGE = 10 * time.Minute
+
+	// The event field alerts are named after.
+	ALERTNAME_SOURCE_MESSAGE = "message"
+	ALERTNAME_SOURCE_REASON  = "reason"
+
+	// How the instance label is derived from the event: the event name or
+	// the kind and name of the involved object.
+	INSTANCE_FORMAT_NAME      = "name"
+	INSTANCE_FORMAT_KIND_NAME = "kind/name"
 )
 
-var ignoreAlerts = []string{"Unhealthy"}
+// nodeLabel reads the cluster name from the node with cluster_from_node.
+var nodeLabel core.NodeLabelFunc = kubeconfig.NodeLabel
 
-var NotVaildAlertName error = fmt.Errorf("not valid alert name")
+// DefaultIgnoreReasons are the event reasons never alerted on, unless
+// nodefaults is set.
+var DefaultIgnoreReasons = []string{"Unhealthy"}
 
-var recorder = inmem.NewUnlocked(MAX_RECORDER)
+// PathOptions are the <name>_file options read as paths by the sink, rather
+// than resolved into <name> by the sink factory.
+var PathOptions = []string{"bearer_token_file", "ca_file", "cert_file", "key_file", "tls_ca_file", "tls_cert_file", "tls_key_file"}
+
+var NotVaildAlertName error = fmt.Errorf("not valid alert name")
 
 type AlertmanagerSink struct {
+	// Endpoint is the first of Endpoints.
 	Endpoint string
-	Level    int
-	Cluster  string
+	// Endpoints are all the replicas alerts are posted to.
+	Endpoints []string
+	// SocketPath is the unix socket alertmanager listens on, if it isn't
+	// reached over TCP.
+	SocketPath string
+	// Scheme is http, or https if the uri says so or TLS is configured.
+	Scheme  string
+	Level   int
+	Cluster string
+	// LevelMode is how event levels are compared to Level, see level_mode.
+	LevelMode string
+	// BatchSize is the maximum number of alerts posted in a single request.
+	BatchSize int
+	// DedupKeys are the event fields identifying duplicate alerts, any of
+	// type, kind, namespace, name, reason and message, see dedup_keys. The
+	// message is normalized before it is hashed. DefaultDedupKeys include
+	// it, dedup_keys=type,namespace,name,reason leaves it out.
+	DedupKeys []string
+	// APIVersion selects the JSON schema of posted alerts, v1 or v2.
+	APIVersion string
+	// GeneratorURL is attached to every alert posted with the v2 API. It
+	// may be a template rendered with the event, see generator_url.
+	GeneratorURL string
+	// Aggregate sends a single alert for the events of a batch about
+	// objects of the same kind in a namespace failing for the same reason,
+	// and dedups on that group rather than DedupKeys, see aggregate.
+	Aggregate bool
+	// MinCount drops the events that haven't occurred this many times yet,
+	// see min_count.
+	MinCount int
+	// MaxEventAge drops the events last seen longer ago than this, such as
+	// the ones replayed after a restart, see max_event_age. Zero disables it.
+	MaxEventAge time.Duration
+	// ResolveTimeout, if set, resolves alerts this long after the event was
+	// last seen, see resolve_timeout.
+	ResolveTimeout time.Duration
+	// SendResolved resolves the alerts fired for an object once a Normal
+	// event is seen for it, see send_resolved.
+	SendResolved bool
+	// AlertnameSource is the event field the alertname is taken from,
+	// message or reason, see alertname_source.
+	AlertnameSource string
+	// Template renders the alert text from the event instead of using its message.
+	Template *template.Template
+	// Instance, if set, is used as the instance label of every alert.
+	Instance string
+	// InstanceFormat is how the instance label is derived from the event
+	// otherwise, see instance_format.
+	InstanceFormat string
+	// Compression of the request body, empty or gzip.
+	Compression string
+	// DryRun logs the alerts that would be sent instead of sending them,
+	// see dry_run. Dedup, filtering and labeling still apply.
+	DryRun bool
+	// StaticLabels are attached to every alert.
+	StaticLabels map[string]string
+	// LabelTemplates and AnnotationTemplates render labels and annotations
+	// from the event, see label_template and annotation_template.
+	LabelTemplates      map[string]*template.Template
+	AnnotationTemplates map[string]*template.Template
+	// LabelPrecedence decides whether event derived or static labels win
+	// on collision, event by default.
+	LabelPrecedence string
+	// ColdStartQuiet is how long after construction events are recorded in
+	// the dedup cache without being sent, so replayed events don't fire.
+	ColdStartQuiet time.Duration
+	// UserAgent is sent with every request, see user_agent.
+	UserAgent string
+	// Username and Password are sent as basic auth, if set.
+	Username string
+	Password string
+	// BearerToken is sent as bearer auth, if set.
+	BearerToken string
+	// BearerTokenFile holds the token sent as bearer auth, reread whenever
+	// it changes, see bearer_token_file.
+	BearerTokenFile string
+	// GroupBy is the event field the group label is taken from.
+	GroupBy string
+	// GroupUpper uppercases the group label, true by default.
+	GroupUpper bool
+	// IgnoreReasons are the event reasons not alerted on, see ignore_reasons.
+	IgnoreReasons map[string]bool
+	// IgnoreMessageRegexps and IgnoreReasonRegexps drop the events whose
+	// message or reason matches any of them, see ignore_message_regex and
+	// ignore_reason_regex.
+	IgnoreMessageRegexps []*regexp.Regexp
+	IgnoreReasonRegexps  []*regexp.Regexp
+	// Timeout bounds every request to alertmanager, see timeout.
+	Timeout time.Duration
+	// ProxyURL, if set, is the proxy requests go through, see proxy_url.
+	ProxyURL *url.URL
+	// MaxRetries is how often a failed chunk is retried, see max_retries.
+	MaxRetries int
+	// InitialBackoff is the wait before the first retry, doubled for every
+	// further retry.
+	InitialBackoff time.Duration
+	// RetryDeadline bounds the time spent retrying a chunk.
+	RetryDeadline time.Duration
+	// DedupTTL is how long dedup keys are remembered, see dedup_ttl.
+	DedupTTL time.Duration
+	// DedupJitter randomizes the dedup window of each key by up to
+	// ±DedupJitter, so that keys recorded together don't expire together.
+	DedupJitter time.Duration
+	// Heartbeat is the interval of heartbeat alerts, none if zero.
+	Heartbeat time.Duration
+
+	// recorder remembers recently seen dedup keys, see recorder_size, with
+	// the *dedupEntry counting their suppressed occurrences.
+	recorder      inmem.Cache
+	recorderSize  int
+	audit         *auditLogger
+	nodeIncidents *nodeIncidents
+	labelFilter   *labelFilter
+	// silences is when no alerts are sent, see silence_windows.
+	silences *silenceSchedule
+	// tokenFile caches the token of BearerTokenFile.
+	tokenFile *tokenFile
+	// namespaceFilter selects events by namespace, see namespaces and
+	// exclude_namespaces.
+	namespaceFilter *namespaceFilter
+	// labelNames maps default label names to the configured ones.
+	labelNames map[string]string
+	client     *http.Client
+	// coalescer sends a summary alert of the suppressed occurrences of an
+	// event once its dedup window expires.
+	coalescer *coalescer
+	// fired remembers the alerts to resolve, nil unless SendResolved.
+	fired *firedAlerts
+	// limiter limits the alerts sent, see max_alerts_per_minute.
+	limiter flowcontrol.RateLimiter
+	// generatorURL is GeneratorURL parsed as a template, nil if it is a
+	// plain URL.
+	generatorURL *template.Template
+
+	// mu guards the dedup and node incident state across concurrent
+	// exports, as well as retryAt and quietUntil.
+	mu sync.Mutex
+	// retryAt is when alertmanager asked to be sent alerts again.
+	retryAt time.Time
+
+	// quietUntil is the end of the cold start quiet period, zero once it
+	// has ended.
+	quietUntil time.Time
+	now        func() time.Time
+	// dryRunf logs the alerts of a dry run.
+	dryRunf func(format string, args ...interface{})
+
+	// ctx is cancelled by Stop to abort in-flight requests.
+	ctx    context.Context
+	cancel context.CancelFunc
+	// workers tracks the heartbeat and coalescer goroutines.
+	workers sync.WaitGroup
 }
 
 // Alert is a generic representation of an alert in the Prometheus eco-system.
@@ -52,140 +257,1091 @@ type Alert struct {
 	Labels map[string]string `json:"labels"`
 
 	// Extra key/value information which does not define alert identity.
-	Annotations map[string]string `json:"annotations"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+
+	// The fields below are only part of the v2 API payload.
+	StartsAt     time.Time `json:"-"`
+	EndsAt       time.Time `json:"-"`
+	GeneratorURL string    `json:"-"`
+
+	// dedupKey is the key of the event the alert was created from.
+	dedupKey string
 }
 
 func (a *AlertmanagerSink) Name() string {
+	if a.DryRun {
+		return ALERTMANAGER_SINK + "_dry_run"
+	}
 	return ALERTMANAGER_SINK
 }
 
+// Stop stops the background workers, then sends the summaries of the events
+// with suppressed occurrences, as their windows would never expire otherwise.
+// Sending them takes no longer than the request timeout.
 func (a *AlertmanagerSink) Stop() {
-	//do nothing
+	a.cancel()
+	a.workers.Wait()
+	ctx, cancel := context.WithTimeout(context.Background(), a.Timeout)
+	if err := a.sendSummaries(ctx, a.coalescer.remaining()); err != nil {
+		glog.Warningf("failed to send coalesced alerts to alertmanager on stop: %v", err)
+	}
+	cancel()
+	a.audit.Close()
 }
 
 func (a *AlertmanagerSink) ExportEvents(batch *core.EventBatch) {
+	if err := a.ExportEventsWithError(batch); err != nil {
+		glog.Errorf("failed to send alerts to alertmanager: %v", err)
+	}
+}
+
+// ExportEventsWithError converts the batch into alerts and sends them,
+// returning the error of sending them.
+func (a *AlertmanagerSink) ExportEventsWithError(batch *core.EventBatch) error {
+	return a.ExportEventsContext(a.ctx, batch)
+}
+
+// ExportEventsContext is like ExportEventsWithError, but the requests are
+// aborted once ctx is done or the sink is stopped.
+func (a *AlertmanagerSink) ExportEventsContext(ctx context.Context, batch *core.EventBatch) error {
+	alerts := a.alertsForBatch(batch)
+	if len(alerts) == 0 {
+		return nil
+	}
+	return a.SendContext(ctx, alerts)
+}
+
+// alertsForBatch filters and dedups the events of batch and returns the
+// alerts to send for them.
+func (a *AlertmanagerSink) alertsForBatch(batch *core.EventBatch) []*Alert {
+	a.mu.Lock()
+	defer a.mu.Unlock()
 
 	var alerts []*Alert
+	// Keys of the alerts already queued, as aggregated events may show up
+	// more than once in a batch.
+	queued := make(map[string]bool)
+	rateLimited, stale := 0, 0
+	quiet := a.inQuietPeriod()
+	// Silenced events aren't recorded, so that they alert once the window
+	// is over if they persist.
+	if a.silences.active(a.now()) {
+		for _, event := range batch.Events {
+			silencedEvents.WithLabelValues(a.Cluster).Inc()
+			a.record(a.dedupKey(event), AuditDecisionDropped, "inside a silence window")
+		}
+		glog.V(2).Infof("dropped %d events inside a silence window", len(batch.Events))
+		return nil
+	}
+	// With aggregate, the alerts of every group.
+	groups := make(map[string]*alertGroup)
 	for _, event := range batch.Events {
-		if a.isEventLevelDangerous(event.Type) {
-			if a.isIgnoreAlert(event) {
-				glog.Infof("skip send alert: %v, for ignore", event)
+		key := a.dedupKey(event)
+		if a.isStale(event) {
+			stale++
+			staleEvents.WithLabelValues(a.Cluster).Inc()
+			a.record(key, AuditDecisionDropped, fmt.Sprintf("last seen before the max event age of %v", a.MaxEventAge))
+			continue
+		}
+		if !a.namespaceFilter.allowed(event) {
+			a.record(key, AuditDecisionIgnored, fmt.Sprintf("namespace %q is filtered out", event.InvolvedObject.Namespace))
+			continue
+		}
+		if resolved := a.fired.resolve(event, a.now()); len(resolved) > 0 {
+			alerts = append(alerts, resolved...)
+			a.record(key, AuditDecisionSent, fmt.Sprintf("resolves %d alert(s) of the object", len(resolved)))
+		}
+		if a.nodeIncidents.openIfNodeFailure(event) {
+			a.record(key, AuditDecisionSent, "node incident opened or extended")
+			continue
+		}
+		if !a.isEventLevelDangerous(event.Type) {
+			a.record(key, AuditDecisionDropped, fmt.Sprintf("level %q below threshold", event.Type))
+			continue
+		}
+		if a.isIgnoreAlert(event) {
+			glog.Infof("skip send alert: %v, for ignore", event)
+			a.record(key, AuditDecisionIgnored, fmt.Sprintf("reason %q or its message is ignored", event.Reason))
+			continue
+		}
+		if count := eventCount(event); count < a.MinCount {
+			a.record(key, AuditDecisionIgnored, fmt.Sprintf("count %d below min_count %d", count, a.MinCount))
+			continue
+		}
+		if a.nodeIncidents.collapse(event) {
+			a.record(key, AuditDecisionDeduped, fmt.Sprintf("collapsed into incident of node %q", event.Source.Host))
+			continue
+		}
+		if queued[key] {
+			if group := groups[key]; group != nil && group.add(event) {
+				a.fired.record(event, group.alert)
+				a.record(key, AuditDecisionSent, "aggregated into the alert of its group")
 				continue
 			}
-			if _, ok := recorder.Get(generateKey(event)); !ok {
-				// then add recoreder
-				recorder.Add(generateKey(event), 1, time.Now().Add(time.Second*300))
-
-				glog.Infof("skip send alert: %v, for first alert at 5 minute", event)
-				continue
+			a.suppress(key, event)
+			a.record(key, AuditDecisionDeduped, "already queued in this batch")
+			continue
+		}
+		if entry, ok := a.recorder.Get(key); ok {
+			// Events replayed on start aren't counted, so that the quiet
+			// period doesn't end with their summaries.
+			if !quiet {
+				a.coalescer.suppress(key, entry.(*dedupEntry), event)
 			}
+			a.record(key, AuditDecisionDeduped, "already alerted within dedup window")
+			continue
+		}
+		if quiet {
+			// Recorded, so that events replayed on start don't alert later.
+			a.recordKey(key)
+			a.record(key, AuditDecisionDeduped, "cold start quiet period")
+			continue
+		}
 
-			alert, err := createAlertFromEvent(a.Cluster, event)
-			if err != nil {
-				glog.Warningf("failed to create alert from event,because of %v", event)
-				continue
-			}
+		alert, err := a.buildAlert(event)
+		if err != nil {
+			glog.Warningf("failed to create alert from event,because of %v", event)
+			a.record(key, AuditDecisionDropped, err.Error())
+			continue
+		}
 
-			alerts = append(alerts, alert)
+		if !a.allowAlert() {
+			rateLimited++
+			a.record(key, AuditDecisionDropped, "rate limited")
+			continue
 		}
-	}
 
-	if len(alerts) > 0 {
-		a.Send(alerts)
+		a.recordKey(key)
+		alert.dedupKey = key
+		alerts = append(alerts, alert)
+		queued[key] = true
+		if a.Aggregate {
+			groups[key] = newAlertGroup(alert, event)
+		}
+		a.fired.record(event, alert)
+		a.record(key, AuditDecisionSent, "queued for alertmanager")
 	}
-
+	if stale > 0 {
+		glog.Infof("dropped %d stale events last seen more than %v ago", stale, a.MaxEventAge)
+	}
+	if rateLimited > 0 {
+		glog.Warningf("dropped %d alerts due to rate limit", rateLimited)
+	}
+	for _, group := range groups {
+		a.finishGroup(group)
+	}
+	// Counted after the loop, so that duplicates later in the batch are
+	// included.
+	for _, alert := range alerts {
+		a.annotateCount(alert)
+	}
+	// Node incidents stay pending until the quiet period is over.
+	if quiet {
+		return nil
+	}
+	for _, alert := range a.nodeIncidents.alerts(a.Cluster) {
+		alert.GeneratorURL = a.renderGeneratorURL(nil)
+		a.applyLabels(alert)
+		alerts = append(alerts, alert)
+	}
+	return alerts
 }
 
 func NewAlertmanagerSink(uri *url.URL) (*AlertmanagerSink, error) {
 	d := &AlertmanagerSink{
-		Level: WARNING,
+		Level:           WARNING,
+		LevelMode:       core.LevelModeAtLeast,
+		BatchSize:       DEFAULT_BATCH_SIZE,
+		DedupKeys:       DefaultDedupKeys,
+		DedupTTL:        DEDUP_WINDOW,
+		Timeout:         DEFAULT_TIMEOUT,
+		MaxEventAge:     DEFAULT_MAX_EVENT_AGE,
+		MinCount:        1,
+		MaxRetries:      DEFAULT_MAX_RETRIES,
+		InitialBackoff:  DEFAULT_INITIAL_BACKOFF,
+		RetryDeadline:   DEFAULT_RETRY_DEADLINE,
+		APIVersion:      API_VERSION_V2,
+		AlertnameSource: ALERTNAME_SOURCE_MESSAGE,
+		InstanceFormat:  INSTANCE_FORMAT_NAME,
+		LabelPrecedence: LABEL_PRECEDENCE_EVENT,
+		GroupBy:         GROUP_BY_NAMESPACE,
+		GroupUpper:      true,
+		UserAgent:       version.UserAgent("events"),
+		now:             time.Now,
+		dryRunf:         glog.Infof,
+		coalescer:       newCoalescer(),
 	}
+	d.ctx, d.cancel = context.WithCancel(context.Background())
+	recorderSize := MAX_RECORDER
 	if len(uri.Host) > 0 {
 		d.Endpoint = uri.Host + uri.Path
 	}
+	d.Scheme = SCHEME_HTTP
+	if uri.Scheme == SCHEME_HTTPS {
+		d.Scheme = SCHEME_HTTPS
+	}
 	opts := uri.Query()
+	joinListOptions(opts)
 
-	if len(opts["cluster"]) >= 1 {
-		d.Cluster = opts["cluster"][0]
-	} else {
-		return nil, fmt.Errorf("you must provide cluster name")
+	if uri.Scheme == SCHEME_UNIX {
+		if err := validateSocketPath(uri.Path); err != nil {
+			return nil, err
+		}
+		d.SocketPath = uri.Path
+	}
+
+	if len(opts["scheme"]) >= 1 {
+		switch scheme := opts["scheme"][0]; {
+		case d.SocketPath != "":
+			return nil, fmt.Errorf("scheme can't be used with a unix socket")
+		case scheme == SCHEME_HTTP || scheme == SCHEME_HTTPS:
+			d.Scheme = scheme
+		default:
+			return nil, fmt.Errorf("scheme must be %s or %s, got %q", SCHEME_HTTP, SCHEME_HTTPS, scheme)
+		}
+	}
+
+	tlsConfig, err := newTLSConfig(opts)
+	if err != nil {
+		return nil, err
+	}
+	if tlsConfig != nil {
+		if d.SocketPath != "" {
+			return nil, fmt.Errorf("tls options can't be used with a unix socket")
+		}
+		d.Scheme = SCHEME_HTTPS
+	}
+	if len(opts["timeout"]) >= 1 {
+		timeout, err := time.ParseDuration(opts["timeout"][0])
+		if err != nil || timeout <= 0 {
+			return nil, fmt.Errorf("timeout must be a positive duration, got %q", opts["timeout"][0])
+		}
+		d.Timeout = timeout
+	}
+	if len(opts["proxy_url"]) >= 1 {
+		if d.SocketPath != "" {
+			return nil, fmt.Errorf("proxy_url can't be used with a unix socket")
+		}
+		proxyURL, err := url.Parse(opts["proxy_url"][0])
+		if err != nil || proxyURL.Scheme == "" || proxyURL.Host == "" {
+			return nil, fmt.Errorf("proxy_url must be an absolute URL, got %q", opts["proxy_url"][0])
+		}
+		d.ProxyURL = proxyURL
+	}
+	d.client = newHTTPClient(tlsConfig, d.SocketPath, d.ProxyURL, d.Timeout)
+
+	d.Username, d.Password, d.BearerToken = opts.Get("username"), opts.Get("password"), opts.Get("bearer_token")
+	if d.BearerToken != "" && (d.Username != "" || d.Password != "") {
+		return nil, fmt.Errorf("basic auth and bearer_token can't be used together")
+	}
+	if d.Password != "" && d.Username == "" {
+		return nil, fmt.Errorf("password given without username")
+	}
+	if d.BearerTokenFile = opts.Get("bearer_token_file"); d.BearerTokenFile != "" {
+		if d.BearerToken != "" || d.Username != "" {
+			return nil, fmt.Errorf("bearer_token_file can't be used with bearer_token or basic auth")
+		}
+		if d.tokenFile, err = newTokenFile(d.BearerTokenFile); err != nil {
+			return nil, err
+		}
+	}
+
+	if d.Cluster, err = core.ClusterName(opts, nodeLabel); err != nil {
+		return nil, err
 	}
 
 	if len(opts["level"]) >= 1 {
-		d.Level = getLevel(opts["level"][0])
+		level, err := core.ParseLevel(opts["level"][0])
+		if err != nil {
+			return nil, err
+		}
+		d.Level = level
+	}
+
+	if len(opts["level_mode"]) >= 1 {
+		mode, err := core.ParseLevelMode(opts["level_mode"][0])
+		if err != nil {
+			return nil, err
+		}
+		d.LevelMode = mode
+	}
+
+	// max_alerts_per_post is accepted as an alias of batch_size.
+	if len(opts["batch_size"]) == 0 && len(opts["max_alerts_per_post"]) >= 1 {
+		opts["batch_size"] = opts["max_alerts_per_post"]
+	}
+	if len(opts["batch_size"]) >= 1 {
+		batchSize, err := strconv.Atoi(opts["batch_size"][0])
+		if err != nil || batchSize <= 0 {
+			return nil, fmt.Errorf("batch_size must be a positive integer, got %q", opts["batch_size"][0])
+		}
+		d.BatchSize = batchSize
+	}
+
+	// dedup_cache_size is accepted as an alias of recorder_size.
+	if len(opts["recorder_size"]) == 0 && len(opts["dedup_cache_size"]) >= 1 {
+		opts["recorder_size"] = opts["dedup_cache_size"]
+	}
+	if len(opts["recorder_size"]) >= 1 {
+		size, err := strconv.Atoi(opts["recorder_size"][0])
+		if err != nil || size <= 0 {
+			return nil, fmt.Errorf("recorder_size must be a positive integer, got %q", opts["recorder_size"][0])
+		}
+		recorderSize = size
+	}
+	d.recorderSize = recorderSize
+	// Locked, as keepForRetry records keys outside of mu.
+	d.recorder = inmem.NewLocked(recorderSize)
+	glog.Infof("Alertmanager dedup cache holds up to %d entries, about %d KB", recorderSize, recorderSize*recorderEntryBytes/1024)
+
+	if len(opts["max_retries"]) >= 1 {
+		retries, err := strconv.Atoi(opts["max_retries"][0])
+		if err != nil || retries < 0 {
+			return nil, fmt.Errorf("max_retries must be a non-negative integer, got %q", opts["max_retries"][0])
+		}
+		d.MaxRetries = retries
+	}
+
+	if len(opts["initial_backoff"]) >= 1 {
+		backoff, err := time.ParseDuration(opts["initial_backoff"][0])
+		if err != nil || backoff <= 0 {
+			return nil, fmt.Errorf("initial_backoff must be a positive duration, got %q", opts["initial_backoff"][0])
+		}
+		d.InitialBackoff = backoff
+	}
+
+	if len(opts["retry_deadline"]) >= 1 {
+		deadline, err := time.ParseDuration(opts["retry_deadline"][0])
+		if err != nil || deadline <= 0 {
+			return nil, fmt.Errorf("retry_deadline must be a positive duration, got %q", opts["retry_deadline"][0])
+		}
+		d.RetryDeadline = deadline
+	}
+
+	if len(opts["dedup_ttl"]) >= 1 {
+		ttl, err := time.ParseDuration(opts["dedup_ttl"][0])
+		if err != nil || ttl <= 0 {
+			return nil, fmt.Errorf("dedup_ttl must be a positive duration, got %q", opts["dedup_ttl"][0])
+		}
+		d.DedupTTL = ttl
+	}
+
+	if len(opts["dedup_jitter"]) >= 1 {
+		jitter, err := time.ParseDuration(opts["dedup_jitter"][0])
+		if err != nil || jitter < 0 || jitter >= d.DedupTTL {
+			return nil, fmt.Errorf("dedup_jitter must be a non-negative duration below %v, got %q", d.DedupTTL, opts["dedup_jitter"][0])
+		}
+		d.DedupJitter = jitter
+	}
+
+	// dedup_key is accepted as an alias of dedup_keys.
+	if len(opts["dedup_keys"]) == 0 && len(opts["dedup_key"]) >= 1 {
+		opts["dedup_keys"] = opts["dedup_key"]
+	}
+	if len(opts["dedup_keys"]) >= 1 {
+		dedupKeys, err := parseDedupKeys(opts["dedup_keys"][0])
+		if err != nil {
+			return nil, err
+		}
+		d.DedupKeys = dedupKeys
+	}
+
+	// apiVersion is accepted as an alias of api_version.
+	if len(opts["api_version"]) == 0 && len(opts["apiVersion"]) >= 1 {
+		opts["api_version"] = opts["apiVersion"]
+	}
+	if len(opts["api_version"]) >= 1 {
+		apiVersion, err := parseAPIVersion(opts["api_version"][0])
+		if err != nil {
+			return nil, err
+		}
+		d.APIVersion = apiVersion
+	} else if d.SocketPath == "" && strings.HasPrefix(uri.Path, "/api/v1/") {
+		// Uris pointing at the v1 endpoint keep working as before the
+		// default changed to v2.
+		d.APIVersion = API_VERSION_V1
+	}
+
+	// Unless the uri has a path, or over a unix socket where it names the
+	// socket, the API path is derived from the API version unless given.
+	path := fmt.Sprintf("/api/%s/alerts", d.APIVersion)
+	if len(opts["path"]) >= 1 && opts["path"][0] != "" {
+		path = opts["path"][0]
+	}
+	if d.SocketPath != "" || uri.Path == "" || uri.Path == "/" {
+		host := uri.Host
+		if d.SocketPath != "" {
+			host = UNIX_SOCKET_HOST
+		}
+		d.Endpoint = host + path
+	}
+
+	// Further replicas of an alertmanager cluster are given as endpoints.
+	if uri.Host != "" || d.SocketPath != "" {
+		d.Endpoints = []string{d.Endpoint}
+	}
+	if len(opts["endpoints"]) >= 1 {
+		if d.SocketPath != "" {
+			return nil, fmt.Errorf("endpoints can't be used with a unix socket")
+		}
+		for _, endpoint := range strings.Split(opts["endpoints"][0], ",") {
+			endpoint = strings.TrimSpace(endpoint)
+			if endpoint == "" {
+				continue
+			}
+			if !strings.Contains(endpoint, "/") {
+				endpoint += path
+			}
+			d.Endpoints = append(d.Endpoints, endpoint)
+		}
+	}
+	if len(d.Endpoints) == 0 {
+		return nil, fmt.Errorf("you must provide the alertmanager host or endpoints")
+	}
+	d.Endpoint = d.Endpoints[0]
+
+	limiter, err := newRateLimiter(d, opts)
+	if err != nil {
+		return nil, err
+	}
+	d.limiter = limiter
+
+	if len(opts["send_resolved"]) >= 1 {
+		sendResolved, err := strconv.ParseBool(opts["send_resolved"][0])
+		if err != nil {
+			return nil, fmt.Errorf("send_resolved must be a boolean, got %q", opts["send_resolved"][0])
+		}
+		if sendResolved && d.APIVersion != API_VERSION_V2 {
+			return nil, fmt.Errorf("send_resolved requires api_version %s", API_VERSION_V2)
+		}
+		d.SendResolved = sendResolved
+		if sendResolved {
+			d.fired = newFiredAlerts(recorderSize)
+		}
+	}
+
+	if len(opts["alertname_source"]) >= 1 {
+		switch source := opts["alertname_source"][0]; source {
+		case ALERTNAME_SOURCE_MESSAGE, ALERTNAME_SOURCE_REASON:
+			d.AlertnameSource = source
+		default:
+			return nil, fmt.Errorf("alertname_source must be %s or %s, got %q", ALERTNAME_SOURCE_MESSAGE, ALERTNAME_SOURCE_REASON, source)
+		}
+	}
+
+	if len(opts["generator_url"]) >= 1 {
+		d.GeneratorURL = opts["generator_url"][0]
+		if strings.Contains(d.GeneratorURL, "{{") {
+			tmpl, err := template.New("generator_url").Parse(d.GeneratorURL)
+			if err != nil {
+				return nil, fmt.Errorf("invalid generator_url template: %v", err)
+			}
+			d.generatorURL = tmpl
+		}
+	}
+
+	if len(opts["resolve_timeout"]) >= 1 {
+		timeout, err := time.ParseDuration(opts["resolve_timeout"][0])
+		if err != nil || timeout < 0 {
+			return nil, fmt.Errorf("resolve_timeout must be a non-negative duration, got %q", opts["resolve_timeout"][0])
+		}
+		d.ResolveTimeout = timeout
+	}
+
+	if len(opts["silence_windows"]) >= 1 {
+		location := time.UTC
+		if len(opts["timezone"]) >= 1 {
+			if location, err = time.LoadLocation(opts["timezone"][0]); err != nil {
+				return nil, fmt.Errorf("timezone must be a time zone name like Asia/Shanghai, got %q: %v", opts["timezone"][0], err)
+			}
+		}
+		if d.silences, err = parseSilenceWindows(opts["silence_windows"], location); err != nil {
+			return nil, err
+		}
+	} else if len(opts["timezone"]) >= 1 {
+		return nil, fmt.Errorf("timezone can only be used with silence_windows")
+	}
+
+	if len(opts["aggregate"]) >= 1 {
+		aggregate, err := strconv.ParseBool(opts["aggregate"][0])
+		if err != nil {
+			return nil, fmt.Errorf("aggregate must be a boolean, got %q", opts["aggregate"][0])
+		}
+		d.Aggregate = aggregate
+	}
+
+	if len(opts["min_count"]) >= 1 {
+		minCount, err := strconv.Atoi(opts["min_count"][0])
+		if err != nil || minCount < 1 {
+			return nil, fmt.Errorf("min_count must be a positive integer, got %q", opts["min_count"][0])
+		}
+		d.MinCount = minCount
+	}
+
+	if len(opts["max_event_age"]) >= 1 {
+		age, err := time.ParseDuration(opts["max_event_age"][0])
+		if err != nil || age < 0 {
+			return nil, fmt.Errorf("max_event_age must be a non-negative duration, got %q", opts["max_event_age"][0])
+		}
+		d.MaxEventAge = age
+	}
+
+	// compression is accepted as an alias of compress.
+	if len(opts["compress"]) == 0 && len(opts["compression"]) >= 1 {
+		opts["compress"] = opts["compression"]
+	}
+	if len(opts["compress"]) >= 1 {
+		compression, err := parseCompression(opts["compress"][0])
+		if err != nil {
+			return nil, err
+		}
+		d.Compression = compression
+	}
+
+	if len(opts["user_agent"]) >= 1 && opts["user_agent"][0] != "" {
+		d.UserAgent = opts["user_agent"][0]
+	}
+
+	if len(opts["dry_run"]) >= 1 {
+		dryRun, err := strconv.ParseBool(opts["dry_run"][0])
+		if err != nil {
+			return nil, fmt.Errorf("dry_run must be a boolean, got %q", opts["dry_run"][0])
+		}
+		d.DryRun = dryRun
+	}
+
+	if len(opts["instance"]) >= 1 {
+		d.Instance = opts["instance"][0]
+	}
+
+	if len(opts["instance_format"]) >= 1 {
+		switch format := opts["instance_format"][0]; format {
+		case INSTANCE_FORMAT_NAME, INSTANCE_FORMAT_KIND_NAME:
+			d.InstanceFormat = format
+		default:
+			return nil, fmt.Errorf("instance_format must be %s or %s, got %q", INSTANCE_FORMAT_NAME, INSTANCE_FORMAT_KIND_NAME, format)
+		}
+	}
+
+	if len(opts["cold_start_quiet"]) >= 1 {
+		quiet, err := time.ParseDuration(opts["cold_start_quiet"][0])
+		if err != nil || quiet < 0 {
+			return nil, fmt.Errorf("cold_start_quiet must be a non-negative duration, got %q", opts["cold_start_quiet"][0])
+		}
+		d.ColdStartQuiet = quiet
+		if quiet > 0 {
+			d.quietUntil = d.now().Add(quiet)
+		}
+	}
+
+	if len(opts["namespaces"]) >= 1 && len(opts["exclude_namespaces"]) >= 1 {
+		return nil, fmt.Errorf("namespaces and exclude_namespaces can't be used together")
+	}
+	if len(opts["namespaces"]) >= 1 {
+		if d.namespaceFilter, err = newNamespaceFilter("namespaces", opts["namespaces"][0], false); err != nil {
+			return nil, err
+		}
+	}
+	if len(opts["exclude_namespaces"]) >= 1 {
+		if d.namespaceFilter, err = newNamespaceFilter("exclude_namespaces", opts["exclude_namespaces"][0], true); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(opts["label_include"]) >= 1 || len(opts["label_exclude"]) >= 1 {
+		filter, err := newLabelFilter(opts.Get("label_include"), opts.Get("label_exclude"))
+		if err != nil {
+			return nil, err
+		}
+		d.labelFilter = filter
+	}
+
+	if d.LabelTemplates, err = parseFieldTemplates("label_template", opts["label_template"]); err != nil {
+		return nil, err
+	}
+	if d.AnnotationTemplates, err = parseFieldTemplates("annotation_template", opts["annotation_template"]); err != nil {
+		return nil, err
+	}
+
+	if len(opts["label"]) >= 1 {
+		labels, err := parseStaticLabels(opts["label"])
+		if err != nil {
+			return nil, err
+		}
+		d.StaticLabels = labels
+	}
+
+	if len(opts["label_precedence"]) >= 1 {
+		precedence, err := parseLabelPrecedence(opts["label_precedence"][0])
+		if err != nil {
+			return nil, err
+		}
+		d.LabelPrecedence = precedence
+	}
+
+	if len(opts["group_by"]) >= 1 {
+		groupBy, err := parseGroupBy(opts["group_by"][0])
+		if err != nil {
+			return nil, err
+		}
+		d.GroupBy = groupBy
+	}
+
+	if len(opts["group_upper"]) >= 1 {
+		upper, err := strconv.ParseBool(opts["group_upper"][0])
+		if err != nil {
+			return nil, fmt.Errorf("group_upper must be a boolean, got %q", opts["group_upper"][0])
+		}
+		d.GroupUpper = upper
+	}
+
+	labelNames, err := parseLabelNames(opts)
+	if err != nil {
+		return nil, err
+	}
+	d.labelNames = labelNames
+
+	if len(opts["template"]) >= 1 && opts["template"][0] != "" {
+		tmpl, err := template.New("alert").Parse(opts["template"][0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid alert template: %v", err)
+		}
+		d.Template = tmpl
+	}
+
+	if len(opts["node_incident_window"]) >= 1 {
+		window, err := time.ParseDuration(opts["node_incident_window"][0])
+		if err != nil || window <= 0 {
+			return nil, fmt.Errorf("node_incident_window must be a positive duration, got %q", opts["node_incident_window"][0])
+		}
+		reasons := DefaultNodeIncidentReasons
+		if len(opts["node_incident_reasons"]) >= 1 {
+			reasons = strings.Split(opts["node_incident_reasons"][0], ",")
+		}
+		d.nodeIncidents = newNodeIncidents(window, reasons)
+	}
+
+	ignoreReasons, err := parseIgnoreReasons(opts)
+	if err != nil {
+		return nil, err
+	}
+	d.IgnoreReasons = ignoreReasons
+	if d.IgnoreMessageRegexps, err = parseRegexps(opts, "ignore_message_regex"); err != nil {
+		return nil, err
+	}
+	if d.IgnoreReasonRegexps, err = parseRegexps(opts, "ignore_reason_regex"); err != nil {
+		return nil, err
+	}
+
+	if len(opts["heartbeat"]) >= 1 {
+		heartbeat, err := time.ParseDuration(opts["heartbeat"][0])
+		if err != nil || heartbeat < 0 {
+			return nil, fmt.Errorf("heartbeat must be a non-negative duration, got %q", opts["heartbeat"][0])
+		}
+		d.Heartbeat = heartbeat
 	}
 
+	if len(opts["auditLog"]) >= 1 && opts["auditLog"][0] != "" {
+		audit, err := newAuditLogger(ALERTMANAGER_SINK, opts["auditLog"][0])
+		if err != nil {
+			return nil, fmt.Errorf("failed to open audit log: %v", err)
+		}
+		d.audit = audit
+	}
+
+	// Started last, so that no goroutine is left behind by a failed build.
+	if d.Heartbeat > 0 {
+		d.workers.Add(1)
+		go d.runHeartbeat(d.Heartbeat)
+	}
+	d.workers.Add(1)
+	go d.runCoalescer()
+
 	return d, nil
 }
 
+// dedupKey returns the key of the event in the dedup recorder: its group
+// with Aggregate, DedupKeys otherwise.
+func (a *AlertmanagerSink) dedupKey(event *v1.Event) string {
+	if a.Aggregate {
+		return generateKey(aggregateKeyFields, event)
+	}
+	return generateKey(a.DedupKeys, event)
+}
+
+// lastSeen returns when the event was last seen, falling back to its event
+// time and then to when it was first seen. It is zero if none is set.
+func lastSeen(event *v1.Event) time.Time {
+	if !event.LastTimestamp.IsZero() {
+		return event.LastTimestamp.Time
+	}
+	if !event.EventTime.IsZero() {
+		return event.EventTime.Time
+	}
+	return event.FirstTimestamp.Time
+}
+
+// eventCount returns how often the event occurred, taking the series of
+// newer API servers into account. Events without a count occurred once.
+func eventCount(event *v1.Event) int {
+	count := event.Count
+	if event.Series != nil && event.Series.Count > count {
+		count = event.Series.Count
+	}
+	if count < 1 {
+		return 1
+	}
+	return int(count)
+}
+
+// isStale tells whether the event was last seen longer than MaxEventAge
+// ago. Events without timestamps are never stale.
+func (a *AlertmanagerSink) isStale(event *v1.Event) bool {
+	seen := lastSeen(event)
+	return a.MaxEventAge > 0 && !seen.IsZero() && a.now().Sub(seen) > a.MaxEventAge
+}
+
 func (a *AlertmanagerSink) isEventLevelDangerous(level string) bool {
-	score := getLevel(level)
-	if score >= a.Level {
+	return core.IsLevelMatching(level, a.Level, a.LevelMode)
+}
+
+// inQuietPeriod tells whether the sink is still in its cold start quiet
+// period, logging once when the period is over.
+func (a *AlertmanagerSink) inQuietPeriod() bool {
+	if a.quietUntil.IsZero() {
+		return false
+	}
+	if a.now().Before(a.quietUntil) {
 		return true
 	}
+	glog.Infof("alertmanager cold start quiet period of %v ended, sending alerts", a.ColdStartQuiet)
+	a.quietUntil = time.Time{}
 	return false
 }
 
+// parseIgnoreReasons returns the event reasons to ignore: the defaults
+// unless nodefaults is set, plus the comma separated ignore_reasons. An
+// empty ignore_reasons ignores nothing at all.
+func parseIgnoreReasons(opts url.Values) (map[string]bool, error) {
+	reasons := make(map[string]bool)
+	noDefaults := false
+	if len(opts["nodefaults"]) >= 1 {
+		var err error
+		noDefaults, err = strconv.ParseBool(opts["nodefaults"][0])
+		if err != nil {
+			return nil, fmt.Errorf("nodefaults must be a boolean, got %q", opts["nodefaults"][0])
+		}
+	}
+	if !noDefaults {
+		for _, reason := range DefaultIgnoreReasons {
+			reasons[reason] = true
+		}
+	}
+	if len(opts["ignore_reasons"]) >= 1 {
+		value := strings.TrimSpace(opts["ignore_reasons"][0])
+		if value == "" {
+			return map[string]bool{}, nil
+		}
+		for _, reason := range strings.Split(value, ",") {
+			if reason = strings.TrimSpace(reason); reason != "" {
+				reasons[reason] = true
+			}
+		}
+	}
+	return reasons, nil
+}
+
+// listOptions hold comma-separated lists. They may also be repeated, as
+// lists in sink config files are, e.g. endpoints=am-0:9093&endpoints=am-1:9093.
+var listOptions = []string{"endpoints", "dedup_keys", "dedup_key", "namespaces", "exclude_namespaces",
+	"node_incident_reasons", "ignore_reasons", "label_include", "label_exclude"}
+
+// joinListOptions joins the repeated values of list options with commas.
+func joinListOptions(opts url.Values) {
+	for _, name := range listOptions {
+		if len(opts[name]) > 1 {
+			opts[name] = []string{strings.Join(opts[name], ",")}
+		}
+	}
+}
+
+// parseRegexps compiles every value of the repeatable option name.
+func parseRegexps(opts url.Values, name string) ([]*regexp.Regexp, error) {
+	var res []*regexp.Regexp
+	for _, pattern := range opts[name] {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("%s must be a valid regular expression, got %q: %v", name, pattern, err)
+		}
+		res = append(res, re)
+	}
+	return res, nil
+}
+
 func (a *AlertmanagerSink) isIgnoreAlert(event *v1.Event) bool {
-	var ignore = false
-	for _, v := range ignoreAlerts {
-		if event.Reason == v {
-			ignore = true
-			continue
+	return a.IgnoreReasons[event.Reason] ||
+		matchesAny(a.IgnoreReasonRegexps, event.Reason) ||
+		matchesAny(a.IgnoreMessageRegexps, event.Message)
+}
+
+func matchesAny(res []*regexp.Regexp, s string) bool {
+	for _, re := range res {
+		if re.MatchString(s) {
+			return true
 		}
 	}
-	return ignore
+	return false
 }
 
-func (a *AlertmanagerSink) isFirstAlertAt5Min(event *v1.Event) bool {
-	var ignore = false
+// Send posts alerts to alertmanager in chunks of at most BatchSize alerts.
+// A failed chunk does not prevent the remaining chunks from being sent; all
+// chunk errors are aggregated into the returned error.
+func (a *AlertmanagerSink) Send(alerts []*Alert) error {
+	return a.SendContext(a.ctx, alerts)
+}
+
+// SendContext is like Send, but stops sending once ctx is done or the sink
+// is stopped.
+func (a *AlertmanagerSink) SendContext(ctx context.Context, alerts []*Alert) (err error) {
+	ctx, span := tracing.StartSpan(ctx, "alertmanager.send")
+	span.SetAttribute("alerts", len(alerts))
+	defer func() { span.Finish(err) }()
 
-	if event.Reason == "" {
-		ignore = true
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-a.ctx.Done():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	var errs []error
+	succeeded, sent := 0, 0
+	for start := 0; start < len(alerts); start += a.BatchSize {
+		if err := ctx.Err(); err != nil {
+			errs = append(errs, err)
+			break
+		}
+		a.mu.Lock()
+		wait := a.retryAt.Sub(a.now())
+		a.mu.Unlock()
+		if wait > 0 {
+			glog.Warningf("alertmanager asked to back off, not sending %d alert(s) for another %v", len(alerts)-start, wait)
+			a.keepForRetry(alerts[start:])
+			errs = append(errs, fmt.Errorf("backing off for %v as asked by alertmanager", wait))
+			break
+		}
+		end := start + a.BatchSize
+		if end > len(alerts) {
+			end = len(alerts)
+		}
+		chunkStart := time.Now()
+		err := a.sendChunkWithRetry(ctx, alerts[start:end])
+		sendDuration.WithLabelValues(a.Cluster).Observe(time.Since(chunkStart).Seconds())
+		if err != nil {
+			if throttled, ok := err.(*throttledError); ok {
+				glog.Warningf("alertmanager throttled %d alert(s): %v", end-start, throttled)
+				a.keepForRetry(alerts[start:end])
+				if throttled.retryAfter > 0 {
+					a.mu.Lock()
+					a.retryAt = a.now().Add(throttled.retryAfter)
+					a.mu.Unlock()
+				}
+			}
+			glog.Warningf("alert chunk %d-%d of %d failed: %v", start+1, end, len(alerts), err)
+			errs = append(errs, err)
+			continue
+		}
+		glog.V(2).Infof("alert chunk %d-%d of %d sent", start+1, end, len(alerts))
+		succeeded++
+		sent += end - start
+	}
+	if a.DryRun {
+		alertsDryRun.WithLabelValues(a.Cluster).Add(float64(sent))
+	} else {
+		alertsSent.WithLabelValues(a.Cluster).Add(float64(sent))
+	}
+	if sent < len(alerts) {
+		alertsSendFailures.WithLabelValues(a.Cluster).Add(float64(len(alerts) - sent))
 	}
 
-	return ignore
+	glog.Infof("alert send finished: %d chunk(s) succeeded, %d chunk(s) failed", succeeded, len(errs))
+	span.SetAttribute("chunks_succeeded", succeeded)
+	span.SetAttribute("chunks_failed", len(errs))
+	return utilerrors.NewAggregate(errs)
 }
 
-func getLevel(level string) int {
-	score := 0
-	switch level {
-	case v1.EventTypeWarning:
-		score += 2
-	case v1.EventTypeNormal:
-		score += 1
-	default:
-		//score will remain 0
+// keepForRetry makes sure the next occurrence of the events behind alerts
+// that weren't accepted is sent, rather than suppressed as a repeat.
+func (a *AlertmanagerSink) keepForRetry(alerts []*Alert) {
+	for _, alert := range alerts {
+		if alert.dedupKey != "" {
+			a.recorder.Remove(alert.dedupKey)
+		}
 	}
-	return score
 }
 
-func (a *AlertmanagerSink) Send(alerts []*Alert) {
+// dedupExpiry returns when a dedup key recorded now expires. The recorder
+// checks expiry against the wall clock, so a.now isn't used.
+func (a *AlertmanagerSink) dedupExpiry() time.Time {
+	window := a.DedupTTL
+	if a.DedupJitter > 0 {
+		window += time.Duration(rand.Int63n(int64(2*a.DedupJitter)+1)) - a.DedupJitter
+	}
+	return time.Now().Add(window)
+}
 
-	alert_bytes, err := json.Marshal(alerts)
+// buildAlert creates the alert for an event and applies the sink options to it.
+func (a *AlertmanagerSink) buildAlert(event *v1.Event) (*Alert, error) {
+	alert, err := createAlertFromEvent(a.Cluster, a.AlertnameSource, event)
 	if err != nil {
-		glog.Warningf("failed to marshal alert %v", alerts)
+		return nil, err
+	}
+	alert.GeneratorURL = a.renderGeneratorURL(event)
+	if a.ResolveTimeout > 0 {
+		// Based on when the event was last seen rather than StartsAt, so
+		// that long recurring events aren't resolved right away.
+		lastSeen := event.LastTimestamp.Time
+		if lastSeen.IsZero() {
+			lastSeen = alert.StartsAt
+		}
+		if !lastSeen.IsZero() {
+			alert.EndsAt = lastSeen.Add(a.ResolveTimeout)
+		}
+	}
+	setGroupLabel(alert, event, a.GroupBy, a.GroupUpper)
+	a.applyTemplate(alert, event)
+	a.applyInstance(alert, event)
+	a.applyLabels(alert)
+	// Applied last, as templated fields are asked for explicitly.
+	renderFieldTemplates(a.LabelTemplates, event, func(name, value string) { alert.Labels[name] = value })
+	renderFieldTemplates(a.AnnotationTemplates, event, func(name, value string) { setAnnotation(alert, name, value) })
+	return alert, nil
+}
+
+// renderGeneratorURL returns the generator URL of the alert for event, or of
+// an alert not created from a single event if event is nil. Such alerts get
+// no generator URL if it is a template.
+func (a *AlertmanagerSink) renderGeneratorURL(event *v1.Event) string {
+	if a.generatorURL == nil {
+		return a.GeneratorURL
+	}
+	if event == nil {
+		return ""
+	}
+	var buf bytes.Buffer
+	if err := a.generatorURL.Execute(&buf, event); err != nil {
+		glog.Warningf("failed to render generator_url for event %s/%s: %v", event.Namespace, event.Name, err)
+		return ""
+	}
+	return buf.String()
+}
+
+// applyLabels filters the generated labels, renames them as configured and
+// adds the static labels. The filter refers to the labels by their default
+// names, static labels are neither filtered nor renamed.
+func (a *AlertmanagerSink) applyLabels(alert *Alert) {
+	a.labelFilter.apply(alert)
+	renameLabels(alert, a.labelNames)
+	mergeStaticLabels(alert, a.StaticLabels, a.LabelPrecedence)
+}
+
+// applyInstance overrides the instance label with the configured static
+// value, keeping the event name as an annotation.
+func (a *AlertmanagerSink) applyInstance(alert *Alert, event *v1.Event) {
+	if a.Instance == "" {
+		if a.InstanceFormat == INSTANCE_FORMAT_KIND_NAME && event.InvolvedObject.Kind != "" && event.InvolvedObject.Name != "" {
+			alert.Labels[AlertInstanceLabel] = event.InvolvedObject.Kind + "/" + event.InvolvedObject.Name
+		}
 		return
 	}
+	alert.Labels[AlertInstanceLabel] = a.Instance
+	if event.Name != "" {
+		setAnnotation(alert, AlertEventNameAnnotation, event.Name)
+	}
+}
 
-	b := bytes.NewBuffer(alert_bytes)
+func setAnnotation(alert *Alert, key, value string) {
+	if alert.Annotations == nil {
+		alert.Annotations = make(map[string]string)
+	}
+	alert.Annotations[key] = value
+}
 
-	_, err = http.Post(fmt.Sprintf("http://%s", a.Endpoint), CONTENT_TYPE_JSON, b)
-	if err != nil {
-		glog.Errorf("failed to send msg to alertmanager,because of %s", err.Error())
+// applyTemplate replaces the alert text with the rendered template, if one is
+// configured. The alert keeps the event message if rendering fails. Alerts
+// named after the event reason keep their name.
+func (a *AlertmanagerSink) applyTemplate(alert *Alert, event *v1.Event) {
+	if a.Template == nil {
 		return
 	}
+	var buf bytes.Buffer
+	if err := a.Template.Execute(&buf, event); err != nil {
+		glog.Warningf("failed to render alert template for event %s/%s: %v", event.Namespace, event.Name, err)
+		return
+	}
+	text := buf.String()
+	if a.AlertnameSource == ALERTNAME_SOURCE_MESSAGE {
+		alert.Labels[AlertNameLabel] = text
+	}
+	setAnnotation(alert, AlertMessageAnnotation, text)
+}
 
-	glog.Infof("alert send success: %v", alerts)
+// HealthCheck queries the status endpoint of every alertmanager replica and
+// succeeds if any of them is healthy, as alerts are sent as long as one
+// replica accepts them.
+func (a *AlertmanagerSink) HealthCheck() error {
+	var errs []error
+	for _, endpoint := range a.Endpoints {
+		err := a.checkEndpoint(endpoint)
+		if err == nil {
+			return nil
+		}
+		errs = append(errs, fmt.Errorf("%s: %v", endpoint, err))
+	}
+	return utilerrors.NewAggregate(errs)
 }
 
-func createAlertFromEvent(cluster string, event *v1.Event) (*Alert, error) {
+func (a *AlertmanagerSink) checkEndpoint(endpoint string) error {
+	host := endpoint
+	if i := strings.Index(host, "/"); i >= 0 {
+		host = host[:i]
+	}
+	client := &http.Client{Timeout: HEALTH_CHECK_TIMEOUT, Transport: a.client.Transport}
+	req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("%s://%s/api/%s/status", a.Scheme, host, a.APIVersion), nil)
+	if err != nil {
+		return err
+	}
+	a.setHeaders(req)
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("alertmanager status endpoint returned %s", resp.Status)
+	}
+	return nil
+}
+
+// createAlertFromEvent creates the alert for an event, named after the
+// event field given by alertnameSource, falling back to the other field if
+// that is empty. The message is kept as an annotation.
+func createAlertFromEvent(cluster, alertnameSource string, event *v1.Event) (*Alert, error) {
 	labels := make(map[string]string)
-	if event.Message != "" {
-		labels[AlertNameLabel] = event.Message
-	} else {
+	name, fallback := event.Message, event.Reason
+	if alertnameSource == ALERTNAME_SOURCE_REASON {
+		name, fallback = event.Reason, event.Message
+	}
+	if name == "" {
+		name = fallback
+	}
+	if name == "" {
 		return nil, NotVaildAlertName
 	}
+	labels[AlertNameLabel] = name
 
 	if event.Namespace != "" {
 		labels[AlertGroupLabel] = strings.ToUpper(event.Namespace)
@@ -202,15 +1358,50 @@ func createAlertFromEvent(cluster string, event *v1.Event) (*Alert, error) {
 		labels[AlertReasonLabel] = event.Reason
 	}
 
+	// Newer API servers report the source in the reporting fields instead.
+	component, host := event.Source.Component, event.Source.Host
+	if component == "" {
+		component = event.ReportingController
+	}
+	if host == "" {
+		host = event.ReportingInstance
+	}
+
+	object := event.InvolvedObject
+	for label, value := range map[string]string{
+		AlertKindLabel:            object.Kind,
+		AlertObjectNamespaceLabel: object.Namespace,
+		AlertObjectNameLabel:      object.Name,
+		AlertFieldPathLabel:       object.FieldPath,
+		AlertComponentLabel:       component,
+		AlertHostLabel:            host,
+	} {
+		if value != "" {
+			labels[label] = value
+		}
+	}
+
 	labels[AlertClusterLabel] = cluster
 
 	alert := &Alert{
-		Labels: labels,
+		Labels:   labels,
+		StartsAt: event.FirstTimestamp.Time,
+	}
+	if event.Message != "" {
+		setAnnotation(alert, AlertMessageAnnotation, event.Message)
+	}
+	if event.Count > 0 || event.Series != nil {
+		setAnnotation(alert, AlertCountAnnotation, strconv.Itoa(eventCount(event)))
+	}
+	if !event.FirstTimestamp.IsZero() {
+		setAnnotation(alert, AlertFirstSeenAnnotation, event.FirstTimestamp.UTC().Format(time.RFC3339))
+	}
+	if !event.LastTimestamp.IsZero() {
+		setAnnotation(alert, AlertLastSeenAnnotation, event.LastTimestamp.UTC().Format(time.RFC3339))
+	}
+	if alert.StartsAt.IsZero() {
+		alert.StartsAt = event.LastTimestamp.Time
 	}
 
 	return alert, nil
 }
-
-func generateKey(event *v1.Event) string {
-	return fmt.Sprintf(MSG_RECORDER_KEY_TEMPLATE, event.Type, event.Namespace, event.Name, event.Message, event.Reason)
-}
@@ -0,0 +1,699 @@
+// Copyright 2018 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package alertmanager
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/heapster/events/core"
+)
+
+// fakeAlertmanager records every alert chunk posted to it.
+type fakeAlertmanager struct {
+	sync.Mutex
+	server *httptest.Server
+	chunks [][]*Alert
+}
+
+func newFakeAlertmanager(handler func(w http.ResponseWriter, alerts []*Alert)) *fakeAlertmanager {
+	f := &fakeAlertmanager{}
+	f.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var alerts []*Alert
+		if err := json.NewDecoder(r.Body).Decode(&alerts); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		f.Lock()
+		f.chunks = append(f.chunks, alerts)
+		f.Unlock()
+		if handler != nil {
+			handler(w, alerts)
+		}
+	}))
+	return f
+}
+
+func (f *fakeAlertmanager) host() string {
+	return strings.TrimPrefix(f.server.URL, "http://")
+}
+
+func (f *fakeAlertmanager) received() [][]*Alert {
+	f.Lock()
+	defer f.Unlock()
+	return f.chunks
+}
+
+func newTestSink(t *testing.T, endpoint string, query string) *AlertmanagerSink {
+	uri, err := url.Parse(fmt.Sprintf("http://%s?cluster=test&%s", endpoint, query))
+	assert.NoError(t, err)
+	sink, err := NewAlertmanagerSink(uri)
+	assert.NoError(t, err)
+	return sink
+}
+
+func makeAlerts(n int) []*Alert {
+	alerts := make([]*Alert, 0, n)
+	for i := 0; i < n; i++ {
+		alerts = append(alerts, &Alert{
+			Labels: map[string]string{AlertNameLabel: fmt.Sprintf("alert-%d", i)},
+		})
+	}
+	return alerts
+}
+
+func TestBatchSizeOption(t *testing.T) {
+	sink := newTestSink(t, "localhost:9093", "")
+	assert.Equal(t, DEFAULT_BATCH_SIZE, sink.BatchSize)
+
+	sink = newTestSink(t, "localhost:9093", "batch_size=7")
+	assert.Equal(t, 7, sink.BatchSize)
+
+	for _, invalid := range []string{"0", "-1", "abc"} {
+		uri, _ := url.Parse("http://localhost:9093?cluster=test&batch_size=" + invalid)
+		_, err := NewAlertmanagerSink(uri)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestDedupCacheSize(t *testing.T) {
+	am := newFakeAlertmanager(nil)
+	defer am.server.Close()
+
+	sink := newTestSink(t, am.host(), "dedup_cache_size=1")
+	first := &v1.Event{Type: v1.EventTypeWarning, Reason: "BackOff", Message: "first",
+		InvolvedObject: v1.ObjectReference{Kind: "Pod", Name: "web-0"}}
+	second := &v1.Event{Type: v1.EventTypeWarning, Reason: "BackOff", Message: "second",
+		InvolvedObject: v1.ObjectReference{Kind: "Pod", Name: "web-1"}}
+
+	// The second event evicts the first one, so its repeat is taken for a
+	// first occurrence and sent again.
+	sink.ExportEvents(&core.EventBatch{Events: []*v1.Event{first, second}})
+	sink.ExportEvents(&core.EventBatch{Events: []*v1.Event{first}})
+	assert.Len(t, am.received(), 2)
+	assert.Len(t, am.received()[1], 1)
+	assert.Equal(t, 1, sink.recorder.Len())
+
+	for _, invalid := range []string{"0", "-1", "abc"} {
+		uri, _ := url.Parse("http://localhost:9093?cluster=test&dedup_cache_size=" + invalid)
+		_, err := NewAlertmanagerSink(uri)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestDuplicateEventsInBatchSentOnce(t *testing.T) {
+	am := newFakeAlertmanager(nil)
+	defer am.server.Close()
+
+	sink := newTestSink(t, am.host(), "")
+	event := &v1.Event{Type: v1.EventTypeWarning, Reason: "BackOff", Message: "aggregated",
+		InvolvedObject: v1.ObjectReference{Kind: "Pod", Name: "web-0"}}
+	duplicate := event.DeepCopy()
+
+	assert.NoError(t, sink.ExportEventsWithError(&core.EventBatch{Events: []*v1.Event{event, duplicate, event, duplicate}}))
+	assert.Len(t, am.received(), 1)
+	assert.Len(t, am.received()[0], 1)
+}
+
+func TestIgnoreReasons(t *testing.T) {
+	// The alert names are the messages, which are set to the reasons here.
+	batch := &core.EventBatch{Events: []*v1.Event{
+		podEvent("web-0", "Unhealthy", "Unhealthy"),
+		podEvent("web-0", "FailedScheduling", "FailedScheduling"),
+		podEvent("web-0", "BackOff", "BackOff"),
+	}}
+	for _, tc := range []struct {
+		query    string
+		expected []string
+	}{
+		{"", []string{"FailedScheduling", "BackOff"}},
+		{"ignore_reasons=FailedScheduling,BackOff", []string{}},
+		{"ignore_reasons=BackOff&nodefaults=true", []string{"Unhealthy", "FailedScheduling"}},
+		{"ignore_reasons=", []string{"Unhealthy", "FailedScheduling", "BackOff"}},
+		{"nodefaults=true", []string{"Unhealthy", "FailedScheduling", "BackOff"}},
+	} {
+		am := newFakeAlertmanager(nil)
+		sink := newTestSink(t, am.host(), tc.query)
+		// The first occurrences are only recorded.
+		sink.ExportEvents(batch)
+		sink.ExportEvents(batch)
+
+		reasons := []string{}
+		for _, chunk := range am.received() {
+			for _, alert := range chunk {
+				reasons = append(reasons, alert.Labels[AlertNameLabel])
+			}
+		}
+		assert.Equal(t, tc.expected, reasons, tc.query)
+		am.server.Close()
+	}
+
+	_, err := NewAlertmanagerSink(mustParseURL("http://localhost:9093?cluster=test&nodefaults=maybe"))
+	assert.Error(t, err)
+}
+
+func TestIgnoreRegexps(t *testing.T) {
+	am := newFakeAlertmanager(nil)
+	defer am.server.Close()
+
+	sink := newTestSink(t, am.host(), "nodefaults=true"+
+		"&ignore_message_regex="+url.QueryEscape("Readiness probe failed.*connection refused")+
+		"&ignore_message_regex="+url.QueryEscape("^Liveness")+
+		"&ignore_reason_regex="+url.QueryEscape("^Failed(Mount|Attach)"))
+	assert.Len(t, sink.IgnoreMessageRegexps, 2)
+	assert.Len(t, sink.IgnoreReasonRegexps, 1)
+
+	batch := &core.EventBatch{Events: []*v1.Event{
+		podEvent("web-0", "Unhealthy", "Readiness probe failed: dial tcp 10.0.0.1:80: connection refused"),
+		podEvent("web-1", "Unhealthy", "Liveness probe failed: timeout"),
+		podEvent("web-2", "FailedMount", "MountVolume.SetUp failed"),
+		podEvent("web-3", "FailedAttachVolume", "AttachVolume.Attach failed"),
+		podEvent("web-4", "Unhealthy", "Readiness probe failed: HTTP probe failed with statuscode: 500"),
+	}}
+	// The first occurrences are only recorded.
+	sink.ExportEvents(batch)
+	sink.ExportEvents(batch)
+
+	received := am.received()
+	if assert.Len(t, received, 1) && assert.Len(t, received[0], 1) {
+		assert.Equal(t, "web-4", received[0][0].Labels[AlertObjectNameLabel])
+	}
+
+	for _, invalid := range []string{"ignore_message_regex=(", "ignore_reason_regex=" + url.QueryEscape("[a-")} {
+		_, err := NewAlertmanagerSink(mustParseURL("http://localhost:9093?cluster=test&" + invalid))
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestLevelMode(t *testing.T) {
+	batch := []*v1.Event{
+		{Type: v1.EventTypeWarning, Reason: "BackOff"},
+		{Type: v1.EventTypeNormal, Reason: "Pulled"},
+		{Type: "", Reason: "Unknown"},
+	}
+	forwarded := func(query string) []string {
+		sink := newTestSink(t, "localhost:9093", query)
+		var reasons []string
+		for _, event := range batch {
+			if sink.isEventLevelDangerous(event.Type) {
+				reasons = append(reasons, event.Reason)
+			}
+		}
+		return reasons
+	}
+
+	assert.Equal(t, []string{"BackOff"}, forwarded(""))
+	assert.Equal(t, []string{"BackOff", "Pulled"}, forwarded("level=Normal&level_mode=atleast"))
+	assert.Equal(t, []string{"Pulled"}, forwarded("level=Normal&level_mode=exact"))
+	assert.Equal(t, []string{"BackOff"}, forwarded("level=Warning&level_mode=exact"))
+	assert.Equal(t, []string{"Pulled"}, forwarded("level=Normal&level_mode=atmost"))
+
+	_, err := NewAlertmanagerSink(mustParseURL("http://localhost:9093?cluster=test&level_mode=below"))
+	assert.Error(t, err)
+}
+
+func TestInvalidLevel(t *testing.T) {
+	for _, level := range []string{"Warnig", "warning", "Error"} {
+		_, err := NewAlertmanagerSink(mustParseURL("http://localhost:9093?cluster=test&level=" + level))
+		assert.Error(t, err, level)
+	}
+}
+
+func TestColdStartQuiet(t *testing.T) {
+	am := newFakeAlertmanager(nil)
+	defer am.server.Close()
+
+	sink := newTestSink(t, am.host(), "cold_start_quiet=30s")
+	start := time.Now()
+	now := start.Add(10 * time.Second)
+	sink.now = func() time.Time { return now }
+
+	replayed := &v1.Event{Type: v1.EventTypeWarning, Reason: "BackOff", Message: "replayed"}
+	assert.NoError(t, sink.ExportEventsWithError(&core.EventBatch{Events: []*v1.Event{replayed, replayed}}))
+	assert.Len(t, am.received(), 0)
+
+	// The replayed event was recorded, so it is still deduped after the
+	// quiet period, while new events are sent.
+	now = start.Add(time.Minute)
+	fresh := &v1.Event{Type: v1.EventTypeWarning, Reason: "OOMKilled", Message: "fresh"}
+	assert.NoError(t, sink.ExportEventsWithError(&core.EventBatch{Events: []*v1.Event{replayed, fresh}}))
+	assert.Len(t, am.received(), 1)
+	assert.Len(t, am.received()[0], 1)
+	assert.Equal(t, "fresh", am.received()[0][0].Annotations["message"])
+
+	_, err := NewAlertmanagerSink(mustParseURL("http://localhost:9093?cluster=test&cold_start_quiet=-1s"))
+	assert.Error(t, err)
+}
+
+func TestDryRun(t *testing.T) {
+	am := newFakeAlertmanager(nil)
+	defer am.server.Close()
+
+	sink := newTestSink(t, am.host(), "dry_run=true")
+	assert.True(t, sink.DryRun)
+	assert.Equal(t, "alertmanager_dry_run", sink.Name())
+	var logged []string
+	sink.dryRunf = func(format string, args ...interface{}) {
+		logged = append(logged, fmt.Sprintf(format, args...))
+	}
+	event := &v1.Event{Type: v1.EventTypeWarning, Reason: "BackOff", Message: "dry run",
+		InvolvedObject: v1.ObjectReference{Kind: "Pod", Name: "web-0"}}
+	other := &v1.Event{Type: v1.EventTypeWarning, Reason: "BackOff", Message: "dry run",
+		InvolvedObject: v1.ObjectReference{Kind: "Pod", Name: "web-1"}}
+	batch := &core.EventBatch{Events: []*v1.Event{event, other}}
+	assert.NoError(t, sink.ExportEventsWithError(batch))
+	assert.NoError(t, sink.ExportEventsWithError(batch))
+
+	assert.Len(t, am.received(), 0)
+	// The recorder is updated as if the alerts were sent.
+	assert.Equal(t, 2, sink.recorder.Len())
+	// One line per alert, holding the JSON that would be posted.
+	if assert.Len(t, logged, 2) {
+		assert.Contains(t, logged[0], `"alertname":"dry run"`)
+		assert.Contains(t, logged[0], `"object_name":"web-0"`)
+		assert.Contains(t, logged[1], `"object_name":"web-1"`)
+	}
+
+	_, err := NewAlertmanagerSink(mustParseURL("http://localhost:9093?cluster=test&dry_run=perhaps"))
+	assert.Error(t, err)
+}
+
+func TestSendSplitsIntoChunks(t *testing.T) {
+	am := newFakeAlertmanager(nil)
+	defer am.server.Close()
+
+	sink := newTestSink(t, am.host(), "batch_size=10")
+	assert.NoError(t, sink.Send(makeAlerts(25)))
+
+	chunks := am.received()
+	assert.Len(t, chunks, 3)
+	assert.Len(t, chunks[0], 10)
+	assert.Len(t, chunks[1], 10)
+	assert.Len(t, chunks[2], 5)
+	assert.Equal(t, "alert-24", chunks[2][4].Labels[AlertNameLabel])
+}
+
+func TestMaxAlertsPerPost(t *testing.T) {
+	am := newFakeAlertmanager(nil)
+	defer am.server.Close()
+
+	sink := newTestSink(t, am.host(), "max_alerts_per_post=64")
+	assert.Equal(t, 64, sink.BatchSize)
+	assert.NoError(t, sink.Send(makeAlerts(200)))
+
+	chunks := am.received()
+	assert.Len(t, chunks, 4)
+	received := 0
+	for i, chunk := range chunks {
+		for j, alert := range chunk {
+			assert.Equal(t, fmt.Sprintf("alert-%d", i*64+j), alert.Labels[AlertNameLabel])
+		}
+		received += len(chunk)
+	}
+	assert.Equal(t, 200, received)
+	assert.Len(t, chunks[3], 8)
+
+	// batch_size wins if both are given.
+	sink = newTestSink(t, am.host(), "max_alerts_per_post=64&batch_size=10")
+	assert.Equal(t, 10, sink.BatchSize)
+	_, err := NewAlertmanagerSink(mustParseURL("http://localhost:9093?cluster=test&max_alerts_per_post=0"))
+	assert.Error(t, err)
+}
+
+func TestSendContinuesAfterFailedChunk(t *testing.T) {
+	am := newFakeAlertmanager(nil)
+	am.server.Close()
+
+	sink := newTestSink(t, am.host(), "batch_size=2&max_retries=0")
+	err := sink.Send(makeAlerts(5))
+	assert.Error(t, err)
+	// Every chunk is attempted and reported even though each one fails.
+	agg, ok := err.(utilerrors.Aggregate)
+	assert.True(t, ok)
+	assert.Len(t, agg.Errors(), 3)
+}
+
+func readAuditLog(t *testing.T, path string) []auditRecord {
+	data, err := ioutil.ReadFile(path)
+	assert.NoError(t, err)
+	var records []auditRecord
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		var record auditRecord
+		assert.NoError(t, json.Unmarshal([]byte(line), &record))
+		records = append(records, record)
+	}
+	return records
+}
+
+func TestAuditLogRecordsEveryDecision(t *testing.T) {
+	am := newFakeAlertmanager(nil)
+	defer am.server.Close()
+
+	dir, err := ioutil.TempDir("", "alertmanager-audit")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	auditPath := filepath.Join(dir, "audit.log")
+
+	sink := newTestSink(t, am.host(), "auditLog="+auditPath)
+
+	normal := &v1.Event{Type: v1.EventTypeNormal, Reason: "Pulled", Message: "audit normal"}
+	ignored := &v1.Event{Type: v1.EventTypeWarning, Reason: "Unhealthy", Message: "audit ignored"}
+	warning := &v1.Event{Type: v1.EventTypeWarning, Reason: "BackOff", Message: "audit warning"}
+	noMessage := &v1.Event{Type: v1.EventTypeWarning, InvolvedObject: v1.ObjectReference{Kind: "Pod", Name: "audit-no-message"}}
+
+	sink.ExportEvents(&core.EventBatch{Events: []*v1.Event{normal, ignored, warning, noMessage}})
+	sink.ExportEvents(&core.EventBatch{Events: []*v1.Event{warning, noMessage}})
+	sink.Stop()
+
+	records := readAuditLog(t, auditPath)
+	decisions := make([]string, 0, len(records))
+	for _, record := range records {
+		assert.Equal(t, ALERTMANAGER_SINK, record.Sink)
+		assert.NotEmpty(t, record.Key)
+		assert.NotEmpty(t, record.Reason)
+		decisions = append(decisions, record.Decision)
+	}
+	assert.Equal(t, []string{
+		AuditDecisionDropped,
+		AuditDecisionIgnored,
+		AuditDecisionSent,
+		AuditDecisionDropped,
+		AuditDecisionDeduped,
+		AuditDecisionDropped,
+		// The summary of the deduped warning, sent on stop.
+		AuditDecisionSent,
+	}, decisions)
+	assert.Len(t, am.received(), 2)
+}
+
+func TestStopCancelsInFlightSend(t *testing.T) {
+	release := make(chan struct{})
+	am := newFakeAlertmanager(func(w http.ResponseWriter, alerts []*Alert) {
+		<-release
+	})
+	defer am.server.Close()
+	defer close(release)
+
+	sink := newTestSink(t, am.host(), "")
+	event := &v1.Event{Type: v1.EventTypeWarning, Reason: "BackOff", Message: "stuck"}
+	done := make(chan error)
+	go func() {
+		// The first occurrence is suppressed, the second one is sent.
+		done <- sink.ExportEventsWithError(&core.EventBatch{Events: []*v1.Event{event, event}})
+	}()
+
+	for len(am.received()) == 0 {
+		time.Sleep(10 * time.Millisecond)
+	}
+	sink.Stop()
+	select {
+	case err := <-done:
+		assert.Error(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("export did not return after Stop")
+	}
+}
+
+func TestSendContextCancelled(t *testing.T) {
+	release := make(chan struct{})
+	am := newFakeAlertmanager(func(w http.ResponseWriter, alerts []*Alert) {
+		<-release
+	})
+	defer am.server.Close()
+	defer close(release)
+
+	sink := newTestSink(t, am.host(), "batch_size=1")
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- sink.SendContext(ctx, makeAlerts(3))
+	}()
+
+	for len(am.received()) == 0 {
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	select {
+	case err := <-done:
+		assert.Error(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("send did not return after cancel")
+	}
+	// The remaining chunks are not attempted.
+	assert.Len(t, am.received(), 1)
+}
+
+func mustParseURL(raw string) *url.URL {
+	uri, err := url.Parse(raw)
+	if err != nil {
+		panic(err)
+	}
+	return uri
+}
+
+func TestAlertTemplate(t *testing.T) {
+	sink := newTestSink(t, "localhost:9093", "template="+url.QueryEscape(`{{.Reason}} on {{.InvolvedObject.Kind}}/{{.InvolvedObject.Name}}`))
+	event := &v1.Event{
+		Type:           v1.EventTypeWarning,
+		Reason:         "BackOff",
+		Message:        "Back-off restarting failed container",
+		InvolvedObject: v1.ObjectReference{Kind: "Pod", Name: "web-0"},
+	}
+	alert, err := sink.buildAlert(event)
+	assert.NoError(t, err)
+	assert.Equal(t, "BackOff on Pod/web-0", alert.Labels[AlertNameLabel])
+	assert.Equal(t, "BackOff on Pod/web-0", alert.Annotations[AlertMessageAnnotation])
+
+	// Rendering errors keep the event message.
+	sink = newTestSink(t, "localhost:9093", "template="+url.QueryEscape(`{{.Reason.Missing}}`))
+	alert, err = sink.buildAlert(event)
+	assert.NoError(t, err)
+	assert.Equal(t, event.Message, alert.Labels[AlertNameLabel])
+
+	_, err = NewAlertmanagerSink(mustParseURL("http://localhost:9093?cluster=test&template=" + url.QueryEscape(`{{.Reason`)))
+	assert.Error(t, err)
+}
+
+func TestHealthCheck(t *testing.T) {
+	var requested string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested = r.URL.Path
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}))
+	defer server.Close()
+	host := strings.TrimPrefix(server.URL, "http://")
+
+	sink := newTestSink(t, host+"/api/v1/alerts", "")
+	assert.NoError(t, sink.HealthCheck())
+	assert.Equal(t, "/api/v1/status", requested)
+
+	server.Close()
+	assert.Error(t, sink.HealthCheck())
+}
+
+func TestAlertnameSource(t *testing.T) {
+	event := podEvent("web-0", "BackOff", "Back-off restarting failed container web-0")
+	noReason := podEvent("web-0", "", "Back-off restarting failed container web-0")
+	noMessage := podEvent("web-0", "BackOff", "")
+
+	sink := newTestSink(t, "localhost:9093", "")
+	assert.Equal(t, ALERTNAME_SOURCE_MESSAGE, sink.AlertnameSource)
+	alert, err := sink.buildAlert(event)
+	assert.NoError(t, err)
+	assert.Equal(t, event.Message, alert.Labels[AlertNameLabel])
+	assert.Equal(t, event.Message, alert.Annotations[AlertMessageAnnotation])
+	alert, err = sink.buildAlert(noMessage)
+	assert.NoError(t, err)
+	assert.Equal(t, "BackOff", alert.Labels[AlertNameLabel])
+	assert.NotContains(t, alert.Annotations, AlertMessageAnnotation)
+
+	sink = newTestSink(t, "localhost:9093", "alertname_source=reason")
+	alert, err = sink.buildAlert(event)
+	assert.NoError(t, err)
+	assert.Equal(t, "BackOff", alert.Labels[AlertNameLabel])
+	assert.Equal(t, event.Message, alert.Annotations[AlertMessageAnnotation])
+	alert, err = sink.buildAlert(noReason)
+	assert.NoError(t, err)
+	assert.Equal(t, noReason.Message, alert.Labels[AlertNameLabel])
+
+	_, err = sink.buildAlert(podEvent("web-0", "", ""))
+	assert.Equal(t, NotVaildAlertName, err)
+
+	// A template only renders the message of alerts named after the reason.
+	sink = newTestSink(t, "localhost:9093", "alertname_source=reason&template="+url.QueryEscape("{{.Reason}} on {{.InvolvedObject.Name}}"))
+	alert, err = sink.buildAlert(event)
+	assert.NoError(t, err)
+	assert.Equal(t, "BackOff", alert.Labels[AlertNameLabel])
+	assert.Equal(t, "BackOff on web-0", alert.Annotations[AlertMessageAnnotation])
+
+	_, err = NewAlertmanagerSink(mustParseURL("http://localhost:9093?cluster=test&alertname_source=uid"))
+	assert.Error(t, err)
+}
+
+func TestInstanceOverride(t *testing.T) {
+	event := &v1.Event{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "web-0.15a6d1b2c3d4e5f6"},
+		Type:       v1.EventTypeWarning,
+		Reason:     "BackOff",
+		Message:    "Back-off restarting failed container",
+	}
+
+	sink := newTestSink(t, "localhost:9093", "")
+	alert, err := sink.buildAlert(event)
+	assert.NoError(t, err)
+	assert.Equal(t, event.Name, alert.Labels[AlertInstanceLabel])
+	assert.NotContains(t, alert.Annotations, AlertEventNameAnnotation)
+
+	sink = newTestSink(t, "localhost:9093", "instance=eu-west-1")
+	alert, err = sink.buildAlert(event)
+	assert.NoError(t, err)
+	assert.Equal(t, "eu-west-1", alert.Labels[AlertInstanceLabel])
+	assert.Equal(t, event.Name, alert.Annotations[AlertEventNameAnnotation])
+}
+
+func TestMaxEventAge(t *testing.T) {
+	am := newFakeAlertmanager(nil)
+	defer am.server.Close()
+
+	sink := newTestSink(t, am.host(), "")
+	assert.Equal(t, DEFAULT_MAX_EVENT_AGE, sink.MaxEventAge)
+	now := time.Date(2018, 3, 1, 12, 0, 0, 0, time.UTC)
+	sink.now = func() time.Time { return now }
+
+	fresh := podEvent("web-0", "BackOff", "fresh")
+	fresh.FirstTimestamp = metav1.NewTime(now.Add(-time.Hour))
+	fresh.LastTimestamp = metav1.NewTime(now.Add(-time.Minute))
+	stale := podEvent("web-1", "BackOff", "stale")
+	stale.LastTimestamp = metav1.NewTime(now.Add(-time.Hour))
+	freshEventTime := podEvent("web-2", "BackOff", "fresh event time")
+	freshEventTime.EventTime = metav1.NewMicroTime(now.Add(-time.Minute))
+	staleEventTime := podEvent("web-3", "BackOff", "stale event time")
+	staleEventTime.EventTime = metav1.NewMicroTime(now.Add(-time.Hour))
+	// Events without any timestamp can't be told apart and are kept.
+	untimed := podEvent("web-4", "BackOff", "untimed")
+
+	staleCount := metricValue(t, staleEvents.WithLabelValues("test"))
+	batch := &core.EventBatch{Events: []*v1.Event{fresh, stale, freshEventTime, staleEventTime, untimed}}
+	// The first occurrences are only recorded.
+	sink.ExportEvents(batch)
+	sink.ExportEvents(batch)
+
+	names := []string{}
+	for _, chunk := range am.received() {
+		for _, alert := range chunk {
+			names = append(names, alert.Labels[AlertNameLabel])
+		}
+	}
+	assert.Equal(t, []string{"fresh", "fresh event time", "untimed"}, names)
+	assert.Equal(t, staleCount+4, metricValue(t, staleEvents.WithLabelValues("test")))
+
+	sink = newTestSink(t, am.host(), "max_event_age=0s")
+	sink.now = func() time.Time { return now }
+	assert.False(t, sink.isStale(stale))
+
+	for _, invalid := range []string{"max_event_age=-1m", "max_event_age=10"} {
+		_, err := NewAlertmanagerSink(mustParseURL("http://localhost:9093?cluster=test&" + invalid))
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestMinCount(t *testing.T) {
+	assert.Equal(t, 1, newTestSink(t, "localhost:9093", "").MinCount)
+
+	counted := func(name string, count int32) *v1.Event {
+		event := podEvent(name, "FailedScheduling", name)
+		event.Count = count
+		return event
+	}
+	series := podEvent("series", "FailedScheduling", "series")
+	series.Series = &v1.EventSeries{Count: 7}
+	batch := &core.EventBatch{Events: []*v1.Event{
+		counted("zero", 0), counted("once", 1), counted("below", 2), counted("at", 3), counted("above", 9), series,
+	}}
+	for _, tc := range []struct {
+		query    string
+		expected []string
+	}{
+		{"", []string{"zero", "once", "below", "at", "above", "series"}},
+		{"min_count=1", []string{"zero", "once", "below", "at", "above", "series"}},
+		{"min_count=3", []string{"at", "above", "series"}},
+	} {
+		am := newFakeAlertmanager(nil)
+		sink := newTestSink(t, am.host(), tc.query)
+		// The first occurrences are only recorded.
+		sink.ExportEvents(batch)
+		sink.ExportEvents(batch)
+
+		names := []string{}
+		counts := map[string]string{}
+		for _, chunk := range am.received() {
+			for _, alert := range chunk {
+				names = append(names, alert.Labels[AlertNameLabel])
+				counts[alert.Labels[AlertNameLabel]] = alert.Annotations[AlertCountAnnotation]
+			}
+		}
+		assert.Equal(t, tc.expected, names, tc.query)
+		if tc.query == "min_count=3" {
+			assert.Equal(t, map[string]string{"at": "3", "above": "9", "series": "7"}, counts)
+		}
+		am.server.Close()
+	}
+
+	for _, invalid := range []string{"min_count=0", "min_count=-1", "min_count=many"} {
+		_, err := NewAlertmanagerSink(mustParseURL("http://localhost:9093?cluster=test&" + invalid))
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestClusterFallback(t *testing.T) {
+	defer os.Setenv(core.ClusterNameEnv, os.Getenv(core.ClusterNameEnv))
+	defer func(f core.NodeLabelFunc) { nodeLabel = f }(nodeLabel)
+	nodeLabel = func(label string) (string, error) {
+		return map[string]string{core.DefaultClusterNodeLabel: "from-node"}[label], nil
+	}
+
+	os.Setenv(core.ClusterNameEnv, "")
+	_, err := NewAlertmanagerSink(mustParseURL("http://localhost:9093"))
+	assert.Error(t, err)
+
+	sink, err := NewAlertmanagerSink(mustParseURL("http://localhost:9093?cluster_from_node=true"))
+	assert.NoError(t, err)
+	assert.Equal(t, "from-node", sink.Cluster)
+
+	os.Setenv(core.ClusterNameEnv, "from-env")
+	sink, err = NewAlertmanagerSink(mustParseURL("http://localhost:9093?cluster_from_node=true"))
+	assert.NoError(t, err)
+	assert.Equal(t, "from-env", sink.Cluster)
+	alert, err := sink.buildAlert(podEvent("web-0", "BackOff", "Back-off restarting failed container"))
+	assert.NoError(t, err)
+	assert.Equal(t, "from-env", alert.Labels[AlertClusterLabel])
+}
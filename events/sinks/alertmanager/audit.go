@@ -0,0 +1,93 @@
+// Copyright 2018 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package alertmanager
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// Decisions recorded in the audit log for every event seen by the sink.
+const (
+	AuditDecisionSent    = "sent"
+	AuditDecisionDeduped = "deduped"
+	AuditDecisionIgnored = "ignored"
+	AuditDecisionDropped = "dropped"
+)
+
+// auditRecord is a single line of the audit log.
+type auditRecord struct {
+	Time     time.Time `json:"time"`
+	Sink     string    `json:"sink"`
+	Key      string    `json:"key"`
+	Decision string    `json:"decision"`
+	Reason   string    `json:"reason"`
+}
+
+// auditLogger writes one JSON line per event decision. A nil auditLogger
+// discards every record, so callers don't need to check whether auditing
+// is enabled.
+type auditLogger struct {
+	sync.Mutex
+	sink string
+	w    io.WriteCloser
+}
+
+func newAuditLogger(sink, path string) (*auditLogger, error) {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &auditLogger{sink: sink, w: f}, nil
+}
+
+func (l *auditLogger) Record(key, decision, reason string) {
+	if l == nil {
+		return
+	}
+	line, err := json.Marshal(&auditRecord{
+		Time:     time.Now().UTC(),
+		Sink:     l.sink,
+		Key:      key,
+		Decision: decision,
+		Reason:   reason,
+	})
+	if err != nil {
+		glog.Warningf("failed to marshal audit record for %s: %v", key, err)
+		return
+	}
+
+	l.Lock()
+	defer l.Unlock()
+	if _, err := l.w.Write(append(line, '\n')); err != nil {
+		glog.Warningf("failed to write audit record for %s: %v", key, err)
+	}
+}
+
+func (l *auditLogger) Close() {
+	if l == nil {
+		return
+	}
+	l.Lock()
+	defer l.Unlock()
+	if err := l.w.Close(); err != nil {
+		glog.Warningf("failed to close audit log: %v", err)
+	}
+}
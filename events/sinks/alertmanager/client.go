@@ -0,0 +1,478 @@
+// Copyright 2018 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package alertmanager
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	COMPRESSION_GZIP = "gzip"
+
+	SCHEME_HTTP  = "http"
+	SCHEME_HTTPS = "https"
+	SCHEME_UNIX  = "unix"
+
+	// UNIX_SOCKET_HOST is the host of requests sent over a unix socket. It
+	// only ends up in the Host header.
+	UNIX_SOCKET_HOST = "localhost"
+
+	// Failed chunks are retried DEFAULT_MAX_RETRIES times, waiting about
+	// DEFAULT_INITIAL_BACKOFF before the first retry and twice as long
+	// before every further one, as long as the retries of a chunk end
+	// within DEFAULT_RETRY_DEADLINE.
+	DEFAULT_MAX_RETRIES     = 2
+	DEFAULT_INITIAL_BACKOFF = 500 * time.Millisecond
+	DEFAULT_RETRY_DEADLINE  = 10 * time.Second
+
+	// DEFAULT_TIMEOUT bounds every request to alertmanager, see timeout.
+	DEFAULT_TIMEOUT = 5 * time.Second
+	// MAX_IDLE_CONNS_PER_HOST keeps enough connections alive for the
+	// concurrent posts to an endpoint to be reused across batches.
+	MAX_IDLE_CONNS_PER_HOST = 8
+	IDLE_CONN_TIMEOUT       = 90 * time.Second
+
+	// maxErrorBodyBytes is how much of an error response is reported.
+	maxErrorBodyBytes = 256
+)
+
+var (
+	// Number of responses asking heapster to slow down.
+	throttledResponses = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: "eventer",
+			Subsystem: "alertmanager",
+			Name:      "throttled_responses_total",
+			Help:      "Number of 429 and 503 responses received from alertmanager.",
+		},
+	)
+
+	// Request bodies are built every batch, so buffers and gzip writers are
+	// reused rather than allocated per send.
+	bufferPool = sync.Pool{
+		New: func() interface{} { return new(bytes.Buffer) },
+	}
+	gzipWriterPool = sync.Pool{
+		New: func() interface{} { return gzip.NewWriter(nil) },
+	}
+)
+
+func init() {
+	prometheus.MustRegister(throttledResponses)
+}
+
+// throttledError is returned when alertmanager responds with 429 or 503.
+type throttledError struct {
+	status     string
+	retryAfter time.Duration
+}
+
+func (e *throttledError) Error() string {
+	if e.retryAfter > 0 {
+		return fmt.Sprintf("alertmanager responded %s, retry after %v", e.status, e.retryAfter)
+	}
+	return fmt.Sprintf("alertmanager responded %s", e.status)
+}
+
+// statusError is returned when alertmanager responds with an unexpected
+// status.
+type statusError struct {
+	code   int
+	status string
+	body   string
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("alertmanager responded %s: %s", e.status, e.body)
+}
+
+// isRetryable tells whether a failed chunk may be accepted if sent again.
+// Throttled chunks are retried with the next export instead.
+func isRetryable(err error) bool {
+	switch err := err.(type) {
+	case *throttledError:
+		return false
+	case *statusError:
+		return err.code >= 500
+	}
+	return true
+}
+
+// parseRetryAfter parses a Retry-After header, given either in seconds or as
+// an HTTP date. It returns 0 if the header is missing or invalid.
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil && date.After(now) {
+		return date.Sub(now)
+	}
+	return 0
+}
+
+func parseCompression(compression string) (string, error) {
+	switch compression {
+	case "", "none":
+		return "", nil
+	case COMPRESSION_GZIP:
+		return compression, nil
+	default:
+		return "", fmt.Errorf("unsupported compression %q, must be %s", compression, COMPRESSION_GZIP)
+	}
+}
+
+// newTLSConfig builds the TLS configuration from the tls_* options, or
+// returns nil if none is given. The certificate files are loaded right away,
+// so that a misconfigured sink fails to build.
+func newTLSConfig(opts url.Values) (*tls.Config, error) {
+	certFile, keyFile, caFile := tlsOption(opts, "cert_file"), tlsOption(opts, "key_file"), tlsOption(opts, "ca_file")
+	insecure := false
+	if value := tlsOption(opts, "insecure_skip_verify"); value != "" {
+		var err error
+		insecure, err = strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("tls_insecure_skip_verify must be a boolean, got %q", value)
+		}
+	}
+	if certFile == "" && keyFile == "" && caFile == "" && !insecure {
+		return nil, nil
+	}
+
+	config := &tls.Config{}
+	if certFile != "" || keyFile != "" {
+		if certFile == "" || keyFile == "" {
+			return nil, fmt.Errorf("tls_cert_file and tls_key_file must be given together")
+		}
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %v", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	if caFile != "" {
+		ca, err := ioutil.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read tls_ca_file: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("no certificates found in tls_ca_file %s", caFile)
+		}
+		config.RootCAs = pool
+	}
+	if insecure {
+		glog.Warningf("TLS certificate verification of alertmanager is disabled, don't use this in production")
+		config.InsecureSkipVerify = true
+	}
+	return config, nil
+}
+
+// tlsOption returns the value of the TLS option name, which may be given
+// with or without the tls_ prefix, e.g. tls_ca_file or ca_file.
+func tlsOption(opts url.Values, name string) string {
+	if value := opts.Get("tls_" + name); value != "" {
+		return value
+	}
+	return opts.Get(name)
+}
+
+// validateSocketPath checks that path may be a unix socket. The socket need
+// not exist yet, as alertmanager may be started after heapster.
+func validateSocketPath(path string) error {
+	if !filepath.IsAbs(path) {
+		return fmt.Errorf("unix socket path must be absolute, got %q", path)
+	}
+	info, err := os.Stat(path)
+	switch {
+	case os.IsNotExist(err):
+		glog.Warningf("alertmanager unix socket %s doesn't exist yet", path)
+		return nil
+	case err != nil:
+		return fmt.Errorf("failed to check unix socket %s: %v", path, err)
+	case info.Mode()&os.ModeSocket == 0:
+		return fmt.Errorf("%s is not a unix socket", path)
+	}
+	return nil
+}
+
+// newHTTPClient returns the client used to talk to alertmanager, over the
+// unix socket at socketPath if given. Requests go through proxyURL if set,
+// or the proxy of the environment otherwise.
+func newHTTPClient(tlsConfig *tls.Config, socketPath string, proxyURL *url.URL, timeout time.Duration) *http.Client {
+	transport := &http.Transport{
+		Proxy:               http.ProxyFromEnvironment,
+		TLSClientConfig:     tlsConfig,
+		MaxIdleConnsPerHost: MAX_IDLE_CONNS_PER_HOST,
+		IdleConnTimeout:     IDLE_CONN_TIMEOUT,
+	}
+	if proxyURL != nil {
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+	if socketPath != "" {
+		dialer := &net.Dialer{}
+		transport.Proxy = nil
+		transport.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return dialer.DialContext(ctx, "unix", socketPath)
+		}
+	}
+	return &http.Client{Timeout: timeout, Transport: transport}
+}
+
+// encodeBody writes the payload into buf, compressing it if configured.
+func (a *AlertmanagerSink) encodeBody(buf *bytes.Buffer, payload []byte) error {
+	if a.Compression != COMPRESSION_GZIP {
+		_, err := buf.Write(payload)
+		return err
+	}
+
+	gz := gzipWriterPool.Get().(*gzip.Writer)
+	defer gzipWriterPool.Put(gz)
+	gz.Reset(buf)
+	if _, err := gz.Write(payload); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// tokenFile is a bearer token read from a file, such as a projected service
+// account token. The file is reread whenever its modification time or size
+// changes, so rotated tokens are picked up.
+type tokenFile struct {
+	path string
+
+	mu      sync.Mutex
+	token   string
+	modTime time.Time
+	size    int64
+}
+
+// newTokenFile reads the token at path, which must exist.
+func newTokenFile(path string) (*tokenFile, error) {
+	f := &tokenFile{path: path}
+	if err := f.reload(); err != nil {
+		return nil, fmt.Errorf("failed to read bearer_token_file: %v", err)
+	}
+	return f, nil
+}
+
+// reload rereads the token if the file changed. f.mu must be held, except
+// during construction.
+func (f *tokenFile) reload() error {
+	info, err := os.Stat(f.path)
+	if err != nil {
+		return err
+	}
+	if info.ModTime().Equal(f.modTime) && info.Size() == f.size {
+		return nil
+	}
+	data, err := ioutil.ReadFile(f.path)
+	if err != nil {
+		return err
+	}
+	token := strings.TrimSpace(string(data))
+	if token == "" {
+		return fmt.Errorf("%s is empty", f.path)
+	}
+	f.token, f.modTime, f.size = token, info.ModTime(), info.Size()
+	return nil
+}
+
+// get returns the current token. If the file can't be read, the last token
+// read is returned.
+func (f *tokenFile) get() string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.reload(); err != nil {
+		glog.Warningf("failed to reload bearer token, using the previous one: %v", err)
+	}
+	return f.token
+}
+
+// setHeaders sets the User-Agent and the credentials, if any, of a request
+// to alertmanager.
+func (a *AlertmanagerSink) setHeaders(req *http.Request) {
+	req.Header.Set("User-Agent", a.UserAgent)
+	switch {
+	case a.BearerToken != "":
+		req.Header.Set("Authorization", "Bearer "+a.BearerToken)
+	case a.tokenFile != nil:
+		req.Header.Set("Authorization", "Bearer "+a.tokenFile.get())
+	case a.Username != "":
+		req.SetBasicAuth(a.Username, a.Password)
+	}
+}
+
+// sendChunkWithRetry sends a chunk, retrying failures that may be transient
+// with exponential backoff and jitter.
+func (a *AlertmanagerSink) sendChunkWithRetry(ctx context.Context, alerts []*Alert) error {
+	deadline := time.Now().Add(a.RetryDeadline)
+	backoff := a.InitialBackoff
+	for attempt := 1; ; attempt++ {
+		err := a.sendChunk(ctx, alerts)
+		if err == nil || !isRetryable(err) || ctx.Err() != nil {
+			return err
+		}
+		if attempt > a.MaxRetries {
+			if a.MaxRetries > 0 {
+				glog.Errorf("failed to send %d alert(s) to alertmanager after %d attempt(s): %v", len(alerts), attempt, err)
+			}
+			return err
+		}
+		// Wait between half and all of the backoff.
+		wait := backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))
+		if time.Now().Add(wait).After(deadline) {
+			glog.Errorf("failed to send %d alert(s) to alertmanager, no time left to retry after %d attempt(s): %v", len(alerts), attempt, err)
+			return err
+		}
+		glog.Warningf("failed to send %d alert(s) to alertmanager, retrying in %v: %v", len(alerts), wait, err)
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return err
+		}
+		backoff *= 2
+	}
+}
+
+// logDryRun logs the alerts that would be sent, one line per alert.
+func (a *AlertmanagerSink) logDryRun(alerts []*Alert) error {
+	for _, alert := range alerts {
+		alert_bytes, err := json.Marshal(a.alertPayload(alert))
+		if err != nil {
+			glog.Warningf("failed to marshal alert %v", alert)
+			return err
+		}
+		a.dryRunf("[DRY RUN] would send alert to %s://%s: %s", a.Scheme, strings.Join(a.Endpoints, ","), alert_bytes)
+	}
+	return nil
+}
+
+// sendChunk posts alerts to every alertmanager endpoint concurrently. The
+// chunk is sent if any endpoint accepts it, otherwise the error of the first
+// endpoint is returned.
+func (a *AlertmanagerSink) sendChunk(ctx context.Context, alerts []*Alert) error {
+	if a.DryRun {
+		return a.logDryRun(alerts)
+	}
+	alert_bytes, err := a.marshalAlerts(alerts)
+	if err != nil {
+		glog.Warningf("failed to marshal alert %v", alerts)
+		return err
+	}
+
+	errs := make([]error, len(a.Endpoints))
+	if len(a.Endpoints) == 1 {
+		errs[0] = a.post(ctx, a.Endpoints[0], alert_bytes)
+	} else {
+		var wg sync.WaitGroup
+		for i, endpoint := range a.Endpoints {
+			wg.Add(1)
+			go func(i int, endpoint string) {
+				defer wg.Done()
+				errs[i] = a.post(ctx, endpoint, alert_bytes)
+			}(i, endpoint)
+		}
+		wg.Wait()
+	}
+
+	accepted := 0
+	for i, err := range errs {
+		if err != nil {
+			if len(a.Endpoints) > 1 {
+				glog.Warningf("failed to send %d alert(s) to alertmanager %s: %v", len(alerts), a.Endpoints[i], err)
+			}
+			continue
+		}
+		accepted++
+	}
+	if accepted == 0 {
+		return errs[0]
+	}
+	glog.Infof("alert send success: %v", alerts)
+	return nil
+}
+
+// post sends an encoded chunk to a single alertmanager endpoint.
+func (a *AlertmanagerSink) post(ctx context.Context, endpoint string, payload []byte) error {
+	buf := bufferPool.Get().(*bytes.Buffer)
+	buf.Reset()
+	if err := a.encodeBody(buf, payload); err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, fmt.Sprintf("%s://%s", a.Scheme, endpoint), buf)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", CONTENT_TYPE_JSON)
+	a.setHeaders(req)
+	if a.Compression == COMPRESSION_GZIP {
+		req.Header.Set("Content-Encoding", COMPRESSION_GZIP)
+	}
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		// The transport may still hold on to the body, so the buffer is
+		// not returned to the pool.
+		glog.Errorf("failed to send msg to alertmanager,because of %s", err.Error())
+		return err
+	}
+	// The body is drained so that the connection can be reused.
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	bufferPool.Put(buf)
+	if err != nil {
+		return fmt.Errorf("failed to read alertmanager response: %v", err)
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable:
+		throttledResponses.Inc()
+		return &throttledError{
+			status:     resp.Status,
+			retryAfter: parseRetryAfter(resp.Header.Get("Retry-After"), a.now()),
+		}
+	case resp.StatusCode/100 != 2:
+		if len(body) > maxErrorBodyBytes {
+			body = body[:maxErrorBodyBytes]
+		}
+		return &statusError{code: resp.StatusCode, status: resp.Status, body: string(body)}
+	}
+	return nil
+}
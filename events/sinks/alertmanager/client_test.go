@@ -0,0 +1,590 @@
+// Copyright 2018 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package alertmanager
+
+import (
+	"compress/gzip"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/heapster/events/core"
+	"k8s.io/heapster/version"
+)
+
+func TestGzipCompression(t *testing.T) {
+	var encodings []string
+	var received [][]*Alert
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		encoding := r.Header.Get("Content-Encoding")
+		encodings = append(encodings, encoding)
+		var body io.Reader = r.Body
+		if encoding == "gzip" {
+			gz, err := gzip.NewReader(r.Body)
+			assert.NoError(t, err)
+			body = gz
+		}
+		var alerts []*Alert
+		assert.NoError(t, json.NewDecoder(body).Decode(&alerts))
+		received = append(received, alerts)
+	}))
+	defer server.Close()
+	host := strings.TrimPrefix(server.URL, "http://")
+
+	compressed := newTestSink(t, host, "compress=gzip&batch_size=3")
+	plain := newTestSink(t, host, "")
+	// Several sends make sure pooled writers and buffers are reset properly.
+	assert.NoError(t, compressed.Send(makeAlerts(7)))
+	assert.NoError(t, plain.Send(makeAlerts(2)))
+
+	assert.Equal(t, []string{"gzip", "gzip", "gzip", ""}, encodings)
+	assert.Len(t, received, 4)
+	assert.Equal(t, "alert-6", received[2][0].Labels[AlertNameLabel])
+	assert.Equal(t, "alert-1", received[3][1].Labels[AlertNameLabel])
+}
+
+func TestCompressedBodyMatchesPlainBody(t *testing.T) {
+	var mu sync.Mutex
+	bodies := map[string][]byte{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, CONTENT_TYPE_JSON, r.Header.Get("Content-Type"))
+		encoding := r.Header.Get("Content-Encoding")
+		var body io.Reader = r.Body
+		if encoding == "gzip" {
+			gz, err := gzip.NewReader(r.Body)
+			assert.NoError(t, err)
+			body = gz
+		}
+		data, err := ioutil.ReadAll(body)
+		assert.NoError(t, err)
+		mu.Lock()
+		bodies[encoding] = data
+		mu.Unlock()
+	}))
+	defer server.Close()
+	host := strings.TrimPrefix(server.URL, "http://")
+
+	alerts := makeAlerts(3)
+	compressed := newTestSink(t, host, "compression=gzip")
+	assert.Equal(t, COMPRESSION_GZIP, compressed.Compression)
+	assert.NoError(t, compressed.Send(alerts))
+	plain := newTestSink(t, host, "")
+	assert.NoError(t, plain.Send(alerts))
+
+	expected, err := plain.marshalAlerts(alerts)
+	assert.NoError(t, err)
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, string(expected), string(bodies[""]))
+	assert.Equal(t, string(expected), string(bodies["gzip"]))
+}
+
+func TestInvalidCompression(t *testing.T) {
+	_, err := NewAlertmanagerSink(mustParseURL("http://localhost:9093?cluster=test&compress=zstd"))
+	assert.Error(t, err)
+	_, err = NewAlertmanagerSink(mustParseURL("http://localhost:9093?cluster=test&compression=zstd"))
+	assert.Error(t, err)
+}
+
+// writeClientCertificate writes a self-signed client certificate and its key
+// to dir and returns their paths along with the parsed certificate.
+func writeClientCertificate(t *testing.T, dir string) (string, string, *x509.Certificate) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "heapster"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	assert.NoError(t, err)
+
+	certFile := filepath.Join(dir, "client.crt")
+	keyFile := filepath.Join(dir, "client.key")
+	assert.NoError(t, ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	assert.NoError(t, ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}), 0600))
+	return certFile, keyFile, cert
+}
+
+func TestMutualTLS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "alertmanager-tls")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	certFile, keyFile, clientCert := writeClientCertificate(t, dir)
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(clientCert)
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: clientCAs}
+	server.StartTLS()
+	defer server.Close()
+
+	caFile := filepath.Join(dir, "ca.crt")
+	serverCert := server.TLS.Certificates[0].Certificate[0]
+	assert.NoError(t, ioutil.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: serverCert}), 0600))
+	host := strings.TrimPrefix(server.URL, "https://")
+
+	sink := newTestSink(t, host, "tls_cert_file="+url.QueryEscape(certFile)+"&tls_key_file="+url.QueryEscape(keyFile)+"&tls_ca_file="+url.QueryEscape(caFile))
+	assert.Equal(t, SCHEME_HTTPS, sink.Scheme)
+	assert.NoError(t, sink.Send(makeAlerts(1)))
+
+	// Without the client certificate the server rejects the handshake.
+	sink = newTestSink(t, host, "tls_ca_file="+url.QueryEscape(caFile))
+	assert.Error(t, sink.Send(makeAlerts(1)))
+}
+
+func TestHTTPSServer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "alertmanager-tls")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	caFile := filepath.Join(dir, "ca.crt")
+	serverCert := server.TLS.Certificates[0].Certificate[0]
+	assert.NoError(t, ioutil.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: serverCert}), 0600))
+	host := strings.TrimPrefix(server.URL, "https://")
+
+	// The server certificate isn't trusted without the CA.
+	sink := newTestSink(t, host, "scheme=https")
+	assert.Equal(t, SCHEME_HTTPS, sink.Scheme)
+	assert.Error(t, sink.Send(makeAlerts(1)))
+
+	sink = newTestSink(t, host, "ca_file="+url.QueryEscape(caFile))
+	assert.Equal(t, SCHEME_HTTPS, sink.Scheme)
+	assert.NoError(t, sink.Send(makeAlerts(1)))
+
+	sink = newTestSink(t, host, "insecure_skip_verify=true")
+	assert.NoError(t, sink.Send(makeAlerts(1)))
+
+	uri := mustParseURL("https://" + host + "?cluster=test")
+	sink, err = NewAlertmanagerSink(uri)
+	assert.NoError(t, err)
+	assert.Equal(t, SCHEME_HTTPS, sink.Scheme)
+}
+
+func TestInvalidTLSOptions(t *testing.T) {
+	for _, invalid := range []string{
+		"tls_cert_file=/nonexistent/client.crt&tls_key_file=/nonexistent/client.key",
+		"tls_cert_file=/nonexistent/client.crt",
+		"tls_ca_file=/nonexistent/ca.crt",
+		"ca_file=/nonexistent/ca.crt",
+		"cert_file=/nonexistent/client.crt&key_file=/nonexistent/client.key",
+		"tls_insecure_skip_verify=maybe",
+		"scheme=ftp",
+	} {
+		_, err := NewAlertmanagerSink(mustParseURL("http://localhost:9093?cluster=test&" + invalid))
+		assert.Error(t, err, invalid)
+	}
+
+	sink, err := NewAlertmanagerSink(mustParseURL("http://localhost:9093?cluster=test&tls_insecure_skip_verify=true"))
+	assert.NoError(t, err)
+	assert.Equal(t, SCHEME_HTTPS, sink.Scheme)
+}
+
+func TestRetryAfter(t *testing.T) {
+	throttle := true
+	am := newFakeAlertmanager(func(w http.ResponseWriter, alerts []*Alert) {
+		if throttle {
+			w.Header().Set("Retry-After", "120")
+			w.WriteHeader(http.StatusTooManyRequests)
+		}
+	})
+	defer am.server.Close()
+
+	sink := newTestSink(t, am.host(), "batch_size=1")
+	now := time.Now()
+	sink.now = func() time.Time { return now }
+
+	// The remaining chunks aren't sent once alertmanager asks to back off.
+	assert.Error(t, sink.Send(makeAlerts(3)))
+	assert.Len(t, am.received(), 1)
+
+	throttle = false
+	assert.Error(t, sink.Send(makeAlerts(1)))
+	assert.Len(t, am.received(), 1)
+
+	now = now.Add(2 * time.Minute)
+	assert.NoError(t, sink.Send(makeAlerts(1)))
+	assert.Len(t, am.received(), 2)
+}
+
+func TestThrottledAlertsAreRetried(t *testing.T) {
+	am := newFakeAlertmanager(func(w http.ResponseWriter, alerts []*Alert) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	defer am.server.Close()
+
+	sink := newTestSink(t, am.host(), "")
+	event := &v1.Event{Type: v1.EventTypeWarning, Reason: "BackOff", Message: "throttled"}
+	alert, err := sink.buildAlert(event)
+	assert.NoError(t, err)
+	alert.dedupKey = generateKey(sink.DedupKeys, event)
+
+	sink.recordKey(alert.dedupKey)
+	assert.Error(t, sink.Send([]*Alert{alert}))
+	// The next occurrence of the event is sent rather than suppressed.
+	_, ok := sink.recorder.Get(alert.dedupKey)
+	assert.False(t, ok)
+	assert.Error(t, sink.ExportEventsWithError(&core.EventBatch{Events: []*v1.Event{event}}))
+	assert.Len(t, am.received(), 2)
+}
+
+// flakyAlertmanager fails the first failures requests with status.
+func flakyAlertmanager(failures, status int, body string) (*httptest.Server, *int) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests <= failures {
+			w.WriteHeader(status)
+			io.WriteString(w, body)
+		}
+	}))
+	return server, &requests
+}
+
+func TestRetryFailedChunks(t *testing.T) {
+	sink := newTestSink(t, "localhost:9093", "")
+	assert.Equal(t, DEFAULT_MAX_RETRIES, sink.MaxRetries)
+	assert.Equal(t, DEFAULT_INITIAL_BACKOFF, sink.InitialBackoff)
+	assert.Equal(t, DEFAULT_RETRY_DEADLINE, sink.RetryDeadline)
+
+	server, requests := flakyAlertmanager(2, http.StatusInternalServerError, "restarting")
+	sink = newTestSink(t, strings.TrimPrefix(server.URL, "http://"), "max_retries=2&initial_backoff=10ms")
+	assert.NoError(t, sink.Send(makeAlerts(1)))
+	assert.Equal(t, 3, *requests)
+	server.Close()
+
+	server, requests = flakyAlertmanager(3, http.StatusInternalServerError, strings.Repeat("x", 1000))
+	sink = newTestSink(t, strings.TrimPrefix(server.URL, "http://"), "max_retries=2&initial_backoff=10ms")
+	err := sink.Send(makeAlerts(1))
+	assert.Error(t, err)
+	assert.Equal(t, 3, *requests)
+	// Only the start of the response is reported.
+	assert.Contains(t, err.Error(), "500 Internal Server Error: "+strings.Repeat("x", maxErrorBodyBytes))
+	assert.NotContains(t, err.Error(), strings.Repeat("x", maxErrorBodyBytes+1))
+	server.Close()
+
+	// Client errors aren't retried.
+	server, requests = flakyAlertmanager(1, http.StatusBadRequest, "invalid alert")
+	sink = newTestSink(t, strings.TrimPrefix(server.URL, "http://"), "max_retries=2&initial_backoff=10ms")
+	assert.Error(t, sink.Send(makeAlerts(1)))
+	assert.Equal(t, 1, *requests)
+	server.Close()
+
+	// Nor are retries started that would end after the deadline.
+	server, requests = flakyAlertmanager(1, http.StatusBadGateway, "")
+	sink = newTestSink(t, strings.TrimPrefix(server.URL, "http://"), "max_retries=2&initial_backoff=10s&retry_deadline=1s")
+	start := time.Now()
+	assert.Error(t, sink.Send(makeAlerts(1)))
+	assert.True(t, time.Since(start) < time.Second)
+	assert.Equal(t, 1, *requests)
+	server.Close()
+
+	for _, invalid := range []string{"max_retries=-1", "max_retries=a", "initial_backoff=0s", "retry_deadline=-1s"} {
+		_, err := NewAlertmanagerSink(mustParseURL("http://localhost:9093?cluster=test&" + invalid))
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2018, 3, 1, 10, 0, 0, 0, time.UTC)
+	assert.Equal(t, 30*time.Second, parseRetryAfter("30", now))
+	assert.Equal(t, time.Minute, parseRetryAfter("Thu, 01 Mar 2018 10:01:00 GMT", now))
+	assert.Equal(t, time.Duration(0), parseRetryAfter("", now))
+	assert.Equal(t, time.Duration(0), parseRetryAfter("soon", now))
+}
+
+func TestUserAgent(t *testing.T) {
+	var userAgents []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userAgents = append(userAgents, r.UserAgent())
+	}))
+	defer server.Close()
+	host := strings.TrimPrefix(server.URL, "http://")
+
+	sink := newTestSink(t, host, "")
+	assert.NoError(t, sink.Send(makeAlerts(1)))
+	assert.NoError(t, sink.HealthCheck())
+
+	sink = newTestSink(t, host, "user_agent=audit/1.0")
+	assert.NoError(t, sink.Send(makeAlerts(1)))
+
+	assert.Equal(t, []string{version.UserAgent("events"), version.UserAgent("events"), "audit/1.0"}, userAgents)
+}
+
+func TestMultipleEndpoints(t *testing.T) {
+	first := newFakeAlertmanager(nil)
+	defer first.server.Close()
+	second := newFakeAlertmanager(nil)
+	defer second.server.Close()
+
+	sink := newTestSink(t, first.host(), "endpoints="+second.host()+","+second.host()+"/custom/alerts")
+	assert.Equal(t, []string{
+		first.host() + "/api/v2/alerts",
+		second.host() + "/api/v2/alerts",
+		second.host() + "/custom/alerts",
+	}, sink.Endpoints)
+	assert.Equal(t, sink.Endpoints[0], sink.Endpoint)
+
+	sink = newTestSink(t, first.host(), "endpoints="+second.host())
+	assert.NoError(t, sink.Send(makeAlerts(3)))
+	assert.Len(t, first.received(), 1)
+	assert.Len(t, second.received(), 1)
+	assert.Equal(t, first.received()[0], second.received()[0])
+
+	// A failing replica doesn't fail the send as long as another accepts it.
+	failing := newFakeAlertmanager(func(w http.ResponseWriter, alerts []*Alert) {
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+	defer failing.server.Close()
+	sink = newTestSink(t, failing.host(), "max_retries=0&endpoints="+first.host())
+	assert.NoError(t, sink.Send(makeAlerts(1)))
+	assert.Len(t, failing.received(), 1)
+	assert.Len(t, first.received(), 2)
+
+	// Nor does a replica that is down for good.
+	down := newFakeAlertmanager(nil)
+	down.server.Close()
+	sink = newTestSink(t, down.host(), "max_retries=0&endpoints="+first.host())
+	assert.NoError(t, sink.Send(makeAlerts(1)))
+	assert.Len(t, first.received(), 3)
+
+	// Alertmanager is healthy as long as one replica is.
+	healthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer healthy.Close()
+	sink = newTestSink(t, down.host(), "endpoints="+strings.TrimPrefix(healthy.URL, "http://"))
+	assert.NoError(t, sink.HealthCheck())
+	sink = newTestSink(t, down.host(), "")
+	assert.Error(t, sink.HealthCheck())
+
+	// The send fails if no replica accepts it.
+	sink = newTestSink(t, failing.host(), "max_retries=0&endpoints="+down.host())
+	err := sink.Send(makeAlerts(1))
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "500 Internal Server Error")
+
+	uri := mustParseURL("http:?cluster=test&endpoints=" + first.host())
+	sink, err = NewAlertmanagerSink(uri)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{first.host() + "/api/v2/alerts"}, sink.Endpoints)
+	_, err = NewAlertmanagerSink(mustParseURL("http:?cluster=test"))
+	assert.Error(t, err)
+}
+
+func TestAuthentication(t *testing.T) {
+	var authorizations []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorizations = append(authorizations, r.Header.Get("Authorization"))
+	}))
+	defer server.Close()
+	host := strings.TrimPrefix(server.URL, "http://")
+
+	sink := newTestSink(t, host, "")
+	assert.NoError(t, sink.Send(makeAlerts(1)))
+
+	sink = newTestSink(t, host, "username=heapster&password=s3cret")
+	assert.NoError(t, sink.Send(makeAlerts(1)))
+	assert.NoError(t, sink.HealthCheck())
+
+	sink = newTestSink(t, host, "bearer_token=t0ken")
+	assert.NoError(t, sink.Send(makeAlerts(1)))
+
+	basic := "Basic " + base64.StdEncoding.EncodeToString([]byte("heapster:s3cret"))
+	assert.Equal(t, []string{"", basic, basic, "Bearer t0ken"}, authorizations)
+
+	for _, invalid := range []string{
+		"username=heapster&bearer_token=t0ken",
+		"password=s3cret&bearer_token=t0ken",
+		"password=s3cret",
+	} {
+		_, err := NewAlertmanagerSink(mustParseURL("http://localhost:9093?cluster=test&" + invalid))
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestBearerTokenFile(t *testing.T) {
+	var mu sync.Mutex
+	var authorizations []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		authorizations = append(authorizations, r.Header.Get("Authorization"))
+		mu.Unlock()
+	}))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "alertmanager-token")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "token")
+	assert.NoError(t, ioutil.WriteFile(path, []byte("t0ken\n"), 0600))
+
+	sink := newTestSink(t, strings.TrimPrefix(server.URL, "http://"), "bearer_token_file="+url.QueryEscape(path))
+	assert.NoError(t, sink.Send(makeAlerts(1)))
+
+	// The rotated token is picked up on the next send.
+	assert.NoError(t, ioutil.WriteFile(path, []byte("r0tated"), 0600))
+	later := time.Now().Add(time.Minute)
+	assert.NoError(t, os.Chtimes(path, later, later))
+	assert.NoError(t, sink.Send(makeAlerts(1)))
+
+	// Once the file is gone the last token is kept.
+	assert.NoError(t, os.Remove(path))
+	assert.NoError(t, sink.Send(makeAlerts(1)))
+
+	mu.Lock()
+	assert.Equal(t, []string{"Bearer t0ken", "Bearer r0tated", "Bearer r0tated"}, authorizations)
+	mu.Unlock()
+
+	for _, invalid := range []string{
+		"bearer_token_file=" + url.QueryEscape(path),
+		"bearer_token_file=" + url.QueryEscape(dir) + "&bearer_token=t0ken",
+		"bearer_token_file=" + url.QueryEscape(dir) + "&username=heapster",
+	} {
+		_, err := NewAlertmanagerSink(mustParseURL("http://localhost:9093?cluster=test&" + invalid))
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestUnixSocket(t *testing.T) {
+	dir, err := ioutil.TempDir("", "alertmanager-unix")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	socketPath := filepath.Join(dir, "am.sock")
+	listener, err := net.Listen("unix", socketPath)
+	assert.NoError(t, err)
+
+	paths := make(chan string, 2)
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths <- r.URL.Path
+	})}
+	go server.Serve(listener)
+	defer server.Close()
+
+	sink, err := NewAlertmanagerSink(mustParseURL("unix://" + socketPath + "?cluster=test"))
+	assert.NoError(t, err)
+	assert.Equal(t, socketPath, sink.SocketPath)
+	assert.NoError(t, sink.Send(makeAlerts(1)))
+	assert.Equal(t, "/api/v2/alerts", <-paths)
+	assert.NoError(t, sink.HealthCheck())
+	assert.Equal(t, "/api/v2/status", <-paths)
+
+	// The socket doesn't need to exist yet.
+	_, err = NewAlertmanagerSink(mustParseURL("unix://" + dir + "/later.sock?cluster=test"))
+	assert.NoError(t, err)
+
+	regular := filepath.Join(dir, "regular")
+	assert.NoError(t, ioutil.WriteFile(regular, nil, 0644))
+	for _, invalid := range []string{"unix:am.sock?cluster=test", "unix://" + regular + "?cluster=test",
+		"unix://" + socketPath + "?cluster=test&tls_insecure_skip_verify=true",
+		"unix://" + socketPath + "?cluster=test&proxy_url=http://proxy:3128"} {
+		_, err := NewAlertmanagerSink(mustParseURL(invalid))
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestRequestTimeout(t *testing.T) {
+	assert.Equal(t, DEFAULT_TIMEOUT, newTestSink(t, "localhost:9093", "").Timeout)
+
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	sink := newTestSink(t, strings.TrimPrefix(server.URL, "http://"), "timeout=50ms&max_retries=0")
+	assert.Equal(t, 50*time.Millisecond, sink.Timeout)
+	start := time.Now()
+	assert.Error(t, sink.Send(makeAlerts(1)))
+	assert.True(t, time.Since(start) < time.Second, "request wasn't aborted by the timeout")
+
+	for _, invalid := range []string{"timeout=0s", "timeout=-1s", "timeout=5"} {
+		_, err := NewAlertmanagerSink(mustParseURL("http://localhost:9093?cluster=test&" + invalid))
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestConnectionsAreReused(t *testing.T) {
+	var mu sync.Mutex
+	conns := 0
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	server.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			mu.Lock()
+			conns++
+			mu.Unlock()
+		}
+	}
+	server.Start()
+	defer server.Close()
+
+	sink := newTestSink(t, strings.TrimPrefix(server.URL, "http://"), "")
+	for i := 0; i < 5; i++ {
+		assert.NoError(t, sink.Send(makeAlerts(1)))
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, 1, conns)
+}
+
+func TestProxyURL(t *testing.T) {
+	var mu sync.Mutex
+	var hosts []string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		hosts = append(hosts, r.URL.Host)
+		mu.Unlock()
+	}))
+	defer proxy.Close()
+
+	sink := newTestSink(t, "alertmanager.example:9093", "proxy_url="+url.QueryEscape(proxy.URL))
+	assert.NoError(t, sink.Send(makeAlerts(1)))
+	mu.Lock()
+	assert.Equal(t, []string{"alertmanager.example:9093"}, hosts)
+	mu.Unlock()
+
+	for _, invalid := range []string{"proxy_url=proxy:3128", "proxy_url=" + url.QueryEscape("http://%zz")} {
+		_, err := NewAlertmanagerSink(mustParseURL("http://localhost:9093?cluster=test&" + invalid))
+		assert.Error(t, err, invalid)
+	}
+}
@@ -0,0 +1,203 @@
+// Copyright 2018 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package alertmanager
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	v1 "k8s.io/api/core/v1"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+)
+
+const (
+	// AlertCountAnnotation is the number of occurrences an alert stands for.
+	AlertCountAnnotation = "count"
+
+	// coalesceFlushes is how many times per dedup window expired entries
+	// are looked for.
+	coalesceFlushes = 10
+)
+
+// dedupEntry is what the recorder remembers of an alerted event: how many of
+// its occurrences were suppressed since, to be summarized once the dedup
+// window expires.
+type dedupEntry struct {
+	// last is the latest suppressed occurrence.
+	last      *v1.Event
+	count     int
+	expiresAt time.Time
+}
+
+// coalescer keeps track of the dedup entries with suppressed occurrences, as
+// the recorder can't be iterated and forgets entries once they expire. It
+// guards the counts of all the entries.
+type coalescer struct {
+	sync.Mutex
+	events map[string]*dedupEntry
+}
+
+func newCoalescer() *coalescer {
+	return &coalescer{events: make(map[string]*dedupEntry)}
+}
+
+// entry returns the entry to record for key until expiresAt. The occurrences
+// suppressed in a window that expired but wasn't flushed yet are carried
+// over, so that the alert sent for key accounts for them.
+func (c *coalescer) entry(key string, expiresAt time.Time) *dedupEntry {
+	c.Lock()
+	defer c.Unlock()
+	entry, ok := c.events[key]
+	if !ok {
+		entry = &dedupEntry{}
+	}
+	entry.expiresAt = expiresAt
+	return entry
+}
+
+// suppress counts a suppressed occurrence of the event recorded as entry.
+func (c *coalescer) suppress(key string, entry *dedupEntry, event *v1.Event) {
+	c.Lock()
+	defer c.Unlock()
+	entry.last = event
+	entry.count++
+	c.events[key] = entry
+}
+
+// take returns and resets the number of suppressed occurrences of the event.
+func (c *coalescer) take(key string) int {
+	c.Lock()
+	defer c.Unlock()
+	entry, ok := c.events[key]
+	if !ok {
+		return 0
+	}
+	delete(c.events, key)
+	count := entry.count
+	entry.count = 0
+	return count
+}
+
+// expired returns and resets the entries whose dedup window has expired by
+// now, by key.
+func (c *coalescer) expired(now time.Time) map[string]*dedupEntry {
+	return c.takeAll(func(entry *dedupEntry) bool { return !now.Before(entry.expiresAt) })
+}
+
+// remaining returns and resets all the entries with suppressed occurrences,
+// by key, whether their window expired or not.
+func (c *coalescer) remaining() map[string]*dedupEntry {
+	return c.takeAll(func(*dedupEntry) bool { return true })
+}
+
+// takeAll returns a copy of the entries selected, by key, and resets them.
+// The recorder keeps using the entries themselves.
+func (c *coalescer) takeAll(selected func(*dedupEntry) bool) map[string]*dedupEntry {
+	c.Lock()
+	defer c.Unlock()
+	taken := make(map[string]*dedupEntry)
+	for key, entry := range c.events {
+		if selected(entry) {
+			taken[key] = &dedupEntry{last: entry.last, count: entry.count}
+			entry.count = 0
+			delete(c.events, key)
+		}
+	}
+	return taken
+}
+
+// suppress counts a suppressed occurrence of the event of key, if key is
+// still recorded.
+func (a *AlertmanagerSink) suppress(key string, event *v1.Event) {
+	if entry, ok := a.recorder.Get(key); ok {
+		a.coalescer.suppress(key, entry.(*dedupEntry), event)
+	}
+}
+
+// annotateCount records in the alert how many occurrences it stands for: the
+// event it was created from and the suppressed ones. The count kubernetes
+// keeps for the event is kept if it is higher, as it includes occurrences
+// heapster never saw.
+func (a *AlertmanagerSink) annotateCount(alert *Alert) {
+	suppressed := a.coalescer.take(alert.dedupKey)
+	if suppressed == 0 {
+		return
+	}
+	if count, err := strconv.Atoi(alert.Annotations[AlertCountAnnotation]); err == nil && count > suppressed+1 {
+		return
+	}
+	setAnnotation(alert, AlertCountAnnotation, strconv.Itoa(suppressed+1))
+}
+
+// runCoalescer sends the summary alerts of expired dedup windows until the
+// sink is stopped.
+func (a *AlertmanagerSink) runCoalescer() {
+	defer a.workers.Done()
+	interval := a.DedupTTL / coalesceFlushes
+	if interval <= 0 {
+		interval = a.DedupTTL
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := a.flushCoalesced(); err != nil {
+				glog.Warningf("failed to send coalesced alerts to alertmanager: %v", err)
+			}
+		case <-a.ctx.Done():
+			return
+		}
+	}
+}
+
+// flushCoalesced sends a summary alert for every event with suppressed
+// occurrences whose dedup window expired without an alert being sent for it.
+// Like the recorder, expiry is checked against the wall clock. Like
+// heartbeats, summaries are sent directly and aren't retried.
+func (a *AlertmanagerSink) flushCoalesced() error {
+	return a.sendSummaries(a.ctx, a.coalescer.expired(time.Now()))
+}
+
+// sendSummaries sends a summary alert for each of the coalesced events.
+func (a *AlertmanagerSink) sendSummaries(ctx context.Context, entries map[string]*dedupEntry) error {
+	var alerts []*Alert
+	for key, entry := range entries {
+		alert, err := a.buildAlert(entry.last)
+		if err != nil {
+			a.record(key, AuditDecisionDropped, err.Error())
+			continue
+		}
+		alert.dedupKey = key
+		setAnnotation(alert, AlertCountAnnotation, strconv.Itoa(entry.count))
+		alerts = append(alerts, alert)
+		a.record(key, AuditDecisionSent, fmt.Sprintf("summary of %d suppressed occurrence(s)", entry.count))
+	}
+	var errs []error
+	for start := 0; start < len(alerts); start += a.BatchSize {
+		end := start + a.BatchSize
+		if end > len(alerts) {
+			end = len(alerts)
+		}
+		if err := a.sendChunk(ctx, alerts[start:end]); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return utilerrors.NewAggregate(errs)
+}
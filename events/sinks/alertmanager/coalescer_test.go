@@ -0,0 +1,151 @@
+// Copyright 2018 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package alertmanager
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/heapster/events/core"
+)
+
+func TestCoalescerCountsAcrossWindow(t *testing.T) {
+	am := newFakeAlertmanager(nil)
+	defer am.server.Close()
+
+	// A window long enough for the background flush not to interfere.
+	sink := newTestSink(t, am.host(), "dedup_ttl=1h")
+	defer sink.Stop()
+	backOff := &v1.Event{Type: v1.EventTypeWarning, Reason: "BackOff", Message: "restarting",
+		InvolvedObject: v1.ObjectReference{Kind: "Pod", Name: "web-0"}}
+	oomKilled := &v1.Event{Type: v1.EventTypeWarning, Reason: "OOMKilled", Message: "out of memory",
+		InvolvedObject: v1.ObjectReference{Kind: "Pod", Name: "web-1"}}
+	batch := func(events ...*v1.Event) *core.EventBatch { return &core.EventBatch{Events: events} }
+
+	// The first occurrences are sent.
+	assert.NoError(t, sink.ExportEventsWithError(batch(backOff, oomKilled)))
+	assert.Len(t, am.received(), 1)
+	assert.Len(t, am.received()[0], 2)
+
+	// The repeats of backOff are suppressed and counted by the recorder.
+	assert.NoError(t, sink.ExportEventsWithError(batch(backOff, backOff)))
+	assert.Len(t, am.received(), 1)
+	key := sink.dedupKey(backOff)
+	entry, ok := sink.recorder.Get(key)
+	assert.True(t, ok)
+	assert.Equal(t, 2, entry.(*dedupEntry).count)
+
+	// Nothing is flushed before the window expires.
+	assert.NoError(t, sink.flushCoalesced())
+	assert.Len(t, am.received(), 1)
+
+	// A summary of the repeats is sent once their window expired.
+	sink.recorder.Remove(key)
+	sink.coalescer.events[key].expiresAt = time.Now()
+	assert.NoError(t, sink.flushCoalesced())
+	assert.Len(t, am.received(), 2)
+	summary := am.received()[1][0]
+	assert.Equal(t, "BackOff", summary.Labels[AlertReasonLabel])
+	assert.Equal(t, "2", summary.Annotations[AlertCountAnnotation])
+
+	// oomKilled never repeated, so it has no summary.
+	assert.NoError(t, sink.flushCoalesced())
+	assert.Len(t, am.received(), 2)
+
+	// The next occurrence starts a new window and alerts without a count.
+	assert.NoError(t, sink.ExportEventsWithError(batch(backOff)))
+	assert.Len(t, am.received(), 3)
+	assert.Empty(t, am.received()[2][0].Annotations[AlertCountAnnotation])
+}
+
+func TestCoalescerFlushesOnExpiry(t *testing.T) {
+	am := newFakeAlertmanager(nil)
+	defer am.server.Close()
+
+	sink := newTestSink(t, am.host(), "dedup_ttl=100ms")
+	defer sink.Stop()
+	backOff := podEvent("web-0", "BackOff", "Back-off restarting failed container")
+	batch := &core.EventBatch{Events: []*v1.Event{backOff}}
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, sink.ExportEventsWithError(batch))
+	}
+	assert.Len(t, am.received(), 1)
+
+	// The summary is sent by the background flush, without any further
+	// occurrence.
+	deadline := time.Now().Add(5 * time.Second)
+	for len(am.received()) < 2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Len(t, am.received(), 2)
+	assert.Equal(t, "2", am.received()[1][0].Annotations[AlertCountAnnotation])
+}
+
+func TestCoalescerCountsAlertedRepeat(t *testing.T) {
+	sink := newTestSink(t, "localhost:9093", "")
+	defer sink.Stop()
+
+	// An expired window that wasn't flushed yet is accounted for by the
+	// next alert.
+	event := &v1.Event{Type: v1.EventTypeWarning, Reason: "BackOff", Message: "restarting"}
+	sink.recordKey("key")
+	sink.suppress("key", event)
+	sink.suppress("key", event)
+	sink.recorder.Remove("key")
+	sink.recordKey("key")
+	alert := &Alert{dedupKey: "key"}
+	sink.annotateCount(alert)
+	assert.Equal(t, "3", alert.Annotations[AlertCountAnnotation])
+	assert.Empty(t, sink.coalescer.remaining())
+}
+
+func TestCoalescerKeepsHigherEventCount(t *testing.T) {
+	sink := newTestSink(t, "localhost:9093", "")
+	defer sink.Stop()
+
+	event := &v1.Event{Type: v1.EventTypeWarning, Reason: "BackOff", Message: "restarting"}
+	sink.recordKey("key")
+	sink.suppress("key", event)
+	sink.suppress("key", event)
+	alert := &Alert{dedupKey: "key", Annotations: map[string]string{AlertCountAnnotation: "10"}}
+	sink.annotateCount(alert)
+	assert.Equal(t, "10", alert.Annotations[AlertCountAnnotation])
+
+	sink.suppress("key", event)
+	sink.suppress("key", event)
+	alert = &Alert{dedupKey: "key", Annotations: map[string]string{AlertCountAnnotation: "2"}}
+	sink.annotateCount(alert)
+	assert.Equal(t, "3", alert.Annotations[AlertCountAnnotation])
+}
+
+func TestCoalescerFlushedOnStop(t *testing.T) {
+	am := newFakeAlertmanager(nil)
+	defer am.server.Close()
+
+	sink := newTestSink(t, am.host(), "dedup_ttl=1h")
+	backOff := &v1.Event{Type: v1.EventTypeWarning, Reason: "BackOff", Message: "restarting",
+		InvolvedObject: v1.ObjectReference{Kind: "Pod", Name: "web-0"}}
+	assert.NoError(t, sink.ExportEventsWithError(&core.EventBatch{Events: []*v1.Event{backOff}}))
+	assert.NoError(t, sink.ExportEventsWithError(&core.EventBatch{Events: []*v1.Event{backOff}}))
+	assert.Len(t, am.received(), 1)
+
+	// The window is far from expired, yet the summary isn't lost on stop.
+	sink.Stop()
+	assert.Len(t, am.received(), 2)
+	assert.Equal(t, "BackOff", am.received()[1][0].Labels[AlertReasonLabel])
+	assert.Equal(t, "1", am.received()[1][0].Annotations[AlertCountAnnotation])
+}
@@ -0,0 +1,69 @@
+// Copyright 2018 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package alertmanager
+
+import (
+	"github.com/golang/glog"
+	"github.com/prometheus/client_golang/prometheus"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/heapster/events/core"
+)
+
+var (
+	// Number of dedup keys evicted from a full recorder.
+	recorderEvictions = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: "eventer",
+			Subsystem: "alertmanager",
+			Name:      "dedup_evictions_total",
+			Help:      "Number of dedup keys evicted because the dedup cache was full, see recorder_size.",
+		},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(recorderEvictions)
+}
+
+// DefaultDedupKeys are the fields alerts used to be deduplicated on, the
+// normalized message included. dedup_keys=type,namespace,name,reason
+// deduplicates events whatever their message.
+var DefaultDedupKeys = core.DefaultIdentityFields
+
+// parseDedupKeys validates a comma-separated list of identity fields and
+// returns them in canonical order.
+func parseDedupKeys(value string) ([]string, error) {
+	return core.ParseIdentityFields(value)
+}
+
+// generateKey returns the dedup key of the event made of the given fields.
+// core.IdentityKey normalizes the message if it is one of them, so that
+// counters, attempt numbers and addresses in it don't make every occurrence
+// distinct.
+func generateKey(fields []string, event *v1.Event) string {
+	return core.IdentityKey(fields, event)
+}
+
+// recordKey remembers key in the dedup recorder, counting the key it evicts
+// if the recorder is full. Evictions before the dedup ttl has passed mean
+// the recorder is too small, as evicted events alert again.
+func (a *AlertmanagerSink) recordKey(key string) {
+	if _, found := a.recorder.Get(key); !found && a.recorder.Len() >= a.recorderSize {
+		recorderEvictions.Inc()
+		glog.V(2).Infof("dedup cache is full with %d entries, evicting the oldest key", a.recorderSize)
+	}
+	expiresAt := a.dedupExpiry()
+	a.recorder.Add(key, a.coalescer.entry(key, expiresAt), expiresAt)
+}
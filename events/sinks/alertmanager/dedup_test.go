@@ -0,0 +1,238 @@
+// Copyright 2018 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package alertmanager
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/heapster/events/core"
+)
+
+func podEvent(name, reason, message string) *v1.Event {
+	return &v1.Event{
+		Type:    v1.EventTypeWarning,
+		Reason:  reason,
+		Message: message,
+		InvolvedObject: v1.ObjectReference{
+			Kind:      "Pod",
+			Namespace: "default",
+			Name:      name,
+		},
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default"},
+	}
+}
+
+func TestDefaultDedupKeyNormalizesMessage(t *testing.T) {
+	first := podEvent("web-0", "BackOff", "Back-off restarting failed container (attempt 1)")
+	second := podEvent("web-0", "BackOff", "Back-off restarting failed container (attempt 2)")
+	assert.Equal(t, generateKey(DefaultDedupKeys, first), generateKey(DefaultDedupKeys, second))
+
+	other := podEvent("web-1", "BackOff", "Back-off restarting failed container (attempt 1)")
+	assert.NotEqual(t, generateKey(DefaultDedupKeys, first), generateKey(DefaultDedupKeys, other))
+
+	// Events with different messages still alert separately by default,
+	// unless the message is left out of the dedup keys.
+	pulled := podEvent("web-0", "BackOff", "Back-off pulling image")
+	assert.NotEqual(t, generateKey(DefaultDedupKeys, first), generateKey(DefaultDedupKeys, pulled))
+	withoutMessage := []string{"type", "namespace", "name", "reason"}
+	assert.Equal(t, generateKey(withoutMessage, first), generateKey(withoutMessage, pulled))
+}
+
+func TestDedupKeyHasNoConcatenationCollisions(t *testing.T) {
+	fields := []string{"name", "reason"}
+	assert.NotEqual(t,
+		generateKey(fields, podEvent("ab", "c", "")),
+		generateKey(fields, podEvent("a", "bc", "")))
+}
+
+func TestDedupKeyNormalizesMessage(t *testing.T) {
+	fields := []string{"type", "namespace", "name", "reason", "message"}
+	first := podEvent("web-0", "Failed", `Failed to pull image "x": rpc error: dial tcp 10.0.0.12:443: i/o timeout (attempt 7)`)
+	second := podEvent("web-0", "Failed", `Failed to pull image "x": rpc error: dial tcp 10.0.3.7:443: i/o timeout (attempt 12)`)
+	assert.Equal(t, generateKey(fields, first), generateKey(fields, second))
+	// The event itself is left alone.
+	assert.Contains(t, first.Message, "attempt 7")
+
+	other := podEvent("web-0", "Failed", `Failed to pull image "y": manifest unknown`)
+	assert.NotEqual(t, generateKey(fields, first), generateKey(fields, other))
+}
+
+func TestDedupKeyOption(t *testing.T) {
+	assert.Equal(t, DefaultDedupKeys, newTestSink(t, "localhost:9093", "").DedupKeys)
+	// dedup_key is an alias of dedup_keys.
+	sink := newTestSink(t, "localhost:9093", "dedup_key=type,namespace,name,reason")
+	assert.Equal(t, []string{"type", "namespace", "name", "reason"}, sink.DedupKeys)
+}
+
+func TestParseDedupKeys(t *testing.T) {
+	fields, err := parseDedupKeys("reason, message,namespace")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"namespace", "reason", "message"}, fields)
+
+	first := podEvent("web-0", "BackOff", "one")
+	second := podEvent("web-0", "BackOff", "two")
+	assert.NotEqual(t, generateKey(fields, first), generateKey(fields, second))
+
+	_, err = parseDedupKeys("reason,uid")
+	assert.Error(t, err)
+	_, err = parseDedupKeys(" , ")
+	assert.Error(t, err)
+}
+
+func TestDedupJitter(t *testing.T) {
+	sink := newTestSink(t, "localhost:9093", "")
+	before := time.Now()
+	expiry := sink.dedupExpiry()
+	assert.False(t, expiry.Before(before.Add(DEDUP_WINDOW)))
+	assert.False(t, expiry.After(time.Now().Add(DEDUP_WINDOW)))
+
+	sink = newTestSink(t, "localhost:9093", "dedup_jitter=30s")
+	assert.Equal(t, 30*time.Second, sink.DedupJitter)
+	expiries := make(map[time.Duration]bool)
+	for i := 0; i < 20; i++ {
+		window := sink.dedupExpiry().Sub(time.Now())
+		assert.True(t, window > DEDUP_WINDOW-31*time.Second && window <= DEDUP_WINDOW+30*time.Second, "window %v", window)
+		expiries[window.Round(time.Second)] = true
+	}
+	assert.True(t, len(expiries) > 1, "expiries aren't spread")
+
+	for _, invalid := range []string{"dedup_jitter=-1s", "dedup_jitter=5m", "dedup_jitter=lots"} {
+		_, err := NewAlertmanagerSink(mustParseURL("http://localhost:9093?cluster=test&" + invalid))
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestDedupTTL(t *testing.T) {
+	sink := newTestSink(t, "localhost:9093", "")
+	assert.Equal(t, DEDUP_WINDOW, sink.DedupTTL)
+
+	sink = newTestSink(t, "localhost:9093", "dedup_ttl=15m")
+	assert.Equal(t, 15*time.Minute, sink.DedupTTL)
+	// The jitter is bounded by the configured ttl rather than the default.
+	sink = newTestSink(t, "localhost:9093", "dedup_ttl=15m&dedup_jitter=10m")
+	assert.Equal(t, 10*time.Minute, sink.DedupJitter)
+
+	for _, invalid := range []string{"dedup_ttl=0s", "dedup_ttl=-1m", "dedup_ttl=15", "dedup_ttl=1m&dedup_jitter=1m"} {
+		_, err := NewAlertmanagerSink(mustParseURL("http://localhost:9093?cluster=test&" + invalid))
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestDedupTTLExpiry(t *testing.T) {
+	am := newFakeAlertmanager(nil)
+	defer am.server.Close()
+
+	sink := newTestSink(t, am.host(), "dedup_ttl=100ms")
+	batch := &core.EventBatch{Events: []*v1.Event{podEvent("web-0", "BackOff", "Back-off restarting failed container")}}
+
+	// The first occurrence is sent, a repeat within the ttl is dropped.
+	assert.NoError(t, sink.ExportEventsWithError(batch))
+	assert.Len(t, am.received(), 1)
+	assert.NoError(t, sink.ExportEventsWithError(batch))
+	assert.Len(t, am.received(), 1)
+
+	// Once the key has expired a summary of the repeat is sent, then the
+	// event is sent again.
+	time.Sleep(150 * time.Millisecond)
+	assert.NoError(t, sink.flushCoalesced())
+	assert.Len(t, am.received(), 2)
+	assert.Equal(t, "1", am.received()[1][0].Annotations[AlertCountAnnotation])
+	assert.NoError(t, sink.ExportEventsWithError(batch))
+	assert.Len(t, am.received(), 3)
+	assert.NoError(t, sink.ExportEventsWithError(batch))
+	assert.Len(t, am.received(), 3)
+}
+
+func TestConcurrentExportEvents(t *testing.T) {
+	am := newFakeAlertmanager(nil)
+	defer am.server.Close()
+
+	sink := newTestSink(t, am.host(), "node_incident_window=1m")
+	batch := &core.EventBatch{Events: []*v1.Event{
+		podEvent("web-0", "BackOff", "Back-off restarting failed container"),
+		podEvent("web-1", "BackOff", "Back-off restarting failed container"),
+	}}
+
+	const exporters = 8
+	var wg sync.WaitGroup
+	for i := 0; i < exporters; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sink.ExportEvents(batch)
+		}()
+	}
+	wg.Wait()
+
+	// Only the very first export sends, every other one is deduped.
+	sent := 0
+	for _, alerts := range am.received() {
+		sent += len(alerts)
+	}
+	assert.Equal(t, 2, sent)
+}
+
+func TestRecorderSize(t *testing.T) {
+	am := newFakeAlertmanager(nil)
+	defer am.server.Close()
+
+	events := []*v1.Event{
+		podEvent("web-0", "BackOff", "Back-off restarting failed container"),
+		podEvent("web-1", "BackOff", "Back-off restarting failed container"),
+		podEvent("web-2", "BackOff", "Back-off restarting failed container"),
+	}
+	repeat := &core.EventBatch{Events: events[:1]}
+
+	// With room for two keys, the third event evicts the first one, so its
+	// repeat is taken for a first occurrence and sent again.
+	sink := newTestSink(t, am.host(), "recorder_size=2")
+	assert.Equal(t, 2, sink.recorderSize)
+	evictions := metricValue(t, recorderEvictions)
+	assert.NoError(t, sink.ExportEventsWithError(&core.EventBatch{Events: events}))
+	assert.NoError(t, sink.ExportEventsWithError(repeat))
+	assert.Len(t, am.received(), 2)
+	assert.Len(t, am.received()[1], 1)
+	assert.Equal(t, 2, sink.recorder.Len())
+	assert.Equal(t, evictions+2, metricValue(t, recorderEvictions))
+
+	// Once the cache holds every key the repeat is deduped.
+	sink = newTestSink(t, am.host(), "recorder_size=3")
+	evictions = metricValue(t, recorderEvictions)
+	assert.NoError(t, sink.ExportEventsWithError(&core.EventBatch{Events: events}))
+	assert.NoError(t, sink.ExportEventsWithError(repeat))
+	assert.Len(t, am.received(), 3)
+	assert.Equal(t, evictions, metricValue(t, recorderEvictions))
+
+	assert.Equal(t, MAX_RECORDER, newTestSink(t, am.host(), "").recorderSize)
+	// dedup_cache_size is an alias.
+	assert.Equal(t, 7, newTestSink(t, am.host(), "dedup_cache_size=7").recorderSize)
+	for _, invalid := range []string{"0", "-1", "abc"} {
+		_, err := NewAlertmanagerSink(mustParseURL("http://localhost:9093?cluster=test&recorder_size=" + invalid))
+		assert.Error(t, err, invalid)
+	}
+}
+
+func metricValue(t *testing.T, metric prometheus.Metric) float64 {
+	var m dto.Metric
+	assert.NoError(t, metric.Write(&m))
+	return m.Counter.GetValue()
+}
@@ -0,0 +1,68 @@
+// Copyright 2018 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package alertmanager
+
+import (
+	"time"
+
+	"github.com/golang/glog"
+	v1 "k8s.io/api/core/v1"
+)
+
+const (
+	HeartbeatAlertName = "HeapsterHeartbeat"
+
+	// A heartbeat alert resolves if it isn't renewed within this many
+	// intervals, so a dead man's switch notices a stopped eventer.
+	heartbeatLifetime = 3
+)
+
+// runHeartbeat sends a heartbeat alert right away and then every interval
+// until the sink is stopped. Heartbeats are sent directly, bypassing the
+// level filter, dedup and back off applied to event alerts.
+func (a *AlertmanagerSink) runHeartbeat(interval time.Duration) {
+	defer a.workers.Done()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := a.sendChunk(a.ctx, []*Alert{a.heartbeatAlert(interval)}); err != nil {
+			glog.Warningf("failed to send heartbeat to alertmanager: %v", err)
+		}
+		select {
+		case <-ticker.C:
+		case <-a.ctx.Done():
+			return
+		}
+	}
+}
+
+func (a *AlertmanagerSink) heartbeatAlert(interval time.Duration) *Alert {
+	now := a.now()
+	alert := &Alert{
+		Labels: map[string]string{
+			AlertNameLabel:    HeartbeatAlertName,
+			AlertClusterLabel: a.Cluster,
+			AlertLevelLabel:   v1.EventTypeNormal,
+		},
+		Annotations: map[string]string{
+			AlertMessageAnnotation: "heapster eventer is running",
+		},
+		StartsAt:     now,
+		EndsAt:       now.Add(heartbeatLifetime * interval),
+		GeneratorURL: a.renderGeneratorURL(nil),
+	}
+	a.applyLabels(alert)
+	return alert
+}
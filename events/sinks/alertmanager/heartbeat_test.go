@@ -0,0 +1,67 @@
+// Copyright 2018 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package alertmanager
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+)
+
+func TestHeartbeat(t *testing.T) {
+	am := newFakeAlertmanager(nil)
+	defer am.server.Close()
+
+	// Normal events are below the level of the sink, heartbeats are not.
+	sink := newTestSink(t, am.host(), "heartbeat=10ms&label=team:infra")
+	assert.Equal(t, 10*time.Millisecond, sink.Heartbeat)
+	time.Sleep(50 * time.Millisecond)
+	sink.Stop()
+	// A request cancelled by Stop may still reach the server.
+	time.Sleep(20 * time.Millisecond)
+
+	chunks := am.received()
+	assert.True(t, len(chunks) >= 2, "got %d heartbeats", len(chunks))
+	alert := chunks[0][0]
+	assert.Equal(t, HeartbeatAlertName, alert.Labels[AlertNameLabel])
+	assert.Equal(t, "test", alert.Labels[AlertClusterLabel])
+	assert.Equal(t, v1.EventTypeNormal, alert.Labels[AlertLevelLabel])
+	assert.Equal(t, "infra", alert.Labels["team"])
+
+	// Nothing is sent once Stop has returned.
+	time.Sleep(30 * time.Millisecond)
+	assert.Len(t, am.received(), len(chunks))
+}
+
+func TestHeartbeatDisabledByDefault(t *testing.T) {
+	sink := newTestSink(t, "localhost:9093", "")
+	assert.Equal(t, time.Duration(0), sink.Heartbeat)
+	sink.Stop()
+
+	_, err := NewAlertmanagerSink(mustParseURL("http://localhost:9093?cluster=test&heartbeat=often"))
+	assert.Error(t, err)
+}
+
+func TestHeartbeatAlertExpires(t *testing.T) {
+	sink := newTestSink(t, "localhost:9093", "")
+	now := time.Date(2018, 3, 1, 10, 0, 0, 0, time.UTC)
+	sink.now = func() time.Time { return now }
+
+	alert := sink.heartbeatAlert(time.Minute)
+	assert.Equal(t, now, alert.StartsAt)
+	assert.Equal(t, now.Add(3*time.Minute), alert.EndsAt)
+}
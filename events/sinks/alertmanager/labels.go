@@ -0,0 +1,277 @@
+// Copyright 2018 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package alertmanager
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+	"text/template"
+
+	"github.com/golang/glog"
+	v1 "k8s.io/api/core/v1"
+)
+
+// labelNameOptions are the options overriding the names of generated labels.
+var labelNameOptions = map[string]string{
+	"alertname_label": AlertNameLabel,
+	"cluster_label":   AlertClusterLabel,
+	"group_label":     AlertGroupLabel,
+	"level_label":     AlertLevelLabel,
+	"instance_label":  AlertInstanceLabel,
+	"reason_label":    AlertReasonLabel,
+
+	"kind_label":             AlertKindLabel,
+	"object_namespace_label": AlertObjectNamespaceLabel,
+	"object_name_label":      AlertObjectNameLabel,
+	"field_path_label":       AlertFieldPathLabel,
+	"component_label":        AlertComponentLabel,
+	"host_label":             AlertHostLabel,
+}
+
+var labelNameRE = regexp.MustCompile("^[a-zA-Z_][a-zA-Z0-9_]*$")
+
+// parseLabelNames returns the overridden label names keyed by the default
+// name, or nil if no names are overridden.
+func parseLabelNames(opts map[string][]string) (map[string]string, error) {
+	var names map[string]string
+	for option, label := range labelNameOptions {
+		if len(opts[option]) == 0 {
+			continue
+		}
+		name := opts[option][0]
+		if !labelNameRE.MatchString(name) {
+			return nil, fmt.Errorf("%s must be a valid label name, got %q", option, name)
+		}
+		if names == nil {
+			names = make(map[string]string)
+		}
+		names[label] = name
+	}
+
+	// Two labels renamed to the same name would overwrite each other.
+	seen := make(map[string]string)
+	for _, label := range labelNameOptions {
+		name := label
+		if override, ok := names[label]; ok {
+			name = override
+		}
+		if other, ok := seen[name]; ok {
+			return nil, fmt.Errorf("labels %s and %s can't both be named %q", other, label, name)
+		}
+		seen[name] = label
+	}
+	return names, nil
+}
+
+// renameLabels renames the generated labels of the alert as configured.
+func renameLabels(alert *Alert, names map[string]string) {
+	if len(names) == 0 {
+		return
+	}
+	labels := make(map[string]string, len(alert.Labels))
+	for label, value := range alert.Labels {
+		if name, ok := names[label]; ok {
+			label = name
+		}
+		labels[label] = value
+	}
+	alert.Labels = labels
+}
+
+// labelFilter selects which of the generated labels are attached to alerts.
+// Labels filtered out are kept as annotations, so the information isn't lost
+// but doesn't add to the label cardinality.
+type labelFilter struct {
+	include map[string]bool
+	exclude map[string]bool
+}
+
+// parseLabelSet parses a comma-separated list of label names. The alertname
+// label is required by alertmanager and can't be filtered out.
+func parseLabelSet(option, value string) (map[string]bool, error) {
+	labels := make(map[string]bool)
+	for _, label := range strings.Split(value, ",") {
+		label = strings.TrimSpace(label)
+		if label == "" {
+			continue
+		}
+		labels[label] = true
+	}
+	if len(labels) == 0 {
+		return nil, fmt.Errorf("%s must list at least one label", option)
+	}
+	return labels, nil
+}
+
+func newLabelFilter(include, exclude string) (*labelFilter, error) {
+	f := &labelFilter{}
+	var err error
+	if include != "" {
+		if f.include, err = parseLabelSet("label_include", include); err != nil {
+			return nil, err
+		}
+		f.include[AlertNameLabel] = true
+	}
+	if exclude != "" {
+		if f.exclude, err = parseLabelSet("label_exclude", exclude); err != nil {
+			return nil, err
+		}
+		if f.exclude[AlertNameLabel] {
+			return nil, fmt.Errorf("label_exclude can't contain the %s label", AlertNameLabel)
+		}
+	}
+	return f, nil
+}
+
+func (f *labelFilter) allowed(label string) bool {
+	if f.include != nil && !f.include[label] {
+		return false
+	}
+	return !f.exclude[label]
+}
+
+// apply moves the labels not allowed by the filter to the annotations of the
+// alert. A nil filter keeps all labels.
+func (f *labelFilter) apply(alert *Alert) {
+	if f == nil {
+		return
+	}
+	for label, value := range alert.Labels {
+		if f.allowed(label) {
+			continue
+		}
+		delete(alert.Labels, label)
+		if _, ok := alert.Annotations[label]; !ok {
+			setAnnotation(alert, label, value)
+		}
+	}
+}
+
+const (
+	LABEL_PRECEDENCE_EVENT  = "event"
+	LABEL_PRECEDENCE_STATIC = "static"
+)
+
+// parseStaticLabels parses repeated key:value or key=value label options.
+// The key ends at the first separator, so values may contain either.
+func parseStaticLabels(values []string) (map[string]string, error) {
+	labels := make(map[string]string, len(values))
+	for _, value := range values {
+		i := strings.IndexAny(value, ":=")
+		if i < 0 || !labelNameRE.MatchString(value[:i]) {
+			return nil, fmt.Errorf("label must be key:value or key=value with a valid label name as key, got %q", value)
+		}
+		labels[value[:i]] = value[i+1:]
+	}
+	return labels, nil
+}
+
+// parseFieldTemplates parses repeated name=template options, the template
+// ending up as the value of the label or annotation name.
+func parseFieldTemplates(option string, values []string) (map[string]*template.Template, error) {
+	templates := make(map[string]*template.Template, len(values))
+	for _, value := range values {
+		i := strings.Index(value, "=")
+		if i < 0 || !labelNameRE.MatchString(value[:i]) {
+			return nil, fmt.Errorf("%s must be name=template with a valid label name as name, got %q", option, value)
+		}
+		tmpl, err := template.New(value[:i]).Parse(value[i+1:])
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s for %s: %v", option, value[:i], err)
+		}
+		templates[value[:i]] = tmpl
+	}
+	return templates, nil
+}
+
+// renderFieldTemplates executes the templates with the event and calls set
+// with every result. Templates that fail are skipped.
+func renderFieldTemplates(templates map[string]*template.Template, event *v1.Event, set func(name, value string)) {
+	for name, tmpl := range templates {
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, event); err != nil {
+			glog.Warningf("failed to render template of %s for event %s/%s: %v", name, event.Namespace, event.Name, err)
+			continue
+		}
+		set(name, buf.String())
+	}
+}
+
+func parseLabelPrecedence(value string) (string, error) {
+	switch value {
+	case LABEL_PRECEDENCE_EVENT, LABEL_PRECEDENCE_STATIC:
+		return value, nil
+	default:
+		return "", fmt.Errorf("label_precedence must be %s or %s, got %q", LABEL_PRECEDENCE_EVENT, LABEL_PRECEDENCE_STATIC, value)
+	}
+}
+
+// mergeStaticLabels adds the static labels to the alert. On collision the
+// event derived label is kept unless static labels take precedence.
+func mergeStaticLabels(alert *Alert, labels map[string]string, precedence string) {
+	for label, value := range labels {
+		if _, ok := alert.Labels[label]; ok && precedence != LABEL_PRECEDENCE_STATIC {
+			continue
+		}
+		alert.Labels[label] = value
+	}
+}
+
+const (
+	GROUP_BY_NAMESPACE = "namespace"
+	GROUP_BY_KIND      = "kind"
+	GROUP_BY_NODE      = "node"
+	GROUP_BY_REASON    = "reason"
+)
+
+func parseGroupBy(value string) (string, error) {
+	switch value {
+	case GROUP_BY_NAMESPACE, GROUP_BY_KIND, GROUP_BY_NODE, GROUP_BY_REASON:
+		return value, nil
+	default:
+		return "", fmt.Errorf("group_by must be one of %s, %s, %s or %s, got %q",
+			GROUP_BY_NAMESPACE, GROUP_BY_KIND, GROUP_BY_NODE, GROUP_BY_REASON, value)
+	}
+}
+
+// groupValue returns the event field selected by groupBy.
+func groupValue(event *v1.Event, groupBy string) string {
+	switch groupBy {
+	case GROUP_BY_KIND:
+		return event.InvolvedObject.Kind
+	case GROUP_BY_NODE:
+		return event.Source.Host
+	case GROUP_BY_REASON:
+		return event.Reason
+	default:
+		return event.Namespace
+	}
+}
+
+// setGroupLabel sets the group label from the field selected by groupBy,
+// uppercased if upper is set. Events without that field get no group label.
+func setGroupLabel(alert *Alert, event *v1.Event, groupBy string, upper bool) {
+	group := groupValue(event, groupBy)
+	if group == "" {
+		delete(alert.Labels, AlertGroupLabel)
+		return
+	}
+	if upper {
+		group = strings.ToUpper(group)
+	}
+	alert.Labels[AlertGroupLabel] = group
+}
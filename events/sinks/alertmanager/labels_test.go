@@ -0,0 +1,306 @@
+// Copyright 2018 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package alertmanager
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func labelTestEvent() *v1.Event {
+	return &v1.Event{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "web-0.15a6d1b2c3d4e5f6"},
+		Type:       v1.EventTypeWarning,
+		Reason:     "BackOff",
+		Message:    "Back-off restarting failed container",
+	}
+}
+
+func TestLabelExclude(t *testing.T) {
+	sink := newTestSink(t, "localhost:9093", "label_exclude=instance,reason")
+	alert, err := sink.buildAlert(labelTestEvent())
+	assert.NoError(t, err)
+
+	assert.Equal(t, map[string]string{
+		AlertNameLabel:    "Back-off restarting failed container",
+		AlertGroupLabel:   "DEFAULT",
+		AlertLevelLabel:   v1.EventTypeWarning,
+		AlertClusterLabel: "test",
+	}, alert.Labels)
+	assert.Equal(t, "web-0.15a6d1b2c3d4e5f6", alert.Annotations[AlertInstanceLabel])
+	assert.Equal(t, "BackOff", alert.Annotations[AlertReasonLabel])
+}
+
+func TestLabelInclude(t *testing.T) {
+	sink := newTestSink(t, "localhost:9093", "label_include=cluster,reason&label_exclude=reason")
+	alert, err := sink.buildAlert(labelTestEvent())
+	assert.NoError(t, err)
+
+	// alertname is always kept.
+	assert.Equal(t, map[string]string{
+		AlertNameLabel:    "Back-off restarting failed container",
+		AlertClusterLabel: "test",
+	}, alert.Labels)
+	assert.Equal(t, "DEFAULT", alert.Annotations[AlertGroupLabel])
+	assert.Equal(t, "BackOff", alert.Annotations[AlertReasonLabel])
+}
+
+func TestLabelFilterOptions(t *testing.T) {
+	for _, invalid := range []string{"label_exclude=alertname", "label_include=,", "label_exclude=,"} {
+		_, err := NewAlertmanagerSink(mustParseURL("http://localhost:9093?cluster=test&" + invalid))
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestLabelNameOverrides(t *testing.T) {
+	sink := newTestSink(t, "localhost:9093", "cluster_label=cluster_name&instance_label=event&label_exclude=reason")
+	alert, err := sink.buildAlert(labelTestEvent())
+	assert.NoError(t, err)
+
+	assert.Equal(t, map[string]string{
+		AlertNameLabel:  "Back-off restarting failed container",
+		AlertGroupLabel: "DEFAULT",
+		AlertLevelLabel: v1.EventTypeWarning,
+		"event":         "web-0.15a6d1b2c3d4e5f6",
+		"cluster_name":  "test",
+	}, alert.Labels)
+	assert.Equal(t, "BackOff", alert.Annotations[AlertReasonLabel])
+
+	for _, invalid := range []string{"cluster_label=", "level_label=0level", "group_label=a-b", "reason_label=level"} {
+		_, err := NewAlertmanagerSink(mustParseURL("http://localhost:9093?cluster=test&" + invalid))
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestStaticLabels(t *testing.T) {
+	sink := newTestSink(t, "localhost:9093", "label=region:us-east-1&label=team:platform&label=cluster:other&label=url:http://x")
+	alert, err := sink.buildAlert(labelTestEvent())
+	assert.NoError(t, err)
+	assert.Equal(t, "us-east-1", alert.Labels["region"])
+	assert.Equal(t, "platform", alert.Labels["team"])
+	assert.Equal(t, "http://x", alert.Labels["url"])
+	// Event derived labels take precedence by default.
+	assert.Equal(t, "test", alert.Labels[AlertClusterLabel])
+
+	sink = newTestSink(t, "localhost:9093", "label=cluster:other&label_precedence=static")
+	alert, err = sink.buildAlert(labelTestEvent())
+	assert.NoError(t, err)
+	assert.Equal(t, "other", alert.Labels[AlertClusterLabel])
+
+	sink = newTestSink(t, "localhost:9093", "label=env=prod&label=region=eu-west-1&label=team:platform&label=query=a:b&label=reason=Other")
+	alert, err = sink.buildAlert(labelTestEvent())
+	assert.NoError(t, err)
+	assert.Equal(t, "prod", alert.Labels["env"])
+	assert.Equal(t, "eu-west-1", alert.Labels["region"])
+	assert.Equal(t, "platform", alert.Labels["team"])
+	assert.Equal(t, "a:b", alert.Labels["query"])
+	assert.Equal(t, labelTestEvent().Reason, alert.Labels[AlertReasonLabel])
+
+	for _, invalid := range []string{"label=region", "label=:x", "label==x", "label=bad-key:x", "label=bad-key=x", "label_precedence=both"} {
+		_, err := NewAlertmanagerSink(mustParseURL("http://localhost:9093?cluster=test&" + invalid))
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestGroupBy(t *testing.T) {
+	event := labelTestEvent()
+	event.InvolvedObject.Kind = "Pod"
+	event.Source.Host = "node-1"
+
+	for query, group := range map[string]string{
+		"":                                 "DEFAULT",
+		"group_upper=false":                "default",
+		"group_by=kind":                    "POD",
+		"group_by=node&group_upper=false":  "node-1",
+		"group_by=reason&group_upper=true": "BACKOFF",
+	} {
+		sink := newTestSink(t, "localhost:9093", query)
+		alert, err := sink.buildAlert(event)
+		assert.NoError(t, err)
+		assert.Equal(t, group, alert.Labels[AlertGroupLabel], query)
+	}
+
+	// Events without the field get no group label.
+	event.Source.Host = ""
+	alert, err := newTestSink(t, "localhost:9093", "group_by=node").buildAlert(event)
+	assert.NoError(t, err)
+	assert.NotContains(t, alert.Labels, AlertGroupLabel)
+
+	for _, invalid := range []string{"group_by=controller", "group_upper=maybe"} {
+		_, err := NewAlertmanagerSink(mustParseURL("http://localhost:9093?cluster=test&" + invalid))
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestInvolvedObjectLabels(t *testing.T) {
+	tests := []struct {
+		name     string
+		object   v1.ObjectReference
+		labels   map[string]string
+		instance string
+	}{
+		{
+			name:   "pod",
+			object: v1.ObjectReference{Kind: "Pod", Namespace: "default", Name: "db-0"},
+			labels: map[string]string{
+				AlertKindLabel:            "Pod",
+				AlertObjectNamespaceLabel: "default",
+				AlertObjectNameLabel:      "db-0",
+			},
+			instance: "Pod/db-0",
+		},
+		{
+			name:   "cluster scoped node",
+			object: v1.ObjectReference{Kind: "Node", Name: "node-1"},
+			labels: map[string]string{
+				AlertKindLabel:       "Node",
+				AlertObjectNameLabel: "node-1",
+			},
+			instance: "Node/node-1",
+		},
+		{
+			name:   "container",
+			object: v1.ObjectReference{Kind: "Pod", Namespace: "default", Name: "web-0", FieldPath: "spec.containers{app}"},
+			labels: map[string]string{
+				AlertKindLabel:            "Pod",
+				AlertObjectNamespaceLabel: "default",
+				AlertObjectNameLabel:      "web-0",
+				AlertFieldPathLabel:       "spec.containers{app}",
+			},
+			instance: "Pod/web-0",
+		},
+		{
+			name:     "no object",
+			labels:   map[string]string{},
+			instance: "db-0.15a6d1b2c3d4e5f6",
+		},
+	}
+
+	sink := newTestSink(t, "localhost:9093", "")
+	kindName := newTestSink(t, "localhost:9093", "instance_format=kind/name")
+	for _, test := range tests {
+		event := &v1.Event{
+			ObjectMeta:     metav1.ObjectMeta{Namespace: "default", Name: "db-0.15a6d1b2c3d4e5f6"},
+			Type:           v1.EventTypeWarning,
+			Reason:         "BackOff",
+			Message:        "Back-off restarting failed container",
+			InvolvedObject: test.object,
+		}
+
+		alert, err := sink.buildAlert(event)
+		assert.NoError(t, err, test.name)
+		for _, label := range []string{AlertKindLabel, AlertObjectNamespaceLabel, AlertObjectNameLabel, AlertFieldPathLabel} {
+			value, ok := test.labels[label]
+			if !ok {
+				assert.NotContains(t, alert.Labels, label, test.name)
+				continue
+			}
+			assert.Equal(t, value, alert.Labels[label], test.name)
+		}
+		assert.Equal(t, event.Name, alert.Labels[AlertInstanceLabel], test.name)
+
+		alert, err = kindName.buildAlert(event)
+		assert.NoError(t, err, test.name)
+		assert.Equal(t, test.instance, alert.Labels[AlertInstanceLabel], test.name)
+	}
+
+	_, err := NewAlertmanagerSink(mustParseURL("http://localhost:9093?cluster=test&instance_format=uid"))
+	assert.Error(t, err)
+}
+
+func TestSourceLabels(t *testing.T) {
+	tests := []struct {
+		name      string
+		event     v1.Event
+		component string
+		host      string
+	}{
+		{
+			name:      "kubelet",
+			event:     v1.Event{Source: v1.EventSource{Component: "kubelet", Host: "node-1"}},
+			component: "kubelet",
+			host:      "node-1",
+		},
+		{
+			name:      "controller manager",
+			event:     v1.Event{Source: v1.EventSource{Component: "deployment-controller"}},
+			component: "deployment-controller",
+		},
+		{
+			name:      "reporting controller",
+			event:     v1.Event{ReportingController: "kubernetes.io/kubelet", ReportingInstance: "node-2"},
+			component: "kubernetes.io/kubelet",
+			host:      "node-2",
+		},
+		{
+			name: "no source",
+		},
+	}
+
+	sink := newTestSink(t, "localhost:9093", "")
+	for _, test := range tests {
+		event := test.event
+		event.Type = v1.EventTypeWarning
+		event.Reason = "BackOff"
+		event.Message = "Back-off restarting failed container"
+
+		alert, err := sink.buildAlert(&event)
+		assert.NoError(t, err, test.name)
+		for label, expected := range map[string]string{AlertComponentLabel: test.component, AlertHostLabel: test.host} {
+			if expected == "" {
+				assert.NotContains(t, alert.Labels, label, test.name)
+				continue
+			}
+			assert.Equal(t, expected, alert.Labels[label], test.name)
+		}
+	}
+}
+
+func TestFieldTemplates(t *testing.T) {
+	query := "label_template=" + url.QueryEscape(`severity={{ if eq .Type "Warning" }}critical{{ else }}info{{ end }}`) +
+		"&annotation_template=" + url.QueryEscape(`summary={{ .Reason }} on {{ .InvolvedObject.Kind }}/{{ .InvolvedObject.Name }}`) +
+		"&annotation_template=" + url.QueryEscape(`owner={{ .NoSuchField }}`)
+	sink := newTestSink(t, "localhost:9093", query)
+	assert.Len(t, sink.LabelTemplates, 1)
+	assert.Len(t, sink.AnnotationTemplates, 2)
+
+	event := labelTestEvent()
+	event.InvolvedObject = v1.ObjectReference{Kind: "Pod", Namespace: "default", Name: "web-0"}
+	alert, err := sink.buildAlert(event)
+	assert.NoError(t, err)
+	assert.Equal(t, "critical", alert.Labels["severity"])
+	assert.Equal(t, "BackOff on Pod/web-0", alert.Annotations["summary"])
+	// The template referencing a missing field is skipped.
+	assert.NotContains(t, alert.Annotations, "owner")
+
+	event.Type = v1.EventTypeNormal
+	alert, err = sink.buildAlert(event)
+	assert.NoError(t, err)
+	assert.Equal(t, "info", alert.Labels["severity"])
+
+	for _, invalid := range []string{
+		"label_template=severity",
+		"label_template=" + url.QueryEscape("bad-name=x"),
+		"label_template=" + url.QueryEscape("severity={{ .Type"),
+		"annotation_template=" + url.QueryEscape("summary={{ if }}"),
+	} {
+		_, err := NewAlertmanagerSink(mustParseURL("http://localhost:9093?cluster=test&" + invalid))
+		assert.Error(t, err, invalid)
+	}
+}
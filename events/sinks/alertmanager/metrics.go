@@ -0,0 +1,133 @@
+// Copyright 2018 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package alertmanager
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	// Number of alerts accepted by alertmanager.
+	alertsSent = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "eventer",
+			Subsystem: "alertmanager",
+			Name:      "alerts_sent_total",
+			Help:      "Number of alerts accepted by alertmanager.",
+		},
+		[]string{"cluster"},
+	)
+
+	// Number of alerts only logged, as the sink is in dry run mode.
+	alertsDryRun = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "eventer",
+			Subsystem: "alertmanager",
+			Name:      "alerts_dry_run_total",
+			Help:      "Number of alerts logged instead of sent because of dry_run.",
+		},
+		[]string{"cluster"},
+	)
+
+	// Number of events not alerted on as duplicates.
+	alertsDeduped = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "eventer",
+			Subsystem: "alertmanager",
+			Name:      "alerts_deduped_total",
+			Help:      "Number of events suppressed as duplicates of earlier alerts.",
+		},
+		[]string{"cluster"},
+	)
+
+	// Number of events not alerted on because of the filters.
+	alertsIgnored = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "eventer",
+			Subsystem: "alertmanager",
+			Name:      "alerts_ignored_total",
+			Help:      "Number of events ignored because of their reason, message or namespace.",
+		},
+		[]string{"cluster"},
+	)
+
+	// Number of events dropped for being too old.
+	staleEvents = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "eventer",
+			Subsystem: "alertmanager",
+			Name:      "stale_events_total",
+			Help:      "Number of events dropped because they were last seen before max_event_age.",
+		},
+		[]string{"cluster"},
+	)
+
+	// Number of events dropped inside a silence window.
+	silencedEvents = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "eventer",
+			Subsystem: "alertmanager",
+			Name:      "silenced_events_total",
+			Help:      "Number of events dropped because they arrived inside one of the silence_windows.",
+		},
+		[]string{"cluster"},
+	)
+
+	// Number of alerts alertmanager didn't accept.
+	alertsSendFailures = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "eventer",
+			Subsystem: "alertmanager",
+			Name:      "alerts_send_failures_total",
+			Help:      "Number of alerts that failed to be sent, after retries.",
+		},
+		[]string{"cluster"},
+	)
+
+	// Time spent sending a chunk of alerts, including retries.
+	sendDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: "eventer",
+			Subsystem: "alertmanager",
+			Name:      "send_duration_seconds",
+			Help:      "Time spent sending a chunk of alerts to alertmanager, including retries.",
+			Buckets:   prometheus.DefBuckets,
+		},
+		[]string{"cluster"},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(alertsSent)
+	prometheus.MustRegister(alertsDryRun)
+	prometheus.MustRegister(alertsDeduped)
+	prometheus.MustRegister(alertsIgnored)
+	prometheus.MustRegister(staleEvents)
+	prometheus.MustRegister(silencedEvents)
+	prometheus.MustRegister(alertsSendFailures)
+	prometheus.MustRegister(sendDuration)
+}
+
+// record records the decision taken for the event with the given key in the
+// audit log and the metrics of the sink.
+func (a *AlertmanagerSink) record(key, decision, reason string) {
+	switch decision {
+	case AuditDecisionDeduped:
+		alertsDeduped.WithLabelValues(a.Cluster).Inc()
+	case AuditDecisionIgnored:
+		alertsIgnored.WithLabelValues(a.Cluster).Inc()
+	}
+	a.audit.Record(key, decision, reason)
+}
@@ -0,0 +1,65 @@
+// Copyright 2018 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package alertmanager
+
+import (
+	"net/http"
+	"sync/atomic"
+	"testing"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/heapster/events/core"
+)
+
+func TestMetrics(t *testing.T) {
+	var reject int32
+	am := newFakeAlertmanager(func(w http.ResponseWriter, alerts []*Alert) {
+		if atomic.LoadInt32(&reject) == 1 {
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	})
+	defer am.server.Close()
+
+	// The metrics are labeled with the cluster, so other tests don't count.
+	sink, err := NewAlertmanagerSink(mustParseURL("http://" + am.host() + "?cluster=metrics-test&max_retries=0"))
+	assert.NoError(t, err)
+	batch := &core.EventBatch{Events: []*v1.Event{
+		podEvent("web-0", "BackOff", "Back-off restarting failed container"),
+		podEvent("web-1", "BackOff", "Back-off restarting failed container"),
+		podEvent("web-2", "Unhealthy", "Readiness probe failed"),
+	}}
+
+	// The first occurrences are sent, the repeats deduped and the reason
+	// ignored by default is ignored every time.
+	sink.ExportEvents(batch)
+	sink.ExportEvents(batch)
+	atomic.StoreInt32(&reject, 1)
+	sink.ExportEvents(&core.EventBatch{Events: []*v1.Event{
+		podEvent("web-3", "BackOff", "Back-off restarting failed container"),
+		podEvent("web-4", "BackOff", "Back-off restarting failed container"),
+		podEvent("web-2", "Unhealthy", "Readiness probe failed"),
+	}})
+
+	assert.Equal(t, float64(2), metricValue(t, alertsSent.WithLabelValues("metrics-test")))
+	assert.Equal(t, float64(2), metricValue(t, alertsDeduped.WithLabelValues("metrics-test")))
+	assert.Equal(t, float64(3), metricValue(t, alertsIgnored.WithLabelValues("metrics-test")))
+	assert.Equal(t, float64(2), metricValue(t, alertsSendFailures.WithLabelValues("metrics-test")))
+
+	var m dto.Metric
+	assert.NoError(t, sendDuration.WithLabelValues("metrics-test").Write(&m))
+	assert.Equal(t, uint64(2), m.Histogram.GetSampleCount())
+}
@@ -0,0 +1,68 @@
+// Copyright 2018 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package alertmanager
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+// ClusterScopedNamespace stands for the empty namespace of cluster-scoped
+// objects in namespaces and exclude_namespaces.
+const ClusterScopedNamespace = "cluster-scoped"
+
+// namespaceFilter selects the events alerted on by the namespace of the
+// object they are about. Patterns are exact names or globs like dev-*.
+type namespaceFilter struct {
+	patterns []string
+	// exclude drops the matching events rather than keeping only them.
+	exclude bool
+}
+
+func newNamespaceFilter(option, value string, exclude bool) (*namespaceFilter, error) {
+	f := &namespaceFilter{exclude: exclude}
+	for _, pattern := range strings.Split(value, ",") {
+		pattern = strings.TrimSpace(pattern)
+		if pattern == ClusterScopedNamespace {
+			pattern = ""
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("%s has an invalid pattern %q: %v", option, pattern, err)
+		}
+		f.patterns = append(f.patterns, pattern)
+	}
+	return f, nil
+}
+
+func (f *namespaceFilter) matches(namespace string) bool {
+	for _, pattern := range f.patterns {
+		if ok, _ := path.Match(pattern, namespace); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// allowed tells whether the event passes the filter. A nil filter allows
+// all events.
+func (f *namespaceFilter) allowed(event *v1.Event) bool {
+	if f == nil {
+		return true
+	}
+	return f.matches(event.InvolvedObject.Namespace) != f.exclude
+}
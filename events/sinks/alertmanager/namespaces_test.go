@@ -0,0 +1,77 @@
+// Copyright 2018 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package alertmanager
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/heapster/events/core"
+)
+
+func namespacedEvent(namespace, name string) *v1.Event {
+	event := podEvent(name, "BackOff", "Back-off restarting failed container")
+	event.InvolvedObject.Namespace = namespace
+	event.Namespace = namespace
+	return event
+}
+
+func TestNamespaceFilter(t *testing.T) {
+	events := []*v1.Event{
+		namespacedEvent("prod", "web-0"),
+		namespacedEvent("prod-eu", "web-1"),
+		namespacedEvent("dev-alice", "web-2"),
+		namespacedEvent("ci-1234", "web-3"),
+		namespacedEvent("", "node-0"),
+	}
+	for _, tc := range []struct {
+		query    string
+		expected []string
+	}{
+		{"", []string{"web-0", "web-1", "web-2", "web-3", "node-0"}},
+		{"exclude_namespaces=dev-*,ci-*", []string{"web-0", "web-1", "node-0"}},
+		{"namespaces=prod*", []string{"web-0", "web-1"}},
+		{"namespaces=prod,cluster-scoped", []string{"web-0", "node-0"}},
+		{"exclude_namespaces=cluster-scoped", []string{"web-0", "web-1", "web-2", "web-3"}},
+	} {
+		am := newFakeAlertmanager(nil)
+		sink := newTestSink(t, am.host(), tc.query)
+		batch := &core.EventBatch{Events: events}
+		// The first occurrences are only recorded.
+		sink.ExportEvents(batch)
+		sink.ExportEvents(batch)
+
+		names := []string{}
+		for _, chunk := range am.received() {
+			for _, alert := range chunk {
+				names = append(names, alert.Labels[AlertObjectNameLabel])
+			}
+		}
+		assert.Equal(t, tc.expected, names, tc.query)
+		am.server.Close()
+	}
+}
+
+func TestNamespaceFilterOptions(t *testing.T) {
+	for _, invalid := range []string{
+		"namespaces=prod&exclude_namespaces=dev-*",
+		"namespaces=prod-[",
+		"exclude_namespaces=dev-[",
+	} {
+		_, err := NewAlertmanagerSink(mustParseURL("http://localhost:9093?cluster=test&" + invalid))
+		assert.Error(t, err, invalid)
+	}
+}
@@ -0,0 +1,151 @@
+// Copyright 2018 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package alertmanager
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+	v1 "k8s.io/api/core/v1"
+)
+
+const (
+	NodeIncidentAlertName = "NodeIncident"
+
+	AffectedPodsAnnotation     = "affected_pods"
+	AffectedPodCountAnnotation = "affected_pod_count"
+)
+
+// DefaultNodeIncidentReasons are the node event reasons treated as a
+// node-wide failure.
+var DefaultNodeIncidentReasons = []string{"NodeNotReady", "NodeUnreachable", "NodeNotSchedulable"}
+
+type nodeIncident struct {
+	reason    string
+	startsAt  time.Time
+	expiresAt time.Time
+	pods      map[string]bool
+	changed   bool
+}
+
+// nodeIncidents collapses the pod events following a node failure into a
+// single alert per node. While an incident is open, pod events reported from
+// that node are only recorded as affected pods.
+type nodeIncidents struct {
+	window    time.Duration
+	reasons   map[string]bool
+	incidents map[string]*nodeIncident
+	now       func() time.Time
+}
+
+func newNodeIncidents(window time.Duration, reasons []string) *nodeIncidents {
+	n := &nodeIncidents{
+		window:    window,
+		reasons:   make(map[string]bool),
+		incidents: make(map[string]*nodeIncident),
+		now:       time.Now,
+	}
+	for _, reason := range reasons {
+		n.reasons[reason] = true
+	}
+	return n
+}
+
+// openIfNodeFailure opens (or extends) the incident of the node the event is
+// about, if it is a node failure event. It reports whether the event was
+// consumed.
+func (n *nodeIncidents) openIfNodeFailure(event *v1.Event) bool {
+	if n == nil || event.InvolvedObject.Kind != "Node" || !n.reasons[event.Reason] {
+		return false
+	}
+	node := event.InvolvedObject.Name
+	now := n.now()
+	incident, found := n.incidents[node]
+	if !found || now.After(incident.expiresAt) {
+		glog.Infof("node incident opened for %s: %s", node, event.Reason)
+		incident = &nodeIncident{
+			reason:   event.Reason,
+			startsAt: now,
+			pods:     make(map[string]bool),
+		}
+		n.incidents[node] = incident
+	}
+	incident.expiresAt = now.Add(n.window)
+	incident.changed = true
+	return true
+}
+
+// collapse records a pod event reported from a node with an open incident
+// and reports whether the event was consumed.
+func (n *nodeIncidents) collapse(event *v1.Event) bool {
+	if n == nil || event.InvolvedObject.Kind != "Pod" {
+		return false
+	}
+	incident, found := n.incidents[event.Source.Host]
+	if !found || n.now().After(incident.expiresAt) {
+		return false
+	}
+	pod := event.InvolvedObject.Namespace + "/" + event.InvolvedObject.Name
+	if !incident.pods[pod] {
+		incident.pods[pod] = true
+		incident.changed = true
+	}
+	return true
+}
+
+// alerts returns one alert for every incident that changed since the last
+// call and forgets expired incidents.
+func (n *nodeIncidents) alerts(cluster string) []*Alert {
+	if n == nil {
+		return nil
+	}
+	var alerts []*Alert
+	now := n.now()
+	for node, incident := range n.incidents {
+		if now.After(incident.expiresAt) {
+			delete(n.incidents, node)
+			continue
+		}
+		if !incident.changed {
+			continue
+		}
+		incident.changed = false
+
+		pods := make([]string, 0, len(incident.pods))
+		for pod := range incident.pods {
+			pods = append(pods, pod)
+		}
+		sort.Strings(pods)
+
+		alerts = append(alerts, &Alert{
+			Labels: map[string]string{
+				AlertNameLabel:     NodeIncidentAlertName,
+				AlertClusterLabel:  cluster,
+				AlertLevelLabel:    v1.EventTypeWarning,
+				AlertInstanceLabel: node,
+				AlertReasonLabel:   incident.reason,
+			},
+			Annotations: map[string]string{
+				AffectedPodsAnnotation:     strings.Join(pods, ","),
+				AffectedPodCountAnnotation: strconv.Itoa(len(pods)),
+			},
+			StartsAt: incident.startsAt,
+		})
+	}
+	return alerts
+}
@@ -0,0 +1,107 @@
+// Copyright 2018 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package alertmanager
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/heapster/events/core"
+)
+
+func nodeNotReady(node string) *v1.Event {
+	return &v1.Event{
+		Type:           v1.EventTypeNormal,
+		Reason:         "NodeNotReady",
+		Message:        fmt.Sprintf("Node %s status is now: NodeNotReady", node),
+		InvolvedObject: v1.ObjectReference{Kind: "Node", Name: node},
+	}
+}
+
+func podOnNode(node, pod string) *v1.Event {
+	return &v1.Event{
+		Type:           v1.EventTypeWarning,
+		Reason:         "BackOff",
+		Message:        "Back-off restarting failed container in " + pod,
+		InvolvedObject: v1.ObjectReference{Kind: "Pod", Namespace: "default", Name: pod},
+		Source:         v1.EventSource{Component: "kubelet", Host: node},
+	}
+}
+
+func TestNodeIncidentCollapsesPodCascade(t *testing.T) {
+	am := newFakeAlertmanager(nil)
+	defer am.server.Close()
+
+	sink := newTestSink(t, am.host(), "node_incident_window=5m")
+	events := []*v1.Event{nodeNotReady("node-1")}
+	for i := 0; i < 50; i++ {
+		events = append(events, podOnNode("node-1", fmt.Sprintf("web-%d", i)))
+	}
+	// A pod on a healthy node is not part of the incident.
+	events = append(events, podOnNode("node-2", "db-0"))
+
+	sink.ExportEvents(&core.EventBatch{Events: events})
+
+	chunks := am.received()
+	assert.Len(t, chunks, 1)
+	assert.Len(t, chunks[0], 2)
+	var alert *Alert
+	for _, sent := range chunks[0] {
+		if sent.Labels[AlertNameLabel] == NodeIncidentAlertName {
+			alert = sent
+		} else {
+			assert.Equal(t, "db-0", sent.Labels["object_name"])
+		}
+	}
+	if !assert.NotNil(t, alert) {
+		return
+	}
+	assert.Equal(t, NodeIncidentAlertName, alert.Labels[AlertNameLabel])
+	assert.Equal(t, "node-1", alert.Labels[AlertInstanceLabel])
+	assert.Equal(t, "50", alert.Annotations[AffectedPodCountAnnotation])
+	assert.Contains(t, alert.Annotations[AffectedPodsAnnotation], "default/web-49")
+}
+
+func TestNodeIncidentExpires(t *testing.T) {
+	now := time.Now()
+	incidents := newNodeIncidents(time.Minute, DefaultNodeIncidentReasons)
+	incidents.now = func() time.Time { return now }
+
+	assert.True(t, incidents.openIfNodeFailure(nodeNotReady("node-1")))
+	assert.True(t, incidents.collapse(podOnNode("node-1", "web-0")))
+	assert.True(t, incidents.collapse(podOnNode("node-1", "web-0")))
+	alerts := incidents.alerts("test")
+	assert.Len(t, alerts, 1)
+	assert.Equal(t, "1", alerts[0].Annotations[AffectedPodCountAnnotation])
+
+	// Nothing changed, so nothing to resend.
+	assert.Empty(t, incidents.alerts("test"))
+
+	now = now.Add(2 * time.Minute)
+	assert.False(t, incidents.collapse(podOnNode("node-1", "web-1")))
+	assert.Empty(t, incidents.alerts("test"))
+	assert.Empty(t, incidents.incidents)
+}
+
+func TestNodeIncidentWindowValidation(t *testing.T) {
+	for _, query := range []string{"node_incident_window=0s", "node_incident_window=soon"} {
+		uri := fmt.Sprintf("http://localhost:9093?cluster=test&%s", query)
+		_, err := NewAlertmanagerSink(mustParseURL(uri))
+		assert.Error(t, err, query)
+	}
+}
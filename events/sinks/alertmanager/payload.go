@@ -0,0 +1,80 @@
+// Copyright 2018 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package alertmanager
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+const (
+	API_VERSION_V1 = "v1"
+	API_VERSION_V2 = "v2"
+
+	// alertmanagerTimeFormat is the layout of Alertmanager v2 timestamps
+	// (go-openapi strfmt.DateTime): RFC 3339 with millisecond precision.
+	alertmanagerTimeFormat = "2006-01-02T15:04:05.000Z07:00"
+)
+
+// alertV2 is the representation of an alert in the Alertmanager v2 API.
+type alertV2 struct {
+	Labels       map[string]string `json:"labels"`
+	Annotations  map[string]string `json:"annotations,omitempty"`
+	StartsAt     string            `json:"startsAt,omitempty"`
+	EndsAt       string            `json:"endsAt,omitempty"`
+	GeneratorURL string            `json:"generatorURL,omitempty"`
+}
+
+func parseAPIVersion(version string) (string, error) {
+	switch version {
+	case API_VERSION_V1, API_VERSION_V2:
+		return version, nil
+	default:
+		return "", fmt.Errorf("unsupported alertmanager api_version %q, must be %s or %s", version, API_VERSION_V1, API_VERSION_V2)
+	}
+}
+
+// marshalAlerts encodes alerts in the JSON shape of the configured API version.
+func (a *AlertmanagerSink) marshalAlerts(alerts []*Alert) ([]byte, error) {
+	payload := make([]interface{}, 0, len(alerts))
+	for _, alert := range alerts {
+		payload = append(payload, a.alertPayload(alert))
+	}
+	return json.Marshal(payload)
+}
+
+// alertPayload returns the alert in the JSON schema of the API version.
+func (a *AlertmanagerSink) alertPayload(alert *Alert) interface{} {
+	if a.APIVersion != API_VERSION_V2 {
+		return alert
+	}
+	return &alertV2{
+		Labels:       alert.Labels,
+		Annotations:  alert.Annotations,
+		StartsAt:     formatTime(alert.StartsAt),
+		EndsAt:       formatTime(alert.EndsAt),
+		GeneratorURL: alert.GeneratorURL,
+	}
+}
+
+// formatTime renders t in UTC as Alertmanager v2 expects it. Zero times are
+// left empty so they are omitted and Alertmanager applies its defaults.
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(alertmanagerTimeFormat)
+}
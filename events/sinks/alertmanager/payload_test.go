@@ -0,0 +1,201 @@
+// Copyright 2018 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package alertmanager
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/url"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func goldenEvent() *v1.Event {
+	// A non-UTC timestamp makes sure v2 timestamps are normalized.
+	started := time.Date(2018, 3, 1, 18, 0, 0, 0, time.FixedZone("CST", 8*3600))
+	return &v1.Event{
+		ObjectMeta:     metav1.ObjectMeta{Namespace: "default", Name: "web-0.15a6d1b2c3d4e5f6"},
+		Type:           v1.EventTypeWarning,
+		Reason:         "BackOff",
+		Message:        "Back-off restarting failed container",
+		FirstTimestamp: metav1.NewTime(started),
+		LastTimestamp:  metav1.NewTime(started.Add(time.Minute)),
+		Count:          4,
+	}
+}
+
+func TestMarshalAlertsMatchesGoldenFixtures(t *testing.T) {
+	tests := []struct {
+		query  string
+		golden string
+	}{
+		{"generator_url=https://heapster.example.com/events", "alerts_v2.json"},
+		{"api_version=v1", "alerts_v1.json"},
+		{"api_version=v2&generator_url=https://heapster.example.com/events", "alerts_v2.json"},
+	}
+	for _, test := range tests {
+		uri, _ := url.Parse("http://localhost:9093?cluster=prod&" + test.query)
+		sink, err := NewAlertmanagerSink(uri)
+		assert.NoError(t, err)
+
+		alert, err := sink.buildAlert(goldenEvent())
+		assert.NoError(t, err)
+
+		body, err := sink.marshalAlerts([]*Alert{alert})
+		assert.NoError(t, err)
+		expected, err := ioutil.ReadFile(filepath.Join("testdata", test.golden))
+		assert.NoError(t, err)
+		assert.JSONEq(t, string(expected), string(body), test.query)
+	}
+}
+
+func TestInvalidAPIVersion(t *testing.T) {
+	uri, _ := url.Parse("http://localhost:9093?cluster=prod&api_version=v3")
+	_, err := NewAlertmanagerSink(uri)
+	assert.Error(t, err)
+}
+
+func TestV2TimestampsRoundTrip(t *testing.T) {
+	uri, _ := url.Parse("http://localhost:9093?cluster=prod&apiVersion=v2")
+	sink, err := NewAlertmanagerSink(uri)
+	assert.NoError(t, err)
+	assert.Equal(t, API_VERSION_V2, sink.APIVersion)
+
+	startsAt := time.Date(2018, 3, 1, 18, 0, 0, 123456789, time.FixedZone("CST", 8*3600))
+	endsAt := startsAt.Add(5 * time.Minute)
+	body, err := sink.marshalAlerts([]*Alert{{
+		Labels:   map[string]string{AlertNameLabel: "Test"},
+		StartsAt: startsAt,
+		EndsAt:   endsAt,
+	}})
+	assert.NoError(t, err)
+
+	var decoded []alertV2
+	assert.NoError(t, json.Unmarshal(body, &decoded))
+	assert.Len(t, decoded, 1)
+	assert.Equal(t, "2018-03-01T10:00:00.123Z", decoded[0].StartsAt)
+
+	for expected, raw := range map[time.Time]string{startsAt: decoded[0].StartsAt, endsAt: decoded[0].EndsAt} {
+		parsed, err := time.Parse(alertmanagerTimeFormat, raw)
+		assert.NoError(t, err)
+		assert.Equal(t, time.UTC, parsed.Location())
+		assert.True(t, expected.Truncate(time.Millisecond).Equal(parsed), raw)
+	}
+}
+
+func TestV2OmitsZeroTimestamps(t *testing.T) {
+	uri, _ := url.Parse("http://localhost:9093?cluster=prod&api_version=v2")
+	sink, err := NewAlertmanagerSink(uri)
+	assert.NoError(t, err)
+
+	body, err := sink.marshalAlerts([]*Alert{{Labels: map[string]string{AlertNameLabel: "Test"}}})
+	assert.NoError(t, err)
+	assert.JSONEq(t, `[{"labels":{"alertname":"Test"}}]`, string(body))
+}
+
+func TestDefaultAPIVersionAndPath(t *testing.T) {
+	for raw, expected := range map[string][2]string{
+		"http://localhost:9093?cluster=prod":                                  {API_VERSION_V2, "localhost:9093/api/v2/alerts"},
+		"http://localhost:9093/?cluster=prod&api_version=v1":                  {API_VERSION_V1, "localhost:9093/api/v1/alerts"},
+		"http://localhost:9093?cluster=prod&path=/alertmanager/api/v2/alerts": {API_VERSION_V2, "localhost:9093/alertmanager/api/v2/alerts"},
+		// Uris of the v1 endpoint imply the v1 API.
+		"http://localhost:9093/api/v1/alerts?cluster=prod": {API_VERSION_V1, "localhost:9093/api/v1/alerts"},
+		"http://localhost:9093/custom?cluster=prod":        {API_VERSION_V2, "localhost:9093/custom"},
+	} {
+		sink, err := NewAlertmanagerSink(mustParseURL(raw))
+		assert.NoError(t, err, raw)
+		assert.Equal(t, expected[0], sink.APIVersion, raw)
+		assert.Equal(t, expected[1], sink.Endpoint, raw)
+	}
+}
+
+func TestResolveTimeout(t *testing.T) {
+	uri, _ := url.Parse("http://localhost:9093?cluster=prod")
+	sink, err := NewAlertmanagerSink(uri)
+	assert.NoError(t, err)
+	alert, err := sink.buildAlert(goldenEvent())
+	assert.NoError(t, err)
+	assert.True(t, alert.EndsAt.IsZero())
+
+	uri, _ = url.Parse("http://localhost:9093?cluster=prod&resolve_timeout=15m")
+	sink, err = NewAlertmanagerSink(uri)
+	assert.NoError(t, err)
+	assert.Equal(t, 15*time.Minute, sink.ResolveTimeout)
+	event := goldenEvent()
+	alert, err = sink.buildAlert(event)
+	assert.NoError(t, err)
+	assert.Equal(t, event.FirstTimestamp.Time, alert.StartsAt)
+	assert.Equal(t, event.LastTimestamp.Add(15*time.Minute), alert.EndsAt)
+
+	body, err := sink.marshalAlerts([]*Alert{alert})
+	assert.NoError(t, err)
+	var decoded []alertV2
+	assert.NoError(t, json.Unmarshal(body, &decoded))
+	assert.Equal(t, "2018-03-01T10:16:00.000Z", decoded[0].EndsAt)
+
+	for _, invalid := range []string{"-1m", "soon"} {
+		uri, _ = url.Parse("http://localhost:9093?cluster=prod&resolve_timeout=" + invalid)
+		_, err = NewAlertmanagerSink(uri)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestGeneratorURLTemplate(t *testing.T) {
+	uri, _ := url.Parse("http://localhost:9093?cluster=prod&generator_url=" +
+		url.QueryEscape("https://dashboard.example.com/#/{{.Namespace}}/events/{{.Name}}"))
+	sink, err := NewAlertmanagerSink(uri)
+	assert.NoError(t, err)
+
+	alert, err := sink.buildAlert(goldenEvent())
+	assert.NoError(t, err)
+	assert.Equal(t, "https://dashboard.example.com/#/default/events/web-0.15a6d1b2c3d4e5f6", alert.GeneratorURL)
+	// Alerts not created from an event can't render the template.
+	assert.Equal(t, "", sink.renderGeneratorURL(nil))
+
+	uri, _ = url.Parse("http://localhost:9093?cluster=prod&generator_url=" + url.QueryEscape("https://x/{{.Name"))
+	_, err = NewAlertmanagerSink(uri)
+	assert.Error(t, err)
+}
+
+func TestEventAnnotations(t *testing.T) {
+	uri, _ := url.Parse("http://localhost:9093?cluster=prod")
+	sink, err := NewAlertmanagerSink(uri)
+	assert.NoError(t, err)
+
+	alert, err := sink.buildAlert(goldenEvent())
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		AlertMessageAnnotation:   "Back-off restarting failed container",
+		AlertCountAnnotation:     "4",
+		AlertFirstSeenAnnotation: "2018-03-01T10:00:00Z",
+		AlertLastSeenAnnotation:  "2018-03-01T10:01:00Z",
+	}, alert.Annotations)
+
+	// Zero values are left out, and so are empty annotations.
+	alert, err = sink.buildAlert(&v1.Event{Type: v1.EventTypeWarning, Reason: "BackOff"})
+	assert.NoError(t, err)
+	assert.Empty(t, alert.Annotations)
+	for _, version := range []string{API_VERSION_V1, API_VERSION_V2} {
+		sink.APIVersion = version
+		body, err := sink.marshalAlerts([]*Alert{alert})
+		assert.NoError(t, err)
+		assert.NotContains(t, string(body), "annotations", version)
+	}
+}
@@ -0,0 +1,87 @@
+// Copyright 2018 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package alertmanager
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/client-go/util/flowcontrol"
+)
+
+var (
+	// Number of alerts dropped by the rate limit.
+	rateLimitedAlerts = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: "eventer",
+			Subsystem: "alertmanager",
+			Name:      "rate_limited_alerts_total",
+			Help:      "Number of alerts dropped because of max_alerts_per_minute.",
+		},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(rateLimitedAlerts)
+}
+
+// sinkClock is the clock of the sink, so that the rate limit follows a.now.
+type sinkClock struct {
+	a *AlertmanagerSink
+}
+
+func (c sinkClock) Now() time.Time {
+	return c.a.now()
+}
+
+func (c sinkClock) Sleep(d time.Duration) {
+	time.Sleep(d)
+}
+
+// newRateLimiter creates the token bucket limiting the alerts sent by a, or
+// returns nil if max_alerts_per_minute isn't set. The bucket holds up to
+// burst alerts, by default a minute's worth.
+func newRateLimiter(a *AlertmanagerSink, opts url.Values) (flowcontrol.RateLimiter, error) {
+	if len(opts["max_alerts_per_minute"]) == 0 {
+		if len(opts["burst"]) >= 1 {
+			return nil, fmt.Errorf("burst requires max_alerts_per_minute")
+		}
+		return nil, nil
+	}
+	perMinute, err := strconv.Atoi(opts["max_alerts_per_minute"][0])
+	if err != nil || perMinute <= 0 {
+		return nil, fmt.Errorf("max_alerts_per_minute must be a positive integer, got %q", opts["max_alerts_per_minute"][0])
+	}
+	burst := perMinute
+	if len(opts["burst"]) >= 1 {
+		burst, err = strconv.Atoi(opts["burst"][0])
+		if err != nil || burst <= 0 {
+			return nil, fmt.Errorf("burst must be a positive integer, got %q", opts["burst"][0])
+		}
+	}
+	return flowcontrol.NewTokenBucketRateLimiterWithClock(float32(perMinute)/60, burst, sinkClock{a}), nil
+}
+
+// allowAlert tells whether the rate limit allows sending another alert.
+func (a *AlertmanagerSink) allowAlert() bool {
+	if a.limiter == nil || a.limiter.TryAccept() {
+		return true
+	}
+	rateLimitedAlerts.Inc()
+	return false
+}
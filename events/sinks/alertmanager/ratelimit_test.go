@@ -0,0 +1,105 @@
+// Copyright 2018 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package alertmanager
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/heapster/events/core"
+)
+
+// distinctEvents returns n events that are each sent as an alert once they
+// have been recorded.
+func distinctEvents(n int) []*v1.Event {
+	events := make([]*v1.Event, 0, n)
+	for i := 0; i < n; i++ {
+		events = append(events, podEvent(fmt.Sprintf("web-%d", i), "BackOff", fmt.Sprintf("restarting web-%d", i)))
+	}
+	return events
+}
+
+func countAlerts(chunks [][]*Alert) int {
+	count := 0
+	for _, chunk := range chunks {
+		count += len(chunk)
+	}
+	return count
+}
+
+func TestRateLimit(t *testing.T) {
+	am := newFakeAlertmanager(nil)
+	defer am.server.Close()
+
+	sink := newTestSink(t, am.host(), "max_alerts_per_minute=60&burst=5")
+	// The bucket starts at the time the sink was created.
+	now := time.Now()
+	sink.now = func() time.Time { return now }
+
+	batch := &core.EventBatch{Events: distinctEvents(20)}
+	// The first occurrences are only recorded.
+	assert.NoError(t, sink.ExportEventsWithError(batch))
+	assert.NoError(t, sink.ExportEventsWithError(batch))
+	assert.Equal(t, 5, countAlerts(am.received()))
+
+	// A token is added every second.
+	now = now.Add(3 * time.Second)
+	assert.NoError(t, sink.ExportEventsWithError(batch))
+	assert.Equal(t, 8, countAlerts(am.received()))
+
+	// The bucket holds no more than burst tokens.
+	now = now.Add(time.Hour)
+	assert.NoError(t, sink.ExportEventsWithError(batch))
+	assert.Equal(t, 13, countAlerts(am.received()))
+}
+
+func TestRateLimitConcurrentExports(t *testing.T) {
+	am := newFakeAlertmanager(nil)
+	defer am.server.Close()
+
+	sink := newTestSink(t, am.host(), "max_alerts_per_minute=10")
+	// The bucket starts at the time the sink was created.
+	now := time.Now()
+	sink.now = func() time.Time { return now }
+	assert.True(t, sink.limiter != nil)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 25; j++ {
+				sink.allowAlert()
+			}
+		}()
+	}
+	wg.Wait()
+	assert.False(t, sink.allowAlert())
+}
+
+func TestRateLimitOptions(t *testing.T) {
+	sink := newTestSink(t, "localhost:9093", "")
+	assert.Nil(t, sink.limiter)
+	assert.True(t, sink.allowAlert())
+
+	for _, invalid := range []string{"max_alerts_per_minute=0", "max_alerts_per_minute=x", "max_alerts_per_minute=10&burst=0", "burst=10"} {
+		_, err := NewAlertmanagerSink(mustParseURL("http://localhost:9093?cluster=test&" + invalid))
+		assert.Error(t, err, invalid)
+	}
+}
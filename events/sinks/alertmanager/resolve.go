@@ -0,0 +1,85 @@
+// Copyright 2018 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package alertmanager
+
+import (
+	"time"
+
+	"github.com/facebookarchive/inmem"
+	v1 "k8s.io/api/core/v1"
+)
+
+const (
+	// FIRED_ALERT_TTL is how long fired alerts are remembered to be resolved.
+	FIRED_ALERT_TTL = time.Hour
+)
+
+// objectKeyFields identify the object an event is about, regardless of why.
+var objectKeyFields = []string{"kind", "namespace", "name"}
+
+// firedAlerts remembers the alerts fired for each object, so that they can be
+// resolved once a Normal event shows the object has recovered.
+type firedAlerts struct {
+	// alerts maps object keys to the alerts fired for the object by name.
+	alerts inmem.Cache
+}
+
+func newFiredAlerts(size int) *firedAlerts {
+	return &firedAlerts{alerts: inmem.NewUnlocked(size)}
+}
+
+// record remembers that alert was fired for the object of event. A nil
+// firedAlerts records nothing.
+func (f *firedAlerts) record(event *v1.Event, alert *Alert) {
+	if f == nil {
+		return
+	}
+	key := generateKey(objectKeyFields, event)
+	fired := make(map[string]*Alert)
+	if value, ok := f.alerts.Get(key); ok {
+		for name, alert := range value.(map[string]*Alert) {
+			fired[name] = alert
+		}
+	}
+	fired[alert.Labels[AlertNameLabel]] = alert
+	f.alerts.Add(key, fired, time.Now().Add(FIRED_ALERT_TTL))
+}
+
+// resolve returns resolved copies, ending at now, of the alerts fired for
+// the object of a Normal event, and forgets them. Nothing is resolved for
+// other events or objects nothing was fired for.
+func (f *firedAlerts) resolve(event *v1.Event, now time.Time) []*Alert {
+	if f == nil || event.Type != v1.EventTypeNormal {
+		return nil
+	}
+	key := generateKey(objectKeyFields, event)
+	value, ok := f.alerts.Get(key)
+	if !ok {
+		return nil
+	}
+	f.alerts.Remove(key)
+
+	var resolved []*Alert
+	for _, alert := range value.(map[string]*Alert) {
+		resolved = append(resolved, &Alert{
+			Labels:       alert.Labels,
+			Annotations:  alert.Annotations,
+			StartsAt:     alert.StartsAt,
+			EndsAt:       now,
+			GeneratorURL: alert.GeneratorURL,
+		})
+	}
+	return resolved
+}
@@ -0,0 +1,89 @@
+// Copyright 2018 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package alertmanager
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/heapster/events/core"
+)
+
+func TestSendResolved(t *testing.T) {
+	var posted [][]alertV2
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var alerts []alertV2
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&alerts))
+		posted = append(posted, alerts)
+	}))
+	defer server.Close()
+
+	sink := newTestSink(t, strings.TrimPrefix(server.URL, "http://"), "send_resolved=true")
+	now := time.Date(2018, 3, 1, 10, 0, 0, 0, time.UTC)
+	sink.now = func() time.Time { return now }
+
+	backOff := podEvent("web-0", "BackOff", "Back-off restarting failed container")
+	started := podEvent("web-0", "Started", "Started container")
+	started.Type = v1.EventTypeNormal
+
+	// The first occurrence is only recorded, the second one fires.
+	assert.NoError(t, sink.ExportEventsWithError(&core.EventBatch{Events: []*v1.Event{backOff}}))
+	assert.NoError(t, sink.ExportEventsWithError(&core.EventBatch{Events: []*v1.Event{backOff}}))
+	assert.Len(t, posted, 1)
+	assert.Equal(t, "", posted[0][0].EndsAt)
+
+	assert.NoError(t, sink.ExportEventsWithError(&core.EventBatch{Events: []*v1.Event{started}}))
+	assert.Len(t, posted, 2)
+	assert.Len(t, posted[1], 1)
+	assert.Equal(t, posted[0][0].Labels, posted[1][0].Labels)
+	assert.Equal(t, "2018-03-01T10:00:00.000Z", posted[1][0].EndsAt)
+
+	// The alert is only resolved once.
+	assert.NoError(t, sink.ExportEventsWithError(&core.EventBatch{Events: []*v1.Event{started}}))
+	assert.Len(t, posted, 2)
+}
+
+func TestResolveWithoutFireIsNoop(t *testing.T) {
+	am := newFakeAlertmanager(nil)
+	defer am.server.Close()
+
+	started := podEvent("web-0", "Started", "Started container")
+	started.Type = v1.EventTypeNormal
+	other := podEvent("web-1", "BackOff", "Back-off restarting failed container")
+
+	sink := newTestSink(t, am.host(), "send_resolved=true")
+	assert.NoError(t, sink.ExportEventsWithError(&core.EventBatch{Events: []*v1.Event{other, other}}))
+	assert.Len(t, am.received(), 1)
+	// web-0 never fired, so nothing is resolved.
+	assert.NoError(t, sink.ExportEventsWithError(&core.EventBatch{Events: []*v1.Event{started}}))
+	assert.Len(t, am.received(), 1)
+
+	// Without send_resolved nothing is tracked.
+	sink = newTestSink(t, am.host(), "")
+	assert.Nil(t, sink.fired)
+	sink.ExportEvents(&core.EventBatch{Events: []*v1.Event{started}})
+	assert.Len(t, am.received(), 1)
+
+	for _, invalid := range []string{"send_resolved=maybe", "send_resolved=true&api_version=v1"} {
+		_, err := NewAlertmanagerSink(mustParseURL("http://localhost:9093?cluster=test&" + invalid))
+		assert.Error(t, err, invalid)
+	}
+}
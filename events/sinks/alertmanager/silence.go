@@ -0,0 +1,173 @@
+// Copyright 2018 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package alertmanager
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// silenceWindow is a daily time range on some days of the week. The range
+// starts on those days and may end on the next day.
+type silenceWindow struct {
+	days [7]bool
+	// start and end are minutes after midnight, end exclusive.
+	start, end int
+}
+
+// silenceSchedule tells when the sink doesn't alert, see silence_windows.
+type silenceSchedule struct {
+	windows  []silenceWindow
+	location *time.Location
+}
+
+// parseSilenceWindows parses the silence_windows values into a schedule in
+// location. Every value holds one or more windows separated by ";", each
+// like "Mon-Fri 01:00-03:00", "Sat,Sun 00:00-24:00" or "22:00-02:00" for
+// every day.
+func parseSilenceWindows(values []string, location *time.Location) (*silenceSchedule, error) {
+	s := &silenceSchedule{location: location}
+	for _, value := range values {
+		for _, spec := range strings.Split(value, ";") {
+			if spec = strings.TrimSpace(spec); spec == "" {
+				continue
+			}
+			window, err := parseSilenceWindow(spec)
+			if err != nil {
+				return nil, fmt.Errorf("invalid silence_windows entry %q: %v", spec, err)
+			}
+			s.windows = append(s.windows, window)
+		}
+	}
+	if len(s.windows) == 0 {
+		return nil, fmt.Errorf("silence_windows must hold at least one window")
+	}
+	return s, nil
+}
+
+func parseSilenceWindow(spec string) (silenceWindow, error) {
+	var w silenceWindow
+	fields := strings.Fields(spec)
+	switch len(fields) {
+	case 1:
+		fields = []string{"*", fields[0]}
+	case 2:
+	default:
+		return w, fmt.Errorf("must be [days] HH:MM-HH:MM")
+	}
+
+	if err := parseDays(fields[0], &w.days); err != nil {
+		return w, err
+	}
+	times := strings.Split(fields[1], "-")
+	if len(times) != 2 {
+		return w, fmt.Errorf("time range must be HH:MM-HH:MM, got %q", fields[1])
+	}
+	var err error
+	if w.start, err = parseClock(times[0]); err != nil {
+		return w, err
+	}
+	if w.end, err = parseClock(times[1]); err != nil {
+		return w, err
+	}
+	if w.start == w.end || w.start == 24*60 {
+		return w, fmt.Errorf("time range %q is empty", fields[1])
+	}
+	return w, nil
+}
+
+// parseDays parses "*" or a comma-separated list of days and day ranges
+// like "Mon-Fri" into days.
+func parseDays(spec string, days *[7]bool) error {
+	if spec == "*" {
+		for i := range days {
+			days[i] = true
+		}
+		return nil
+	}
+	for _, part := range strings.Split(spec, ",") {
+		bounds := strings.Split(part, "-")
+		if len(bounds) > 2 {
+			return fmt.Errorf("invalid day range %q", part)
+		}
+		first, ok := weekdays[strings.ToLower(bounds[0])]
+		if !ok {
+			return fmt.Errorf("unknown day %q", bounds[0])
+		}
+		last := first
+		if len(bounds) == 2 {
+			if last, ok = weekdays[strings.ToLower(bounds[1])]; !ok {
+				return fmt.Errorf("unknown day %q", bounds[1])
+			}
+		}
+		// Ranges may wrap around the week, like Sat-Mon.
+		for day := first; ; day = (day + 1) % 7 {
+			days[day] = true
+			if day == last {
+				break
+			}
+		}
+	}
+	return nil
+}
+
+// parseClock parses HH:MM into minutes after midnight. 24:00 is accepted as
+// the end of the day.
+func parseClock(clock string) (int, error) {
+	var hours, minutes int
+	if n, err := fmt.Sscanf(clock, "%d:%d", &hours, &minutes); err != nil || n != 2 || len(clock) != 5 {
+		return 0, fmt.Errorf("time must be HH:MM, got %q", clock)
+	}
+	if hours < 0 || minutes < 0 || minutes > 59 || hours > 24 || (hours == 24 && minutes != 0) {
+		return 0, fmt.Errorf("time must be between 00:00 and 24:00, got %q", clock)
+	}
+	return hours*60 + minutes, nil
+}
+
+// active tells whether t is inside any of the windows. A nil schedule is
+// never active.
+func (s *silenceSchedule) active(t time.Time) bool {
+	if s == nil {
+		return false
+	}
+	t = t.In(s.location)
+	minute := t.Hour()*60 + t.Minute()
+	today := t.Weekday()
+	yesterday := (today + 6) % 7
+	for _, w := range s.windows {
+		if w.start < w.end {
+			if w.days[today] && minute >= w.start && minute < w.end {
+				return true
+			}
+			continue
+		}
+		// The window wraps around midnight.
+		if (w.days[today] && minute >= w.start) || (w.days[yesterday] && minute < w.end) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,112 @@
+// Copyright 2018 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package alertmanager
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/heapster/events/core"
+)
+
+func TestSilenceSchedule(t *testing.T) {
+	schedule, err := parseSilenceWindows([]string{"Mon-Fri 01:00-03:00; Sat,Sun 00:00-24:00", "Fri 02:00-04:00", "Wed 22:00-00:30"}, time.UTC)
+	assert.NoError(t, err)
+
+	// 2018-03-05 is a Monday.
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2018, 3, day, hour, minute, 0, 0, time.UTC)
+	}
+	for _, tc := range []struct {
+		name     string
+		t        time.Time
+		expected bool
+	}{
+		{"before window", at(5, 0, 59), false},
+		{"window start", at(5, 1, 0), true},
+		{"inside window", at(6, 2, 30), true},
+		{"just before window end", at(7, 2, 59), true},
+		{"window end", at(7, 3, 0), false},
+		{"overlapping windows", at(9, 2, 30), true},
+		{"end of the longer overlapping window", at(9, 3, 30), true},
+		{"end of overlapping windows", at(9, 4, 0), false},
+		{"whole weekend day", at(10, 12, 0), true},
+		{"weekend day end", at(11, 23, 59), true},
+		{"after midnight wraparound", at(8, 0, 15), true},
+		{"before midnight wraparound", at(7, 23, 0), true},
+		{"midnight wraparound end", at(8, 0, 30), false},
+		{"wraparound on other day", at(5, 23, 0), false},
+	} {
+		assert.Equal(t, tc.expected, schedule.active(tc.t), tc.name)
+	}
+	assert.False(t, (*silenceSchedule)(nil).active(at(5, 2, 0)))
+}
+
+func TestSilenceScheduleTimezone(t *testing.T) {
+	location, err := time.LoadLocation("Asia/Shanghai")
+	if err != nil {
+		t.Skipf("no time zone database: %v", err)
+	}
+	schedule, err := parseSilenceWindows([]string{"Mon 01:00-03:00"}, location)
+	assert.NoError(t, err)
+	// Monday 02:00 in Shanghai is Sunday 18:00 UTC.
+	assert.True(t, schedule.active(time.Date(2018, 3, 4, 18, 0, 0, 0, time.UTC)))
+	assert.False(t, schedule.active(time.Date(2018, 3, 5, 2, 0, 0, 0, time.UTC)))
+}
+
+func TestSilenceWindowsOptions(t *testing.T) {
+	for _, invalid := range []string{
+		"silence_windows=",
+		"silence_windows=Mon-Fri",
+		"silence_windows=Funday+01:00-03:00",
+		"silence_windows=Mon+1:00-03:00",
+		"silence_windows=Mon+01:00-25:00",
+		"silence_windows=Mon+01:60-03:00",
+		"silence_windows=Mon+01:00-01:00",
+		"silence_windows=Mon+01:00",
+		"silence_windows=Mon+01:00-03:00&timezone=Mars/Olympus",
+		"timezone=UTC",
+	} {
+		_, err := NewAlertmanagerSink(mustParseURL("http://localhost:9093?cluster=test&" + invalid))
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestSilencedEventsAreNotRecorded(t *testing.T) {
+	am := newFakeAlertmanager(nil)
+	defer am.server.Close()
+
+	sink := newTestSink(t, am.host(), "silence_windows=01:00-03:00")
+	now := time.Date(2018, 3, 5, 1, 0, 0, 0, time.UTC)
+	sink.now = func() time.Time { return now }
+	silenced := metricValue(t, silencedEvents.WithLabelValues("test"))
+	batch := &core.EventBatch{Events: []*v1.Event{podEvent("web-0", "BackOff", "Back-off restarting failed container")}}
+
+	sink.ExportEvents(batch)
+	sink.ExportEvents(batch)
+	assert.Len(t, am.received(), 0)
+	assert.Equal(t, 0, sink.recorder.Len())
+	assert.Equal(t, silenced+2, metricValue(t, silencedEvents.WithLabelValues("test")))
+
+	// At the end of the window the event is a first occurrence again, and
+	// alerts once.
+	now = time.Date(2018, 3, 5, 3, 0, 0, 0, time.UTC)
+	sink.ExportEvents(batch)
+	assert.Len(t, am.received(), 1)
+	sink.ExportEvents(batch)
+	assert.Len(t, am.received(), 1)
+}
@@ -0,0 +1,188 @@
+// Copyright 2018 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sinks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"k8s.io/heapster/events/core"
+)
+
+const (
+	DefaultCircuitBreakerThreshold = 5
+	DefaultCircuitBreakerCooldown  = time.Minute
+)
+
+type circuitState int
+
+const (
+	circuitClosed circuitState = iota
+	circuitOpen
+	circuitHalfOpen
+)
+
+func (s circuitState) String() string {
+	switch s {
+	case circuitClosed:
+		return "closed"
+	case circuitOpen:
+		return "open"
+	default:
+		return "half-open"
+	}
+}
+
+var errCircuitOpen = errors.New("circuit breaker is open")
+
+// circuitBreakerSink stops exporting to the wrapped sink after threshold
+// consecutive failed exports. While open, batches are dropped without
+// touching the wrapped sink. After cooldown one batch is let through as a
+// probe: if it succeeds the circuit closes, otherwise it opens again.
+//
+// Only sinks implementing core.EventSinkWithError report failures, so other
+// sinks can't be wrapped: the circuit would never open.
+//
+// Usage:
+// --sink=circuitbreaker:alertmanager:http://am:9093?cluster=prod&threshold=5&cooldown=1m
+type circuitBreakerSink struct {
+	sync.Mutex
+	sink      core.EventSink
+	threshold int
+	cooldown  time.Duration
+
+	state    circuitState
+	failures int
+	openedAt time.Time
+	now      func() time.Time
+}
+
+func newCircuitBreakerSink(sink core.EventSink, threshold int, cooldown time.Duration) *circuitBreakerSink {
+	return &circuitBreakerSink{
+		sink:      sink,
+		threshold: threshold,
+		cooldown:  cooldown,
+		state:     circuitClosed,
+		now:       time.Now,
+	}
+}
+
+func (this *SinkFactory) buildCircuitBreakerSink(val *url.URL) (core.EventSink, error) {
+	child, opts, err := splitWrappedUri(val, "threshold", "cooldown")
+	if err != nil {
+		return nil, err
+	}
+
+	threshold := DefaultCircuitBreakerThreshold
+	if len(opts["threshold"]) >= 1 {
+		threshold, err = strconv.Atoi(opts["threshold"][0])
+		if err != nil || threshold <= 0 {
+			return nil, fmt.Errorf("threshold must be a positive integer, got %q", opts["threshold"][0])
+		}
+	}
+	cooldown := DefaultCircuitBreakerCooldown
+	if len(opts["cooldown"]) >= 1 {
+		cooldown, err = time.ParseDuration(opts["cooldown"][0])
+		if err != nil || cooldown <= 0 {
+			return nil, fmt.Errorf("cooldown must be a positive duration, got %q", opts["cooldown"][0])
+		}
+	}
+
+	sink, err := this.Build(child)
+	if err != nil {
+		return nil, err
+	}
+	if !core.ReportsErrors(sink) {
+		sink.Stop()
+		return nil, fmt.Errorf("circuitbreaker can't wrap %s, it doesn't report failed exports", child.Key)
+	}
+	return newCircuitBreakerSink(sink, threshold, cooldown), nil
+}
+
+func (this *circuitBreakerSink) Name() string {
+	return this.sink.Name()
+}
+
+func (this *circuitBreakerSink) Stop() {
+	this.sink.Stop()
+}
+
+func (this *circuitBreakerSink) WrappedSinks() []core.EventSink {
+	return []core.EventSink{this.sink}
+}
+
+func (this *circuitBreakerSink) ExportEvents(batch *core.EventBatch) {
+	if err := this.ExportEventsWithError(batch); err != nil {
+		glog.Warningf("Failed to export events to %s: %v", this.sink.Name(), err)
+	}
+}
+
+func (this *circuitBreakerSink) ExportEventsWithError(batch *core.EventBatch) error {
+	return this.ExportEventsContext(context.Background(), batch)
+}
+
+func (this *circuitBreakerSink) ExportEventsContext(ctx context.Context, batch *core.EventBatch) error {
+	if !this.allow() {
+		return errCircuitOpen
+	}
+	err := core.ExportEventsContext(ctx, this.sink, batch)
+	this.record(err)
+	return err
+}
+
+// allow reports whether the export may go through, moving an open circuit
+// to half-open once the cooldown has passed.
+func (this *circuitBreakerSink) allow() bool {
+	this.Lock()
+	defer this.Unlock()
+	if this.state == circuitOpen {
+		if this.now().Sub(this.openedAt) < this.cooldown {
+			return false
+		}
+		this.transition(circuitHalfOpen)
+	}
+	return true
+}
+
+func (this *circuitBreakerSink) record(err error) {
+	this.Lock()
+	defer this.Unlock()
+	if err == nil {
+		this.failures = 0
+		if this.state != circuitClosed {
+			this.transition(circuitClosed)
+		}
+		return
+	}
+
+	this.failures++
+	if this.state == circuitHalfOpen || this.failures >= this.threshold {
+		this.openedAt = this.now()
+		if this.state != circuitOpen {
+			this.transition(circuitOpen)
+		}
+	}
+}
+
+func (this *circuitBreakerSink) transition(state circuitState) {
+	glog.Infof("Circuit breaker of %s sink: %s -> %s (consecutive failures: %d)", this.sink.Name(), this.state, state, this.failures)
+	this.state = state
+}
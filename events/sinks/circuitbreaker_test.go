@@ -0,0 +1,108 @@
+// Copyright 2018 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sinks
+
+import (
+	"context"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/heapster/common/flags"
+	"k8s.io/heapster/events/core"
+	"k8s.io/heapster/events/util"
+)
+
+func TestCircuitBreakerOpensAndRecovers(t *testing.T) {
+	now := time.Now()
+	child := &fakeSink{name: "fake", err: errFake}
+	breaker := newCircuitBreakerSink(child, 3, time.Minute)
+	breaker.now = func() time.Time { return now }
+	batch := &core.EventBatch{}
+
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, errFake, breaker.ExportEventsWithError(batch))
+	}
+	assert.Equal(t, circuitOpen, breaker.state)
+
+	// While open the child isn't called.
+	assert.Equal(t, errCircuitOpen, breaker.ExportEventsWithError(batch))
+	assert.Len(t, child.exported(), 3)
+
+	// A failed probe after the cooldown opens the circuit again.
+	now = now.Add(time.Minute)
+	assert.Equal(t, errFake, breaker.ExportEventsWithError(batch))
+	assert.Equal(t, circuitOpen, breaker.state)
+	assert.Equal(t, errCircuitOpen, breaker.ExportEventsWithError(batch))
+	assert.Len(t, child.exported(), 4)
+
+	// A successful probe closes it.
+	now = now.Add(time.Minute)
+	child.setErr(nil)
+	assert.NoError(t, breaker.ExportEventsWithError(batch))
+	assert.Equal(t, circuitClosed, breaker.state)
+	assert.NoError(t, breaker.ExportEventsWithError(batch))
+	assert.Len(t, child.exported(), 6)
+}
+
+func TestCircuitBreakerResetsOnSuccess(t *testing.T) {
+	child := &fakeSink{name: "fake"}
+	breaker := newCircuitBreakerSink(child, 2, time.Minute)
+	batch := &core.EventBatch{}
+
+	child.setErr(errFake)
+	breaker.ExportEventsWithError(batch)
+	child.setErr(nil)
+	breaker.ExportEventsWithError(batch)
+	child.setErr(errFake)
+	breaker.ExportEventsWithError(batch)
+	assert.Equal(t, circuitClosed, breaker.state)
+}
+
+func TestBuildCircuitBreakerSink(t *testing.T) {
+	factory := NewSinkFactory()
+	var uri flags.Uri
+	assert.NoError(t, uri.Set("circuitbreaker:log:?threshold=2&cooldown=30s"))
+	sink, err := factory.Build(uri)
+	assert.NoError(t, err)
+	breaker, ok := sink.(*circuitBreakerSink)
+	assert.True(t, ok)
+	assert.Equal(t, 2, breaker.threshold)
+	assert.Equal(t, 30*time.Second, breaker.cooldown)
+	assert.Equal(t, "LogSink", breaker.Name())
+
+	assert.NoError(t, uri.Set("circuitbreaker:log:?threshold=0"))
+	_, err = factory.Build(uri)
+	assert.Error(t, err)
+
+	// The circuit of a sink that doesn't report failures would never open.
+	Register("silent-fake", func(uri *url.URL) (core.EventSink, error) {
+		return util.NewDummySink("silent", 0), nil
+	})
+	for _, silent := range []string{"circuitbreaker:silent-fake:", "circuitbreaker:sample:silent-fake:?rate=0.5"} {
+		assert.NoError(t, uri.Set(silent))
+		_, err = factory.Build(uri)
+		assert.Error(t, err, silent)
+	}
+}
+
+func TestCircuitBreakerPassesContext(t *testing.T) {
+	breaker := newCircuitBreakerSink(&blockingSink{fakeSink{name: "blocking"}}, 1, time.Minute)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, breaker.ExportEventsContext(ctx, &core.EventBatch{}))
+	assert.Equal(t, circuitOpen, breaker.state)
+}
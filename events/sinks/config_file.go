@@ -0,0 +1,153 @@
+// Copyright 2018 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sinks
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"sort"
+	"strconv"
+
+	"github.com/ghodss/yaml"
+)
+
+// sinkConfigFile is the YAML form of a sink URI, for configurations that are
+// unwieldy to encode in a query string. For example
+// --sink=alertmanager:file:///etc/heapster/am.yaml with am.yaml being
+//
+//	endpoint: http://alertmanager:9093
+//	options:
+//	  cluster: production
+//	  dedup_keys: [kind, namespace, name, reason]
+//	  template: |
+//	    {{.Reason}} on {{.InvolvedObject.Name}}
+//
+// is the same as
+// --sink=alertmanager:http://alertmanager:9093?cluster=production&dedup_keys=...
+//
+// Option values may be scalars, lists of scalars for repeated options, or
+// maps whose entries are passed as repeated key:value options. Options given
+// in the query of the file URI, e.g. file:///etc/heapster/am.yaml?cluster=staging,
+// win over those in the file.
+type sinkConfigFile struct {
+	Endpoint string                 `json:"endpoint"`
+	Options  map[string]interface{} `json:"options"`
+}
+
+// isSinkConfigFile tells whether the sink URI refers to a configuration file.
+func isSinkConfigFile(val *url.URL) bool {
+	return val.Scheme == "file"
+}
+
+// loadSinkConfigFile reads the configuration file the sink URI refers to and
+// returns the equivalent sink URI.
+func loadSinkConfigFile(val *url.URL) (*url.URL, error) {
+	path := val.Path
+	if path == "" {
+		path = val.Opaque
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read sink config file: %v", err)
+	}
+	var config sinkConfigFile
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("failed to parse sink config file %s: %v", path, err)
+	}
+
+	uri, err := url.Parse(config.Endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid endpoint in sink config file %s: %v", path, err)
+	}
+	opts := uri.Query()
+	for name, value := range config.Options {
+		values, err := optionValues(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid option %s in sink config file %s: %v", name, path, err)
+		}
+		opts[name] = values
+	}
+	for name, values := range val.Query() {
+		opts[name] = values
+	}
+	uri.RawQuery = opts.Encode()
+	return uri, nil
+}
+
+func optionValues(value interface{}) ([]string, error) {
+	switch v := value.(type) {
+	case []interface{}:
+		values := make([]string, 0, len(v))
+		for _, item := range v {
+			s, err := scalarValue(item)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, s)
+		}
+		return values, nil
+	case map[interface{}]interface{}:
+		entries := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			s, err := scalarValue(key)
+			if err != nil {
+				return nil, err
+			}
+			entries[s] = item
+		}
+		return optionValues(entries)
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		values := make([]string, 0, len(v))
+		for _, key := range keys {
+			s, err := scalarValue(v[key])
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, key+":"+s)
+		}
+		return values, nil
+	default:
+		s, err := scalarValue(v)
+		if err != nil {
+			return nil, err
+		}
+		return []string{s}, nil
+	}
+}
+
+func scalarValue(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case int:
+		return strconv.Itoa(v), nil
+	case uint64:
+		return strconv.FormatUint(v, 10), nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	default:
+		return "", fmt.Errorf("unsupported value %v", value)
+	}
+}
@@ -0,0 +1,100 @@
+// Copyright 2018 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sinks
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/heapster/common/flags"
+	"k8s.io/heapster/events/sinks/alertmanager"
+)
+
+func writeSinkConfigFile(t *testing.T, dir, content string) string {
+	path := filepath.Join(dir, "sink.yaml")
+	assert.NoError(t, ioutil.WriteFile(path, []byte(content), 0644))
+	return path
+}
+
+func TestBuildFromConfigFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sink-config")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := writeSinkConfigFile(t, dir, `
+endpoint: http://alertmanager:9093/api/v1/alerts?level=Normal
+options:
+  cluster: production
+  batch_size: 20
+  dedup_keys: kind,name
+  template: |
+    {{.Reason}} on {{.InvolvedObject.Name}}
+`)
+
+	var uri flags.Uri
+	assert.NoError(t, uri.Set("alertmanager:file://"+path))
+	sink, err := NewSinkFactory().Build(uri)
+	assert.NoError(t, err)
+
+	am := sink.(*alertmanager.AlertmanagerSink)
+	assert.Equal(t, "alertmanager:9093/api/v1/alerts", am.Endpoint)
+	assert.Equal(t, "production", am.Cluster)
+	assert.Equal(t, 20, am.BatchSize)
+	assert.Equal(t, alertmanager.NORMAL, am.Level)
+	assert.Equal(t, []string{"kind", "name"}, am.DedupKeys)
+	assert.NotNil(t, am.Template)
+	sink.Stop()
+
+	// Options given with the file URI win over those in the file.
+	assert.NoError(t, uri.Set("alertmanager:file://"+path+"?cluster=staging"))
+	sink, err = NewSinkFactory().Build(uri)
+	assert.NoError(t, err)
+	am = sink.(*alertmanager.AlertmanagerSink)
+	assert.Equal(t, "staging", am.Cluster)
+	assert.Equal(t, 20, am.BatchSize)
+	sink.Stop()
+}
+
+func TestOptionValues(t *testing.T) {
+	values, err := optionValues([]interface{}{"a", float64(2), true})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a", "2", "true"}, values)
+
+	values, err = optionValues(map[string]interface{}{"team": "infra", "env": "prod"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"env:prod", "team:infra"}, values)
+
+	_, err = optionValues([]interface{}{[]interface{}{"nested"}})
+	assert.Error(t, err)
+}
+
+func TestBuildFromInvalidConfigFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sink-config")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	var uri flags.Uri
+	assert.NoError(t, uri.Set("alertmanager:file://"+filepath.Join(dir, "missing.yaml")))
+	_, err = NewSinkFactory().Build(uri)
+	assert.Error(t, err)
+
+	path := writeSinkConfigFile(t, dir, "options: [not, a, map]")
+	assert.NoError(t, uri.Set("alertmanager:file://"+path))
+	_, err = NewSinkFactory().Build(uri)
+	assert.Error(t, err)
+}
@@ -16,120 +16,356 @@ package dingtalk
 
 import (
 	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"net/http"
 	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
 	"time"
 
 	"github.com/facebookarchive/inmem"
 	"github.com/golang/glog"
 	"k8s.io/api/core/v1"
+	kubeconfig "k8s.io/heapster/common/kubernetes"
 	"k8s.io/heapster/events/core"
+	"k8s.io/heapster/version"
 )
 
 const (
-	DINGTALK_SINK                 = "DingTalkSink"
-	WARNING                   int = 2
-	NORMAL                    int = 1
-	DEFAULT_MSG_TYPE              = "text"
-	CONTENT_TYPE_JSON             = "application/json"
-	MSG_TEMPLATE                  = "Level:%s \nNamespace:%s \nName:%s \nMessage:%s \nReason:%s \nTimestamp:%s"
-	MSG_RECORDER_KEY_TEMPLATE     = "%s%s%s%s%s"
-	LABE_TEMPLATE                 = "%s\n"
-	MAX_RECORDER                  = 100
+	DINGTALK_SINK             = "DingTalkSink"
+	WARNING                   = core.LevelWarning
+	NORMAL                    = core.LevelNormal
+	DEFAULT_MSG_TYPE          = "text"
+	CONTENT_TYPE_JSON         = "application/json"
+	MSG_TEMPLATE              = "Level:%s \nNamespace:%s \nName:%s \nMessage:%s \nReason:%s \nTimestamp:%s"
+	MSG_RECORDER_KEY_TEMPLATE = "%s%s%s%s%s"
+	LABE_TEMPLATE             = "%s\n"
+	MAX_RECORDER              = 100
 )
 
-var recorder = inmem.NewUnlocked(MAX_RECORDER)
+// PathOptions are the <name>_file options read as paths by the sink.
+var PathOptions = []string{"template_file"}
 
-/**
+// nodeLabel reads the cluster name from the node with cluster_from_node.
+var nodeLabel core.NodeLabelFunc = kubeconfig.NodeLabel
+
+/*
+*
 dingtalk msg struct
 */
 type DingTalkMsg struct {
-	MsgType string       `json:"msgtype"`
-	Text    DingTalkText `json:"text"`
+	MsgType  string            `json:"msgtype"`
+	Text     *DingTalkText     `json:"text,omitempty"`
+	Markdown *DingTalkMarkdown `json:"markdown,omitempty"`
+	At       *DingTalkAt       `json:"at,omitempty"`
+}
+
+type DingTalkAt struct {
+	AtMobiles []string `json:"atMobiles,omitempty"`
+	IsAtAll   bool     `json:"isAtAll,omitempty"`
 }
 
 type DingTalkText struct {
 	Content string `json:"content"`
 }
 
-/**
+/*
+*
 dingtalk sink usage
 --sink:dingtalk:https://oapi.dingtalk.com/robot/send?access_token=[access_token]&level=Warning&label=[label]
 
+access_token: the token of the robot. Repeated or comma-separated tokens, also accepted as token,
+spread messages round-robin across robots, skipping for token_cooldown (1m by default) those that fail.
+
 level: Normal or Warning. The event level greater than global level will emit.
 label: some thing unique when you want to distinguish different k8s clusters.
+template: optional Go text/template rendered against TemplateData, the event and the cluster, to
+build the message body. template_file reads it from a file instead.
+user_agent: the User-Agent header sent, heapster-events/<version> by default.
+sign: the signing secret of a secured robot. Every request is signed with it.
+msg_type: text (the default) or markdown.
+cluster: the cluster listed in markdown messages and templates, CLUSTER_NAME by default. With
+cluster_from_node=true, it's read from the cluster_node_label label (cluster by default) of the node
+heapster runs on. Messages don't list any cluster if none is set.
+time_zone: the time zone of event times in markdown messages, local time by default.
+at_mobiles: comma-separated phone numbers of the people mentioned in messages, may be repeated.
+is_at_all: true to mention everyone in the group.
+at_level: Normal or Warning. Only events of this level or greater mention anyone.
+msg_per_minute: the most messages sent per minute, 19 by default to stay below the robot limit.
+queue_size: the most messages waiting to be sent, 100 by default. The oldest are dropped beyond.
+flush_timeout: how long queued messages are still sent, at the same pace, once the sink is stopped. 5s by default, 0 to abandon them.
+namespaces: comma-separated namespaces, or globs like dev-*, of the objects events are sent for.
+cluster stands for cluster-scoped objects like nodes.
+kinds: comma-separated kinds of the objects events are sent for, like Pod,Node.
+ignore_reasons: comma-separated reasons of the events never sent, like DNSConfigForming.
 */
 type DingTalkSink struct {
 	Endpoint string
-	Token    string
-	Level    int
-	Labels   []string
+	// Tokens are the access tokens of the robots messages are spread across.
+	Tokens    []string
+	Level     int
+	Labels    []string
+	Template  *template.Template
+	UserAgent string
+	// Secret signs the requests to robots secured with a signature.
+	Secret string
+	// MsgType is the message type sent, text or markdown.
+	MsgType string
+	// Cluster and Location are used by markdown messages, Cluster by templates too.
+	Cluster  string
+	Location *time.Location
+	// AtMobiles and AtAll are the mentions of messages for events of AtLevel
+	// or greater.
+	AtMobiles []string
+	AtAll     bool
+	AtLevel   int
+	// MsgPerMinute paces the messages sent from a queue of QueueSize.
+	MsgPerMinute int
+	QueueSize    int
+	// FlushTimeout bounds the time spent sending queued messages on stop.
+	FlushTimeout time.Duration
+	// TokenCooldown is how long a token that failed is skipped.
+	TokenCooldown time.Duration
+
+	filter   *eventFilter
+	tokens   *tokenPool
+	recorder inmem.Cache
+	client   *http.Client
+	queue    *msgQueue
+	// after waits between two messages, time.After but in tests.
+	after    func(time.Duration) <-chan time.Time
+	stopCh   chan struct{}
+	stopOnce sync.Once
+	done     chan struct{}
 }
 
 func (d *DingTalkSink) Name() string {
 	return DINGTALK_SINK
 }
 
+// Stop keeps sending the messages still queued for up to FlushTimeout,
+// abandons those left after, and returns once sending is over. It may be
+// called more than once.
 func (d *DingTalkSink) Stop() {
-	//do nothing
+	d.stopOnce.Do(func() { close(d.stopCh) })
+	<-d.done
 }
 
+// ExportEvents queues the messages of the events, which are sent in the
+// background at the configured pace. Events are recorded once queued so that
+// repeats don't fill the queue.
 func (d *DingTalkSink) ExportEvents(batch *core.EventBatch) {
+	dropped := 0
+	forwarded, byLevel, byReason, byObject := 0, 0, 0, 0
 	for _, event := range batch.Events {
-		if d.isEventLevelDangerous(event.Type) {
-			if _, ok := recorder.Get(generateKey(event)); !ok {
-				d.Ding(event)
-			}
+		switch {
+		case !d.isEventLevelDangerous(event.Type):
+			byLevel++
+			continue
+		case d.filter.ignoredReason(event):
+			byReason++
+			continue
+		case !d.filter.allowed(event):
+			byObject++
+			continue
+		}
+		key := generateKey(event)
+		if _, ok := d.recorder.Get(key); ok {
+			continue
 		}
+		msg := d.createMsg(event)
+		if msg == nil {
+			glog.Warningf("failed to create msg from event,because of %v", event)
+			continue
+		}
+		dropped += d.queue.push(msg)
+		d.recorder.Add(key, 1, time.Now().Add(time.Second*5))
+		forwarded++
+	}
+	if len(batch.Events) > 0 {
+		glog.V(2).Infof("dingtalk sink forwarded %d events, filtered %d by level, %d by reason, %d by namespace or kind",
+			forwarded, byLevel, byReason, byObject)
+	}
+	if dropped > 0 {
+		glog.Warningf("dingtalk queue is full, dropped the %d oldest messages", dropped)
 	}
 }
 
 func (d *DingTalkSink) isEventLevelDangerous(level string) bool {
-	score := getLevel(level)
-	if score >= d.Level {
-		return true
-	}
-	return false
+	return core.IsLevelAtLeast(level, d.Level)
 }
 
+// Ding sends the message of the event right away, bypassing the queue.
 func (d *DingTalkSink) Ding(event *v1.Event) {
-	msg := createMsgFromEvent(d.Labels, event)
+	msg := d.createMsg(event)
 	if msg == nil {
 		glog.Warningf("failed to create msg from event,because of %v", event)
 		return
 	}
+	if d.send(msg) {
+		d.recorder.Add(generateKey(event), 1, time.Now().Add(time.Second*5))
+	}
+}
 
+// send posts the message to the webhook and tells whether it succeeded.
+func (d *DingTalkSink) send(msg *DingTalkMsg) bool {
 	msg_bytes, err := json.Marshal(msg)
 	if err != nil {
 		glog.Warningf("failed to marshal msg %v", msg)
-		return
+		return false
 	}
 
-	b := bytes.NewBuffer(msg_bytes)
-
-	_, err = http.Post(fmt.Sprintf("https://%s?access_token=%s", d.Endpoint, d.Token), CONTENT_TYPE_JSON, b)
+	// A robot that failed, for instance because it is rate limited, is
+	// skipped for a while and the message retried once with the next one.
+	token := d.tokens.pick()
+	err = d.post(token, msg_bytes)
+	if err != nil && len(d.Tokens) > 1 {
+		d.tokens.fail(token)
+		glog.Warningf("failed to send msg to dingtalk, retrying with another robot: %v", err)
+		token = d.tokens.pick()
+		err = d.post(token, msg_bytes)
+	}
 	if err != nil {
+		d.tokens.fail(token)
 		glog.Errorf("failed to send msg to dingtalk,because of %s", err.Error())
+		return false
+	}
+	return true
+}
+
+// dingTalkResponse is the result of a request, errcode 0 on success.
+type dingTalkResponse struct {
+	ErrCode int    `json:"errcode"`
+	ErrMsg  string `json:"errmsg"`
+}
+
+// post sends the message to the robot of token. DingTalk reports most
+// errors, rate limiting included, in the body of 200 responses.
+func (d *DingTalkSink) post(token string, msg []byte) error {
+	req, err := http.NewRequest(http.MethodPost, d.webhookURL(token, time.Now()), bytes.NewReader(msg))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", CONTENT_TYPE_JSON)
+	req.Header.Set("User-Agent", d.UserAgent)
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	var result dingTalkResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err == nil && result.ErrCode != 0 {
+		return fmt.Errorf("error %d: %s", result.ErrCode, result.ErrMsg)
+	}
+	return nil
+}
+
+// webhookURL returns the URL messages are posted to with token at now. With
+// a secret, it carries the timestamp and signature, which DingTalk only
+// accepts for an hour, so it is built for every request.
+func (d *DingTalkSink) webhookURL(token string, now time.Time) string {
+	webhook := fmt.Sprintf("https://%s?access_token=%s", d.Endpoint, url.QueryEscape(token))
+	if d.Secret == "" {
+		return webhook
+	}
+	timestamp := now.UnixNano() / int64(time.Millisecond)
+	return fmt.Sprintf("%s&timestamp=%d&sign=%s", webhook, timestamp, url.QueryEscape(sign(timestamp, d.Secret)))
+}
+
+// sign computes the signature of a request at timestamp, in milliseconds:
+// the base64 encoded HMAC-SHA256 of timestamp+"\n"+secret keyed by secret.
+func sign(timestamp int64, secret string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d\n%s", timestamp, secret)
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// createMsg builds the message of the event and adds the configured mentions.
+func (d *DingTalkSink) createMsg(event *v1.Event) *DingTalkMsg {
+	msg := d.renderMsg(event)
+	if msg != nil {
+		d.mention(msg, event)
+	}
+	return msg
+}
+
+// mention fills the at block of the message if the event is of the mention
+// level. DingTalk only notifies the mentioned numbers when they also appear
+// in the message body, so they are appended to it.
+func (d *DingTalkSink) mention(msg *DingTalkMsg, event *v1.Event) {
+	if len(d.AtMobiles) == 0 && !d.AtAll || !core.IsLevelAtLeast(event.Type, d.AtLevel) {
+		return
+	}
+	msg.At = &DingTalkAt{AtMobiles: d.AtMobiles, IsAtAll: d.AtAll}
+	if len(d.AtMobiles) == 0 {
 		return
 	}
+	mentions := "\n@" + strings.Join(d.AtMobiles, " @")
+	switch {
+	case msg.Text != nil:
+		msg.Text.Content += mentions
+	case msg.Markdown != nil:
+		msg.Markdown.Text += mentions
+	}
+}
 
-	// if send success ，then add recoreder
-	recorder.Add(generateKey(event), 1, time.Now().Add(time.Second*5))
+// TemplateData is what message templates are rendered against: the fields
+// of the event, like {{.Reason}}, and the name of the cluster.
+type TemplateData struct {
+	*v1.Event
+	Cluster string
 }
 
-func getLevel(level string) int {
-	score := 0
-	switch level {
-	case v1.EventTypeWarning:
-		score += 2
-	case v1.EventTypeNormal:
-		score += 1
-	default:
-		//score will remain 0
+// renderMsg renders the configured template, falling back to the default
+// message format when there is none or it fails to render.
+func (d *DingTalkSink) renderMsg(event *v1.Event) *DingTalkMsg {
+	if d.Template != nil {
+		msg, err := d.renderTemplate(event)
+		if err == nil {
+			return msg
+		}
+		glog.Warningf("failed to render dingtalk template for event %s/%s: %v", event.Namespace, event.Name, err)
+	}
+	if d.MsgType == MSG_TYPE_MARKDOWN {
+		return d.createMarkdownMsg(event)
 	}
-	return score
+	return createMsgFromEvent(d.Labels, event)
+}
+
+// renderTemplate renders the body of the message with the template. Markdown
+// messages are titled like the default ones.
+func (d *DingTalkSink) renderTemplate(event *v1.Event) (*DingTalkMsg, error) {
+	var buf bytes.Buffer
+	for _, label := range d.Labels {
+		buf.WriteString(fmt.Sprintf(LABE_TEMPLATE, label))
+		if d.MsgType == MSG_TYPE_MARKDOWN {
+			buf.WriteString("\n")
+		}
+	}
+	if err := d.Template.Execute(&buf, TemplateData{Event: event, Cluster: d.Cluster}); err != nil {
+		return nil, err
+	}
+	if d.MsgType == MSG_TYPE_MARKDOWN {
+		return &DingTalkMsg{
+			MsgType:  MSG_TYPE_MARKDOWN,
+			Markdown: &DingTalkMarkdown{Title: strings.TrimSpace(event.Type + " " + event.Reason), Text: buf.String()},
+		}, nil
+	}
+	return &DingTalkMsg{
+		MsgType: DEFAULT_MSG_TYPE,
+		Text:    &DingTalkText{Content: buf.String()},
+	}, nil
 }
 
 func createMsgFromEvent(labels []string, event *v1.Event) *DingTalkMsg {
@@ -141,36 +377,172 @@ func createMsgFromEvent(labels []string, event *v1.Event) *DingTalkMsg {
 			template = fmt.Sprintf(LABE_TEMPLATE, label) + template
 		}
 	}
-	msg.Text = DingTalkText{
+	msg.Text = &DingTalkText{
 		Content: fmt.Sprintf(template, event.Type, event.Namespace, event.Name, event.Message, event.Reason, event.LastTimestamp),
 	}
 	return msg
 }
 
 func NewDingTalkSink(uri *url.URL) (*DingTalkSink, error) {
+	d, err := newDingTalkSink(uri)
+	if err != nil {
+		return nil, err
+	}
+	go d.run()
+	return d, nil
+}
+
+// newDingTalkSink parses the options of the sink without starting to send
+// queued messages.
+func newDingTalkSink(uri *url.URL) (*DingTalkSink, error) {
 	d := &DingTalkSink{
-		Level: WARNING,
+		Level:     WARNING,
+		UserAgent: version.UserAgent("events"),
+		MsgType:   DEFAULT_MSG_TYPE,
+		Location:  time.Local,
+
+		MsgPerMinute:  DEFAULT_MSG_PER_MINUTE,
+		QueueSize:     DEFAULT_QUEUE_SIZE,
+		FlushTimeout:  DEFAULT_FLUSH_TIMEOUT,
+		TokenCooldown: DEFAULT_TOKEN_COOLDOWN,
+		recorder:      inmem.NewLocked(MAX_RECORDER),
+		client:        http.DefaultClient,
+		after:         time.After,
+		stopCh:        make(chan struct{}),
+		done:          make(chan struct{}),
 	}
 	if len(uri.Host) > 0 {
 		d.Endpoint = uri.Host + uri.Path
 	}
 	opts := uri.Query()
 
-	if len(opts["access_token"]) >= 1 {
-		d.Token = opts["access_token"][0]
-	} else {
+	// token is an alias of access_token, both may be repeated or list
+	// several tokens separated by commas.
+	for _, value := range append(opts["access_token"], opts["token"]...) {
+		d.Tokens = append(d.Tokens, splitList(value)...)
+	}
+	if len(d.Tokens) == 0 {
 		return nil, fmt.Errorf("you must provide dingtalk bot access_token")
 	}
+	if len(opts["token_cooldown"]) >= 1 {
+		cooldown, err := time.ParseDuration(opts["token_cooldown"][0])
+		if err != nil || cooldown <= 0 {
+			return nil, fmt.Errorf("token_cooldown must be a positive duration, got %q", opts["token_cooldown"][0])
+		}
+		d.TokenCooldown = cooldown
+	}
+	d.tokens = newTokenPool(d.Tokens, d.TokenCooldown)
 
 	if len(opts["level"]) >= 1 {
-		d.Level = getLevel(opts["level"][0])
+		d.Level = core.EventLevel(opts["level"][0])
+		if d.Level == 0 {
+			return nil, fmt.Errorf("level must be %s or %s, got %q", v1.EventTypeNormal, v1.EventTypeWarning, opts["level"][0])
+		}
+	}
+
+	if len(opts["user_agent"]) >= 1 && opts["user_agent"][0] != "" {
+		d.UserAgent = opts["user_agent"][0]
+	}
+
+	if len(opts["sign"]) >= 1 {
+		d.Secret = opts["sign"][0]
+	}
+
+	if len(opts["msg_type"]) >= 1 {
+		switch opts["msg_type"][0] {
+		case DEFAULT_MSG_TYPE, MSG_TYPE_MARKDOWN:
+			d.MsgType = opts["msg_type"][0]
+		default:
+			return nil, fmt.Errorf("msg_type must be %s or %s, got %q", DEFAULT_MSG_TYPE, MSG_TYPE_MARKDOWN, opts["msg_type"][0])
+		}
+	}
+	// Unlike other sinks, the cluster is optional: it's only shown when set.
+	cluster, err := core.ClusterName(opts, nodeLabel)
+	if err != nil && err != core.ErrNoClusterName {
+		return nil, err
+	}
+	d.Cluster = cluster
+	if len(opts["time_zone"]) >= 1 {
+		location, err := time.LoadLocation(opts["time_zone"][0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid time_zone %q: %v", opts["time_zone"][0], err)
+		}
+		d.Location = location
 	}
 
+	for _, value := range opts["at_mobiles"] {
+		d.AtMobiles = append(d.AtMobiles, splitList(value)...)
+	}
+	if len(opts["is_at_all"]) >= 1 {
+		atAll, err := strconv.ParseBool(opts["is_at_all"][0])
+		if err != nil {
+			return nil, fmt.Errorf("is_at_all must be a boolean, got %q", opts["is_at_all"][0])
+		}
+		d.AtAll = atAll
+	}
+	if len(opts["at_level"]) >= 1 {
+		d.AtLevel = core.EventLevel(opts["at_level"][0])
+		if d.AtLevel == 0 {
+			return nil, fmt.Errorf("at_level must be %s or %s, got %q", v1.EventTypeNormal, v1.EventTypeWarning, opts["at_level"][0])
+		}
+	}
+
+	if len(opts["msg_per_minute"]) >= 1 {
+		perMinute, err := strconv.Atoi(opts["msg_per_minute"][0])
+		if err != nil || perMinute <= 0 {
+			return nil, fmt.Errorf("msg_per_minute must be a positive integer, got %q", opts["msg_per_minute"][0])
+		}
+		d.MsgPerMinute = perMinute
+	}
+	if len(opts["queue_size"]) >= 1 {
+		size, err := strconv.Atoi(opts["queue_size"][0])
+		if err != nil || size <= 0 {
+			return nil, fmt.Errorf("queue_size must be a positive integer, got %q", opts["queue_size"][0])
+		}
+		d.QueueSize = size
+	}
+	if len(opts["flush_timeout"]) >= 1 {
+		timeout, err := time.ParseDuration(opts["flush_timeout"][0])
+		if err != nil || timeout < 0 {
+			return nil, fmt.Errorf("flush_timeout must be a non-negative duration, got %q", opts["flush_timeout"][0])
+		}
+		d.FlushTimeout = timeout
+	}
+
+	filter, err := newEventFilter(opts["namespaces"], opts["kinds"], opts["ignore_reasons"])
+	if err != nil {
+		return nil, err
+	}
+	d.filter = filter
+
 	//add extra labels
 	if len(opts["label"]) >= 1 {
 		d.Labels = opts["label"]
 	}
 
+	var text string
+	if len(opts["template"]) >= 1 {
+		text = opts["template"][0]
+	}
+	if len(opts["template_file"]) >= 1 && opts["template_file"][0] != "" {
+		if text != "" {
+			return nil, fmt.Errorf("template and template_file can't both be set")
+		}
+		data, err := ioutil.ReadFile(opts["template_file"][0])
+		if err != nil {
+			return nil, fmt.Errorf("failed to read dingtalk template_file: %v", err)
+		}
+		text = string(data)
+	}
+	if text != "" {
+		tmpl, err := template.New("dingtalk").Parse(text)
+		if err != nil {
+			return nil, fmt.Errorf("invalid dingtalk template: %v", err)
+		}
+		d.Template = tmpl
+	}
+
+	d.queue = newMsgQueue(d.QueueSize)
 	return d, nil
 }
 
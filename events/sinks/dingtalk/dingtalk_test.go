@@ -1,22 +1,35 @@
 package dingtalk
 
 import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"unicode/utf8"
 
 	"github.com/stretchr/testify/assert"
 	"k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/heapster/events/core"
 	"time"
 )
 
-func TestGetLevel(t *testing.T) {
-	warning := getLevel(v1.EventTypeWarning)
-	normal := getLevel(v1.EventTypeNormal)
-	none := getLevel("")
-	assert.True(t, warning > normal)
-	assert.True(t, warning == WARNING)
-	assert.True(t, normal == NORMAL)
-	assert.True(t, 0 == none)
+func TestLevels(t *testing.T) {
+	assert.Equal(t, WARNING, core.EventLevel(v1.EventTypeWarning))
+	assert.Equal(t, NORMAL, core.EventLevel(v1.EventTypeNormal))
+
+	d := &DingTalkSink{Level: WARNING}
+	assert.True(t, d.isEventLevelDangerous(v1.EventTypeWarning))
+	assert.False(t, d.isEventLevelDangerous(v1.EventTypeNormal))
+	assert.False(t, d.isEventLevelDangerous(""))
 }
 
 func TestCreateMsgFromEvent(t *testing.T) {
@@ -33,3 +46,528 @@ func TestCreateMsgFromEvent(t *testing.T) {
 
 	assert.True(t, msg != nil)
 }
+
+func TestCreateMsgWithTemplate(t *testing.T) {
+	uri, _ := url.Parse("https://oapi.dingtalk.com/robot/send?access_token=token&label=prod&template=" +
+		url.QueryEscape(`{{.Reason}}: {{.Message}}`))
+	sink, err := NewDingTalkSink(uri)
+	assert.NoError(t, err)
+
+	event := &v1.Event{Reason: "BackOff", Message: "some thing wrong"}
+	msg := sink.createMsg(event)
+	assert.Equal(t, "prod\nBackOff: some thing wrong", msg.Text.Content)
+
+	// Without a template the default format is used.
+	sink.Template = nil
+	assert.Equal(t, createMsgFromEvent(sink.Labels, event), sink.createMsg(event))
+
+	uri, _ = url.Parse("https://oapi.dingtalk.com/robot/send?access_token=token&template=" + url.QueryEscape(`{{.Reason`))
+	_, err = NewDingTalkSink(uri)
+	assert.Error(t, err)
+}
+
+func TestSignedWebhookURL(t *testing.T) {
+	uri, _ := url.Parse("https://oapi.dingtalk.com/robot/send?access_token=token&sign=SECtest")
+	sink, err := NewDingTalkSink(uri)
+	assert.NoError(t, err)
+	assert.Equal(t, "SECtest", sink.Secret)
+
+	now := time.Unix(1600000000, 0)
+	assert.Equal(t, "J1ROuI0lRhdAs5lXpASksT0u9NwWl4DNkvcHISJRBoY=", sign(1600000000000, "SECtest"))
+	assert.Equal(t, "https://oapi.dingtalk.com/robot/send?access_token=token&timestamp=1600000000000&sign=J1ROuI0lRhdAs5lXpASksT0u9NwWl4DNkvcHISJRBoY%3D",
+		sink.webhookURL("token", now))
+	// The signature is computed for every request.
+	assert.NotEqual(t, sink.webhookURL("token", now), sink.webhookURL("token", now.Add(time.Second)))
+
+	uri, _ = url.Parse("https://oapi.dingtalk.com/robot/send?access_token=token")
+	sink, err = NewDingTalkSink(uri)
+	assert.NoError(t, err)
+	assert.Equal(t, "https://oapi.dingtalk.com/robot/send?access_token=token", sink.webhookURL("token", now))
+}
+
+func markdownSink(t *testing.T) *DingTalkSink {
+	uri, _ := url.Parse("https://oapi.dingtalk.com/robot/send?access_token=token&msg_type=markdown&cluster=prod&label=team_a&time_zone=Asia/Shanghai")
+	sink, err := NewDingTalkSink(uri)
+	assert.NoError(t, err)
+	return sink
+}
+
+func TestMarkdownMsgMatchesSnapshots(t *testing.T) {
+	seen := time.Date(2018, 3, 1, 10, 1, 0, 0, time.UTC)
+	tests := []struct {
+		event    *v1.Event
+		snapshot string
+	}{
+		{
+			event: &v1.Event{
+				Type:           v1.EventTypeWarning,
+				Reason:         "BackOff",
+				Message:        "Back-off restarting failed container `app` in pod web-0_default(1234)",
+				Count:          4,
+				InvolvedObject: v1.ObjectReference{Kind: "Pod", Namespace: "default", Name: "web-0"},
+				LastTimestamp:  metav1.NewTime(seen),
+			},
+			snapshot: "markdown_warning.json",
+		},
+		{
+			event: &v1.Event{
+				Type:           v1.EventTypeNormal,
+				Reason:         "ScalingReplicaSet",
+				Message:        "Scaled up replica set web-5d9c7b8f6 to 3",
+				InvolvedObject: v1.ObjectReference{Kind: "Deployment", Namespace: "default", Name: "web"},
+				EventTime:      metav1.NewMicroTime(seen),
+			},
+			snapshot: "markdown_normal.json",
+		},
+	}
+	sink := markdownSink(t)
+	for _, test := range tests {
+		body, err := json.Marshal(sink.createMsg(test.event))
+		assert.NoError(t, err)
+		expected, err := ioutil.ReadFile(filepath.Join("testdata", test.snapshot))
+		assert.NoError(t, err)
+		assert.JSONEq(t, string(expected), string(body), test.snapshot)
+	}
+}
+
+func TestMarkdownMsgIsTruncated(t *testing.T) {
+	sink := markdownSink(t)
+	event := &v1.Event{Type: v1.EventTypeWarning, Reason: "Failed", Message: strings.Repeat("错误", MAX_MSG_BYTES)}
+	msg := sink.createMsg(event)
+	assert.True(t, len(msg.Markdown.Text) <= MAX_MSG_BYTES)
+	assert.True(t, utf8.ValidString(msg.Markdown.Text))
+	assert.Contains(t, msg.Markdown.Text, ellipsis+"\n```\n")
+}
+
+func TestMsgType(t *testing.T) {
+	uri, _ := url.Parse("https://oapi.dingtalk.com/robot/send?access_token=token")
+	sink, err := NewDingTalkSink(uri)
+	assert.NoError(t, err)
+	assert.Equal(t, DEFAULT_MSG_TYPE, sink.MsgType)
+	msg := sink.createMsg(&v1.Event{Reason: "BackOff"})
+	assert.Nil(t, msg.Markdown)
+
+	for _, invalid := range []string{"msg_type=html", "msg_type=markdown&time_zone=Mars/Olympus"} {
+		uri, _ := url.Parse("https://oapi.dingtalk.com/robot/send?access_token=token&" + invalid)
+		_, err := NewDingTalkSink(uri)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestMentions(t *testing.T) {
+	warning := &v1.Event{Type: v1.EventTypeWarning, Reason: "BackOff", Namespace: "payment"}
+	normal := &v1.Event{Type: v1.EventTypeNormal, Reason: "Pulled", Namespace: "payment"}
+	tests := []struct {
+		query    string
+		event    *v1.Event
+		expected string
+	}{
+		{"at_mobiles=13800000000,%2013900000000", warning, `{"atMobiles":["13800000000","13900000000"]}`},
+		{"is_at_all=true", warning, `{"isAtAll":true}`},
+		{"is_at_all=true&at_level=Warning", normal, ""},
+		{"at_mobiles=13800000000&at_level=Warning", warning, `{"atMobiles":["13800000000"]}`},
+		{"", warning, ""},
+	}
+	for _, test := range tests {
+		uri, _ := url.Parse("https://oapi.dingtalk.com/robot/send?access_token=token&level=Normal&" + test.query)
+		sink, err := NewDingTalkSink(uri)
+		assert.NoError(t, err, test.query)
+		msg := sink.createMsg(test.event)
+		if test.expected == "" {
+			assert.Nil(t, msg.At, test.query)
+			assert.NotContains(t, msg.Text.Content, "@", test.query)
+			continue
+		}
+		at, err := json.Marshal(msg.At)
+		assert.NoError(t, err)
+		assert.JSONEq(t, test.expected, string(at), test.query)
+		for _, mobile := range msg.At.AtMobiles {
+			assert.Contains(t, msg.Text.Content, "@"+mobile, test.query)
+		}
+	}
+
+	for _, invalid := range []string{"is_at_all=yes please", "at_level=Critical"} {
+		uri, _ := url.Parse("https://oapi.dingtalk.com/robot/send?access_token=token&" + invalid)
+		_, err := NewDingTalkSink(uri)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestQueuePacingAndOverflow(t *testing.T) {
+	var received int32
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&received, 1)
+	}))
+	defer server.Close()
+
+	uri, _ := url.Parse("https://oapi.dingtalk.com/robot/send?access_token=token&level=Normal&queue_size=30")
+	sink, err := newDingTalkSink(uri)
+	assert.NoError(t, err)
+	sink.Endpoint = strings.TrimPrefix(server.URL, "https://") + "/robot/send"
+	sink.client = server.Client()
+	waits := make(chan time.Duration)
+	tick := make(chan time.Time)
+	sink.after = func(d time.Duration) <-chan time.Time {
+		waits <- d
+		return tick
+	}
+
+	// A burst of 50 events overflows the queue before the sink starts.
+	batch := &core.EventBatch{}
+	for i := 0; i < 50; i++ {
+		batch.Events = append(batch.Events, &v1.Event{
+			Type:    v1.EventTypeWarning,
+			Reason:  "FailedScheduling",
+			Message: fmt.Sprintf("pod %d doesn't fit", i),
+		})
+	}
+	sink.ExportEvents(batch)
+	assert.Equal(t, 30, sink.queue.len())
+	assert.Equal(t, 20, sink.queue.droppedTotal())
+	go sink.run()
+
+	for i := 1; i <= 30; i++ {
+		assert.Equal(t, time.Minute/DEFAULT_MSG_PER_MINUTE, <-waits)
+		assert.Equal(t, int32(i), atomic.LoadInt32(&received))
+		tick <- time.Now()
+	}
+
+	// Repeats of queued events aren't queued again.
+	sink.ExportEvents(batch)
+	assert.Equal(t, 0, sink.queue.len())
+
+	// Messages still queued are abandoned on stop without a flush timeout.
+	sink.FlushTimeout = 0
+	batch.Events = batch.Events[:3]
+	for _, event := range batch.Events {
+		event.Reason = "Unhealthy"
+	}
+	sink.ExportEvents(batch)
+	<-waits
+	sink.Stop()
+	assert.Equal(t, int32(31), atomic.LoadInt32(&received))
+	assert.Equal(t, 2, sink.queue.len())
+
+	// Stopping again is harmless.
+	sink.Stop()
+}
+
+func TestFlushOnStop(t *testing.T) {
+	var received int32
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&received, 1)
+	}))
+	defer server.Close()
+
+	uri, _ := url.Parse("https://oapi.dingtalk.com/robot/send?access_token=token&level=Normal&flush_timeout=10s")
+	sink, err := newDingTalkSink(uri)
+	assert.NoError(t, err)
+	assert.Equal(t, 10*time.Second, sink.FlushTimeout)
+	sink.Endpoint = strings.TrimPrefix(server.URL, "https://") + "/robot/send"
+	sink.client = server.Client()
+	waits := make(chan time.Duration)
+	tick := make(chan time.Time)
+	deadline := make(chan time.Time)
+	sink.after = func(d time.Duration) <-chan time.Time {
+		waits <- d
+		if d == sink.FlushTimeout {
+			return deadline
+		}
+		return tick
+	}
+
+	batch := &core.EventBatch{}
+	for i := 0; i < 4; i++ {
+		batch.Events = append(batch.Events, &v1.Event{
+			Type:    v1.EventTypeWarning,
+			Reason:  "FailedScheduling",
+			Message: fmt.Sprintf("pod %d doesn't fit", i),
+		})
+	}
+	sink.ExportEvents(batch)
+	go sink.run()
+	interval := <-waits
+	stopped := make(chan struct{})
+	go func() {
+		sink.Stop()
+		close(stopped)
+	}()
+
+	// Queued messages are still sent at the same pace once stopped, until
+	// the flush timeout expires.
+	assert.Equal(t, 10*time.Second, <-waits)
+	assert.Equal(t, interval, <-waits)
+	tick <- time.Now()
+	assert.Equal(t, interval, <-waits)
+	tick <- time.Now()
+	assert.Equal(t, interval, <-waits)
+	deadline <- time.Now()
+	<-stopped
+	assert.Equal(t, int32(3), atomic.LoadInt32(&received))
+	assert.Equal(t, 1, sink.queue.len())
+
+	for _, invalid := range []string{"flush_timeout=-1s", "flush_timeout=soon"} {
+		uri, _ := url.Parse("https://oapi.dingtalk.com/robot/send?access_token=token&" + invalid)
+		_, err := NewDingTalkSink(uri)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestQueueOptions(t *testing.T) {
+	uri, _ := url.Parse("https://oapi.dingtalk.com/robot/send?access_token=token&msg_per_minute=10&queue_size=5")
+	sink, err := NewDingTalkSink(uri)
+	assert.NoError(t, err)
+	defer sink.Stop()
+	assert.Equal(t, 10, sink.MsgPerMinute)
+	assert.Equal(t, 5, sink.QueueSize)
+
+	for _, invalid := range []string{"msg_per_minute=0", "msg_per_minute=fast", "queue_size=-1"} {
+		uri, _ := url.Parse("https://oapi.dingtalk.com/robot/send?access_token=token&" + invalid)
+		_, err := NewDingTalkSink(uri)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestTokenFailover(t *testing.T) {
+	var mu sync.Mutex
+	var used []string
+	limited := map[string]bool{}
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := r.URL.Query().Get("access_token")
+		mu.Lock()
+		defer mu.Unlock()
+		used = append(used, token)
+		switch {
+		case limited[token] && token == "b":
+			w.WriteHeader(http.StatusTooManyRequests)
+		case limited[token]:
+			fmt.Fprint(w, `{"errcode":130101,"errmsg":"send too fast"}`)
+		default:
+			fmt.Fprint(w, `{"errcode":0,"errmsg":"ok"}`)
+		}
+	}))
+	defer server.Close()
+	sent := func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		defer func() { used = nil }()
+		return used
+	}
+
+	uri, _ := url.Parse("https://oapi.dingtalk.com/robot/send?access_token=a&token=b,%20c&token_cooldown=30s")
+	sink, err := newDingTalkSink(uri)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a", "b", "c"}, sink.Tokens)
+	sink.Endpoint = strings.TrimPrefix(server.URL, "https://") + "/robot/send"
+	sink.client = server.Client()
+	now := time.Now()
+	sink.tokens.now = func() time.Time { return now }
+	msg := &DingTalkMsg{MsgType: DEFAULT_MSG_TYPE, Text: &DingTalkText{Content: "BackOff"}}
+
+	// Messages rotate across the robots.
+	for i := 0; i < 4; i++ {
+		assert.True(t, sink.send(msg))
+	}
+	assert.Equal(t, []string{"a", "b", "c", "a"}, sent())
+
+	// A 429 fails over to the next robot, which is retried once.
+	limited["b"] = true
+	assert.True(t, sink.send(msg))
+	assert.Equal(t, []string{"b", "c"}, sent())
+	// b is skipped while cooling down.
+	assert.True(t, sink.send(msg))
+	assert.True(t, sink.send(msg))
+	assert.Equal(t, []string{"a", "c"}, sent())
+
+	// So is a robot reporting an error in a 200 response. The retry fails
+	// too, so the message is lost.
+	limited["a"], limited["c"] = true, true
+	assert.False(t, sink.send(msg))
+	assert.Equal(t, []string{"a", "c"}, sent())
+
+	// Robots recover after the cooldown.
+	limited = map[string]bool{}
+	now = now.Add(30 * time.Second)
+	for i := 0; i < 3; i++ {
+		assert.True(t, sink.send(msg))
+	}
+	assert.Equal(t, []string{"a", "b", "c"}, sent())
+
+	uri, _ = url.Parse("https://oapi.dingtalk.com/robot/send?token=%20,")
+	_, err = NewDingTalkSink(uri)
+	assert.Error(t, err)
+}
+
+func TestEventFilter(t *testing.T) {
+	event := func(kind, namespace string) *v1.Event {
+		return &v1.Event{
+			Type:           v1.EventTypeWarning,
+			Reason:         "BackOff",
+			Message:        kind + " in " + namespace,
+			InvolvedObject: v1.ObjectReference{Kind: kind, Namespace: namespace, Name: "web"},
+		}
+	}
+	tests := []struct {
+		query    string
+		event    *v1.Event
+		expected bool
+	}{
+		{"", event("Pod", "default"), true},
+		{"", event("Node", ""), true},
+		{"namespaces=payment,dev-*", event("Pod", "payment"), true},
+		{"namespaces=payment,dev-*", event("Pod", "dev-alice"), true},
+		{"namespaces=payment,dev-*", event("Pod", "default"), false},
+		{"namespaces=*", event("Node", ""), false},
+		{"namespaces=payment,cluster", event("Node", ""), true},
+		{"kinds=Pod,%20node", event("Node", ""), true},
+		{"kinds=Pod,Node", event("Deployment", "default"), false},
+		{"namespaces=payment&kinds=Pod", event("Pod", "default"), false},
+		{"namespaces=payment&kinds=Pod", event("Service", "payment"), false},
+		{"namespaces=payment&namespaces=default&kinds=Pod", event("Pod", "default"), true},
+	}
+	for _, test := range tests {
+		uri, _ := url.Parse("https://oapi.dingtalk.com/robot/send?access_token=token&" + test.query)
+		sink, err := newDingTalkSink(uri)
+		assert.NoError(t, err, test.query)
+		sink.ExportEvents(&core.EventBatch{Events: []*v1.Event{test.event}})
+		assert.Equal(t, test.expected, sink.queue.len() == 1, "%s with %s", test.query, test.event.Message)
+	}
+
+	uri, _ := url.Parse("https://oapi.dingtalk.com/robot/send?access_token=token&namespaces=dev-[")
+	_, err := NewDingTalkSink(uri)
+	assert.Error(t, err)
+}
+
+func TestTemplateWithCluster(t *testing.T) {
+	tmpl := `{{if eq .Type "Warning"}}🔥{{else}}ℹ️{{end}} {{.Message}}
+https://grafana.example.com/d/events?var-cluster={{.Cluster}}&var-namespace={{.InvolvedObject.Namespace}}`
+	uri, _ := url.Parse("https://oapi.dingtalk.com/robot/send?access_token=token&cluster=prod&template=" + url.QueryEscape(tmpl))
+	sink, err := NewDingTalkSink(uri)
+	assert.NoError(t, err)
+	defer sink.Stop()
+
+	event := &v1.Event{
+		Type:           v1.EventTypeWarning,
+		Message:        "Back-off restarting failed container",
+		InvolvedObject: v1.ObjectReference{Kind: "Pod", Namespace: "payment", Name: "web-0"},
+	}
+	assert.Equal(t, "🔥 Back-off restarting failed container\nhttps://grafana.example.com/d/events?var-cluster=prod&var-namespace=payment",
+		sink.createMsg(event).Text.Content)
+	event.Type = v1.EventTypeNormal
+	assert.Equal(t, "ℹ️ Back-off restarting failed container\nhttps://grafana.example.com/d/events?var-cluster=prod&var-namespace=payment",
+		sink.createMsg(event).Text.Content)
+
+	// Markdown messages keep their title.
+	sink.MsgType = MSG_TYPE_MARKDOWN
+	msg := sink.createMsg(event)
+	assert.Equal(t, "Normal", msg.Markdown.Title)
+	assert.Contains(t, msg.Markdown.Text, "ℹ️ Back-off")
+}
+
+func TestClusterName(t *testing.T) {
+	defer os.Setenv(core.ClusterNameEnv, os.Getenv(core.ClusterNameEnv))
+	defer func(f core.NodeLabelFunc) { nodeLabel = f }(nodeLabel)
+	nodeLabel = func(label string) (string, error) {
+		if label != core.DefaultClusterNodeLabel {
+			return "", fmt.Errorf("no node label %s", label)
+		}
+		return "from-node", nil
+	}
+
+	tests := []struct {
+		query    string
+		env      string
+		expected string
+	}{
+		{"", "", ""},
+		{"", "from-env", "from-env"},
+		{"cluster=from-option", "from-env", "from-option"},
+		{"cluster_from_node=true", "", "from-node"},
+		{"cluster_from_node=false", "", ""},
+	}
+	for _, test := range tests {
+		os.Setenv(core.ClusterNameEnv, test.env)
+		uri, _ := url.Parse("https://oapi.dingtalk.com/robot/send?access_token=token&" + test.query)
+		sink, err := newDingTalkSink(uri)
+		assert.NoError(t, err, test.query)
+		assert.Equal(t, test.expected, sink.Cluster, test.query)
+	}
+
+	os.Setenv(core.ClusterNameEnv, "")
+	uri, _ := url.Parse("https://oapi.dingtalk.com/robot/send?access_token=token&cluster_from_node=true&cluster_node_label=missing")
+	_, err := newDingTalkSink(uri)
+	assert.Error(t, err)
+}
+
+func TestTemplateFallback(t *testing.T) {
+	uri, _ := url.Parse("https://oapi.dingtalk.com/robot/send?access_token=token&template=" + url.QueryEscape(`{{.Reason}} on {{.Node}}`))
+	sink, err := NewDingTalkSink(uri)
+	assert.NoError(t, err)
+	defer sink.Stop()
+
+	event := &v1.Event{Reason: "BackOff", Message: "some thing wrong"}
+	assert.Equal(t, createMsgFromEvent(nil, event), sink.createMsg(event))
+	sink.MsgType = MSG_TYPE_MARKDOWN
+	assert.Equal(t, sink.createMarkdownMsg(event), sink.createMsg(event))
+}
+
+func TestTemplateFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dingtalk")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "template")
+	assert.NoError(t, ioutil.WriteFile(file, []byte(`[{{.Cluster}}] {{.Reason}}`), 0644))
+
+	uri, _ := url.Parse("https://oapi.dingtalk.com/robot/send?access_token=token&cluster=prod&template_file=" + url.QueryEscape(file))
+	sink, err := NewDingTalkSink(uri)
+	assert.NoError(t, err)
+	defer sink.Stop()
+	assert.Equal(t, "[prod] BackOff", sink.createMsg(&v1.Event{Reason: "BackOff"}).Text.Content)
+
+	for _, invalid := range []string{
+		"template_file=" + url.QueryEscape(filepath.Join(dir, "missing")),
+		"template_file=" + url.QueryEscape(file) + "&template=" + url.QueryEscape(`{{.Reason}}`),
+	} {
+		uri, _ := url.Parse("https://oapi.dingtalk.com/robot/send?access_token=token&" + invalid)
+		_, err := NewDingTalkSink(uri)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestLevelAndIgnoreReasons(t *testing.T) {
+	event := func(level, reason string) *v1.Event {
+		return &v1.Event{Type: level, Reason: reason, Message: level + " " + reason}
+	}
+	batch := &core.EventBatch{Events: []*v1.Event{
+		event(v1.EventTypeNormal, "Pulled"),
+		event(v1.EventTypeNormal, "DNSConfigForming"),
+		event(v1.EventTypeWarning, "BackOff"),
+		event(v1.EventTypeWarning, "DNSConfigForming"),
+		event(v1.EventTypeWarning, "NodeSysctlChange"),
+		event("", "Unknown"),
+	}}
+	tests := []struct {
+		query    string
+		expected []string
+	}{
+		{"", []string{"BackOff", "DNSConfigForming", "NodeSysctlChange"}},
+		{"level=Normal", []string{"Pulled", "DNSConfigForming", "BackOff", "DNSConfigForming", "NodeSysctlChange"}},
+		{"level=Normal&ignore_reasons=DNSConfigForming,%20NodeSysctlChange", []string{"Pulled", "BackOff"}},
+		{"level=Warning&ignore_reasons=DNSConfigForming", []string{"BackOff", "NodeSysctlChange"}},
+	}
+	for _, test := range tests {
+		uri, _ := url.Parse("https://oapi.dingtalk.com/robot/send?access_token=token&template={{.Reason}}&" + test.query)
+		sink, err := newDingTalkSink(uri)
+		assert.NoError(t, err, test.query)
+		sink.ExportEvents(batch)
+		var reasons []string
+		for msg := sink.queue.pop(); msg != nil; msg = sink.queue.pop() {
+			reasons = append(reasons, msg.Text.Content)
+		}
+		assert.Equal(t, test.expected, reasons, test.query)
+	}
+
+	uri, _ := url.Parse("https://oapi.dingtalk.com/robot/send?access_token=token&level=Critical")
+	_, err := NewDingTalkSink(uri)
+	assert.Error(t, err)
+}
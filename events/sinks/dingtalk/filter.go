@@ -0,0 +1,120 @@
+// Copyright 2018 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dingtalk
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/golang/glog"
+	"k8s.io/api/core/v1"
+)
+
+// CLUSTER_NAMESPACE stands in namespaces for the empty namespace of
+// cluster-scoped objects like nodes.
+const CLUSTER_NAMESPACE = "cluster"
+
+// eventFilter selects the events sent by the namespace and kind of the
+// object they are about, and drops those of ignored reasons. An empty list
+// allows everything.
+type eventFilter struct {
+	// namespaces are exact names or globs like dev-*.
+	namespaces []string
+	// kinds are lower case.
+	kinds         map[string]bool
+	ignoreReasons map[string]bool
+}
+
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func newEventFilter(namespaces, kinds, ignoreReasons []string) (*eventFilter, error) {
+	f := &eventFilter{}
+	for _, value := range namespaces {
+		for _, pattern := range splitList(value) {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("namespaces has an invalid pattern %q: %v", pattern, err)
+			}
+			f.namespaces = append(f.namespaces, pattern)
+		}
+	}
+	for _, value := range kinds {
+		for _, kind := range splitList(value) {
+			if f.kinds == nil {
+				f.kinds = make(map[string]bool)
+			}
+			f.kinds[strings.ToLower(kind)] = true
+		}
+	}
+	for _, value := range ignoreReasons {
+		for _, reason := range splitList(value) {
+			if f.ignoreReasons == nil {
+				f.ignoreReasons = make(map[string]bool)
+			}
+			f.ignoreReasons[reason] = true
+		}
+	}
+	return f, nil
+}
+
+// ignoredReason tells whether the reason of the event is ignored.
+func (f *eventFilter) ignoredReason(event *v1.Event) bool {
+	if !f.ignoreReasons[event.Reason] {
+		return false
+	}
+	glog.V(4).Infof("dingtalk sink skipped event %s/%s: reason %s ignored", event.Namespace, event.Name, event.Reason)
+	return true
+}
+
+// allowedNamespace tells whether the namespace is in the list. Globs don't
+// match the empty namespace, only the cluster entry does.
+func (f *eventFilter) allowedNamespace(namespace string) bool {
+	if len(f.namespaces) == 0 {
+		return true
+	}
+	for _, pattern := range f.namespaces {
+		if namespace == "" {
+			if pattern == CLUSTER_NAMESPACE {
+				return true
+			}
+			continue
+		}
+		if ok, _ := path.Match(pattern, namespace); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *eventFilter) allowed(event *v1.Event) bool {
+	object := event.InvolvedObject
+	if !f.allowedNamespace(object.Namespace) {
+		glog.V(4).Infof("dingtalk sink skipped event %s/%s: namespace %q not allowed", event.Namespace, event.Name, object.Namespace)
+		return false
+	}
+	if f.kinds != nil && !f.kinds[strings.ToLower(object.Kind)] {
+		glog.V(4).Infof("dingtalk sink skipped event %s/%s: kind %q not allowed", event.Namespace, event.Name, object.Kind)
+		return false
+	}
+	return true
+}
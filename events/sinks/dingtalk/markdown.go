@@ -0,0 +1,115 @@
+// Copyright 2018 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dingtalk
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"k8s.io/api/core/v1"
+)
+
+const (
+	MSG_TYPE_MARKDOWN = "markdown"
+	// MAX_MSG_BYTES is the largest message text DingTalk accepts.
+	MAX_MSG_BYTES = 20000
+	// MARKDOWN_TIME_FORMAT renders event times in markdown messages.
+	MARKDOWN_TIME_FORMAT = "2006-01-02 15:04:05 MST"
+	ellipsis             = "..."
+)
+
+type DingTalkMarkdown struct {
+	Title string `json:"title"`
+	Text  string `json:"text"`
+}
+
+// markdownEscaper escapes the characters DingTalk markdown gives a meaning
+// to in field values.
+var markdownEscaper = strings.NewReplacer(
+	`\`, `\\`, "`", "\\`", "*", `\*`, "_", `\_`, "#", `\#`,
+	"[", `\[`, "]", `\]`, "<", "&lt;", ">", "&gt;",
+)
+
+// createMarkdownMsg renders the event as a markdown message: a title made of
+// the level and reason, the fields of the event as a list and the message in
+// a code block, truncated to fit DingTalk's size limit.
+func (d *DingTalkSink) createMarkdownMsg(event *v1.Event) *DingTalkMsg {
+	title := strings.TrimSpace(event.Type + " " + event.Reason)
+
+	var buf bytes.Buffer
+	for _, label := range d.Labels {
+		buf.WriteString(fmt.Sprintf(LABE_TEMPLATE, markdownEscaper.Replace(label)))
+		buf.WriteString("\n")
+	}
+	fmt.Fprintf(&buf, "### **%s**\n\n", markdownEscaper.Replace(title))
+	field := func(name, value string) {
+		if value != "" {
+			fmt.Fprintf(&buf, "- %s: %s\n", name, markdownEscaper.Replace(value))
+		}
+	}
+	field("Cluster", d.Cluster)
+	field("Namespace", event.InvolvedObject.Namespace)
+	field("Object", strings.TrimPrefix(event.InvolvedObject.Kind+"/"+event.InvolvedObject.Name, "/"))
+	if event.Count > 0 {
+		field("Count", fmt.Sprint(event.Count))
+	}
+	if seen := lastSeen(event); !seen.IsZero() {
+		field("Time", seen.In(d.Location).Format(MARKDOWN_TIME_FORMAT))
+	}
+
+	// Backticks would end the code block early.
+	message := strings.Replace(event.Message, "`", "'", -1)
+	const fence = "\n```\n"
+	if room := MAX_MSG_BYTES - buf.Len() - 2*len(fence); len(message) > room {
+		message = truncate(message, room-len(ellipsis)) + ellipsis
+	}
+	buf.WriteString(fence)
+	buf.WriteString(message)
+	buf.WriteString(fence)
+
+	return &DingTalkMsg{
+		MsgType:  MSG_TYPE_MARKDOWN,
+		Markdown: &DingTalkMarkdown{Title: title, Text: buf.String()},
+	}
+}
+
+// truncate cuts s to at most n bytes without splitting a character.
+func truncate(s string, n int) string {
+	if n <= 0 {
+		return ""
+	}
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+// lastSeen returns when the event was last seen, falling back to its event
+// time and then to when it was first seen.
+func lastSeen(event *v1.Event) time.Time {
+	if !event.LastTimestamp.IsZero() {
+		return event.LastTimestamp.Time
+	}
+	if !event.EventTime.IsZero() {
+		return event.EventTime.Time
+	}
+	return event.FirstTimestamp.Time
+}
@@ -0,0 +1,141 @@
+// Copyright 2018 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dingtalk
+
+import (
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+const (
+	// DEFAULT_MSG_PER_MINUTE stays below the 20 messages a robot accepts
+	// per minute.
+	DEFAULT_MSG_PER_MINUTE = 19
+	DEFAULT_QUEUE_SIZE     = 100
+	// DEFAULT_FLUSH_TIMEOUT leaves time for a message or two on stop, within
+	// the stop timeout of the sink manager.
+	DEFAULT_FLUSH_TIMEOUT = 5 * time.Second
+)
+
+// msgQueue is the bounded queue of messages waiting to be sent. Once full,
+// the oldest messages are dropped to make room for new ones.
+type msgQueue struct {
+	sync.Mutex
+	msgs []*DingTalkMsg
+	size int
+	// dropped is the number of messages dropped since the queue was created.
+	dropped int
+	// ready is signaled when messages are pushed.
+	ready chan struct{}
+}
+
+func newMsgQueue(size int) *msgQueue {
+	return &msgQueue{size: size, ready: make(chan struct{}, 1)}
+}
+
+// push appends the message to the queue and returns how many messages were
+// dropped to make room for it.
+func (q *msgQueue) push(msg *DingTalkMsg) int {
+	q.Lock()
+	defer q.Unlock()
+	dropped := 0
+	if len(q.msgs) >= q.size {
+		dropped = len(q.msgs) - q.size + 1
+		q.msgs = q.msgs[dropped:]
+		q.dropped += dropped
+	}
+	q.msgs = append(q.msgs, msg)
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+	return dropped
+}
+
+// pop removes and returns the oldest message, if any.
+func (q *msgQueue) pop() *DingTalkMsg {
+	q.Lock()
+	defer q.Unlock()
+	if len(q.msgs) == 0 {
+		return nil
+	}
+	msg := q.msgs[0]
+	q.msgs[0] = nil
+	q.msgs = q.msgs[1:]
+	return msg
+}
+
+func (q *msgQueue) len() int {
+	q.Lock()
+	defer q.Unlock()
+	return len(q.msgs)
+}
+
+func (q *msgQueue) droppedTotal() int {
+	q.Lock()
+	defer q.Unlock()
+	return q.dropped
+}
+
+// run sends the queued messages, waiting between two of them so that no more
+// than MsgPerMinute are sent per minute, until the sink is stopped. Messages
+// still queued then are flushed.
+func (d *DingTalkSink) run() {
+	defer close(d.done)
+	interval := time.Minute / time.Duration(d.MsgPerMinute)
+	for {
+		msg := d.queue.pop()
+		if msg == nil {
+			select {
+			case <-d.queue.ready:
+				continue
+			case <-d.stopCh:
+				return
+			}
+		}
+		d.send(msg)
+		select {
+		case <-d.after(interval):
+		case <-d.stopCh:
+			d.flush(interval)
+			return
+		}
+	}
+}
+
+// flush keeps sending the queued messages at the same pace for up to
+// FlushTimeout. Messages still queued after are abandoned.
+func (d *DingTalkSink) flush(interval time.Duration) {
+	if d.queue.len() == 0 {
+		return
+	}
+	if d.FlushTimeout > 0 {
+		deadline := d.after(d.FlushTimeout)
+	flushing:
+		for d.queue.len() > 0 {
+			select {
+			case <-d.after(interval):
+				d.send(d.queue.pop())
+			case <-deadline:
+				break flushing
+			}
+		}
+	}
+	if n := d.queue.len(); n > 0 {
+		glog.Warningf("dingtalk sink stopped with %d messages not sent", n)
+	}
+}
@@ -0,0 +1,72 @@
+// Copyright 2018 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dingtalk
+
+import (
+	"sync"
+	"time"
+)
+
+// DEFAULT_TOKEN_COOLDOWN is how long a token that failed is skipped, the
+// window of the robot rate limit.
+const DEFAULT_TOKEN_COOLDOWN = time.Minute
+
+// tokenPool hands out the tokens of the robots messages are spread across,
+// round-robin. Tokens that failed are skipped until their cooldown is over.
+type tokenPool struct {
+	sync.Mutex
+	tokens []string
+	// unhealthyUntil is when the tokens that failed become usable again.
+	unhealthyUntil map[string]time.Time
+	next           int
+	cooldown       time.Duration
+	now            func() time.Time
+}
+
+func newTokenPool(tokens []string, cooldown time.Duration) *tokenPool {
+	return &tokenPool{
+		tokens:         tokens,
+		unhealthyUntil: make(map[string]time.Time),
+		cooldown:       cooldown,
+		now:            time.Now,
+	}
+}
+
+// pick returns the next healthy token. If all of them failed recently, the
+// next one is returned anyway rather than dropping the message.
+func (p *tokenPool) pick() string {
+	p.Lock()
+	defer p.Unlock()
+	now := p.now()
+	for i := 0; i < len(p.tokens); i++ {
+		token := p.tokens[(p.next+i)%len(p.tokens)]
+		if now.Before(p.unhealthyUntil[token]) {
+			continue
+		}
+		delete(p.unhealthyUntil, token)
+		p.next = (p.next + i + 1) % len(p.tokens)
+		return token
+	}
+	token := p.tokens[p.next]
+	p.next = (p.next + 1) % len(p.tokens)
+	return token
+}
+
+// fail marks the token unhealthy for the cooldown.
+func (p *tokenPool) fail(token string) {
+	p.Lock()
+	defer p.Unlock()
+	p.unhealthyUntil[token] = p.now().Add(p.cooldown)
+}
@@ -0,0 +1,80 @@
+// Copyright 2018 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sinks
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+
+	"github.com/golang/glog"
+	"k8s.io/heapster/events/core"
+)
+
+// dryRunSink logs the events the wrapped sink would export instead of
+// exporting them. The wrapped sink is still built, so its configuration is
+// validated, but never receives events.
+//
+// Usage:
+// --sink=dryrun:elasticsearch:http://es:9200?minlevel=Warning
+type dryRunSink struct {
+	sink core.EventSink
+}
+
+func (this *SinkFactory) buildDryRunSink(val *url.URL) (core.EventSink, error) {
+	child, _, err := splitWrappedUri(val)
+	if err != nil {
+		return nil, err
+	}
+	sink, err := this.Build(child)
+	if err != nil {
+		return nil, err
+	}
+	return &dryRunSink{sink: sink}, nil
+}
+
+func (this *dryRunSink) Name() string {
+	return this.sink.Name()
+}
+
+func (this *dryRunSink) Stop() {
+	this.sink.Stop()
+}
+
+func (this *dryRunSink) ExportEvents(batch *core.EventBatch) {
+	this.ExportEventsContext(context.Background(), batch)
+}
+
+func (this *dryRunSink) ExportEventsWithError(batch *core.EventBatch) error {
+	return this.ExportEventsContext(context.Background(), batch)
+}
+
+// ExportEventsContext only logs, so it never fails, but doesn't start logging
+// a batch once ctx is done.
+func (this *dryRunSink) ExportEventsContext(ctx context.Context, batch *core.EventBatch) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	glog.Infof("[DRY RUN] %s would export %d events", this.sink.Name(), len(batch.Events))
+	for _, event := range batch.Events {
+		data, err := json.Marshal(event)
+		if err != nil {
+			glog.Warningf("[DRY RUN] failed to marshal event %s/%s: %v", event.Namespace, event.Name, err)
+			continue
+		}
+		glog.Infof("[DRY RUN] %s: %s", this.sink.Name(), data)
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+// Copyright 2018 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sinks
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	kube_api "k8s.io/api/core/v1"
+	"k8s.io/heapster/common/flags"
+	"k8s.io/heapster/events/core"
+)
+
+func TestDryRunDoesNotExport(t *testing.T) {
+	child := &fakeSink{name: "fake"}
+	sink := &dryRunSink{sink: child}
+
+	sink.ExportEvents(&core.EventBatch{Events: []*kube_api.Event{{Reason: "BackOff"}}})
+	sink.Stop()
+
+	assert.Len(t, child.exported(), 0)
+	assert.True(t, child.stopped)
+	assert.Equal(t, "fake", sink.Name())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.Equal(t, context.Canceled, sink.ExportEventsContext(ctx, &core.EventBatch{}))
+}
+
+func TestBuildDryRunSink(t *testing.T) {
+	factory := NewSinkFactory()
+	var uri flags.Uri
+
+	assert.NoError(t, uri.Set("dryrun:log"))
+	sink, err := factory.Build(uri)
+	assert.NoError(t, err)
+	assert.IsType(t, &dryRunSink{}, sink)
+
+	// The wrapped sink's configuration is still validated.
+	assert.NoError(t, uri.Set("dryrun:alertmanager:http://localhost:9093"))
+	_, err = factory.Build(uri)
+	assert.Error(t, err)
+}
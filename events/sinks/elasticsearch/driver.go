@@ -15,6 +15,8 @@
 package elasticsearch
 
 import (
+	"context"
+	"fmt"
 	"net/url"
 	"sync"
 	"time"
@@ -31,7 +33,7 @@ const (
 )
 
 // SaveDataFunc is a pluggable function to enforce limits on the object
-type SaveDataFunc func(date time.Time, sinkData []interface{}) error
+type SaveDataFunc func(ctx context.Context, date time.Time, sinkData []interface{}) error
 
 type elasticSearchSink struct {
 	esSvc     esCommon.ElasticSearchService
@@ -78,30 +80,62 @@ func eventToPoint(event *kube_api.Event, clusterName string) (*EsSinkPoint, erro
 }
 
 func (sink *elasticSearchSink) ExportEvents(eventBatch *event_core.EventBatch) {
+	if err := sink.ExportEventsWithError(eventBatch); err != nil {
+		glog.Warningf("Failed to export data to ElasticSearch sink: %v", err)
+	}
+}
+
+func (sink *elasticSearchSink) ExportEventsWithError(eventBatch *event_core.EventBatch) error {
+	return sink.ExportEventsContext(context.Background(), eventBatch)
+}
+
+// ExportEventsContext saves every event of the batch and flushes them,
+// returning the first error along with the number of events that failed.
+// The requests made to save an event are bound to ctx, and once it is done
+// the remaining events are given up.
+func (sink *elasticSearchSink) ExportEventsContext(ctx context.Context, eventBatch *event_core.EventBatch) error {
 	sink.Lock()
 	defer sink.Unlock()
+	var (
+		firstErr error
+		failed   int
+	)
 	for _, event := range eventBatch.Events {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 		point, err := eventToPoint(event, sink.esSvc.ClusterName)
-		if err != nil {
-			glog.Warningf("Failed to convert event to point: %v", err)
+		if err == nil {
+			err = sink.saveData(ctx, point.LastOccurrenceTimestamp, []interface{}{*point})
 		}
-		err = sink.saveData(point.LastOccurrenceTimestamp, []interface{}{*point})
 		if err != nil {
-			glog.Warningf("Failed to export data to ElasticSearch sink: %v", err)
+			failed++
+			if firstErr == nil {
+				firstErr = err
+			}
 		}
 	}
-	err := sink.flushData()
-	if err != nil {
-		glog.Warningf("Failed to flushing data to ElasticSearch sink: %v", err)
+	if err := sink.flushData(); err != nil {
+		return fmt.Errorf("failed to flush data: %v", err)
+	}
+	if firstErr != nil {
+		return fmt.Errorf("failed to save %d of %d events: %v", failed, len(eventBatch.Events), firstErr)
 	}
+	return nil
 }
 
 func (sink *elasticSearchSink) Name() string {
 	return "ElasticSearch Sink"
 }
 
+// Stop flushes what the bulk processor still holds, such as requests of an
+// export that failed to flush.
 func (sink *elasticSearchSink) Stop() {
-	// nothing needs to be done.
+	sink.Lock()
+	defer sink.Unlock()
+	if err := sink.flushData(); err != nil {
+		glog.Warningf("Failed to flush data to ElasticSearch sink on stop: %v", err)
+	}
 }
 
 func NewElasticSearchSink(uri *url.URL) (event_core.EventSink, error) {
@@ -113,8 +147,8 @@ func NewElasticSearchSink(uri *url.URL) (event_core.EventSink, error) {
 	}
 
 	esSink.esSvc = *esSvc
-	esSink.saveData = func(date time.Time, sinkData []interface{}) error {
-		return esSvc.SaveData(date, typeName, sinkData)
+	esSink.saveData = func(ctx context.Context, date time.Time, sinkData []interface{}) error {
+		return esSvc.SaveDataContext(ctx, date, typeName, sinkData)
 	}
 	esSink.flushData = func() error {
 		return esSvc.FlushData()
@@ -15,6 +15,7 @@
 package elasticsearch
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"testing"
@@ -38,7 +39,7 @@ type fakeESSink struct {
 
 var FakeESSink fakeESSink
 
-func SaveDataIntoES_Stub(date time.Time, sinkData []interface{}) error {
+func SaveDataIntoES_Stub(_ context.Context, date time.Time, sinkData []interface{}) error {
 	for _, data := range sinkData {
 		jsonItems, err := json.Marshal(data)
 		if err != nil {
@@ -114,3 +115,51 @@ func TestStoreMultipleDataInput(t *testing.T) {
 
 	FakeESSink = fakeESSink{}
 }
+
+func TestExportEventsWithError(t *testing.T) {
+	saved := 0
+	sink := &elasticSearchSink{
+		saveData: func(_ context.Context, date time.Time, sinkData []interface{}) error {
+			saved++
+			if saved == 2 {
+				return fmt.Errorf("index_not_found_exception")
+			}
+			return nil
+		},
+		flushData: func() error { return nil },
+	}
+	now := metav1.NewTime(time.Now())
+	batch := &core.EventBatch{Events: []*kube_api.Event{
+		{Message: "event1", LastTimestamp: now},
+		{Message: "event2", LastTimestamp: now},
+		{Message: "event3", LastTimestamp: now},
+	}}
+
+	err := sink.ExportEventsWithError(batch)
+	assert.EqualError(t, err, "failed to save 1 of 3 events: index_not_found_exception")
+	// The events after the failed one are still saved.
+	assert.Equal(t, 3, saved)
+	assert.True(t, core.ReportsErrors(sink))
+
+	sink.flushData = func() error { return fmt.Errorf("connection refused") }
+	assert.EqualError(t, sink.ExportEventsWithError(batch), "failed to flush data: connection refused")
+}
+
+func TestExportEventsContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	saved := 0
+	sink := &elasticSearchSink{
+		saveData: func(saveCtx context.Context, date time.Time, sinkData []interface{}) error {
+			assert.True(t, ctx == saveCtx)
+			saved++
+			// The export times out while saving the first event.
+			cancel()
+			return saveCtx.Err()
+		},
+		flushData: func() error { return nil },
+	}
+	batch := &core.EventBatch{Events: []*kube_api.Event{{Message: "event1"}, {Message: "event2"}}}
+
+	assert.Equal(t, context.Canceled, sink.ExportEventsContext(ctx, batch))
+	assert.Equal(t, 1, saved)
+}
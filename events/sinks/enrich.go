@@ -0,0 +1,246 @@
+// Copyright 2018 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sinks
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+	kube_api "k8s.io/api/core/v1"
+	"k8s.io/client-go/informers"
+	kubeclient "k8s.io/client-go/kubernetes"
+	kubeconfig "k8s.io/heapster/common/kubernetes"
+	"k8s.io/heapster/events/core"
+	"k8s.io/heapster/events/enrich"
+)
+
+// enrichKinds maps the kinds accepted in the enrich option to the kinds the
+// fetcher looks up.
+var enrichKinds = map[string]string{
+	"pod":  enrich.KindPod,
+	"node": enrich.KindNode,
+}
+
+// Options configuring the API server connection, as for the kubernetes
+// source. kube_master and kube_insecure are renamed to avoid clashing with
+// the wrapped sink's options.
+var enrichKubeOptions = []string{"kube_master", "kube_insecure", "inClusterConfig", "auth", "useServiceAccount"}
+
+type enrichRule struct {
+	kind  string
+	label string
+}
+
+// enrichSink copies labels of the pod or node an event is about into the
+// event's annotations before passing it to the wrapped sink. Node labels are
+// also added to events about pods scheduled on that node. Pods and nodes are
+// read from informer caches; the objects of a batch are resolved once per
+// batch and cached for enrich_ttl. Events are exported unchanged until the
+// informers have synced.
+//
+// Usage:
+// --sink=enrich:log:?enrich=node:topology.kubernetes.io/zone&enrich=pod:app
+// --sink=enrich:slack:?webhook_url=...&enrich=pod:app&enrich_ttl=10m&kube_master=https://kubernetes.default
+type enrichSink struct {
+	sink    core.EventSink
+	fetcher *enrich.Fetcher
+	rules   []enrichRule
+	synced  func() bool
+	stopCh  chan struct{}
+}
+
+func parseEnrichRules(values []string) ([]enrichRule, error) {
+	rules := make([]enrichRule, 0, len(values))
+	for _, value := range values {
+		parts := strings.SplitN(value, ":", 2)
+		if len(parts) != 2 || parts[1] == "" {
+			return nil, fmt.Errorf("enrich must be kind:label, got %q", value)
+		}
+		kind, found := enrichKinds[strings.ToLower(parts[0])]
+		if !found {
+			return nil, fmt.Errorf("enrich kind must be pod or node, got %q", parts[0])
+		}
+		rules = append(rules, enrichRule{kind: kind, label: parts[1]})
+	}
+	return rules, nil
+}
+
+// enrichKubeUri converts the kube options to the uri format of the
+// kubernetes source.
+func enrichKubeUri(opts url.Values) (*url.URL, error) {
+	uri := &url.URL{}
+	if len(opts["kube_master"]) >= 1 {
+		var err error
+		if uri, err = url.Parse(opts["kube_master"][0]); err != nil {
+			return nil, fmt.Errorf("invalid kube_master %q: %v", opts["kube_master"][0], err)
+		}
+	}
+	query := uri.Query()
+	// Everything but kube_master is passed on as a query option.
+	for _, name := range enrichKubeOptions[1:] {
+		if len(opts[name]) >= 1 {
+			query.Set(strings.TrimPrefix(name, "kube_"), opts[name][0])
+		}
+	}
+	uri.RawQuery = query.Encode()
+	return uri, nil
+}
+
+func (this *SinkFactory) buildEnrichSink(val *url.URL) (core.EventSink, error) {
+	child, opts, err := splitWrappedUri(val, append([]string{"enrich", "enrich_ttl"}, enrichKubeOptions...)...)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(opts["enrich"]) == 0 {
+		return nil, fmt.Errorf("enrich sink needs at least one enrich=kind:label")
+	}
+	rules, err := parseEnrichRules(opts["enrich"])
+	if err != nil {
+		return nil, err
+	}
+	ttl := enrich.DefaultMetadataCacheTTL
+	if len(opts["enrich_ttl"]) >= 1 {
+		if ttl, err = time.ParseDuration(opts["enrich_ttl"][0]); err != nil || ttl <= 0 {
+			return nil, fmt.Errorf("enrich_ttl must be a positive duration, got %q", opts["enrich_ttl"][0])
+		}
+	}
+	kubeUri, err := enrichKubeUri(opts)
+	if err != nil {
+		return nil, err
+	}
+	kubeConfig, err := kubeconfig.GetKubeClientConfig(kubeUri)
+	if err != nil {
+		return nil, err
+	}
+	kubeClient, err := kubeclient.NewForConfig(kubeConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	sink, err := this.Build(child)
+	if err != nil {
+		return nil, err
+	}
+
+	factory := informers.NewSharedInformerFactory(kubeClient, 0)
+	getters := enrich.NewListerGetters(factory)
+	pods := factory.Core().V1().Pods().Informer()
+	nodes := factory.Core().V1().Nodes().Informer()
+	stopCh := make(chan struct{})
+	factory.Start(stopCh)
+	return &enrichSink{
+		sink:    sink,
+		fetcher: enrich.NewFetcher(getters, ttl),
+		rules:   rules,
+		synced: func() bool {
+			return pods.HasSynced() && nodes.HasSynced()
+		},
+		stopCh: stopCh,
+	}, nil
+}
+
+func (this *enrichSink) Name() string {
+	return this.sink.Name()
+}
+
+func (this *enrichSink) Stop() {
+	close(this.stopCh)
+	this.sink.Stop()
+}
+
+func (this *enrichSink) WrappedSinks() []core.EventSink {
+	return []core.EventSink{this.sink}
+}
+
+func (this *enrichSink) ExportEvents(batch *core.EventBatch) {
+	if err := this.ExportEventsWithError(batch); err != nil {
+		glog.Warningf("Failed to export enriched events to %s: %v", this.sink.Name(), err)
+	}
+}
+
+func (this *enrichSink) ExportEventsWithError(batch *core.EventBatch) error {
+	return this.ExportEventsContext(context.Background(), batch)
+}
+
+func (this *enrichSink) ExportEventsContext(ctx context.Context, batch *core.EventBatch) error {
+	if !this.synced() {
+		// Misses would be cached for enrich_ttl, so don't look anything up
+		// before the informers have listed the pods and nodes.
+		glog.V(2).Infof("Exporting events to %s without enrichment, pods and nodes are still being listed", this.sink.Name())
+		return core.ExportEventsContext(ctx, this.sink, batch)
+	}
+	objects := this.fetcher.Prefetch(batch)
+	enriched := &core.EventBatch{
+		Timestamp: batch.Timestamp,
+		Events:    make([]*kube_api.Event, 0, len(batch.Events)),
+	}
+	for _, event := range batch.Events {
+		enriched.Events = append(enriched.Events, this.enrich(event, objects))
+	}
+	return core.ExportEventsContext(ctx, this.sink, enriched)
+}
+
+// enrich returns the event with the configured labels added to its
+// annotations. The batch is shared with other sinks, so a modified copy is
+// returned rather than changing the event.
+func (this *enrichSink) enrich(event *kube_api.Event, objects map[enrich.ObjectKey]*enrich.Object) *kube_api.Event {
+	labels := this.lookup(enrich.InvolvedObjectKey(event), objects)
+	if len(labels) == 0 {
+		return event
+	}
+	event = event.DeepCopy()
+	if event.Annotations == nil {
+		event.Annotations = make(map[string]string, len(labels))
+	}
+	for key, value := range labels {
+		event.Annotations[key] = value
+	}
+	return event
+}
+
+func (this *enrichSink) lookup(key enrich.ObjectKey, objects map[enrich.ObjectKey]*enrich.Object) map[string]string {
+	var pod, node *enrich.Object
+	switch key.Kind {
+	case enrich.KindPod:
+		pod = objects[key]
+		if pod != nil && pod.NodeName != "" {
+			node = objects[enrich.ObjectKey{Kind: enrich.KindNode, Name: pod.NodeName}]
+		}
+	case enrich.KindNode:
+		node = objects[enrich.ObjectKey{Kind: enrich.KindNode, Name: key.Name}]
+	default:
+		return nil
+	}
+
+	labels := map[string]string{}
+	for _, rule := range this.rules {
+		object := pod
+		if rule.kind == enrich.KindNode {
+			object = node
+		}
+		if object == nil {
+			continue
+		}
+		if value, found := object.Labels[rule.label]; found {
+			labels[rule.label] = value
+		}
+	}
+	return labels
+}
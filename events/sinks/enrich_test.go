@@ -0,0 +1,132 @@
+// Copyright 2018 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sinks
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	kube_api "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/heapster/events/core"
+	"k8s.io/heapster/events/enrich"
+)
+
+// fakeGetter serves objects from a map, failing for objects named broken.
+type fakeGetter map[string]*enrich.Object
+
+func (f fakeGetter) Get(namespace, name string) (*enrich.Object, error) {
+	if name == "broken" {
+		return nil, fmt.Errorf("connection refused")
+	}
+	if object, found := f[namespace+"/"+name]; found {
+		return object, nil
+	}
+	return nil, fmt.Errorf("%s/%s not found", namespace, name)
+}
+
+func newTestEnrichSink(t *testing.T, child core.EventSink, synced bool) *enrichSink {
+	getters := map[string]enrich.MetadataGetter{
+		enrich.KindPod: fakeGetter{"default/web-0": {
+			ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"app": "web", "pod-template-hash": "1234"}},
+			NodeName:   "node-1",
+		}},
+		enrich.KindNode: fakeGetter{"/node-1": {
+			ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"topology.kubernetes.io/zone": "eu-west-1a"}},
+		}},
+	}
+	rules, err := parseEnrichRules([]string{"node:topology.kubernetes.io/zone", "pod:app"})
+	assert.NoError(t, err)
+	return &enrichSink{
+		sink:    child,
+		fetcher: enrich.NewFetcher(getters, time.Minute),
+		rules:   rules,
+		synced:  func() bool { return synced },
+		stopCh:  make(chan struct{}),
+	}
+}
+
+func TestEnrichSink(t *testing.T) {
+	child := &fakeSink{name: "fake"}
+	sink := newTestEnrichSink(t, child, true)
+
+	podEvent := &kube_api.Event{InvolvedObject: kube_api.ObjectReference{Kind: "Pod", Namespace: "default", Name: "web-0"}}
+	nodeEvent := &kube_api.Event{InvolvedObject: kube_api.ObjectReference{Kind: "Node", Name: "node-1"}}
+	otherEvent := &kube_api.Event{InvolvedObject: kube_api.ObjectReference{Kind: "Service", Namespace: "default", Name: "web"}}
+	brokenEvent := &kube_api.Event{InvolvedObject: kube_api.ObjectReference{Kind: "Pod", Namespace: "default", Name: "broken"}}
+
+	assert.NoError(t, sink.ExportEventsWithError(&core.EventBatch{
+		Events: []*kube_api.Event{podEvent, nodeEvent, otherEvent, brokenEvent},
+	}))
+
+	assert.Len(t, child.exported(), 1)
+	exported := child.exported()[0].Events
+	assert.Len(t, exported, 4)
+	assert.Equal(t, map[string]string{"app": "web", "topology.kubernetes.io/zone": "eu-west-1a"}, exported[0].Annotations)
+	assert.Equal(t, map[string]string{"topology.kubernetes.io/zone": "eu-west-1a"}, exported[1].Annotations)
+	assert.True(t, otherEvent == exported[2])
+	assert.True(t, brokenEvent == exported[3])
+	// The events shared with other sinks are left alone.
+	assert.Nil(t, podEvent.Annotations)
+}
+
+func TestEnrichSinkWaitsForSync(t *testing.T) {
+	child := &fakeSink{name: "fake"}
+	sink := newTestEnrichSink(t, child, false)
+
+	batch := &core.EventBatch{Events: []*kube_api.Event{
+		{InvolvedObject: kube_api.ObjectReference{Kind: "Pod", Namespace: "default", Name: "web-0"}},
+	}}
+	assert.NoError(t, sink.ExportEventsWithError(batch))
+	assert.Len(t, child.exported(), 1)
+	assert.True(t, batch == child.exported()[0])
+
+	sink.Stop()
+	assert.True(t, child.isStopped())
+	_, open := <-sink.stopCh
+	assert.False(t, open)
+}
+
+func TestEnrichSinkPassesContext(t *testing.T) {
+	sink := newTestEnrichSink(t, &blockingSink{fakeSink{name: "blocking"}}, true)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, sink.ExportEventsContext(ctx, &core.EventBatch{}))
+}
+
+func TestParseEnrichRules(t *testing.T) {
+	rules, err := parseEnrichRules([]string{"Node:topology.kubernetes.io/zone", "pod:app"})
+	assert.NoError(t, err)
+	assert.Equal(t, []enrichRule{{kind: enrich.KindNode, label: "topology.kubernetes.io/zone"}, {kind: enrich.KindPod, label: "app"}}, rules)
+
+	for _, value := range []string{"app", "pod:", "service:app"} {
+		_, err := parseEnrichRules([]string{value})
+		assert.Error(t, err, value)
+	}
+}
+
+func TestEnrichKubeUri(t *testing.T) {
+	uri, err := enrichKubeUri(url.Values{
+		"kube_master":     {"https://kubernetes.default"},
+		"kube_insecure":   {"true"},
+		"inClusterConfig": {"false"},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "https://kubernetes.default?inClusterConfig=false&insecure=true", uri.String())
+}
@@ -16,6 +16,7 @@ package sinks
 
 import (
 	"fmt"
+	"net/url"
 
 	"k8s.io/heapster/common/flags"
 	"k8s.io/heapster/events/core"
@@ -27,55 +28,155 @@ import (
 	"k8s.io/heapster/events/sinks/influxdb"
 	"k8s.io/heapster/events/sinks/kafka"
 	logsink "k8s.io/heapster/events/sinks/log"
+	"k8s.io/heapster/events/sinks/memory"
+	"k8s.io/heapster/events/sinks/nsq"
+	"k8s.io/heapster/events/sinks/pagerduty"
 	"k8s.io/heapster/events/sinks/riemann"
+	"k8s.io/heapster/events/sinks/slack"
 	"k8s.io/heapster/events/sinks/sls"
+	"k8s.io/heapster/events/sinks/sns"
+	"k8s.io/heapster/events/sinks/teams"
 
 	"github.com/golang/glog"
+	"github.com/prometheus/client_golang/prometheus"
 )
 
+var (
+	// Number of sinks built by the last BuildAll call.
+	sinksConfigured = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: "heapster",
+			Subsystem: "event_sinks",
+			Name:      "configured_total",
+			Help:      "Number of event sinks successfully built from the configuration.",
+		},
+	)
+
+	// Number of sinks that failed to build.
+	sinkBuildFailures = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "heapster",
+			Subsystem: "event_sinks",
+			Name:      "build_failures_total",
+			Help:      "Number of event sinks that failed to build, by sink key.",
+		},
+		[]string{"sink"},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(sinksConfigured)
+	prometheus.MustRegister(sinkBuildFailures)
+
+	// The sinks maintained in tree.
+	Register("gcl", func(uri *url.URL) (core.EventSink, error) { return gcl.CreateGCLSink(uri) })
+	Register("log", func(uri *url.URL) (core.EventSink, error) { return logsink.CreateLogSink(uri) })
+	Register("influxdb", func(uri *url.URL) (core.EventSink, error) { return influxdb.CreateInfluxdbSink(uri) })
+	Register("elasticsearch", func(uri *url.URL) (core.EventSink, error) { return elasticsearch.NewElasticSearchSink(uri) })
+	Register("kafka", func(uri *url.URL) (core.EventSink, error) { return kafka.NewKafkaSink(uri) })
+	Register("nsq", func(uri *url.URL) (core.EventSink, error) { return nsq.NewNsqSink(uri) })
+	Register("riemann", func(uri *url.URL) (core.EventSink, error) { return riemann.CreateRiemannSink(uri) })
+	Register("honeycomb", func(uri *url.URL) (core.EventSink, error) { return honeycomb.NewHoneycombSink(uri) })
+	Register("dingtalk", func(uri *url.URL) (core.EventSink, error) { return dingtalk.NewDingTalkSink(uri) })
+	Register("sls", func(uri *url.URL) (core.EventSink, error) { return sls.NewSLSSink(uri) })
+	Register("alertmanager", func(uri *url.URL) (core.EventSink, error) { return alertmanager.NewAlertmanagerSink(uri) })
+	Register("slack", func(uri *url.URL) (core.EventSink, error) { return slack.NewSlackSink(uri) })
+	Register("teams", func(uri *url.URL) (core.EventSink, error) { return teams.NewTeamsSink(uri) })
+	Register("pagerduty", func(uri *url.URL) (core.EventSink, error) { return pagerduty.NewPagerDutySink(uri) })
+	Register("memory", func(uri *url.URL) (core.EventSink, error) { return memory.NewMemorySink(uri) })
+	Register("sns", func(uri *url.URL) (core.EventSink, error) { return sns.NewSNSSink(uri) })
+	RegisterPathOptions("alertmanager", alertmanager.PathOptions...)
+	RegisterPathOptions("dingtalk", dingtalk.PathOptions...)
+
+	// Sinks wrapping other sinks build them with a factory.
+	registerWrapper("circuitbreaker", NewSinkFactory().buildCircuitBreakerSink)
+	registerWrapper("route", NewSinkFactory().buildRouteSink)
+	registerWrapper("sample", NewSinkFactory().buildSampleSink)
+	registerWrapper("dryrun", NewSinkFactory().buildDryRunSink)
+	registerWrapper("enrich", NewSinkFactory().buildEnrichSink)
+	registerWrapper("maxbatch", NewSinkFactory().buildMaxBatchSink)
+}
+
 type SinkFactory struct {
 }
 
 func (this *SinkFactory) Build(uri flags.Uri) (core.EventSink, error) {
-	switch uri.Key {
-	case "gcl":
-		return gcl.CreateGCLSink(&uri.Val)
-	case "log":
-		return logsink.CreateLogSink()
-	case "influxdb":
-		return influxdb.CreateInfluxdbSink(&uri.Val)
-	case "elasticsearch":
-		return elasticsearch.NewElasticSearchSink(&uri.Val)
-	case "kafka":
-		return kafka.NewKafkaSink(&uri.Val)
-	case "riemann":
-		return riemann.CreateRiemannSink(&uri.Val)
-	case "honeycomb":
-		return honeycomb.NewHoneycombSink(&uri.Val)
-	case "dingtalk":
-		return dingtalk.NewDingTalkSink(&uri.Val)
-	case "sls":
-		return sls.NewSLSSink(&uri.Val)
-	case "alertmanager":
-		return alertmanager.NewAlertmanagerSink(&uri.Val)
-	default:
+	uri, err := resolveUri(uri)
+	if err != nil {
+		return nil, err
+	}
+	if err := flags.ResolveOptions(&uri.Val, keptPathOptions(uri.Key)...); err != nil {
+		return nil, err
+	}
+	filter, err := parseFilterOptions(&uri.Val)
+	if err != nil {
+		return nil, err
+	}
+
+	sink, err := this.build(uri)
+	if err != nil {
+		return nil, err
+	}
+	if !filter.isEmpty() {
+		sink = NewFilteredSink(sink, filter)
+	}
+	if sink, err = withMinLevel(sink, &uri.Val); err != nil {
+		return nil, err
+	}
+	return withExportTimeout(sink, &uri.Val)
+}
+
+// resolveUri returns the uri with the configuration file it refers to, if
+// any, loaded.
+func resolveUri(uri flags.Uri) (flags.Uri, error) {
+	if isSinkConfigFile(&uri.Val) {
+		val, err := loadSinkConfigFile(&uri.Val)
+		if err != nil {
+			return flags.Uri{}, err
+		}
+		uri.Val = *val
+	}
+	return uri, nil
+}
+
+func (this *SinkFactory) build(uri flags.Uri) (core.EventSink, error) {
+	builder, ok := lookupBuilder(uri.Key)
+	if !ok {
 		return nil, fmt.Errorf("Sink not recognized: %s", uri.Key)
 	}
+	return builder(&uri.Val)
 }
 
 func (this *SinkFactory) BuildAll(uris flags.Uris) []core.EventSink {
 	result := make([]core.EventSink, 0, len(uris))
 	for _, uri := range uris {
-		sink, err := this.Build(uri)
-		if err != nil {
-			glog.Errorf("Failed to create %v sink: %v", uri, err)
-			continue
+		if sink, ok := this.buildChecked(uri); ok {
+			result = append(result, sink)
 		}
-		result = append(result, sink)
 	}
+	sinksConfigured.Set(float64(len(result)))
 	return result
 }
 
+// buildChecked builds the sink and checks its health, logging and counting
+// build failures. Sinks failing their health check are returned anyway.
+func (this *SinkFactory) buildChecked(uri flags.Uri) (core.EventSink, bool) {
+	sink, err := this.Build(uri)
+	if err != nil {
+		glog.Errorf("Failed to create %s sink: %v", uri.Redacted(), err)
+		sinkBuildFailures.WithLabelValues(uri.Key).Inc()
+		return nil, false
+	}
+	if checker, ok := sink.(core.EventSinkHealthChecker); ok {
+		if err := checker.HealthCheck(); err != nil {
+			glog.Warningf("Health check of %s sink failed: %v", sink.Name(), err)
+		} else {
+			glog.Infof("Health check of %s sink passed", sink.Name())
+		}
+	}
+	return sink, true
+}
+
 func NewSinkFactory() *SinkFactory {
 	return &SinkFactory{}
 }
@@ -0,0 +1,147 @@
+// Copyright 2018 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sinks
+
+import (
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	kube_api "k8s.io/api/core/v1"
+	"k8s.io/heapster/common/flags"
+	"k8s.io/heapster/events/core"
+	"k8s.io/heapster/events/sinks/memory"
+)
+
+func metricValue(t *testing.T, metric prometheus.Metric) float64 {
+	var m dto.Metric
+	assert.NoError(t, metric.Write(&m))
+	if m.Gauge != nil {
+		return m.Gauge.GetValue()
+	}
+	return m.Counter.GetValue()
+}
+
+func TestBuildAllMetrics(t *testing.T) {
+	var uris flags.Uris
+	assert.NoError(t, uris.Set("log"))
+	assert.NoError(t, uris.Set("unknown:foo"))
+	assert.NoError(t, uris.Set("sample:log:?rate=2"))
+
+	failures := metricValue(t, sinkBuildFailures.WithLabelValues("sample"))
+	factory := NewSinkFactory()
+	// Building twice must not count the configured sinks twice.
+	factory.BuildAll(uris)
+	sinks := factory.BuildAll(uris)
+
+	assert.Len(t, sinks, 1)
+	assert.Equal(t, float64(1), metricValue(t, sinksConfigured))
+	assert.Equal(t, failures+2, metricValue(t, sinkBuildFailures.WithLabelValues("sample")))
+}
+
+func TestPipelineIntoMemorySink(t *testing.T) {
+	var uri flags.Uri
+	assert.NoError(t, uri.Set("maxbatch:memory:?name=factory-test&maxbatch=1&minlevel=Warning"))
+	sink, err := NewSinkFactory().Build(uri)
+	assert.NoError(t, err)
+
+	warning := &kube_api.Event{Type: kube_api.EventTypeWarning, Reason: "BackOff"}
+	normal := &kube_api.Event{Type: kube_api.EventTypeNormal, Reason: "Pulled"}
+	sink.ExportEvents(&core.EventBatch{Events: []*kube_api.Event{warning, normal, warning}})
+
+	assert.Equal(t, []*kube_api.Event{warning, warning}, memory.Lookup("factory-test").Events())
+}
+
+func TestBuildAlertmanagerInvalidRegexp(t *testing.T) {
+	var uri flags.Uri
+	assert.NoError(t, uri.Set("alertmanager:http://localhost:9093?cluster=test&ignore_message_regex=("))
+	_, err := NewSinkFactory().Build(uri)
+	assert.Error(t, err)
+}
+
+func TestRegisterSink(t *testing.T) {
+	Register("fake", func(uri *url.URL) (core.EventSink, error) {
+		return &fakeSink{name: uri.Host}, nil
+	})
+	assert.Contains(t, RegisteredSinks(), "fake")
+
+	var uri flags.Uri
+	assert.NoError(t, uri.Set("fake:https://example.com"))
+	sink, err := NewSinkFactory().Build(uri)
+	assert.NoError(t, err)
+	assert.Equal(t, "example.com", sink.Name())
+
+	// Registered sinks can be wrapped like the in-tree ones.
+	assert.NoError(t, uri.Set("maxbatch:fake:https://example.com?maxbatch=10"))
+	_, err = NewSinkFactory().Build(uri)
+	assert.NoError(t, err)
+
+	assert.NoError(t, uri.Set("unknown:https://example.com"))
+	_, err = NewSinkFactory().Build(uri)
+	assert.EqualError(t, err, "Sink not recognized: unknown")
+
+	builder := func(*url.URL) (core.EventSink, error) { return nil, nil }
+	assert.Panics(t, func() { Register("fake", builder) })
+	assert.Panics(t, func() { Register("log", builder) })
+	assert.Panics(t, func() { Register("other", nil) })
+}
+
+func TestBuildResolvesSecretOptions(t *testing.T) {
+	var built url.Values
+	Register("secret-fake", func(uri *url.URL) (core.EventSink, error) {
+		built = uri.Query()
+		return &fakeSink{name: "secret-fake"}, nil
+	})
+	RegisterPathOptions("secret-fake", "ca_file")
+	os.Setenv("HEAPSTER_TEST_TOKEN", "from-env")
+	defer os.Unsetenv("HEAPSTER_TEST_TOKEN")
+
+	var uri flags.Uri
+	assert.NoError(t, uri.Set("secret-fake:https://example.com?token_env=HEAPSTER_TEST_TOKEN&ca_file=/etc/ssl/ca.pem"))
+	_, err := NewSinkFactory().Build(uri)
+	assert.NoError(t, err)
+	assert.Equal(t, url.Values{"token": {"from-env"}, "ca_file": {"/etc/ssl/ca.pem"}}, built)
+
+	assert.NoError(t, uri.Set("secret-fake:https://example.com?token_env=HEAPSTER_TEST_UNSET"))
+	_, err = NewSinkFactory().Build(uri)
+	assert.Error(t, err)
+}
+
+func TestBuildKeepsPathOptions(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sinks")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	badCA := filepath.Join(dir, "ca.crt")
+	assert.NoError(t, ioutil.WriteFile(badCA, []byte("not a certificate"), 0644))
+
+	// The alertmanager sink reads the CA itself, directly or wrapped.
+	for _, value := range []string{
+		"alertmanager:https://am:9093?cluster=test&tls_ca_file=",
+		"alertmanager:https://am:9093?cluster=test&ca_file=",
+		"circuitbreaker:alertmanager:https://am:9093?cluster=test&tls_ca_file=",
+	} {
+		var uri flags.Uri
+		assert.NoError(t, uri.Set(value+url.QueryEscape(badCA)))
+		_, err := NewSinkFactory().Build(uri)
+		if assert.Error(t, err, value) {
+			assert.Contains(t, err.Error(), "no certificates found", value)
+		}
+	}
+}
@@ -0,0 +1,213 @@
+// Copyright 2018 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sinks
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+
+	kube_api "k8s.io/api/core/v1"
+	"k8s.io/heapster/events/core"
+)
+
+// The filter options may be given to any sink, e.g.
+// --sink=kafka:?brokers=kafka:9092&filter_namespaces=prod-*&filter_types=Warning.
+// They are removed from the uri before the sink is built.
+const (
+	filterNamespacesOption = "filter_namespaces"
+	filterTypesOption      = "filter_types"
+	filterReasonsOption    = "filter_reasons"
+	filterMinCountOption   = "filter_min_count"
+)
+
+var filterOptions = []string{filterNamespacesOption, filterTypesOption, filterReasonsOption, filterMinCountOption}
+
+// FilterOptions select the events exported to a sink. Empty lists select
+// everything.
+type FilterOptions struct {
+	// Namespaces are names or globs like prod-* matched against the
+	// namespace of the object the event is about.
+	Namespaces []string
+	// Types are event types, Normal or Warning.
+	Types []string
+	// Reasons are exact event reasons.
+	Reasons []string
+	// MinCount is the least number of occurrences of exported events.
+	MinCount int32
+}
+
+func (opts FilterOptions) isEmpty() bool {
+	return len(opts.Namespaces) == 0 && len(opts.Types) == 0 && len(opts.Reasons) == 0 && opts.MinCount <= 1
+}
+
+// filteredSink exports to the wrapped sink only the events selected by the
+// filter options.
+type filteredSink struct {
+	sink core.EventSink
+	opts FilterOptions
+}
+
+func NewFilteredSink(inner core.EventSink, opts FilterOptions) core.EventSink {
+	return &filteredSink{sink: inner, opts: opts}
+}
+
+// splitList splits comma-separated values of a repeated option.
+func splitList(values []string) []string {
+	var items []string
+	for _, value := range values {
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+	}
+	return items
+}
+
+// parseFilterOptions removes the filter options from the uri and returns
+// them.
+func parseFilterOptions(val *url.URL) (FilterOptions, error) {
+	query := val.Query()
+	var opts FilterOptions
+	found := false
+	for _, name := range filterOptions {
+		if _, ok := query[name]; ok {
+			found = true
+		}
+	}
+	if !found {
+		return opts, nil
+	}
+
+	opts.Namespaces = splitList(query[filterNamespacesOption])
+	for _, pattern := range opts.Namespaces {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return opts, fmt.Errorf("%s has an invalid pattern %q: %v", filterNamespacesOption, pattern, err)
+		}
+	}
+	opts.Types = splitList(query[filterTypesOption])
+	for _, eventType := range opts.Types {
+		if _, err := core.ParseLevel(eventType); err != nil {
+			return opts, fmt.Errorf("invalid %s: %v", filterTypesOption, err)
+		}
+	}
+	opts.Reasons = splitList(query[filterReasonsOption])
+	if len(query[filterMinCountOption]) >= 1 {
+		count, err := strconv.ParseInt(query[filterMinCountOption][0], 10, 32)
+		if err != nil || count < 1 {
+			return opts, fmt.Errorf("%s must be a positive integer, got %q", filterMinCountOption, query[filterMinCountOption][0])
+		}
+		opts.MinCount = int32(count)
+	}
+
+	for _, name := range filterOptions {
+		delete(query, name)
+	}
+	val.RawQuery = query.Encode()
+	return opts, nil
+}
+
+func (this *filteredSink) Name() string {
+	return this.sink.Name() + " (filtered)"
+}
+
+func (this *filteredSink) Stop() {
+	this.sink.Stop()
+}
+
+func (this *filteredSink) WrappedSinks() []core.EventSink {
+	return []core.EventSink{this.sink}
+}
+
+func (this *filteredSink) ExportEvents(batch *core.EventBatch) {
+	if batch = this.filter(batch); len(batch.Events) > 0 {
+		this.sink.ExportEvents(batch)
+	}
+}
+
+func (this *filteredSink) ExportEventsWithError(batch *core.EventBatch) error {
+	if batch = this.filter(batch); len(batch.Events) > 0 {
+		return core.ExportEvents(this.sink, batch)
+	}
+	return nil
+}
+
+func (this *filteredSink) ExportEventsContext(ctx context.Context, batch *core.EventBatch) error {
+	if batch = this.filter(batch); len(batch.Events) > 0 {
+		return core.ExportEventsContext(ctx, this.sink, batch)
+	}
+	return nil
+}
+
+func (this *filteredSink) filter(batch *core.EventBatch) *core.EventBatch {
+	filtered := &core.EventBatch{
+		Timestamp: batch.Timestamp,
+		Events:    make([]*kube_api.Event, 0, len(batch.Events)),
+	}
+	for _, event := range batch.Events {
+		if this.selected(event) {
+			filtered.Events = append(filtered.Events, event)
+		}
+	}
+	return filtered
+}
+
+func (this *filteredSink) selected(event *kube_api.Event) bool {
+	if len(this.opts.Namespaces) > 0 && !matchesAny(this.opts.Namespaces, event.InvolvedObject.Namespace) {
+		return false
+	}
+	if len(this.opts.Types) > 0 && !contains(this.opts.Types, event.Type) {
+		return false
+	}
+	if len(this.opts.Reasons) > 0 && !contains(this.opts.Reasons, event.Reason) {
+		return false
+	}
+	return eventCount(event) >= this.opts.MinCount
+}
+
+func matchesAny(patterns []string, value string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, value); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// eventCount is the number of occurrences of the event, kept in its series
+// by the events API.
+func eventCount(event *kube_api.Event) int32 {
+	count := event.Count
+	if event.Series != nil && event.Series.Count > count {
+		count = event.Series.Count
+	}
+	if count < 1 {
+		count = 1
+	}
+	return count
+}
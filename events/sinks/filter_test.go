@@ -0,0 +1,120 @@
+// Copyright 2018 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sinks
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	kube_api "k8s.io/api/core/v1"
+	"k8s.io/heapster/common/flags"
+	"k8s.io/heapster/events/core"
+	"k8s.io/heapster/events/sinks/memory"
+)
+
+func init() {
+	// The name of the sink is the query it was built with.
+	Register("filter-fake", func(uri *url.URL) (core.EventSink, error) {
+		return &fakeSink{name: uri.RawQuery}, nil
+	})
+}
+
+func filterTestEvents() []*kube_api.Event {
+	return []*kube_api.Event{
+		{Type: kube_api.EventTypeWarning, Reason: "BackOff", Count: 5, InvolvedObject: kube_api.ObjectReference{Namespace: "prod-web"}},
+		{Type: kube_api.EventTypeNormal, Reason: "Pulled", Count: 1, InvolvedObject: kube_api.ObjectReference{Namespace: "prod-web"}},
+		{Type: kube_api.EventTypeWarning, Reason: "FailedMount", Count: 2, InvolvedObject: kube_api.ObjectReference{Namespace: "dev"}},
+		{Type: kube_api.EventTypeWarning, Reason: "NodeNotReady", Series: &kube_api.EventSeries{Count: 9}},
+	}
+}
+
+func TestFilteredSink(t *testing.T) {
+	events := filterTestEvents()
+	tests := []struct {
+		opts     FilterOptions
+		expected []*kube_api.Event
+	}{
+		{FilterOptions{}, events},
+		{FilterOptions{Namespaces: []string{"prod-*"}}, events[:2]},
+		{FilterOptions{Types: []string{kube_api.EventTypeWarning}}, []*kube_api.Event{events[0], events[2], events[3]}},
+		{FilterOptions{Reasons: []string{"Pulled", "FailedMount"}}, events[1:3]},
+		{FilterOptions{MinCount: 5}, []*kube_api.Event{events[0], events[3]}},
+		{FilterOptions{Namespaces: []string{"prod-*", "dev"}, Types: []string{kube_api.EventTypeWarning}, MinCount: 3}, events[:1]},
+	}
+	for _, test := range tests {
+		child := &fakeSink{name: "fake"}
+		sink := NewFilteredSink(child, test.opts)
+		now := time.Now()
+		assert.NoError(t, core.ExportEvents(sink, &core.EventBatch{Timestamp: now, Events: events}))
+		assert.Len(t, child.exported(), 1, "%+v", test.opts)
+		assert.Equal(t, test.expected, child.exported()[0].Events, "%+v", test.opts)
+		assert.Equal(t, now, child.exported()[0].Timestamp)
+	}
+
+	// Nothing is exported when all events are filtered out.
+	child := &fakeSink{name: "fake"}
+	sink := NewFilteredSink(child, FilterOptions{Reasons: []string{"Killing"}})
+	sink.ExportEvents(&core.EventBatch{Events: events})
+	assert.Empty(t, child.exported())
+
+	assert.Equal(t, "fake (filtered)", sink.Name())
+	sink.Stop()
+	assert.True(t, child.isStopped())
+}
+
+func TestBuildWithFilterOptions(t *testing.T) {
+	factory := NewSinkFactory()
+	var uri flags.Uri
+
+	// The filter options aren't passed to the sink.
+	assert.NoError(t, uri.Set("filter-fake:?filter_namespaces=prod-*,dev&filter_types=Warning&filter_reasons=BackOff&filter_min_count=2&other=1"))
+	sink, err := factory.Build(uri)
+	assert.NoError(t, err)
+	filtered := sink.(*filteredSink)
+	assert.Equal(t, "other=1 (filtered)", filtered.Name())
+	assert.Equal(t, FilterOptions{
+		Namespaces: []string{"prod-*", "dev"},
+		Types:      []string{kube_api.EventTypeWarning},
+		Reasons:    []string{"BackOff"},
+		MinCount:   2,
+	}, filtered.opts)
+
+	assert.NoError(t, uri.Set("memory:?name=filter-test&filter_namespaces=prod-*"))
+	sink, err = factory.Build(uri)
+	assert.NoError(t, err)
+	events := filterTestEvents()
+	sink.ExportEvents(&core.EventBatch{Events: events})
+	assert.Equal(t, events[:2], memory.Lookup("filter-test").Events())
+
+	assert.NoError(t, uri.Set("log:?filter_types=Warning&minlevel=Normal"))
+	sink, err = factory.Build(uri)
+	assert.NoError(t, err)
+	assert.IsType(t, &filteredSink{}, sink.(*minLevelSink).sink)
+
+	// Without filter options the sink isn't wrapped.
+	assert.NoError(t, uri.Set("log"))
+	sink, err = factory.Build(uri)
+	assert.NoError(t, err)
+	_, wrapped := sink.(*filteredSink)
+	assert.False(t, wrapped)
+
+	for _, invalid := range []string{"log:?filter_types=Critical", "log:?filter_min_count=0", "log:?filter_namespaces=prod-["} {
+		assert.NoError(t, uri.Set(invalid))
+		_, err := factory.Build(uri)
+		assert.Error(t, err, invalid)
+	}
+}
@@ -0,0 +1,96 @@
+// Copyright 2018 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sinks
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultFailureThreshold marks a sink as failing after 5 consecutive failed
+// exports or 10 minutes without a successful one.
+const DefaultFailureThreshold = "5,10m"
+
+// HealthPolicy tells when sinks are failing, and whether the failing ones
+// make the eventer unhealthy.
+type HealthPolicy struct {
+	// MaxFailures is the number of consecutive failed exports after which a
+	// sink is failing. Zero means no limit.
+	MaxFailures int
+	// MaxSilence is how long a sink may go without a successful export
+	// before it is failing. Zero means no limit.
+	MaxSilence time.Duration
+	// Strict makes the eventer unhealthy as soon as any sink is failing,
+	// rather than once all of them are.
+	Strict bool
+}
+
+// ParseFailureThreshold parses a comma-separated number of consecutive
+// failures and duration without success, either of which may be omitted,
+// like "5,10m", "3" or "15m".
+func ParseFailureThreshold(value string) (HealthPolicy, error) {
+	var policy HealthPolicy
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+		if failures, err := strconv.Atoi(part); err == nil && failures > 0 && policy.MaxFailures == 0 {
+			policy.MaxFailures = failures
+			continue
+		}
+		if silence, err := time.ParseDuration(part); err == nil && silence > 0 && policy.MaxSilence == 0 {
+			policy.MaxSilence = silence
+			continue
+		}
+		return HealthPolicy{}, fmt.Errorf("sink failure threshold must be a positive number of failures and/or duration, like %s, got %q", DefaultFailureThreshold, value)
+	}
+	return policy, nil
+}
+
+// failing tells whether the sink of the status is failing at now.
+func (this HealthPolicy) failing(status SinkStatus, now time.Time) bool {
+	if this.MaxFailures > 0 && status.ConsecutiveFailures >= this.MaxFailures {
+		return true
+	}
+	if this.MaxSilence > 0 {
+		lastSuccess := status.started
+		if status.LastSuccessTime != nil {
+			lastSuccess = *status.LastSuccessTime
+		}
+		return now.Sub(lastSuccess) > this.MaxSilence
+	}
+	return false
+}
+
+// Check returns an error naming the failing sinks if they make the eventer
+// unhealthy: any of them in strict mode, all of them otherwise. Sinks that
+// don't report failed exports are left out, since their health is unknown.
+func (this HealthPolicy) Check(statuses []SinkStatus, now time.Time) error {
+	var checked int
+	var failing []string
+	for _, status := range statuses {
+		if !status.ReportsErrors {
+			continue
+		}
+		checked++
+		if this.failing(status, now) {
+			failing = append(failing, status.Name)
+		}
+	}
+	if len(failing) == 0 || !this.Strict && len(failing) < checked {
+		return nil
+	}
+	return fmt.Errorf("failing sinks: %s", strings.Join(failing, ", "))
+}
@@ -0,0 +1,75 @@
+// Copyright 2018 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sinks
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseFailureThreshold(t *testing.T) {
+	tests := []struct {
+		value string
+		want  HealthPolicy
+	}{
+		{value: DefaultFailureThreshold, want: HealthPolicy{MaxFailures: 5, MaxSilence: 10 * time.Minute}},
+		{value: "3", want: HealthPolicy{MaxFailures: 3}},
+		{value: "15m", want: HealthPolicy{MaxSilence: 15 * time.Minute}},
+		{value: "1h, 10", want: HealthPolicy{MaxFailures: 10, MaxSilence: time.Hour}},
+	}
+	for _, test := range tests {
+		policy, err := ParseFailureThreshold(test.value)
+		assert.NoError(t, err, test.value)
+		assert.Equal(t, test.want, policy, test.value)
+	}
+
+	for _, invalid := range []string{"", "0", "-1m", "5,6", "often"} {
+		_, err := ParseFailureThreshold(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestHealthPolicy(t *testing.T) {
+	now := time.Now()
+	recent, old := now.Add(-time.Minute), now.Add(-time.Hour)
+	healthy := SinkStatus{Name: "healthy", LastSuccessTime: &recent, ReportsErrors: true, started: old}
+	failingStreak := SinkStatus{Name: "streak", LastSuccessTime: &recent, ConsecutiveFailures: 5, ReportsErrors: true, started: old}
+	silent := SinkStatus{Name: "silent", LastSuccessTime: &old, ConsecutiveFailures: 1, ReportsErrors: true, started: old}
+	neverSucceeded := SinkStatus{Name: "never", ReportsErrors: true, started: old}
+	justStarted := SinkStatus{Name: "new", ConsecutiveFailures: 1, ReportsErrors: true, started: recent}
+	// A sink that doesn't report failures never succeeds either.
+	unknown := SinkStatus{Name: "unknown", LastExportResult: ExportUnknown, started: old}
+
+	policy := HealthPolicy{MaxFailures: 5, MaxSilence: 10 * time.Minute}
+	assert.NoError(t, policy.Check(nil, now))
+	assert.NoError(t, policy.Check([]SinkStatus{healthy, justStarted}, now))
+	// Degraded: at least one sink is still exporting.
+	assert.NoError(t, policy.Check([]SinkStatus{healthy, failingStreak, silent}, now))
+	assert.EqualError(t, policy.Check([]SinkStatus{failingStreak, silent, neverSucceeded}, now),
+		"failing sinks: streak, silent, never")
+	// Sinks of unknown health neither fail nor keep the eventer healthy.
+	assert.NoError(t, policy.Check([]SinkStatus{unknown}, now))
+	assert.EqualError(t, policy.Check([]SinkStatus{failingStreak, unknown}, now), "failing sinks: streak")
+
+	policy.Strict = true
+	assert.NoError(t, policy.Check([]SinkStatus{healthy, justStarted}, now))
+	assert.EqualError(t, policy.Check([]SinkStatus{healthy, failingStreak}, now), "failing sinks: streak")
+
+	// Without a time limit, only the failure streaks count.
+	policy = HealthPolicy{MaxFailures: 5, Strict: true}
+	assert.NoError(t, policy.Check([]SinkStatus{healthy, silent, neverSucceeded}, now))
+}
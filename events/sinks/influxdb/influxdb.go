@@ -178,6 +178,23 @@ func (sink *influxdbSink) Stop() {
 	// nothing needs to be done.
 }
 
+// HealthCheck pings the InfluxDB server, connecting to it if needed.
+func (sink *influxdbSink) HealthCheck() error {
+	sink.Lock()
+	defer sink.Unlock()
+	if sink.client == nil {
+		// Creating the client pings the server.
+		client, err := influxdb_common.NewClient(sink.c)
+		if err != nil {
+			return err
+		}
+		sink.client = client
+		return nil
+	}
+	_, _, err := sink.client.Ping()
+	return err
+}
+
 func (sink *influxdbSink) createDatabase() error {
 	if sink.client == nil {
 		client, err := influxdb_common.NewClient(sink.c)
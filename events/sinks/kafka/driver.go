@@ -23,6 +23,7 @@ import (
 	"github.com/golang/glog"
 	kube_api "k8s.io/api/core/v1"
 	kafka_common "k8s.io/heapster/common/kafka"
+	"k8s.io/heapster/common/reconnect"
 	event_core "k8s.io/heapster/events/core"
 	"k8s.io/heapster/metrics/core"
 )
@@ -36,6 +37,11 @@ type KafkaSinkPoint struct {
 type kafkaSink struct {
 	kafka_common.KafkaClient
 	sync.RWMutex
+
+	// connect creates a new client, used to reconnect after a write failure.
+	connect     func() (kafka_common.KafkaClient, error)
+	reconnector *reconnect.Reconnector
+	broken      bool
 }
 
 func getEventValue(event *kube_api.Event) (string, error) {
@@ -71,6 +77,11 @@ func (sink *kafkaSink) ExportEvents(eventBatch *event_core.EventBatch) {
 	sink.Lock()
 	defer sink.Unlock()
 
+	if sink.broken && !sink.reconnect() {
+		glog.Warningf("Kafka sink not connected, dropping %d events", len(eventBatch.Events))
+		return
+	}
+
 	for _, event := range eventBatch.Events {
 		point, err := eventToPoint(event)
 		if err != nil {
@@ -80,17 +91,54 @@ func (sink *kafkaSink) ExportEvents(eventBatch *event_core.EventBatch) {
 		err = sink.ProduceKafkaMessage(*point)
 		if err != nil {
 			glog.Errorf("Failed to produce event message: %s", err)
+			// The connection is re-established before the next batch.
+			sink.broken = true
+			return
 		}
 	}
 }
 
+// HealthCheck connects to the brokers anew, which fetches the metadata of
+// the cluster, without disturbing the client in use.
+func (sink *kafkaSink) HealthCheck() error {
+	client, err := sink.connect()
+	if err != nil {
+		return err
+	}
+	client.Stop()
+	return nil
+}
+
+// reconnect replaces the client with a newly connected one.
+func (sink *kafkaSink) reconnect() bool {
+	return sink.reconnector.Attempt(func() error {
+		client, err := sink.connect()
+		if err != nil {
+			return err
+		}
+		sink.KafkaClient.Stop()
+		sink.KafkaClient = client
+		sink.broken = false
+		return nil
+	})
+}
+
 func NewKafkaSink(uri *url.URL) (event_core.EventSink, error) {
-	client, err := kafka_common.NewKafkaClient(uri, kafka_common.EventsTopic)
+	maxBackoff, err := reconnect.ParseMaxBackoff(uri.Query())
+	if err != nil {
+		return nil, err
+	}
+	connect := func() (kafka_common.KafkaClient, error) {
+		return kafka_common.NewKafkaClient(uri, kafka_common.EventsTopic)
+	}
+	client, err := connect()
 	if err != nil {
 		return nil, err
 	}
 
 	return &kafkaSink{
 		KafkaClient: client,
+		connect:     connect,
+		reconnector: reconnect.NewReconnector("kafka sink", maxBackoff),
 	}, nil
 }
@@ -15,12 +15,15 @@
 package kafka
 
 import (
+	"fmt"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
 	kube_api "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kafka_common "k8s.io/heapster/common/kafka"
+	"k8s.io/heapster/common/reconnect"
 	event_core "k8s.io/heapster/events/core"
 )
 
@@ -99,3 +102,65 @@ func TestStoreMultipleEventsInput(t *testing.T) {
 	assert.Equal(t, 2, len(fakeSink.fakeClient.points))
 
 }
+
+// fakeBroker hands out clients that fail while the broker is down.
+type fakeBroker struct {
+	up        bool
+	delivered int
+	stopped   int
+}
+
+type fakeBrokerClient struct {
+	broker *fakeBroker
+}
+
+func (client *fakeBrokerClient) ProduceKafkaMessage(msgData interface{}) error {
+	if !client.broker.up {
+		return fmt.Errorf("broken pipe")
+	}
+	client.broker.delivered++
+	return nil
+}
+
+func (client *fakeBrokerClient) Name() string {
+	return "Apache Kafka Sink"
+}
+
+func (client *fakeBrokerClient) Stop() {
+	client.broker.stopped++
+}
+
+func (broker *fakeBroker) connect() (kafka_common.KafkaClient, error) {
+	if !broker.up {
+		return nil, fmt.Errorf("connection refused")
+	}
+	return &fakeBrokerClient{broker}, nil
+}
+
+func TestReconnectAfterBrokerRestart(t *testing.T) {
+	broker := &fakeBroker{up: true}
+	client, _ := broker.connect()
+	sink := &kafkaSink{
+		KafkaClient: client,
+		connect:     broker.connect,
+		reconnector: reconnect.NewReconnector("kafka sink", 10*time.Millisecond),
+	}
+	batch := &event_core.EventBatch{Events: []*kube_api.Event{{Message: "event"}}}
+
+	sink.ExportEvents(batch)
+	assert.Equal(t, 1, broker.delivered)
+
+	broker.up = false
+	sink.ExportEvents(batch)
+	assert.True(t, sink.broken)
+	// Reconnecting fails while the broker is down.
+	sink.ExportEvents(batch)
+	assert.True(t, sink.broken)
+
+	broker.up = true
+	time.Sleep(20 * time.Millisecond)
+	sink.ExportEvents(batch)
+	assert.False(t, sink.broken)
+	assert.Equal(t, 2, broker.delivered)
+	assert.Equal(t, 1, broker.stopped)
+}
@@ -16,13 +16,40 @@ package logsink
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
 	"fmt"
+	"net/url"
+	"time"
 
 	"github.com/golang/glog"
+	kube_api "k8s.io/api/core/v1"
 	"k8s.io/heapster/events/core"
 )
 
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// LogSink logs the events, either in a human readable format or, with
+// --sink=log:?format=json, as a single-line JSON object per event.
 type LogSink struct {
+	Format string
+}
+
+// logRecord is the JSON form of an event.
+type logRecord struct {
+	Namespace      string    `json:"namespace"`
+	Kind           string    `json:"kind"`
+	Name           string    `json:"name"`
+	Type           string    `json:"type"`
+	Reason         string    `json:"reason"`
+	Message        string    `json:"message"`
+	Count          int32     `json:"count"`
+	FirstTimestamp time.Time `json:"firstTimestamp"`
+	LastTimestamp  time.Time `json:"lastTimestamp"`
+	Source         string    `json:"source,omitempty"`
 }
 
 func (this *LogSink) Name() string {
@@ -42,10 +69,61 @@ func batchToString(batch *core.EventBatch) string {
 	return buffer.String()
 }
 
+func eventToJSON(event *kube_api.Event) ([]byte, error) {
+	return json.Marshal(logRecord{
+		Namespace:      event.InvolvedObject.Namespace,
+		Kind:           event.InvolvedObject.Kind,
+		Name:           event.InvolvedObject.Name,
+		Type:           event.Type,
+		Reason:         event.Reason,
+		Message:        event.Message,
+		Count:          event.Count,
+		FirstTimestamp: event.FirstTimestamp.UTC(),
+		LastTimestamp:  event.LastTimestamp.UTC(),
+		Source:         event.Source.Component,
+	})
+}
+
 func (this *LogSink) ExportEvents(batch *core.EventBatch) {
-	glog.Info(batchToString(batch))
+	this.ExportEventsWithError(batch)
+}
+
+// ExportEventsWithError never fails: logging can't, and events that can't be
+// marshaled are skipped.
+func (this *LogSink) ExportEventsWithError(batch *core.EventBatch) error {
+	return this.ExportEventsContext(context.Background(), batch)
 }
 
-func CreateLogSink() (*LogSink, error) {
-	return &LogSink{}, nil
+// ExportEventsContext doesn't start logging a batch once ctx is done.
+func (this *LogSink) ExportEventsContext(ctx context.Context, batch *core.EventBatch) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if this.Format != FormatJSON {
+		glog.Info(batchToString(batch))
+		return nil
+	}
+	for _, event := range batch.Events {
+		line, err := eventToJSON(event)
+		if err != nil {
+			glog.Warningf("Failed to marshal event %s/%s: %v", event.Namespace, event.Name, err)
+			continue
+		}
+		glog.Info(string(line))
+	}
+	return nil
+}
+
+func CreateLogSink(uri *url.URL) (*LogSink, error) {
+	sink := &LogSink{Format: FormatText}
+	opts := uri.Query()
+	if len(opts["format"]) >= 1 {
+		switch opts["format"][0] {
+		case FormatText, FormatJSON:
+			sink.Format = opts["format"][0]
+		default:
+			return nil, fmt.Errorf("format must be %s or %s, got %q", FormatText, FormatJSON, opts["format"][0])
+		}
+	}
+	return sink, nil
 }
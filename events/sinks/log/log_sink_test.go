@@ -15,7 +15,9 @@
 package logsink
 
 import (
+	"encoding/json"
 	"fmt"
+	"net/url"
 	"strings"
 	"testing"
 	"time"
@@ -47,3 +49,44 @@ func TestSimpleWrite(t *testing.T) {
 	assert.True(t, strings.Contains(log, "251"))
 	assert.True(t, strings.Contains(log, fmt.Sprintf("%s", now)))
 }
+
+func TestEventToJSON(t *testing.T) {
+	now := time.Date(2018, 3, 1, 10, 0, 0, 0, time.UTC)
+	event := kube_api.Event{
+		InvolvedObject: kube_api.ObjectReference{Kind: "Pod", Namespace: "default", Name: "web-0"},
+		Type:           kube_api.EventTypeWarning,
+		Reason:         "BackOff",
+		Message:        "Back-off restarting failed container",
+		Count:          3,
+		LastTimestamp:  metav1.NewTime(now),
+		FirstTimestamp: metav1.NewTime(now.Add(-time.Minute)),
+	}
+
+	line, err := eventToJSON(&event)
+	assert.NoError(t, err)
+	assert.False(t, strings.Contains(string(line), "\n"))
+
+	var record map[string]interface{}
+	assert.NoError(t, json.Unmarshal(line, &record))
+	assert.Equal(t, "default", record["namespace"])
+	assert.Equal(t, "BackOff", record["reason"])
+	assert.Equal(t, "Back-off restarting failed container", record["message"])
+	assert.Equal(t, float64(3), record["count"])
+	assert.Equal(t, "2018-03-01T09:59:00Z", record["firstTimestamp"])
+	assert.Equal(t, "2018-03-01T10:00:00Z", record["lastTimestamp"])
+}
+
+func TestCreateLogSink(t *testing.T) {
+	sink, err := CreateLogSink(&url.URL{})
+	assert.NoError(t, err)
+	assert.Equal(t, FormatText, sink.Format)
+
+	uri, _ := url.Parse("?format=json")
+	sink, err = CreateLogSink(uri)
+	assert.NoError(t, err)
+	assert.Equal(t, FormatJSON, sink.Format)
+
+	uri, _ = url.Parse("?format=xml")
+	_, err = CreateLogSink(uri)
+	assert.Error(t, err)
+}
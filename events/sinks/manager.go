@@ -15,17 +15,23 @@
 package sinks
 
 import (
+	"context"
+	"fmt"
+	"runtime/debug"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/golang/glog"
 	"github.com/prometheus/client_golang/prometheus"
+	kube_api "k8s.io/api/core/v1"
 	"k8s.io/heapster/events/core"
+	"k8s.io/heapster/events/tracing"
 )
 
 const (
 	DefaultSinkExportEventsTimeout = 20 * time.Second
-	DefaultSinkStopTimeout         = 60 * time.Second
+	DefaultSinkStopTimeout         = 10 * time.Second
 )
 
 var (
@@ -39,63 +45,437 @@ var (
 		},
 		[]string{"exporter"},
 	)
+
+	// Number of exports to sink.
+	exportsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "eventer",
+			Subsystem: "exporter",
+			Name:      "exports_total",
+			Help:      "Number of exports to sink.",
+		},
+		[]string{"exporter"},
+	)
+
+	// Number of exports to sink that hit its export timeout.
+	exportTimeouts = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "eventer",
+			Subsystem: "exporter",
+			Name:      "export_timeouts_total",
+			Help:      "Number of exports to sink that hit its export timeout, including batches dropped because the sink was still busy.",
+		},
+		[]string{"exporter"},
+	)
+
+	// Number of exports to sink that panicked.
+	exportPanics = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "eventer",
+			Subsystem: "exporter",
+			Name:      "export_panics_total",
+			Help:      "Number of exports to sink that panicked.",
+		},
+		[]string{"exporter"},
+	)
+
+	// Latency of exports to sink in seconds.
+	exportLatency = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: "eventer",
+			Subsystem: "exporter",
+			Name:      "export_latency_seconds",
+			Help:      "Latency of exports to sink in seconds.",
+			Buckets:   prometheus.DefBuckets,
+		},
+		[]string{"exporter"},
+	)
+
+	// Time of the last successful export to sink.
+	lastSuccessfulExport = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "eventer",
+			Subsystem: "exporter",
+			Name:      "last_successful_export_timestamp_seconds",
+			Help:      "Unix time of the last successful export to sink.",
+		},
+		[]string{"exporter"},
+	)
+
+	// Number of events dropped before export because they carry neither a reason nor a message.
+	emptyEventsSkipped = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: "eventer",
+			Subsystem: "exporter",
+			Name:      "empty_events_skipped_total",
+			Help:      "Number of events skipped because they have neither a reason nor a message.",
+		},
+	)
+
+	// Number of sink exports currently running.
+	exportsInFlight = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: "eventer",
+			Subsystem: "exporter",
+			Name:      "exports_in_flight",
+			Help:      "Number of sink exports currently running.",
+		},
+	)
 )
 
 func init() {
 	prometheus.MustRegister(exporterDuration)
+	prometheus.MustRegister(emptyEventsSkipped)
+	prometheus.MustRegister(exportsInFlight)
+	prometheus.MustRegister(exportsTotal)
+	prometheus.MustRegister(exportTimeouts)
+	prometheus.MustRegister(exportPanics)
+	prometheus.MustRegister(exportLatency)
+	prometheus.MustRegister(lastSuccessfulExport)
 }
 
 type sinkHolder struct {
-	sink              core.EventSink
+	sink core.EventSink
+	// exportTimeout is the timeout of the sink, the manager's by default.
+	exportTimeout     time.Duration
 	eventBatchChannel chan *core.EventBatch
 	stopChannel       chan bool
+	// Closed once the sink's Stop has returned.
+	stoppedChannel chan struct{}
+	// queue holds the batches waiting for export, nil if batches are
+	// handed over to the sink directly.
+	queue *batchQueue
+	// busy holds a token while a queued batch is exported, so that the
+	// worker moves on from an export outlasting its timeout without running
+	// another one concurrently.
+	busy   chan struct{}
+	status *sinkStatus
 }
 
 // Sink Manager - a special sink that distributes data to other sinks. It pushes data
 // only to these sinks that completed their previous exports. Data that could not be
 // pushed in the defined time is dropped and not retried.
+//
+// With a queue depth, data is instead queued for each sink without blocking and
+// drained by a worker per sink. Data that doesn't fit in the queue of a sink is
+// dropped according to the drop policy.
 type sinkManager struct {
+	// lock guards sinkHolders, replaced by SetSinks.
+	lock                sync.RWMutex
 	sinkHolders         []sinkHolder
+	limiter             exportLimiter
 	exportEventsTimeout time.Duration
 	// Should be larger than exportEventsTimeout, although it is not a hard requirement.
 	stopTimeout time.Duration
+	queueDepth  int
+	dropPolicy  string
+	// How long queued data is still exported on Stop.
+	drainTimeout time.Duration
+	// drainCtx bounds the export of the batches still queued for stopped
+	// sinks: the manager's context, until Stop bounds it by drainTimeout.
+	drainCtx context.Context
+	// Cancelled on Stop, or with the context of the options, to abort
+	// in-flight exports.
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// exportLimiter bounds the number of sink exports running at the same time
+// across all sinks. Exports over the limit wait for a free slot. A nil
+// limiter doesn't limit.
+type exportLimiter chan struct{}
+
+func newExportLimiter(maxInFlight int) exportLimiter {
+	if maxInFlight <= 0 {
+		return nil
+	}
+	return make(exportLimiter, maxInFlight)
+}
+
+func (l exportLimiter) acquire(ctx context.Context) error {
+	if l != nil {
+		select {
+		case l <- struct{}{}:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	exportsInFlight.Inc()
+	return nil
+}
+
+func (l exportLimiter) release() {
+	exportsInFlight.Dec()
+	if l != nil {
+		<-l
+	}
+}
+
+// SinkManagerOptions configures the sink manager.
+type SinkManagerOptions struct {
+	ExportTimeout time.Duration
+	StopTimeout   time.Duration
+	// MaxInFlight bounds the number of concurrent exports, zero or less means
+	// no limit.
+	MaxInFlight int
+	// QueueDepth is the number of batches queued per sink. Zero or less hands
+	// batches over to the sinks directly, blocking up to the export timeout.
+	QueueDepth int
+	// DropPolicy is DropOldest or DropNewest, DropOldest by default.
+	DropPolicy string
+	// DrainTimeout is how long queued batches are still exported on Stop.
+	DrainTimeout time.Duration
+	// Context aborts the exports once cancelled, as Stop does, optional.
+	Context context.Context
+}
+
+// NewEventSinkManager creates a manager exporting to the given sinks. At most
+// maxInFlight exports run concurrently; zero or less means no limit.
+func NewEventSinkManager(sinks []core.EventSink, exportEventsTimeout, stopTimeout time.Duration, maxInFlight int) (core.EventSink, error) {
+	return NewEventSinkManagerWithOptions(sinks, SinkManagerOptions{
+		ExportTimeout: exportEventsTimeout,
+		StopTimeout:   stopTimeout,
+		MaxInFlight:   maxInFlight,
+	})
 }
 
-func NewEventSinkManager(sinks []core.EventSink, exportEventsTimeout, stopTimeout time.Duration) (core.EventSink, error) {
-	sinkHolders := []sinkHolder{}
+// NewEventSinkManagerWithOptions creates a manager exporting to the given sinks.
+func NewEventSinkManagerWithOptions(sinks []core.EventSink, options SinkManagerOptions) (core.EventSink, error) {
+	dropPolicy := DropOldest
+	if options.DropPolicy != "" {
+		var err error
+		if dropPolicy, err = ParseDropPolicy(options.DropPolicy); err != nil {
+			return nil, err
+		}
+	}
+	parent := options.Context
+	if parent == nil {
+		parent = context.Background()
+	}
+	ctx, cancel := context.WithCancel(parent)
+	manager := &sinkManager{
+		sinkHolders:         []sinkHolder{},
+		limiter:             newExportLimiter(options.MaxInFlight),
+		exportEventsTimeout: options.ExportTimeout,
+		stopTimeout:         options.StopTimeout,
+		queueDepth:          options.QueueDepth,
+		dropPolicy:          dropPolicy,
+		drainTimeout:        options.DrainTimeout,
+		drainCtx:            ctx,
+		ctx:                 ctx,
+		cancel:              cancel,
+	}
 	for _, sink := range sinks {
-		sh := sinkHolder{
-			sink:              sink,
-			eventBatchChannel: make(chan *core.EventBatch),
-			stopChannel:       make(chan bool),
+		manager.sinkHolders = append(manager.sinkHolders, manager.startSink(sink))
+	}
+	return manager, nil
+}
+
+// startSink starts the goroutine exporting to the sink.
+func (this *sinkManager) startSink(sink core.EventSink) sinkHolder {
+	sh := sinkHolder{
+		sink:              sink,
+		exportTimeout:     exportTimeout(sink, this.exportEventsTimeout),
+		eventBatchChannel: make(chan *core.EventBatch),
+		stopChannel:       make(chan bool),
+		stoppedChannel:    make(chan struct{}),
+		status:            newSinkStatus(core.ReportsErrors(sink)),
+	}
+	glog.Infof("Export timeout of sink %s: %v", sink.Name(), sh.exportTimeout)
+	if this.queueDepth > 0 {
+		sh.queue = newBatchQueue(sink.Name(), this.queueDepth, this.dropPolicy)
+		sh.busy = make(chan struct{}, 1)
+		go this.drainQueue(sh)
+		return sh
+	}
+	go func(sh sinkHolder) {
+		for {
+			select {
+			case data := <-sh.eventBatchChannel:
+				if err := this.exportLimited(sh, data, sh.recordExport); err != nil {
+					glog.Warningf("Dropped events for sink %s: %v", sh.sink.Name(), err)
+				}
+			case isStop := <-sh.stopChannel:
+				glog.V(2).Infof("Stop received: %s", sh.sink.Name())
+				if isStop {
+					sh.sink.Stop()
+					close(sh.stoppedChannel)
+					return
+				}
+			}
 		}
-		sinkHolders = append(sinkHolders, sh)
-		go func(sh sinkHolder) {
-			for {
-				select {
-				case data := <-sh.eventBatchChannel:
-					export(sh.sink, data)
-				case isStop := <-sh.stopChannel:
-					glog.V(2).Infof("Stop received: %s", sh.sink.Name())
-					if isStop {
-						sh.sink.Stop()
-						return
-					}
+	}(sh)
+	return sh
+}
+
+// drainQueue exports the batches queued for the sink of sh until stopped.
+// On stop, the batches still queued are exported until the drain context is
+// done, and dropped after.
+func (this *sinkManager) drainQueue(sh sinkHolder) {
+	for {
+		select {
+		case <-sh.queue.ready:
+			for data := sh.queue.pop(); data != nil; data = sh.queue.pop() {
+				this.exportQueued(sh, data)
+			}
+		case isStop := <-sh.stopChannel:
+			glog.V(2).Infof("Stop received: %s", sh.sink.Name())
+			if !isStop {
+				continue
+			}
+			drainCtx := this.drainContext()
+			for drainCtx.Err() == nil {
+				data := sh.queue.pop()
+				if data == nil {
+					break
 				}
+				this.exportQueued(sh, data)
+			}
+			if dropped := sh.queue.clear(); dropped > 0 {
+				glog.Warningf("Dropped %d batches still queued for sink %s on stop", dropped, sh.sink.Name())
 			}
+			// Never stop the sink in the middle of an export.
+			sh.busy <- struct{}{}
+			sh.sink.Stop()
+			close(sh.stoppedChannel)
+			return
+		}
+	}
+}
+
+// exportQueued exports a batch taken from the queue of sh and counts it.
+// Once the manager stopped, or its drain timeout expired, the batch is
+// dropped instead.
+func (this *sinkManager) exportQueued(sh sinkHolder, data *core.EventBatch) {
+	err := this.drainContext().Err()
+	if err == nil {
+		err = this.exportWithin(sh, data)
+	}
+	if err != nil {
+		batchesDropped.WithLabelValues(sh.sink.Name()).Inc()
+		glog.Warningf("Dropped events for sink %s: %v", sh.sink.Name(), err)
+		return
+	}
+	batchesExported.WithLabelValues(sh.sink.Name()).Inc()
+}
+
+// exportWithin exports a queued batch in the background and waits for it no
+// longer than the export timeout of the sink, so that a sink ignoring the
+// cancellation of its exports can't block the queue. Until such an export
+// returns, the next batches wait for it up to the export timeout and are
+// dropped after, as when handing batches over to a busy sink.
+func (this *sinkManager) exportWithin(sh sinkHolder, data *core.EventBatch) error {
+	timer := time.NewTimer(sh.exportTimeout)
+	defer timer.Stop()
+	select {
+	case sh.busy <- struct{}{}:
+	case <-timer.C:
+		exportTimeouts.WithLabelValues(sh.sink.Name()).Inc()
+		err := fmt.Errorf("still exporting after its timeout of %v", sh.exportTimeout)
+		sh.status.recordResult(ExportDropped, err)
+		return err
+	case <-this.ctx.Done():
+		return this.ctx.Err()
+	}
+
+	// Whichever of the export and its timeout comes first is recorded.
+	var once sync.Once
+	record := func(err error) {
+		once.Do(func() { sh.recordExport(err) })
+	}
+	done := make(chan error, 1)
+	go func() {
+		defer func() { <-sh.busy }()
+		done <- this.exportLimited(sh, data, record)
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-timer.C:
+		// The batch was handed over to the sink, only late.
+		record(context.DeadlineExceeded)
+		return nil
+	}
+}
+
+// exportLimited exports the batch once the export limiter allows it, within
+// the export timeout of the sink, and passes the result to record. It fails
+// only if the manager stopped before.
+func (this *sinkManager) exportLimited(sh sinkHolder, data *core.EventBatch, record func(error)) error {
+	if err := this.ctx.Err(); err != nil {
+		return err
+	}
+	if err := this.limiter.acquire(this.ctx); err != nil {
+		return err
+	}
+	defer this.limiter.release()
+	ctx, cancel := context.WithTimeout(this.ctx, sh.exportTimeout)
+	defer cancel()
+	record(export(ctx, sh, data))
+	return nil
+}
+
+// drainContext returns the context bounding the export of the batches still
+// queued for stopped sinks.
+func (this *sinkManager) drainContext() context.Context {
+	this.lock.RLock()
+	defer this.lock.RUnlock()
+	return this.drainCtx
+}
+
+// holders returns the current sink holders.
+func (this *sinkManager) holders() []sinkHolder {
+	this.lock.RLock()
+	defer this.lock.RUnlock()
+	return this.sinkHolders
+}
+
+// SetSinks replaces the sinks exported to. Sinks already exported to keep
+// running untouched, new ones are started and the others are stopped once
+// their in-flight export, if any, is done.
+func (this *sinkManager) SetSinks(sinks []core.EventSink) {
+	this.lock.Lock()
+	removed := make(map[core.EventSink]sinkHolder, len(this.sinkHolders))
+	for _, sh := range this.sinkHolders {
+		removed[sh.sink] = sh
+	}
+	sinkHolders := make([]sinkHolder, 0, len(sinks))
+	for _, sink := range sinks {
+		if sh, ok := removed[sink]; ok {
+			delete(removed, sink)
+			sinkHolders = append(sinkHolders, sh)
+			continue
+		}
+		glog.Infof("Starting sink %s", sink.Name())
+		sinkHolders = append(sinkHolders, this.startSink(sink))
+	}
+	this.sinkHolders = sinkHolders
+	this.lock.Unlock()
+
+	for _, sh := range removed {
+		glog.Infof("Stopping sink %s", sh.sink.Name())
+		go func(sh sinkHolder) {
+			sh.stopChannel <- true
 		}(sh)
 	}
-	return &sinkManager{
-		sinkHolders:         sinkHolders,
-		exportEventsTimeout: exportEventsTimeout,
-		stopTimeout:         stopTimeout,
-	}, nil
 }
 
-// Guarantees that the export will complete in exportEventsTimeout.
+// Guarantees that the export will complete in the export timeout of the
+// slowest sink. With queues, returns as soon as the data is queued.
 func (this *sinkManager) ExportEvents(data *core.EventBatch) {
+	data = skipEmptyEvents(data)
+
+	if this.queueDepth > 0 {
+		for _, sh := range this.holders() {
+			if sh.queue.push(data) {
+				glog.Warningf("Queue of sink %s is full, dropped the %s batch", sh.sink.Name(), strings.TrimPrefix(this.dropPolicy, "drop_"))
+			}
+		}
+		return
+	}
+
 	var wg sync.WaitGroup
-	for _, sh := range this.sinkHolders {
+	for _, sh := range this.holders() {
 		wg.Add(1)
 		go func(sh sinkHolder, wg *sync.WaitGroup) {
 			defer wg.Done()
@@ -104,8 +484,10 @@ func (this *sinkManager) ExportEvents(data *core.EventBatch) {
 			case sh.eventBatchChannel <- data:
 				glog.V(2).Infof("Data events completed: %s", sh.sink.Name())
 				// everything ok
-			case <-time.After(this.exportEventsTimeout):
-				glog.Warningf("Failed to events data to sink: %s", sh.sink.Name())
+			case <-time.After(sh.exportTimeout):
+				exportTimeouts.WithLabelValues(sh.sink.Name()).Inc()
+				sh.status.recordResult(ExportDropped, fmt.Errorf("still exporting after its timeout of %v", sh.exportTimeout))
+				glog.Warningf("Failed to events data to sink: %s, still exporting after its timeout of %v", sh.sink.Name(), sh.exportTimeout)
 			}
 		}(sh, &wg)
 	}
@@ -117,8 +499,23 @@ func (this *sinkManager) Name() string {
 	return "Manager"
 }
 
+// Stop stops all sinks concurrently and waits for them, but no longer than
+// stopTimeout in total, so that a misbehaving sink can't hang the shutdown.
+// Queued data is exported for up to drainTimeout before the sinks stop.
+// Exports in progress, such as the final batch exported before Stop, run to
+// completion: they are only cancelled once stopTimeout expires.
 func (this *sinkManager) Stop() {
-	for _, sh := range this.sinkHolders {
+	defer this.cancel()
+	drainCtx, cancelDrain := context.WithTimeout(this.ctx, this.drainTimeout)
+	defer cancelDrain()
+	this.lock.Lock()
+	this.drainCtx = drainCtx
+	this.lock.Unlock()
+
+	deadline, cancel := context.WithTimeout(context.Background(), this.stopTimeout)
+	defer cancel()
+	sinkHolders := this.holders()
+	for _, sh := range sinkHolders {
 		glog.V(2).Infof("Running stop for: %s", sh.sink.Name())
 
 		go func(sh sinkHolder) {
@@ -127,20 +524,97 @@ func (this *sinkManager) Stop() {
 				// everything ok
 				glog.V(2).Infof("Stop sent to sink: %s", sh.sink.Name())
 
-			case <-time.After(this.stopTimeout):
+			case <-deadline.Done():
 				glog.Warningf("Failed to stop sink: %s", sh.sink.Name())
 			}
 			return
 		}(sh)
 	}
+
+	for _, sh := range sinkHolders {
+		select {
+		case <-sh.stoppedChannel:
+		case <-deadline.Done():
+			glog.Warningf("Sink %s did not stop within %v", sh.sink.Name(), this.stopTimeout)
+		}
+	}
+}
+
+// skipEmptyEvents drops events with neither a reason nor a message, such as
+// controller housekeeping events, so that no sink has to deal with them. The
+// skipped events are counted rather than logged one by one.
+func skipEmptyEvents(data *core.EventBatch) *core.EventBatch {
+	skipped := 0
+	for _, event := range data.Events {
+		if isEmptyEvent(event) {
+			skipped++
+		}
+	}
+	if skipped == 0 {
+		return data
+	}
+
+	filtered := &core.EventBatch{
+		Timestamp: data.Timestamp,
+		Events:    make([]*kube_api.Event, 0, len(data.Events)-skipped),
+	}
+	for _, event := range data.Events {
+		if !isEmptyEvent(event) {
+			filtered.Events = append(filtered.Events, event)
+		}
+	}
+	emptyEventsSkipped.Add(float64(skipped))
+	glog.V(4).Infof("Skipped %d events without reason and message", skipped)
+	return filtered
+}
+
+func isEmptyEvent(event *kube_api.Event) bool {
+	return strings.TrimSpace(event.Reason) == "" && strings.TrimSpace(event.Message) == ""
 }
 
-func export(s core.EventSink, data *core.EventBatch) {
+// export exports the batch to the sink of sh. A panicking sink is counted
+// and logged rather than bringing the eventer down.
+func export(ctx context.Context, sh sinkHolder, data *core.EventBatch) error {
+	s := sh.sink
 	startTime := time.Now()
+	exportsTotal.WithLabelValues(s.Name()).Inc()
 	defer func() {
+		elapsed := time.Since(startTime)
 		exporterDuration.
 			WithLabelValues(s.Name()).
-			Observe(float64(time.Since(startTime)) / float64(time.Millisecond))
+			Observe(float64(elapsed) / float64(time.Millisecond))
+		exportLatency.WithLabelValues(s.Name()).Observe(elapsed.Seconds())
+	}()
+	ctx, span := tracing.StartSpan(ctx, "sink.export")
+	span.SetAttribute("sink", s.Name())
+	span.SetAttribute("events", len(data.Events))
+	err := exportRecovered(ctx, s, data)
+	span.Finish(err)
+	return err
+}
+
+// recordExport records the result of an export to the sink of sh.
+func (sh sinkHolder) recordExport(err error) {
+	s := sh.sink
+	sh.status.record(err)
+	switch {
+	case err == context.DeadlineExceeded:
+		exportTimeouts.WithLabelValues(s.Name()).Inc()
+		glog.Warningf("Failed to export events to sink %s within its timeout of %v", s.Name(), sh.exportTimeout)
+	case err != nil:
+		glog.Warningf("Failed to export events to sink %s: %v", s.Name(), err)
+	default:
+		lastSuccessfulExport.WithLabelValues(s.Name()).Set(float64(time.Now().Unix()))
+	}
+}
+
+func exportRecovered(ctx context.Context, s core.EventSink, data *core.EventBatch) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			exportPanics.WithLabelValues(s.Name()).Inc()
+			glog.Errorf("Sink %s panicked exporting events: %v\n%s", s.Name(), r, debug.Stack())
+			err = fmt.Errorf("panic: %v", r)
+		}
 	}()
-	s.ExportEvents(data)
+	return core.ExportEventsContext(ctx, s, data)
 }
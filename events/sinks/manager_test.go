@@ -15,9 +15,11 @@
 package sinks
 
 import (
+	"context"
 	"testing"
 	"time"
 
+	dto "github.com/prometheus/client_model/go"
 	"github.com/stretchr/testify/assert"
 	kube_api "k8s.io/api/core/v1"
 
@@ -45,7 +47,7 @@ func TestAllExportsInTime(t *testing.T) {
 
 	sink1 := util.NewDummySink("s1", time.Second)
 	sink2 := util.NewDummySink("s2", time.Second)
-	manager, _ := NewEventSinkManager([]core.EventSink{sink1, sink2}, timeout, timeout)
+	manager, _ := NewEventSinkManager([]core.EventSink{sink1, sink2}, timeout, timeout, 0)
 
 	elapsed := doThreeBatches(manager)
 	if elapsed > 2*timeout+2*time.Second {
@@ -61,7 +63,7 @@ func TestOneExportInTime(t *testing.T) {
 
 	sink1 := util.NewDummySink("s1", time.Second)
 	sink2 := util.NewDummySink("s2", 30*time.Second)
-	manager, _ := NewEventSinkManager([]core.EventSink{sink1, sink2}, timeout, timeout)
+	manager, _ := NewEventSinkManager([]core.EventSink{sink1, sink2}, timeout, timeout, 0)
 
 	elapsed := doThreeBatches(manager)
 	if elapsed > 2*timeout+2*time.Second {
@@ -80,7 +82,7 @@ func TestNoExportInTime(t *testing.T) {
 
 	sink1 := util.NewDummySink("s1", 30*time.Second)
 	sink2 := util.NewDummySink("s2", 30*time.Second)
-	manager, _ := NewEventSinkManager([]core.EventSink{sink1, sink2}, timeout, timeout)
+	manager, _ := NewEventSinkManager([]core.EventSink{sink1, sink2}, timeout, timeout, 0)
 
 	elapsed := doThreeBatches(manager)
 	if elapsed > 2*timeout+2*time.Second {
@@ -99,16 +101,382 @@ func TestStop(t *testing.T) {
 
 	sink1 := util.NewDummySink("s1", 30*time.Second)
 	sink2 := util.NewDummySink("s2", 30*time.Second)
-	manager, _ := NewEventSinkManager([]core.EventSink{sink1, sink2}, timeout, timeout)
+	manager, _ := NewEventSinkManager([]core.EventSink{sink1, sink2}, timeout, timeout, 0)
 
+	// Stop waits for the slow sinks, but no longer than the stop timeout.
 	now := time.Now()
 	manager.Stop()
 	elapsed := time.Now().Sub(now)
-	if elapsed > time.Second {
+	if elapsed > timeout+time.Second {
 		t.Fatalf("stop too long: %s", elapsed)
 	}
-	time.Sleep(time.Second)
+	if elapsed < timeout-time.Second {
+		t.Fatalf("stop too short: %s", elapsed)
+	}
 
 	assert.Equal(t, true, sink1.IsStopped())
 	assert.Equal(t, true, sink2.IsStopped())
 }
+
+func TestStopWaitsForSinks(t *testing.T) {
+	timeout := 3 * time.Second
+
+	sink1 := util.NewDummySink("s1", 100*time.Millisecond)
+	sink2 := util.NewDummySink("s2", 200*time.Millisecond)
+	manager, _ := NewEventSinkManager([]core.EventSink{sink1, sink2}, timeout, timeout, 0)
+
+	now := time.Now()
+	manager.Stop()
+	elapsed := time.Now().Sub(now)
+	if elapsed > time.Second {
+		t.Fatalf("stop too long: %s", elapsed)
+	}
+	if elapsed < 200*time.Millisecond {
+		t.Fatalf("stop returned before the sinks stopped: %s", elapsed)
+	}
+}
+
+func TestExportLimiter(t *testing.T) {
+	limiter := newExportLimiter(2)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	assert.NoError(t, limiter.acquire(ctx))
+	assert.NoError(t, limiter.acquire(ctx))
+
+	acquired := make(chan error)
+	go func() { acquired <- limiter.acquire(ctx) }()
+	select {
+	case <-acquired:
+		t.Fatal("acquired a slot over the limit")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	limiter.release()
+	assert.NoError(t, <-acquired)
+
+	go func() { acquired <- limiter.acquire(ctx) }()
+	cancel()
+	assert.Equal(t, context.Canceled, <-acquired)
+
+	limiter.release()
+	limiter.release()
+	assert.Nil(t, newExportLimiter(0))
+	assert.NoError(t, newExportLimiter(0).acquire(ctx))
+	newExportLimiter(0).release()
+}
+
+func TestSkipEmptyEvents(t *testing.T) {
+	now := time.Now()
+	kept := &kube_api.Event{Reason: "BackOff"}
+	messageOnly := &kube_api.Event{Message: "something happened"}
+	batch := &core.EventBatch{
+		Timestamp: now,
+		Events: []*kube_api.Event{
+			kept,
+			{},
+			{Reason: " ", Message: "\t\n"},
+			messageOnly,
+		},
+	}
+
+	filtered := skipEmptyEvents(batch)
+	assert.Equal(t, now, filtered.Timestamp)
+	assert.Equal(t, []*kube_api.Event{kept, messageOnly}, filtered.Events)
+	// The original batch is left untouched.
+	assert.Len(t, batch.Events, 4)
+
+	clean := &core.EventBatch{Events: []*kube_api.Event{kept}}
+	assert.True(t, clean == skipEmptyEvents(clean))
+}
+
+// panickingSink panics on every export.
+type panickingSink struct {
+	fakeSink
+}
+
+func (s *panickingSink) ExportEventsWithError(batch *core.EventBatch) error {
+	panic("boom")
+}
+
+func TestPerSinkMetrics(t *testing.T) {
+	fast := &fakeSink{name: "metrics-fast"}
+	slow := util.NewDummySink("metrics-slow", 2*time.Second)
+	panicking := &panickingSink{fakeSink{name: "metrics-panicking"}}
+	manager, _ := NewEventSinkManager([]core.EventSink{fast, slow, panicking}, 200*time.Millisecond, time.Second, 0)
+	defer manager.Stop()
+
+	doThreeBatches(manager)
+	// Exports run asynchronously after the batch was handed over.
+	deadline := time.Now().Add(5 * time.Second)
+	for metricValue(t, exportPanics.WithLabelValues("metrics-panicking")) < 3 ||
+		metricValue(t, exportsTotal.WithLabelValues("metrics-fast")) < 3 {
+		if time.Now().After(deadline) {
+			t.Fatal("exports didn't complete in time")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// The panics didn't stop the manager from exporting the later batches.
+	assert.Equal(t, float64(3), metricValue(t, exportsTotal.WithLabelValues("metrics-panicking")))
+	assert.Equal(t, float64(3), metricValue(t, exportPanics.WithLabelValues("metrics-panicking")))
+	assert.Equal(t, float64(0), metricValue(t, lastSuccessfulExport.WithLabelValues("metrics-panicking")))
+
+	assert.Equal(t, float64(0), metricValue(t, exportTimeouts.WithLabelValues("metrics-fast")))
+	assert.InDelta(t, float64(time.Now().Unix()), metricValue(t, lastSuccessfulExport.WithLabelValues("metrics-fast")), 10)
+	var latency dto.Metric
+	assert.NoError(t, exportLatency.WithLabelValues("metrics-fast").Write(&latency))
+	assert.Equal(t, uint64(3), latency.Histogram.GetSampleCount())
+
+	// The slow sink was still busy with the first batch when the others came.
+	assert.Equal(t, float64(1), metricValue(t, exportsTotal.WithLabelValues("metrics-slow")))
+	assert.Equal(t, float64(2), metricValue(t, exportTimeouts.WithLabelValues("metrics-slow")))
+}
+
+// gatedSink blocks its exports until gate is closed. started receives each
+// batch as its export begins.
+type gatedSink struct {
+	fakeSink
+	gate    chan struct{}
+	started chan *core.EventBatch
+}
+
+func newGatedSink(name string) *gatedSink {
+	return &gatedSink{
+		fakeSink: fakeSink{name: name},
+		gate:     make(chan struct{}),
+		started:  make(chan *core.EventBatch, 10),
+	}
+}
+
+func (s *gatedSink) ExportEventsWithError(batch *core.EventBatch) error {
+	s.started <- batch
+	<-s.gate
+	return s.fakeSink.ExportEventsWithError(batch)
+}
+
+func TestQueueDropPolicies(t *testing.T) {
+	tests := []struct {
+		policy   string
+		exported []int
+		enqueued float64
+	}{
+		{policy: DropOldest, exported: []int{0, 2, 3}, enqueued: 4},
+		{policy: DropNewest, exported: []int{0, 1, 2}, enqueued: 3},
+	}
+	for _, tc := range tests {
+		name := "queue-" + tc.policy
+		sink := newGatedSink(name)
+		manager, err := NewEventSinkManagerWithOptions([]core.EventSink{sink}, SinkManagerOptions{
+			ExportTimeout: time.Second,
+			StopTimeout:   5 * time.Second,
+			QueueDepth:    2,
+			DropPolicy:    tc.policy,
+			DrainTimeout:  5 * time.Second,
+		})
+		assert.NoError(t, err)
+
+		batches := make([]*core.EventBatch, 4)
+		for i := range batches {
+			batches[i] = &core.EventBatch{Timestamp: time.Unix(int64(i), 0)}
+		}
+		// The first batch keeps the sink busy, the others pile up behind it.
+		start := time.Now()
+		manager.ExportEvents(batches[0])
+		<-sink.started
+		for _, batch := range batches[1:] {
+			manager.ExportEvents(batch)
+		}
+		assert.True(t, time.Since(start) < time.Second, "%s: export blocked on the slow sink", tc.policy)
+		assert.Equal(t, float64(1), metricValue(t, batchesDropped.WithLabelValues(name)), tc.policy)
+		assert.Equal(t, float64(2), metricValue(t, queuedBatches.WithLabelValues(name)), tc.policy)
+
+		close(sink.gate)
+		manager.Stop()
+
+		var want []*core.EventBatch
+		for _, i := range tc.exported {
+			want = append(want, batches[i])
+		}
+		assert.Equal(t, want, sink.exported(), tc.policy)
+		assert.True(t, sink.isStopped(), tc.policy)
+		assert.Equal(t, tc.enqueued, metricValue(t, batchesEnqueued.WithLabelValues(name)), tc.policy)
+		assert.Equal(t, float64(3), metricValue(t, batchesExported.WithLabelValues(name)), tc.policy)
+		assert.Equal(t, float64(1), metricValue(t, batchesDropped.WithLabelValues(name)), tc.policy)
+		assert.Equal(t, float64(0), metricValue(t, queuedBatches.WithLabelValues(name)), tc.policy)
+	}
+}
+
+func TestQueueDrainTimeout(t *testing.T) {
+	sink := newGatedSink("queue-drain")
+	manager, _ := NewEventSinkManagerWithOptions([]core.EventSink{sink}, SinkManagerOptions{
+		ExportTimeout: time.Second,
+		StopTimeout:   5 * time.Second,
+		QueueDepth:    10,
+		DrainTimeout:  100 * time.Millisecond,
+	})
+
+	first := &core.EventBatch{}
+	manager.ExportEvents(first)
+	<-sink.started
+	manager.ExportEvents(&core.EventBatch{})
+	manager.ExportEvents(&core.EventBatch{})
+
+	// The sink is still busy when the drain timeout expires.
+	time.AfterFunc(300*time.Millisecond, func() { close(sink.gate) })
+	manager.Stop()
+
+	assert.Equal(t, []*core.EventBatch{first}, sink.exported())
+	assert.True(t, sink.isStopped())
+	assert.Equal(t, float64(1), metricValue(t, batchesExported.WithLabelValues("queue-drain")))
+	assert.Equal(t, float64(2), metricValue(t, batchesDropped.WithLabelValues("queue-drain")))
+}
+
+func TestQueueExportTimeout(t *testing.T) {
+	// The hung sink ignores the cancellation of its exports, the other one
+	// honors it.
+	hung := newGatedSink("queue-hung")
+	blocking := &blockingSink{fakeSink{name: "queue-blocking"}}
+	manager, _ := NewEventSinkManagerWithOptions([]core.EventSink{hung, blocking}, SinkManagerOptions{
+		ExportTimeout: 100 * time.Millisecond,
+		StopTimeout:   5 * time.Second,
+		QueueDepth:    10,
+		DrainTimeout:  5 * time.Second,
+	})
+
+	first := &core.EventBatch{}
+	manager.ExportEvents(first)
+	<-hung.started
+	manager.ExportEvents(&core.EventBatch{})
+	manager.ExportEvents(&core.EventBatch{})
+	time.Sleep(time.Second)
+
+	// The batches queued behind the hung export are dropped once they
+	// waited for it for the export timeout.
+	assert.Equal(t, float64(3), metricValue(t, exportTimeouts.WithLabelValues("queue-hung")))
+	assert.Equal(t, float64(2), metricValue(t, batchesDropped.WithLabelValues("queue-hung")))
+	assert.Equal(t, float64(3), metricValue(t, exportTimeouts.WithLabelValues("queue-blocking")))
+	assert.Equal(t, float64(3), metricValue(t, batchesExported.WithLabelValues("queue-blocking")))
+	statuses := manager.(SinkStatusReporter).SinkStatuses()
+	assert.Equal(t, ExportDropped, statuses[0].LastExportResult)
+	assert.Equal(t, 3, statuses[0].ConsecutiveFailures)
+	assert.Equal(t, ExportTimedOut, statuses[1].LastExportResult)
+	assert.Equal(t, 3, statuses[1].ConsecutiveFailures)
+
+	close(hung.gate)
+	manager.Stop()
+	assert.Equal(t, []*core.EventBatch{first}, hung.exported())
+	assert.True(t, hung.isStopped())
+	assert.True(t, blocking.isStopped())
+}
+
+func TestContextAbortsExports(t *testing.T) {
+	sink := newGatedSink("queue-cancel")
+	ctx, cancel := context.WithCancel(context.Background())
+	manager, _ := NewEventSinkManagerWithOptions([]core.EventSink{sink}, SinkManagerOptions{
+		ExportTimeout: time.Second,
+		StopTimeout:   5 * time.Second,
+		QueueDepth:    10,
+		DrainTimeout:  5 * time.Second,
+		Context:       ctx,
+	})
+
+	first := &core.EventBatch{}
+	manager.ExportEvents(first)
+	<-sink.started
+	manager.ExportEvents(&core.EventBatch{})
+	cancel()
+	close(sink.gate)
+	manager.ExportEvents(&core.EventBatch{})
+	manager.Stop()
+
+	// Only the export in progress when cancelled completed.
+	assert.Equal(t, []*core.EventBatch{first}, sink.exported())
+	assert.True(t, sink.isStopped())
+	assert.Equal(t, float64(2), metricValue(t, batchesDropped.WithLabelValues("queue-cancel")))
+}
+
+// slowContextSink takes delay to export, unless its context is done first.
+// started receives each batch as its export begins.
+type slowContextSink struct {
+	fakeSink
+	delay   time.Duration
+	started chan *core.EventBatch
+}
+
+func (s *slowContextSink) ExportEventsContext(ctx context.Context, batch *core.EventBatch) error {
+	s.started <- batch
+	select {
+	case <-time.After(s.delay):
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return s.fakeSink.ExportEventsWithError(batch)
+}
+
+func TestStopCompletesLastExport(t *testing.T) {
+	for _, options := range []SinkManagerOptions{
+		{ExportTimeout: time.Second, StopTimeout: 5 * time.Second},
+		{ExportTimeout: time.Second, StopTimeout: 5 * time.Second, QueueDepth: 10},
+	} {
+		sink := &slowContextSink{fakeSink{name: "last-export"}, 200 * time.Millisecond, make(chan *core.EventBatch, 1)}
+		manager, _ := NewEventSinkManagerWithOptions([]core.EventSink{sink}, options)
+
+		// The final batch is being exported when the manager stops.
+		last := &core.EventBatch{}
+		manager.ExportEvents(last)
+		<-sink.started
+		manager.Stop()
+		assert.Equal(t, []*core.EventBatch{last}, sink.exported(), "queue depth %d", options.QueueDepth)
+		assert.True(t, sink.isStopped(), "queue depth %d", options.QueueDepth)
+	}
+}
+
+func TestInvalidDropPolicy(t *testing.T) {
+	_, err := NewEventSinkManagerWithOptions(nil, SinkManagerOptions{QueueDepth: 1, DropPolicy: "drop_random"})
+	assert.Error(t, err)
+}
+
+// slowStopSink takes stopDelay to stop.
+type slowStopSink struct {
+	fakeSink
+	stopDelay time.Duration
+}
+
+func (s *slowStopSink) Stop() {
+	time.Sleep(s.stopDelay)
+	s.fakeSink.Stop()
+}
+
+func TestStopDeadline(t *testing.T) {
+	slow := &slowStopSink{fakeSink{name: "slow-stop"}, 30 * time.Second}
+	fast := []*fakeSink{{name: "fast-1"}, {name: "fast-2"}, {name: "fast-3"}}
+	sinkList := []core.EventSink{slow}
+	for _, sink := range fast {
+		sinkList = append(sinkList, sink)
+	}
+	manager, _ := NewEventSinkManagerWithOptions(sinkList, SinkManagerOptions{
+		ExportTimeout: time.Second,
+		StopTimeout:   500 * time.Millisecond,
+		QueueDepth:    DefaultSinkQueueDepth,
+		DrainTimeout:  200 * time.Millisecond,
+	})
+	manager.ExportEvents(&core.EventBatch{})
+
+	// The slow sink doesn't hold up the shutdown past the stop timeout.
+	now := time.Now()
+	manager.Stop()
+	elapsed := time.Since(now)
+	if elapsed > 2*time.Second {
+		t.Fatalf("stop too long: %s", elapsed)
+	}
+	if elapsed < 400*time.Millisecond {
+		t.Fatalf("stop returned before its timeout: %s", elapsed)
+	}
+
+	// The fast sinks were all flushed and stopped meanwhile.
+	for _, sink := range fast {
+		assert.Len(t, sink.exported(), 1, sink.name)
+		assert.True(t, sink.isStopped(), sink.name)
+	}
+	assert.False(t, slow.isStopped())
+}
@@ -0,0 +1,115 @@
+// Copyright 2018 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sinks
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/golang/glog"
+	"k8s.io/heapster/events/core"
+)
+
+// maxBatchSink splits batches into chunks of at most maxBatch events, which
+// are exported one after another, in order, to the wrapped sink. An optional
+// delay is waited between chunks. A failed chunk doesn't stop the remaining
+// ones from being exported.
+//
+// Usage:
+// --sink=maxbatch:elasticsearch:http://es:9200?maxbatch=500&delay=200ms
+type maxBatchSink struct {
+	sink     core.EventSink
+	maxBatch int
+	delay    time.Duration
+}
+
+func (this *SinkFactory) buildMaxBatchSink(val *url.URL) (core.EventSink, error) {
+	child, opts, err := splitWrappedUri(val, "maxbatch", "delay")
+	if err != nil {
+		return nil, err
+	}
+
+	if len(opts["maxbatch"]) == 0 {
+		return nil, fmt.Errorf("maxbatch sink needs a maxbatch")
+	}
+	maxBatch, err := strconv.Atoi(opts["maxbatch"][0])
+	if err != nil || maxBatch <= 0 {
+		return nil, fmt.Errorf("maxbatch must be a positive integer, got %q", opts["maxbatch"][0])
+	}
+	var delay time.Duration
+	if len(opts["delay"]) >= 1 {
+		if delay, err = time.ParseDuration(opts["delay"][0]); err != nil || delay < 0 {
+			return nil, fmt.Errorf("delay must be a non-negative duration, got %q", opts["delay"][0])
+		}
+	}
+
+	sink, err := this.Build(child)
+	if err != nil {
+		return nil, err
+	}
+	return &maxBatchSink{sink: sink, maxBatch: maxBatch, delay: delay}, nil
+}
+
+func (this *maxBatchSink) Name() string {
+	return this.sink.Name()
+}
+
+func (this *maxBatchSink) Stop() {
+	this.sink.Stop()
+}
+
+func (this *maxBatchSink) WrappedSinks() []core.EventSink {
+	return []core.EventSink{this.sink}
+}
+
+func (this *maxBatchSink) ExportEvents(batch *core.EventBatch) {
+	if err := this.ExportEventsWithError(batch); err != nil {
+		glog.Warningf("Failed to export events to %s: %v", this.sink.Name(), err)
+	}
+}
+
+func (this *maxBatchSink) ExportEventsWithError(batch *core.EventBatch) error {
+	return this.ExportEventsContext(context.Background(), batch)
+}
+
+// ExportEventsContext returns the first error of a chunk, or the context's
+// error if it is done while waiting between chunks.
+func (this *maxBatchSink) ExportEventsContext(ctx context.Context, batch *core.EventBatch) error {
+	var firstErr error
+	for start := 0; start < len(batch.Events); start += this.maxBatch {
+		if start > 0 && this.delay > 0 {
+			select {
+			case <-time.After(this.delay):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		end := start + this.maxBatch
+		if end > len(batch.Events) {
+			end = len(batch.Events)
+		}
+		chunk := &core.EventBatch{
+			Timestamp: batch.Timestamp,
+			Events:    batch.Events[start:end],
+		}
+		if err := core.ExportEventsContext(ctx, this.sink, chunk); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
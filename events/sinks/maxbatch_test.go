@@ -0,0 +1,88 @@
+// Copyright 2018 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sinks
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	kube_api "k8s.io/api/core/v1"
+	"k8s.io/heapster/common/flags"
+	"k8s.io/heapster/events/core"
+)
+
+func makeEventBatch(n int) *core.EventBatch {
+	batch := &core.EventBatch{Timestamp: time.Now()}
+	for i := 0; i < n; i++ {
+		batch.Events = append(batch.Events, &kube_api.Event{Reason: fmt.Sprintf("reason-%d", i)})
+	}
+	return batch
+}
+
+func TestMaxBatchSplitsInOrder(t *testing.T) {
+	child := &fakeSink{name: "fake"}
+	sink := &maxBatchSink{sink: child, maxBatch: 2}
+	batch := makeEventBatch(5)
+
+	assert.NoError(t, sink.ExportEventsWithError(batch))
+
+	chunks := child.exported()
+	assert.Len(t, chunks, 3)
+	var events []*kube_api.Event
+	for _, chunk := range chunks {
+		assert.True(t, len(chunk.Events) <= 2)
+		assert.Equal(t, batch.Timestamp, chunk.Timestamp)
+		events = append(events, chunk.Events...)
+	}
+	assert.Equal(t, batch.Events, events)
+}
+
+func TestMaxBatchContinuesAfterFailedChunk(t *testing.T) {
+	child := &fakeSink{name: "fake"}
+	child.setErr(fmt.Errorf("unavailable"))
+	sink := &maxBatchSink{sink: child, maxBatch: 2}
+
+	assert.Error(t, sink.ExportEventsWithError(makeEventBatch(4)))
+	assert.Len(t, child.exported(), 2)
+}
+
+func TestMaxBatchDelayCancelled(t *testing.T) {
+	child := &fakeSink{name: "fake"}
+	sink := &maxBatchSink{sink: child, maxBatch: 1, delay: time.Hour}
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+
+	assert.Equal(t, context.Canceled, sink.ExportEventsContext(ctx, makeEventBatch(3)))
+	assert.Len(t, child.exported(), 1)
+}
+
+func TestBuildMaxBatchSink(t *testing.T) {
+	factory := NewSinkFactory()
+	var uri flags.Uri
+
+	assert.NoError(t, uri.Set("maxbatch:log:?maxbatch=100&delay=50ms"))
+	sink, err := factory.Build(uri)
+	assert.NoError(t, err)
+	assert.Equal(t, &maxBatchSink{sink: sink.(*maxBatchSink).sink, maxBatch: 100, delay: 50 * time.Millisecond}, sink)
+
+	for _, value := range []string{"maxbatch:log", "maxbatch:log:?maxbatch=0", "maxbatch:log:?maxbatch=10&delay=soon"} {
+		assert.NoError(t, uri.Set(value))
+		_, err := factory.Build(uri)
+		assert.Error(t, err, value)
+	}
+}
@@ -0,0 +1,110 @@
+// Copyright 2018 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package memory
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"sync"
+
+	kube_api "k8s.io/api/core/v1"
+	"k8s.io/heapster/events/core"
+)
+
+const (
+	MEMORY_SINK = "MemorySink"
+	// DEFAULT_CAPACITY is the default number of events retained.
+	DEFAULT_CAPACITY = 10000
+)
+
+// registry holds the memory sinks built with a name, so that tests can get
+// hold of sinks that were built from a uri, possibly inside wrapper sinks.
+var registry = struct {
+	sync.Mutex
+	sinks map[string]*MemorySink
+}{sinks: make(map[string]*MemorySink)}
+
+/*
+memory sink usage
+--sink=memory:?name=e2e&capacity=1000
+
+The memory sink keeps the exported events in memory so that tests can check
+what the pipeline delivered. It is not meant for production use.
+name: optional, registers the sink so that it can be found with Lookup.
+capacity: the number of events retained, the oldest are dropped first. 10000 by default.
+*/
+type MemorySink struct {
+	sync.Mutex
+	capacity int
+	events   []*kube_api.Event
+}
+
+func NewMemorySink(uri *url.URL) (*MemorySink, error) {
+	m := &MemorySink{capacity: DEFAULT_CAPACITY}
+	opts := uri.Query()
+	if len(opts["capacity"]) >= 1 {
+		capacity, err := strconv.Atoi(opts["capacity"][0])
+		if err != nil || capacity <= 0 {
+			return nil, fmt.Errorf("capacity must be a positive integer, got %q", opts["capacity"][0])
+		}
+		m.capacity = capacity
+	}
+	if len(opts["name"]) >= 1 && opts["name"][0] != "" {
+		registry.Lock()
+		registry.sinks[opts["name"][0]] = m
+		registry.Unlock()
+	}
+	return m, nil
+}
+
+// Lookup returns the last memory sink built with the given name, or nil.
+func Lookup(name string) *MemorySink {
+	registry.Lock()
+	defer registry.Unlock()
+	return registry.sinks[name]
+}
+
+func (m *MemorySink) Name() string {
+	return MEMORY_SINK
+}
+
+func (m *MemorySink) Stop() {
+	// nothing needs to be done.
+}
+
+func (m *MemorySink) ExportEvents(batch *core.EventBatch) {
+	m.Lock()
+	defer m.Unlock()
+	m.events = append(m.events, batch.Events...)
+	if overflow := len(m.events) - m.capacity; overflow > 0 {
+		// Copied so the dropped events can be garbage collected.
+		m.events = append([]*kube_api.Event(nil), m.events[overflow:]...)
+	}
+}
+
+// Events returns a copy of the retained events, oldest first.
+func (m *MemorySink) Events() []*kube_api.Event {
+	m.Lock()
+	defer m.Unlock()
+	return append([]*kube_api.Event(nil), m.events...)
+}
+
+// Reset drops all retained events.
+func (m *MemorySink) Reset() {
+	m.Lock()
+	defer m.Unlock()
+	m.events = nil
+}
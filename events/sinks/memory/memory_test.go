@@ -0,0 +1,67 @@
+// Copyright 2018 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package memory
+
+import (
+	"fmt"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	kube_api "k8s.io/api/core/v1"
+	"k8s.io/heapster/events/core"
+)
+
+func makeEvents(from, to int) []*kube_api.Event {
+	var events []*kube_api.Event
+	for i := from; i < to; i++ {
+		events = append(events, &kube_api.Event{Reason: fmt.Sprintf("reason-%d", i)})
+	}
+	return events
+}
+
+func TestMemorySinkCapacity(t *testing.T) {
+	uri, _ := url.Parse("memory:?capacity=3")
+	sink, err := NewMemorySink(uri)
+	assert.NoError(t, err)
+
+	sink.ExportEvents(&core.EventBatch{Events: makeEvents(0, 2)})
+	assert.Equal(t, makeEvents(0, 2), sink.Events())
+
+	sink.ExportEvents(&core.EventBatch{Events: makeEvents(2, 5)})
+	assert.Equal(t, makeEvents(2, 5), sink.Events())
+
+	sink.Reset()
+	assert.Len(t, sink.Events(), 0)
+}
+
+func TestNewMemorySink(t *testing.T) {
+	sink, err := NewMemorySink(&url.URL{})
+	assert.NoError(t, err)
+	assert.Equal(t, DEFAULT_CAPACITY, sink.capacity)
+
+	uri, _ := url.Parse("memory:?capacity=0")
+	_, err = NewMemorySink(uri)
+	assert.Error(t, err)
+}
+
+func TestLookup(t *testing.T) {
+	uri, _ := url.Parse("memory:?name=lookup-test")
+	sink, err := NewMemorySink(uri)
+	assert.NoError(t, err)
+
+	assert.True(t, sink == Lookup("lookup-test"))
+	assert.Nil(t, Lookup("unknown"))
+}
@@ -0,0 +1,83 @@
+// Copyright 2018 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sinks
+
+import (
+	"context"
+	"net/url"
+
+	kube_api "k8s.io/api/core/v1"
+	"k8s.io/heapster/events/core"
+)
+
+// minLevelOption may be given to any sink to only export events of at least
+// the given level, e.g. --sink=elasticsearch:http://es:9200?minlevel=Warning.
+const minLevelOption = "minlevel"
+
+// minLevelSink forwards only events of at least the given level.
+type minLevelSink struct {
+	sink  core.EventSink
+	level int
+}
+
+// withMinLevel wraps the sink if the uri has the minlevel option.
+func withMinLevel(sink core.EventSink, val *url.URL) (core.EventSink, error) {
+	opts := val.Query()
+	if len(opts[minLevelOption]) == 0 {
+		return sink, nil
+	}
+	level, err := core.ParseLevel(opts[minLevelOption][0])
+	if err != nil {
+		return nil, err
+	}
+	return &minLevelSink{sink: sink, level: level}, nil
+}
+
+func (this *minLevelSink) Name() string {
+	return this.sink.Name()
+}
+
+func (this *minLevelSink) Stop() {
+	this.sink.Stop()
+}
+
+func (this *minLevelSink) WrappedSinks() []core.EventSink {
+	return []core.EventSink{this.sink}
+}
+
+func (this *minLevelSink) ExportEvents(batch *core.EventBatch) {
+	this.sink.ExportEvents(this.filter(batch))
+}
+
+func (this *minLevelSink) ExportEventsWithError(batch *core.EventBatch) error {
+	return core.ExportEvents(this.sink, this.filter(batch))
+}
+
+func (this *minLevelSink) ExportEventsContext(ctx context.Context, batch *core.EventBatch) error {
+	return core.ExportEventsContext(ctx, this.sink, this.filter(batch))
+}
+
+func (this *minLevelSink) filter(batch *core.EventBatch) *core.EventBatch {
+	filtered := &core.EventBatch{
+		Timestamp: batch.Timestamp,
+		Events:    make([]*kube_api.Event, 0, len(batch.Events)),
+	}
+	for _, event := range batch.Events {
+		if core.IsLevelAtLeast(event.Type, this.level) {
+			filtered.Events = append(filtered.Events, event)
+		}
+	}
+	return filtered
+}
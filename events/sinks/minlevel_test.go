@@ -0,0 +1,57 @@
+// Copyright 2018 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sinks
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	kube_api "k8s.io/api/core/v1"
+	"k8s.io/heapster/common/flags"
+	"k8s.io/heapster/events/core"
+)
+
+func TestMinLevelFiltersEvents(t *testing.T) {
+	child := &fakeSink{name: "fake"}
+	sink := &minLevelSink{sink: child, level: core.LevelWarning}
+
+	warning := &kube_api.Event{Type: kube_api.EventTypeWarning, Reason: "BackOff"}
+	normal := &kube_api.Event{Type: kube_api.EventTypeNormal, Reason: "Pulled"}
+	assert.NoError(t, sink.ExportEventsWithError(&core.EventBatch{Events: []*kube_api.Event{warning, normal}}))
+
+	assert.Equal(t, []*kube_api.Event{warning}, child.exported()[0].Events)
+}
+
+func TestBuildWithMinLevel(t *testing.T) {
+	factory := NewSinkFactory()
+	var uri flags.Uri
+
+	assert.NoError(t, uri.Set("log:?minlevel=Warning"))
+	sink, err := factory.Build(uri)
+	assert.NoError(t, err)
+	assert.Equal(t, core.LevelWarning, sink.(*minLevelSink).level)
+
+	// A wrapper applies minlevel as a whole rather than passing it on.
+	assert.NoError(t, uri.Set("sample:log:?rate=0.5&minlevel=Normal"))
+	sink, err = factory.Build(uri)
+	assert.NoError(t, err)
+	sampled := sink.(*minLevelSink).sink.(*sampleSink)
+	_, wrapped := sampled.sink.(*minLevelSink)
+	assert.False(t, wrapped)
+
+	assert.NoError(t, uri.Set("log:?minlevel=Critical"))
+	_, err = factory.Build(uri)
+	assert.Error(t, err)
+}
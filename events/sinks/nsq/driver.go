@@ -0,0 +1,146 @@
+// Copyright 2018 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nsq
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sync"
+
+	"github.com/golang/glog"
+	nsq "github.com/nsqio/go-nsq"
+	"k8s.io/heapster/events/core"
+)
+
+const (
+	defaultTopic = "heapster-events"
+
+	// Every event is published as a message of its own.
+	ModeEvent = "event"
+	// Every batch is published as a single message holding a list of events.
+	ModeBatch = "batch"
+)
+
+// nsqProducer is the part of nsq.Producer used by the sink.
+type nsqProducer interface {
+	Publish(topic string, body []byte) error
+	MultiPublish(topic string, body [][]byte) error
+	Stop()
+}
+
+/*
+nsq sink usage
+--sink=nsq:tcp://nsqd:4150?topic=k8s-events&mode=event
+
+topic: the topic events are published to, heapster-events by default.
+mode: event publishes every event as a message of its own, batch publishes
+every batch of events as a single message holding a JSON list.
+*/
+type nsqSink struct {
+	producer nsqProducer
+	topic    string
+	mode     string
+	sync.Mutex
+}
+
+// glogLogger passes the log lines of the nsq producer on to glog.
+type glogLogger struct{}
+
+func (glogLogger) Output(calldepth int, s string) error {
+	glog.InfoDepth(calldepth, s)
+	return nil
+}
+
+func (sink *nsqSink) Name() string {
+	return "NSQ Sink"
+}
+
+func (sink *nsqSink) Stop() {
+	sink.producer.Stop()
+}
+
+func (sink *nsqSink) ExportEvents(eventBatch *core.EventBatch) {
+	if err := sink.ExportEventsWithError(eventBatch); err != nil {
+		glog.Errorf("Failed to publish events to nsq: %v", err)
+	}
+}
+
+func (sink *nsqSink) ExportEventsWithError(eventBatch *core.EventBatch) error {
+	if len(eventBatch.Events) == 0 {
+		return nil
+	}
+	sink.Lock()
+	defer sink.Unlock()
+
+	if sink.mode == ModeBatch {
+		body, err := json.Marshal(eventBatch.Events)
+		if err != nil {
+			return fmt.Errorf("failed to marshal events: %v", err)
+		}
+		return sink.producer.Publish(sink.topic, body)
+	}
+
+	bodies := make([][]byte, 0, len(eventBatch.Events))
+	for _, event := range eventBatch.Events {
+		body, err := json.Marshal(event)
+		if err != nil {
+			glog.Warningf("Failed to marshal event %s/%s: %v", event.Namespace, event.Name, err)
+			continue
+		}
+		bodies = append(bodies, body)
+	}
+	if len(bodies) == 0 {
+		return nil
+	}
+	return sink.producer.MultiPublish(sink.topic, bodies)
+}
+
+func NewNsqSink(uri *url.URL) (core.EventSink, error) {
+	if len(uri.Host) == 0 {
+		return nil, fmt.Errorf("you must provide the nsqd address")
+	}
+	opts := uri.Query()
+
+	topic := defaultTopic
+	if len(opts["topic"]) >= 1 {
+		topic = opts["topic"][0]
+	}
+
+	mode := ModeEvent
+	if len(opts["mode"]) >= 1 {
+		mode = opts["mode"][0]
+		if mode != ModeEvent && mode != ModeBatch {
+			return nil, fmt.Errorf("mode must be %s or %s, got %q", ModeEvent, ModeBatch, mode)
+		}
+	}
+
+	producer, err := nsq.NewProducer(uri.Host, nsq.NewConfig())
+	if err != nil {
+		return nil, fmt.Errorf("failed to create nsq producer: %v", err)
+	}
+	producer.SetLogger(glogLogger{}, nsq.LogLevelWarning)
+	if err := producer.Ping(); err != nil {
+		producer.Stop()
+		return nil, fmt.Errorf("failed to connect to nsqd %s: %v", uri.Host, err)
+	}
+	glog.V(2).Infof("Publishing events to nsq topic %s on %s", topic, uri.Host)
+
+	return &nsqSink{
+		producer: producer,
+		topic:    topic,
+		mode:     mode,
+	}, nil
+}
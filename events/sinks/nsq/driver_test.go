@@ -0,0 +1,99 @@
+// Copyright 2018 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nsq
+
+import (
+	"encoding/json"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	kube_api "k8s.io/api/core/v1"
+	"k8s.io/heapster/events/core"
+)
+
+type fakeProducer struct {
+	messages map[string][][]byte
+	stopped  bool
+}
+
+func newFakeProducer() *fakeProducer {
+	return &fakeProducer{messages: make(map[string][][]byte)}
+}
+
+func (p *fakeProducer) Publish(topic string, body []byte) error {
+	p.messages[topic] = append(p.messages[topic], body)
+	return nil
+}
+
+func (p *fakeProducer) MultiPublish(topic string, body [][]byte) error {
+	p.messages[topic] = append(p.messages[topic], body...)
+	return nil
+}
+
+func (p *fakeProducer) Stop() {
+	p.stopped = true
+}
+
+func testBatch() *core.EventBatch {
+	return &core.EventBatch{
+		Events: []*kube_api.Event{
+			{Reason: "BackOff", Message: "event1"},
+			{Reason: "Pulled", Message: "event2"},
+		},
+	}
+}
+
+func TestEventMode(t *testing.T) {
+	producer := newFakeProducer()
+	sink := &nsqSink{producer: producer, topic: "k8s-events", mode: ModeEvent}
+
+	assert.NoError(t, sink.ExportEventsWithError(testBatch()))
+	assert.NoError(t, sink.ExportEventsWithError(&core.EventBatch{}))
+	sink.Stop()
+
+	messages := producer.messages["k8s-events"]
+	assert.Len(t, messages, 2)
+	var event kube_api.Event
+	assert.NoError(t, json.Unmarshal(messages[1], &event))
+	assert.Equal(t, "event2", event.Message)
+	assert.True(t, producer.stopped)
+}
+
+func TestBatchMode(t *testing.T) {
+	producer := newFakeProducer()
+	sink := &nsqSink{producer: producer, topic: "k8s-events", mode: ModeBatch}
+
+	assert.NoError(t, sink.ExportEventsWithError(testBatch()))
+
+	messages := producer.messages["k8s-events"]
+	assert.Len(t, messages, 1)
+	var events []kube_api.Event
+	assert.NoError(t, json.Unmarshal(messages[0], &events))
+	assert.Len(t, events, 2)
+}
+
+func TestNewNsqSinkErrors(t *testing.T) {
+	for _, invalid := range []string{
+		"?topic=k8s-events",
+		"tcp://localhost:4150?mode=stream",
+		// Nothing listens on port 1, so the connection check fails.
+		"tcp://127.0.0.1:1?topic=k8s-events",
+	} {
+		uri, _ := url.Parse(invalid)
+		_, err := NewNsqSink(uri)
+		assert.Error(t, err, invalid)
+	}
+}
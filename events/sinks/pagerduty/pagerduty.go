@@ -0,0 +1,260 @@
+// Copyright 2018 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pagerduty
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/facebookarchive/inmem"
+	"github.com/golang/glog"
+	"k8s.io/api/core/v1"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/heapster/events/core"
+	"k8s.io/heapster/version"
+)
+
+const (
+	PAGERDUTY_SINK       = "PagerDutySink"
+	WARNING              = core.LevelWarning
+	NORMAL               = core.LevelNormal
+	CONTENT_TYPE_JSON    = "application/json"
+	MAX_RECORDER         = 500
+	DEFAULT_DEDUP_WINDOW = 5 * time.Minute
+	DEFAULT_TIMEOUT      = 5 * time.Second
+	DEFAULT_ENDPOINT     = "https://events.pagerduty.com/v2/enqueue"
+
+	EVENT_ACTION_TRIGGER = "trigger"
+	EVENT_ACTION_RESOLVE = "resolve"
+
+	SEVERITY_WARNING = "warning"
+	SEVERITY_INFO    = "info"
+
+	// PagerDuty rejects summaries longer than this.
+	maxSummaryLength = 1024
+)
+
+// PagerDutyEvent is a PagerDuty Events API v2 event.
+type PagerDutyEvent struct {
+	RoutingKey  string            `json:"routing_key"`
+	EventAction string            `json:"event_action"`
+	DedupKey    string            `json:"dedup_key,omitempty"`
+	Payload     *PagerDutyPayload `json:"payload,omitempty"`
+}
+
+type PagerDutyPayload struct {
+	Summary       string            `json:"summary"`
+	Source        string            `json:"source"`
+	Severity      string            `json:"severity"`
+	Timestamp     string            `json:"timestamp,omitempty"`
+	Component     string            `json:"component,omitempty"`
+	Group         string            `json:"group,omitempty"`
+	Class         string            `json:"class,omitempty"`
+	CustomDetails map[string]string `json:"custom_details,omitempty"`
+}
+
+/*
+pagerduty sink usage
+--sink=pagerduty:?routing_key=XXXX&level=Warning
+
+routing_key: the integration key of the PagerDuty service, required.
+level: Normal or Warning. The event level greater than global level will emit.
+dedup_window: how long repeats of an event are not sent again, 5m by default.
+Repeats are grouped by PagerDuty anyway, as their dedup_key is the same.
+timeout: how long an event may take to be sent, 5s by default.
+user_agent: the User-Agent header sent, heapster-events/<version> by default.
+*/
+type PagerDutySink struct {
+	Endpoint    string
+	RoutingKey  string
+	Level       int
+	DedupWindow time.Duration
+	Timeout     time.Duration
+	UserAgent   string
+
+	recorder inmem.Cache
+	client   *http.Client
+}
+
+func (p *PagerDutySink) Name() string {
+	return PAGERDUTY_SINK
+}
+
+func (p *PagerDutySink) Stop() {
+	//do nothing
+}
+
+func (p *PagerDutySink) ExportEvents(batch *core.EventBatch) {
+	if err := p.ExportEventsWithError(batch); err != nil {
+		glog.Errorf("failed to send events to pagerduty: %v", err)
+	}
+}
+
+// ExportEventsWithError triggers a PagerDuty incident for every qualifying
+// event not sent within the dedup window, returning the aggregated errors.
+func (p *PagerDutySink) ExportEventsWithError(batch *core.EventBatch) error {
+	var errs []error
+	for _, event := range batch.Events {
+		if !p.isEventLevelDangerous(event.Type) {
+			continue
+		}
+		key := core.IdentityKey(core.DefaultIdentityFields, event)
+		if _, ok := p.recorder.Get(key); ok {
+			continue
+		}
+		if err := p.Post(createEventFromEvent(p.RoutingKey, key, event)); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		// if send success ，then add recoreder
+		p.recorder.Add(key, 1, time.Now().Add(p.DedupWindow))
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+func (p *PagerDutySink) isEventLevelDangerous(level string) bool {
+	return core.IsLevelAtLeast(level, p.Level)
+}
+
+func (p *PagerDutySink) Post(pdEvent *PagerDutyEvent) error {
+	event_bytes, err := json.Marshal(pdEvent)
+	if err != nil {
+		glog.Warningf("failed to marshal pagerduty event %v", pdEvent)
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, p.Endpoint, bytes.NewBuffer(event_bytes))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", CONTENT_TYPE_JSON)
+	req.Header.Set("User-Agent", p.UserAgent)
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send event to pagerduty: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("failed to send event to pagerduty: status %s", resp.Status)
+	}
+	return nil
+}
+
+func getSeverity(level string) string {
+	if level == v1.EventTypeWarning {
+		return SEVERITY_WARNING
+	}
+	return SEVERITY_INFO
+}
+
+func createEventFromEvent(routingKey, dedupKey string, event *v1.Event) *PagerDutyEvent {
+	object := fmt.Sprintf("%s/%s", event.InvolvedObject.Kind, event.InvolvedObject.Name)
+	source := object
+	if event.InvolvedObject.Namespace != "" {
+		source = fmt.Sprintf("%s/%s", event.InvolvedObject.Namespace, object)
+	}
+
+	summary := fmt.Sprintf("[%s] %s %s: %s", event.Type, source, event.Reason, event.Message)
+	if len(summary) > maxSummaryLength {
+		summary = summary[:maxSummaryLength]
+	}
+
+	payload := &PagerDutyPayload{
+		Summary:   summary,
+		Source:    source,
+		Severity:  getSeverity(event.Type),
+		Component: event.InvolvedObject.Kind,
+		Group:     event.Namespace,
+		Class:     event.Reason,
+		CustomDetails: map[string]string{
+			"message": event.Message,
+			"count":   fmt.Sprintf("%d", event.Count),
+			"host":    event.Source.Host,
+		},
+	}
+	if !event.LastTimestamp.IsZero() {
+		payload.Timestamp = event.LastTimestamp.UTC().Format(time.RFC3339)
+	}
+
+	return &PagerDutyEvent{
+		RoutingKey:  routingKey,
+		EventAction: EVENT_ACTION_TRIGGER,
+		DedupKey:    dedupKey,
+		Payload:     payload,
+	}
+}
+
+func NewPagerDutySink(uri *url.URL) (*PagerDutySink, error) {
+	p := &PagerDutySink{
+		Endpoint:    DEFAULT_ENDPOINT,
+		Level:       WARNING,
+		DedupWindow: DEFAULT_DEDUP_WINDOW,
+		Timeout:     DEFAULT_TIMEOUT,
+		UserAgent:   version.UserAgent("events"),
+		recorder:    inmem.NewLocked(MAX_RECORDER),
+	}
+	// The endpoint may be overridden, e.g. to go through a proxy.
+	if len(uri.Host) > 0 {
+		scheme := uri.Scheme
+		if scheme == "" {
+			scheme = "https"
+		}
+		p.Endpoint = fmt.Sprintf("%s://%s%s", scheme, uri.Host, uri.Path)
+	}
+
+	opts := uri.Query()
+
+	if len(opts["routing_key"]) >= 1 && opts["routing_key"][0] != "" {
+		p.RoutingKey = opts["routing_key"][0]
+	} else {
+		return nil, fmt.Errorf("you must provide pagerduty routing_key")
+	}
+
+	if len(opts["level"]) >= 1 {
+		level, err := core.ParseLevel(opts["level"][0])
+		if err != nil {
+			return nil, err
+		}
+		p.Level = level
+	}
+
+	if len(opts["user_agent"]) >= 1 && opts["user_agent"][0] != "" {
+		p.UserAgent = opts["user_agent"][0]
+	}
+
+	if len(opts["dedup_window"]) >= 1 {
+		window, err := time.ParseDuration(opts["dedup_window"][0])
+		if err != nil || window < 0 {
+			return nil, fmt.Errorf("dedup_window must be a non-negative duration, got %q", opts["dedup_window"][0])
+		}
+		p.DedupWindow = window
+	}
+
+	if len(opts["timeout"]) >= 1 {
+		timeout, err := time.ParseDuration(opts["timeout"][0])
+		if err != nil || timeout <= 0 {
+			return nil, fmt.Errorf("timeout must be a positive duration, got %q", opts["timeout"][0])
+		}
+		p.Timeout = timeout
+	}
+	p.client = &http.Client{Timeout: p.Timeout}
+
+	return p, nil
+}
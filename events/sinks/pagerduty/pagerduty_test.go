@@ -0,0 +1,148 @@
+// Copyright 2018 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pagerduty
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/api/core/v1"
+	"k8s.io/heapster/events/core"
+)
+
+func TestNewPagerDutySink(t *testing.T) {
+	uri, _ := url.Parse("?routing_key=abc&level=Normal&dedup_window=1m")
+	sink, err := NewPagerDutySink(uri)
+	assert.NoError(t, err)
+	assert.Equal(t, DEFAULT_ENDPOINT, sink.Endpoint)
+	assert.Equal(t, "abc", sink.RoutingKey)
+	assert.Equal(t, NORMAL, sink.Level)
+	assert.Equal(t, time.Minute, sink.DedupWindow)
+	assert.Equal(t, DEFAULT_TIMEOUT, sink.client.Timeout)
+
+	uri, _ = url.Parse("http://localhost:8080/enqueue?routing_key=abc&timeout=2s")
+	sink, err = NewPagerDutySink(uri)
+	assert.NoError(t, err)
+	assert.Equal(t, "http://localhost:8080/enqueue", sink.Endpoint)
+	assert.Equal(t, WARNING, sink.Level)
+	assert.Equal(t, 2*time.Second, sink.client.Timeout)
+
+	for _, invalid := range []string{"?level=Warning", "?routing_key=", "?routing_key=abc&dedup_window=soon", "?routing_key=abc&timeout=0s"} {
+		uri, _ = url.Parse(invalid)
+		_, err = NewPagerDutySink(uri)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestInvalidLevel(t *testing.T) {
+	for _, level := range []string{"Warnig", "warning", "Error"} {
+		uri, _ := url.Parse("?routing_key=abc&level=" + level)
+		_, err := NewPagerDutySink(uri)
+		assert.Error(t, err, level)
+	}
+}
+
+func TestCreateEventFromEvent(t *testing.T) {
+	event := &v1.Event{
+		Type:           v1.EventTypeWarning,
+		Reason:         "BackOff",
+		Message:        "Back-off restarting failed container",
+		InvolvedObject: v1.ObjectReference{Kind: "Pod", Namespace: "default", Name: "web-0"},
+	}
+	pdEvent := createEventFromEvent("abc", "0123456789abcdef", event)
+	assert.Equal(t, "abc", pdEvent.RoutingKey)
+	assert.Equal(t, EVENT_ACTION_TRIGGER, pdEvent.EventAction)
+	assert.Equal(t, "0123456789abcdef", pdEvent.DedupKey)
+	assert.Equal(t, "default/Pod/web-0", pdEvent.Payload.Source)
+	assert.Equal(t, SEVERITY_WARNING, pdEvent.Payload.Severity)
+	assert.Equal(t, "BackOff", pdEvent.Payload.Class)
+	assert.Equal(t, "[Warning] default/Pod/web-0 BackOff: Back-off restarting failed container", pdEvent.Payload.Summary)
+
+	event.Type = v1.EventTypeNormal
+	assert.Equal(t, SEVERITY_INFO, createEventFromEvent("abc", "", event).Payload.Severity)
+}
+
+func TestExportEvents(t *testing.T) {
+	var mu sync.Mutex
+	var received []PagerDutyEvent
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var pdEvent PagerDutyEvent
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&pdEvent))
+		mu.Lock()
+		received = append(received, pdEvent)
+		mu.Unlock()
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	uri, _ := url.Parse(server.URL + "?routing_key=abc")
+	sink, err := NewPagerDutySink(uri)
+	assert.NoError(t, err)
+
+	warning := &v1.Event{Type: v1.EventTypeWarning, Reason: "BackOff", Message: "attempt 1",
+		InvolvedObject: v1.ObjectReference{Kind: "Pod", Namespace: "default", Name: "web-0"}}
+	repeat := warning.DeepCopy()
+	repeat.Message = "attempt 2"
+	normal := &v1.Event{Type: v1.EventTypeNormal, Reason: "Pulled", Message: "pulled"}
+
+	assert.NoError(t, sink.ExportEventsWithError(&core.EventBatch{Events: []*v1.Event{warning, normal, repeat}}))
+
+	mu.Lock()
+	defer mu.Unlock()
+	// The normal event is below the level and the repeat is deduplicated.
+	assert.Len(t, received, 1)
+	assert.Equal(t, core.IdentityKey(core.DefaultIdentityFields, warning), received[0].DedupKey)
+}
+
+func TestExportEventsFailure(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	uri, _ := url.Parse(server.URL + "?routing_key=abc")
+	sink, err := NewPagerDutySink(uri)
+	assert.NoError(t, err)
+
+	event := &v1.Event{Type: v1.EventTypeWarning, Reason: "BackOff", Message: "failing"}
+	assert.Error(t, sink.ExportEventsWithError(&core.EventBatch{Events: []*v1.Event{event}}))
+	// Failed events are not recorded, so they are retried with the next batch.
+	assert.Equal(t, 0, sink.recorder.Len())
+}
+
+func TestExportEventsTimeout(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	uri, _ := url.Parse(server.URL + "?routing_key=abc&timeout=50ms")
+	sink, err := NewPagerDutySink(uri)
+	assert.NoError(t, err)
+
+	event := &v1.Event{Type: v1.EventTypeWarning, Reason: "BackOff", Message: "hanging"}
+	start := time.Now()
+	assert.Error(t, sink.ExportEventsWithError(&core.EventBatch{Events: []*v1.Event{event}}))
+	assert.True(t, time.Since(start) < 5*time.Second)
+	assert.Equal(t, 0, sink.recorder.Len())
+}
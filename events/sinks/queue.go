@@ -0,0 +1,169 @@
+// Copyright 2018 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sinks
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/heapster/events/core"
+)
+
+// Drop policies, selecting which batch is dropped when a sink queue is full.
+const (
+	DropOldest = "drop_oldest"
+	DropNewest = "drop_newest"
+
+	DefaultSinkQueueDepth = 100
+	// DefaultSinkDrainTimeout leaves the sinks part of the stop timeout to
+	// flush their own buffers.
+	DefaultSinkDrainTimeout = 5 * time.Second
+)
+
+var (
+	// Number of batches queued for export to sink.
+	batchesEnqueued = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "eventer",
+			Subsystem: "exporter",
+			Name:      "batches_enqueued_total",
+			Help:      "Number of batches queued for export to sink.",
+		},
+		[]string{"exporter"},
+	)
+
+	// Number of queued batches exported to sink.
+	batchesExported = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "eventer",
+			Subsystem: "exporter",
+			Name:      "batches_exported_total",
+			Help:      "Number of queued batches exported to sink, successfully or not.",
+		},
+		[]string{"exporter"},
+	)
+
+	// Number of batches dropped because the queue of sink was full.
+	batchesDropped = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "eventer",
+			Subsystem: "exporter",
+			Name:      "batches_dropped_total",
+			Help:      "Number of batches dropped because the queue of sink was full, or still queued when the sink stopped.",
+		},
+		[]string{"exporter"},
+	)
+
+	// Number of batches waiting for export to sink.
+	queuedBatches = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "eventer",
+			Subsystem: "exporter",
+			Name:      "queued_batches",
+			Help:      "Number of batches waiting for export to sink.",
+		},
+		[]string{"exporter"},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(batchesEnqueued)
+	prometheus.MustRegister(batchesExported)
+	prometheus.MustRegister(batchesDropped)
+	prometheus.MustRegister(queuedBatches)
+}
+
+func ParseDropPolicy(policy string) (string, error) {
+	switch policy {
+	case DropOldest, DropNewest:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("drop policy must be %s or %s, got %q", DropOldest, DropNewest, policy)
+	}
+}
+
+// batchQueue is the bounded queue of the batches waiting for export to a
+// sink. Once full, batches are dropped according to the drop policy.
+type batchQueue struct {
+	sync.Mutex
+	name    string
+	batches []*core.EventBatch
+	depth   int
+	policy  string
+	// ready is signaled when batches are pushed.
+	ready chan struct{}
+}
+
+func newBatchQueue(name string, depth int, policy string) *batchQueue {
+	return &batchQueue{name: name, depth: depth, policy: policy, ready: make(chan struct{}, 1)}
+}
+
+// push queues the batch without blocking and tells whether a batch had to
+// be dropped.
+func (q *batchQueue) push(batch *core.EventBatch) bool {
+	q.Lock()
+	defer q.Unlock()
+	dropped := false
+	if len(q.batches) >= q.depth {
+		dropped = true
+		batchesDropped.WithLabelValues(q.name).Inc()
+		if q.policy == DropNewest {
+			return true
+		}
+		q.batches[0] = nil
+		q.batches = q.batches[1:]
+	}
+	q.batches = append(q.batches, batch)
+	batchesEnqueued.WithLabelValues(q.name).Inc()
+	queuedBatches.WithLabelValues(q.name).Set(float64(len(q.batches)))
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+	return dropped
+}
+
+// pop removes and returns the oldest batch, if any.
+func (q *batchQueue) pop() *core.EventBatch {
+	q.Lock()
+	defer q.Unlock()
+	if len(q.batches) == 0 {
+		return nil
+	}
+	batch := q.batches[0]
+	q.batches[0] = nil
+	q.batches = q.batches[1:]
+	queuedBatches.WithLabelValues(q.name).Set(float64(len(q.batches)))
+	return batch
+}
+
+func (q *batchQueue) len() int {
+	q.Lock()
+	defer q.Unlock()
+	return len(q.batches)
+}
+
+// clear drops the queued batches and returns how many there were.
+func (q *batchQueue) clear() int {
+	q.Lock()
+	defer q.Unlock()
+	n := len(q.batches)
+	q.batches = nil
+	batchesDropped.WithLabelValues(q.name).Add(float64(n))
+	queuedBatches.WithLabelValues(q.name).Set(0)
+	return n
+}
@@ -0,0 +1,104 @@
+// Copyright 2018 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sinks
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"sync"
+
+	"k8s.io/heapster/events/core"
+)
+
+// SinkBuilder creates a sink from the options of its URI.
+type SinkBuilder func(*url.URL) (core.EventSink, error)
+
+var (
+	buildersLock sync.RWMutex
+	builders     = make(map[string]SinkBuilder)
+	// pathOptions are the <name>_file options each sink reads itself.
+	pathOptions = make(map[string][]string)
+	// wrappers are the sinks wrapping another sink, whose options they pass on.
+	wrappers = make(map[string]bool)
+)
+
+// Register makes a sink available under name, so that --sink=name:... builds
+// it. Sinks maintained out of tree register themselves from an init function.
+// It panics if the name is already taken or builder is nil.
+func Register(name string, builder SinkBuilder) {
+	buildersLock.Lock()
+	defer buildersLock.Unlock()
+	if builder == nil {
+		panic(fmt.Sprintf("sinks: Register builder of %s is nil", name))
+	}
+	if _, ok := builders[name]; ok {
+		panic(fmt.Sprintf("sinks: Register called twice for %s", name))
+	}
+	builders[name] = builder
+}
+
+// RegisterPathOptions declares the <name>_file options that the sink
+// registered under name reads as paths itself, like tls_ca_file. Build leaves
+// them as is, rather than replacing them by <name> and the file content.
+func RegisterPathOptions(name string, options ...string) {
+	buildersLock.Lock()
+	defer buildersLock.Unlock()
+	pathOptions[name] = append(pathOptions[name], options...)
+}
+
+// registerWrapper registers a sink wrapping the sink of its value, such as
+// circuitbreaker:alertmanager:..., which builds the wrapped sink with Build.
+func registerWrapper(name string, builder SinkBuilder) {
+	Register(name, builder)
+	buildersLock.Lock()
+	defer buildersLock.Unlock()
+	wrappers[name] = true
+}
+
+// keptPathOptions returns the path options of the sink registered under
+// name. The options of wrapper sinks are passed on to the wrapped sink, so
+// the path options of every sink are kept for the wrapped sink's Build.
+func keptPathOptions(name string) []string {
+	buildersLock.RLock()
+	defer buildersLock.RUnlock()
+	if !wrappers[name] {
+		return pathOptions[name]
+	}
+	var kept []string
+	for _, options := range pathOptions {
+		kept = append(kept, options...)
+	}
+	return kept
+}
+
+func lookupBuilder(name string) (SinkBuilder, bool) {
+	buildersLock.RLock()
+	defer buildersLock.RUnlock()
+	builder, ok := builders[name]
+	return builder, ok
+}
+
+// RegisteredSinks returns the sorted names of the registered sinks.
+func RegisteredSinks() []string {
+	buildersLock.RLock()
+	defer buildersLock.RUnlock()
+	names := make([]string, 0, len(builders))
+	for name := range builders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
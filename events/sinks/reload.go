@@ -0,0 +1,101 @@
+// Copyright 2018 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sinks
+
+import (
+	"fmt"
+	"sync"
+
+	"k8s.io/heapster/common/flags"
+	"k8s.io/heapster/events/core"
+)
+
+// ReconfigurableSink is implemented by the sink manager, whose sinks can be
+// replaced while it runs.
+type ReconfigurableSink interface {
+	core.EventSink
+	SetSinks(sinks []core.EventSink)
+}
+
+// SinkSet keeps the sinks built from a list of sink URIs, so that when the
+// list changes only the sinks whose URI changed are built again. The others
+// keep their state, such as dedup caches and queues.
+type SinkSet struct {
+	factory *SinkFactory
+	// sinks are keyed by their resolved URI.
+	sinks map[string]core.EventSink
+	// lock guards uris, read while Update runs.
+	lock sync.RWMutex
+	// uris are the redacted URIs the sinks were built from.
+	uris map[core.EventSink]string
+}
+
+func NewSinkSet(factory *SinkFactory) *SinkSet {
+	return &SinkSet{factory: factory, sinks: make(map[string]core.EventSink), uris: make(map[core.EventSink]string)}
+}
+
+// sinkKey identifies the sink built from the uri. URIs referring to a
+// configuration file are identified by its content, so that editing the file
+// rebuilds the sink.
+func sinkKey(uri flags.Uri) (string, error) {
+	resolved, err := resolveUri(uri)
+	if err != nil {
+		return "", err
+	}
+	return resolved.String(), nil
+}
+
+// Update returns the sinks of the uris, building those not in the set, like
+// BuildAll. Sinks no longer listed are forgotten, stopping them is left to
+// the sink manager.
+func (this *SinkSet) Update(uris flags.Uris) []core.EventSink {
+	result := make([]core.EventSink, 0, len(uris))
+	sinks := make(map[string]core.EventSink, len(uris))
+	redacted := make(map[core.EventSink]string, len(uris))
+	occurrences := make(map[string]int)
+	for _, uri := range uris {
+		key, err := sinkKey(uri)
+		if err != nil {
+			// Build reports the error.
+			key = uri.String()
+		}
+		// A sink listed twice is built twice, like BuildAll does.
+		occurrences[key]++
+		key = fmt.Sprintf("%s#%d", key, occurrences[key])
+		sink, ok := this.sinks[key]
+		if !ok {
+			if sink, ok = this.factory.buildChecked(uri); !ok {
+				continue
+			}
+		}
+		sinks[key] = sink
+		redacted[sink] = uri.Redacted()
+		result = append(result, sink)
+	}
+	this.sinks = sinks
+	this.lock.Lock()
+	this.uris = redacted
+	this.lock.Unlock()
+	sinksConfigured.Set(float64(len(result)))
+	return result
+}
+
+// RedactedUri returns the URI the sink was built from, secrets redacted, or
+// an empty string for sinks not in the set.
+func (this *SinkSet) RedactedUri(sink core.EventSink) string {
+	this.lock.RLock()
+	defer this.lock.RUnlock()
+	return this.uris[sink]
+}
@@ -0,0 +1,143 @@
+// Copyright 2018 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sinks
+
+import (
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	kube_api "k8s.io/api/core/v1"
+	"k8s.io/heapster/common/flags"
+	"k8s.io/heapster/events/core"
+)
+
+func init() {
+	Register("reload-fake", func(uri *url.URL) (core.EventSink, error) {
+		return &fakeSink{name: uri.Host}, nil
+	})
+}
+
+func (f *fakeSink) isStopped() bool {
+	f.Lock()
+	defer f.Unlock()
+	return f.stopped
+}
+
+// waitFor polls the condition for up to 5 seconds.
+func waitFor(t *testing.T, what string, condition func() bool) {
+	deadline := time.Now().Add(5 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func sinkUris(t *testing.T, values ...string) flags.Uris {
+	var uris flags.Uris
+	for _, value := range values {
+		assert.NoError(t, uris.Set(value))
+	}
+	return uris
+}
+
+func TestReloadSinks(t *testing.T) {
+	set := NewSinkSet(NewSinkFactory())
+	initial := set.Update(sinkUris(t, "reload-fake://a", "reload-fake://b"))
+	assert.Len(t, initial, 2)
+	a, b := initial[0].(*fakeSink), initial[1].(*fakeSink)
+	manager, _ := NewEventSinkManager(initial, time.Second, time.Second, 0)
+	defer manager.Stop()
+
+	batch := &core.EventBatch{Events: []*kube_api.Event{{Reason: "BackOff"}}}
+	manager.ExportEvents(batch)
+	waitFor(t, "first batch", func() bool { return len(a.exported()) == 1 && len(b.exported()) == 1 })
+
+	// a is removed and c added, b keeps running untouched.
+	reloaded := set.Update(sinkUris(t, "reload-fake://b", "reload-fake://c", "unknown:foo"))
+	assert.Len(t, reloaded, 2)
+	assert.True(t, reloaded[0] == core.EventSink(b))
+	c := reloaded[1].(*fakeSink)
+	assert.Equal(t, "c", c.Name())
+	manager.(ReconfigurableSink).SetSinks(reloaded)
+	waitFor(t, "a to stop", a.isStopped)
+	assert.False(t, b.isStopped())
+
+	manager.ExportEvents(batch)
+	waitFor(t, "second batch", func() bool { return len(b.exported()) == 2 && len(c.exported()) == 1 })
+	assert.Len(t, a.exported(), 1)
+}
+
+func TestReloadSinksExportInFlight(t *testing.T) {
+	set := NewSinkSet(NewSinkFactory())
+	slow := &slowSink{fakeSink: fakeSink{name: "slow"}, release: make(chan struct{})}
+	manager, _ := NewEventSinkManager([]core.EventSink{slow}, time.Second, time.Second, 0)
+	defer manager.Stop()
+
+	manager.ExportEvents(&core.EventBatch{})
+	manager.(ReconfigurableSink).SetSinks(set.Update(sinkUris(t, "reload-fake://a")))
+	// The removed sink is stopped once its export is done.
+	time.Sleep(100 * time.Millisecond)
+	assert.False(t, slow.isStopped())
+	close(slow.release)
+	waitFor(t, "the slow sink to stop", slow.isStopped)
+	assert.Len(t, slow.exported(), 1)
+}
+
+// slowSink exports once release is closed.
+type slowSink struct {
+	fakeSink
+	release chan struct{}
+}
+
+func (s *slowSink) ExportEventsWithError(batch *core.EventBatch) error {
+	<-s.release
+	return s.fakeSink.ExportEventsWithError(batch)
+}
+
+func TestReloadRebuildsChangedConfigFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sinks")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	config := filepath.Join(dir, "fake.yaml")
+	assert.NoError(t, ioutil.WriteFile(config, []byte("endpoint: reload-fake://a\n"), 0644))
+
+	set := NewSinkSet(NewSinkFactory())
+	uris := sinkUris(t, "reload-fake:file://"+config)
+	first := set.Update(uris)
+	assert.Len(t, first, 1)
+	assert.True(t, first[0] == set.Update(uris)[0])
+
+	assert.NoError(t, ioutil.WriteFile(config, []byte("endpoint: reload-fake://b\n"), 0644))
+	second := set.Update(uris)
+	assert.Len(t, second, 1)
+	assert.Equal(t, "b", second[0].Name())
+}
+
+func TestSinkSetRedactedUri(t *testing.T) {
+	set := NewSinkSet(NewSinkFactory())
+	built := set.Update(sinkUris(t, "reload-fake://a?token=secret&level=Warning"))
+	assert.Len(t, built, 1)
+	assert.Equal(t, "reload-fake://a?level=Warning&token=xxxxx", set.RedactedUri(built[0]))
+
+	set.Update(sinkUris(t, "reload-fake://b"))
+	assert.Equal(t, "", set.RedactedUri(built[0]))
+}
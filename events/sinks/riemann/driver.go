@@ -23,6 +23,7 @@ import (
 	"github.com/golang/glog"
 	"github.com/riemann/riemann-go-client"
 	kube_api "k8s.io/api/core/v1"
+	"k8s.io/heapster/common/reconnect"
 	riemannCommon "k8s.io/heapster/common/riemann"
 	"k8s.io/heapster/events/core"
 )
@@ -32,18 +33,27 @@ type RiemannSink struct {
 	client riemanngo.Client
 	config riemannCommon.RiemannConfig
 	sync.RWMutex
+
+	// connect creates a new client, riemannCommon.GetRiemannClient if nil.
+	connect     func(riemannCommon.RiemannConfig) (riemanngo.Client, error)
+	reconnector *reconnect.Reconnector
 }
 
 // creates a Riemann sink. Returns a riemannSink
 func CreateRiemannSink(uri *url.URL) (core.EventSink, error) {
-	var sink, err = riemannCommon.CreateRiemannSink(uri)
+	maxBackoff, err := reconnect.ParseMaxBackoff(uri.Query())
+	if err != nil {
+		return nil, err
+	}
+	sink, err := riemannCommon.CreateRiemannSink(uri)
 	if err != nil {
 		glog.Warningf("Error creating the Riemann metrics sink: %v", err)
 		return nil, err
 	}
 	rs := &RiemannSink{
-		client: sink.Client,
-		config: sink.Config,
+		client:      sink.Client,
+		config:      sink.Config,
+		reconnector: reconnect.NewReconnector("riemann sink", maxBackoff),
 	}
 	return rs, nil
 }
@@ -116,14 +126,10 @@ func (sink *RiemannSink) ExportEvents(eventBatch *core.EventBatch) {
 	sink.Lock()
 	defer sink.Unlock()
 
-	if sink.client == nil {
-		// the client could be nil here, so we reconnect
-		client, err := riemannCommon.GetRiemannClient(sink.config)
-		if err != nil {
-			glog.Warningf("Riemann sink not connected: %v", err)
-			return
-		}
-		sink.client = client
+	// the client could be nil here, so we reconnect
+	if sink.client == nil && !sink.reconnect() {
+		glog.Warningf("Riemann sink not connected, dropping %d events", len(eventBatch.Events))
+		return
 	}
 
 	var events []riemanngo.Event
@@ -144,3 +150,19 @@ func (sink *RiemannSink) ExportEvents(eventBatch *core.EventBatch) {
 		events = nil
 	}
 }
+
+// reconnect connects a new client, backing off after failed attempts.
+func (sink *RiemannSink) reconnect() bool {
+	connect := sink.connect
+	if connect == nil {
+		connect = riemannCommon.GetRiemannClient
+	}
+	return sink.reconnector.Attempt(func() error {
+		client, err := connect(sink.config)
+		if err != nil {
+			return err
+		}
+		sink.client = client
+		return nil
+	})
+}
@@ -15,15 +15,18 @@
 package riemann
 
 import (
+	"fmt"
 	"strconv"
 	"testing"
 	"time"
 
 	pb "github.com/golang/protobuf/proto"
+	"github.com/riemann/riemann-go-client"
 	"github.com/riemann/riemann-go-client/proto"
 	"github.com/stretchr/testify/assert"
 	kube_api "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/heapster/common/reconnect"
 	riemannCommon "k8s.io/heapster/common/riemann"
 	"k8s.io/heapster/events/core"
 )
@@ -296,3 +299,64 @@ func TestStoreMultipleDataInput(t *testing.T) {
 		}
 	}
 }
+
+// fakeRiemannServer hands out clients that fail while the server is down.
+type fakeRiemannServer struct {
+	up     bool
+	events int
+}
+
+type fakeRiemannServerClient struct {
+	server *fakeRiemannServer
+}
+
+func (client *fakeRiemannServerClient) Connect(timeout int32) error {
+	return nil
+}
+
+func (client *fakeRiemannServerClient) Close() error {
+	return nil
+}
+
+func (client *fakeRiemannServerClient) Send(e *proto.Msg) (*proto.Msg, error) {
+	if !client.server.up {
+		return nil, fmt.Errorf("broken pipe")
+	}
+	client.server.events += len(e.Events)
+	return &proto.Msg{Ok: pb.Bool(true)}, nil
+}
+
+func (server *fakeRiemannServer) connect(config riemannCommon.RiemannConfig) (riemanngo.Client, error) {
+	if !server.up {
+		return nil, fmt.Errorf("connection refused")
+	}
+	return &fakeRiemannServerClient{server}, nil
+}
+
+func TestReconnectAfterServerRestart(t *testing.T) {
+	server := &fakeRiemannServer{up: true}
+	client, _ := server.connect(riemannCommon.RiemannConfig{})
+	sink := &RiemannSink{
+		client:      client,
+		config:      riemannCommon.RiemannConfig{BatchSize: 1000},
+		connect:     server.connect,
+		reconnector: reconnect.NewReconnector("riemann sink", 10*time.Millisecond),
+	}
+	batch := &core.EventBatch{Events: []*kube_api.Event{{Message: "event"}}}
+
+	sink.ExportEvents(batch)
+	assert.Equal(t, 1, server.events)
+
+	server.up = false
+	sink.ExportEvents(batch)
+	assert.Nil(t, sink.client)
+	// Reconnecting fails while the server is down.
+	sink.ExportEvents(batch)
+	assert.Nil(t, sink.client)
+
+	server.up = true
+	time.Sleep(20 * time.Millisecond)
+	sink.ExportEvents(batch)
+	assert.NotNil(t, sink.client)
+	assert.Equal(t, 2, server.events)
+}
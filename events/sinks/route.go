@@ -0,0 +1,160 @@
+// Copyright 2018 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sinks
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/golang/glog"
+	kube_api "k8s.io/api/core/v1"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/heapster/common/flags"
+	"k8s.io/heapster/events/core"
+)
+
+type route struct {
+	reason *regexp.Regexp
+	sink   core.EventSink
+}
+
+// routeSink splits every batch by event reason and forwards each part to the
+// child sink of the first matching route. Events matching no route go to the
+// default sink, or are dropped if there is none.
+//
+// Usage (child uris must be query escaped):
+// --sink=route:?match=NodeNotReady|NodeUnreachable=alertmanager:http://am:9093?cluster%3Dprod&default=log
+type routeSink struct {
+	routes      []route
+	defaultSink core.EventSink
+}
+
+func (this *SinkFactory) buildRouteSink(val *url.URL) (core.EventSink, error) {
+	opts := val.Query()
+	result := &routeSink{}
+
+	for _, match := range opts["match"] {
+		parts := strings.SplitN(match, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("route match must be <reason regex>=<sink uri>, got %q", match)
+		}
+		reason, err := regexp.Compile("^(?:" + parts[0] + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("invalid route reason regex %q: %v", parts[0], err)
+		}
+		sink, err := this.buildRouteChild(parts[1])
+		if err != nil {
+			result.Stop()
+			return nil, err
+		}
+		result.routes = append(result.routes, route{reason: reason, sink: sink})
+	}
+	if len(result.routes) == 0 {
+		return nil, fmt.Errorf("route sink needs at least one match")
+	}
+
+	if len(opts["default"]) >= 1 {
+		sink, err := this.buildRouteChild(opts["default"][0])
+		if err != nil {
+			result.Stop()
+			return nil, err
+		}
+		result.defaultSink = sink
+	}
+	return result, nil
+}
+
+func (this *SinkFactory) buildRouteChild(value string) (core.EventSink, error) {
+	var uri flags.Uri
+	if err := uri.Set(value); err != nil {
+		return nil, err
+	}
+	return this.Build(uri)
+}
+
+func (this *routeSink) Name() string {
+	return "Route"
+}
+
+func (this *routeSink) Stop() {
+	for _, r := range this.routes {
+		r.sink.Stop()
+	}
+	if this.defaultSink != nil {
+		this.defaultSink.Stop()
+	}
+}
+
+func (this *routeSink) WrappedSinks() []core.EventSink {
+	sinks := make([]core.EventSink, 0, len(this.routes)+1)
+	for _, r := range this.routes {
+		sinks = append(sinks, r.sink)
+	}
+	if this.defaultSink != nil {
+		sinks = append(sinks, this.defaultSink)
+	}
+	return sinks
+}
+
+func (this *routeSink) ExportEvents(batch *core.EventBatch) {
+	if err := this.ExportEventsWithError(batch); err != nil {
+		glog.Warningf("Failed to export routed events: %v", err)
+	}
+}
+
+func (this *routeSink) ExportEventsWithError(batch *core.EventBatch) error {
+	return this.ExportEventsContext(context.Background(), batch)
+}
+
+func (this *routeSink) ExportEventsContext(ctx context.Context, batch *core.EventBatch) error {
+	var errs []error
+	for sink, part := range this.split(batch) {
+		if err := core.ExportEventsContext(ctx, sink, part); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %v", sink.Name(), err))
+		}
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+// split partitions the batch into one non-empty sub-batch per child sink,
+// keeping the order of events and the batch timestamp.
+func (this *routeSink) split(batch *core.EventBatch) map[core.EventSink]*core.EventBatch {
+	parts := make(map[core.EventSink]*core.EventBatch)
+	for _, event := range batch.Events {
+		sink := this.sinkFor(event)
+		if sink == nil {
+			continue
+		}
+		part, found := parts[sink]
+		if !found {
+			part = &core.EventBatch{Timestamp: batch.Timestamp}
+			parts[sink] = part
+		}
+		part.Events = append(part.Events, event)
+	}
+	return parts
+}
+
+func (this *routeSink) sinkFor(event *kube_api.Event) core.EventSink {
+	for _, r := range this.routes {
+		if r.reason.MatchString(event.Reason) {
+			return r.sink
+		}
+	}
+	return this.defaultSink
+}
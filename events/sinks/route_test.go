@@ -0,0 +1,90 @@
+// Copyright 2018 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sinks
+
+import (
+	"net/url"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	kube_api "k8s.io/api/core/v1"
+	"k8s.io/heapster/common/flags"
+	"k8s.io/heapster/events/core"
+)
+
+func TestRouteSplitsBatch(t *testing.T) {
+	node := &fakeSink{name: "node"}
+	pull := &fakeSink{name: "pull"}
+	fallback := &fakeSink{name: "fallback"}
+	sink := &routeSink{
+		routes: []route{
+			{reason: regexp.MustCompile("^(?:NodeNotReady|NodeUnreachable)$"), sink: node},
+			{reason: regexp.MustCompile("^(?:Pull.*)$"), sink: pull},
+		},
+		defaultSink: fallback,
+	}
+
+	now := time.Now()
+	events := []*kube_api.Event{
+		{Reason: "NodeNotReady"},
+		{Reason: "Pulling"},
+		{Reason: "ScalingReplicaSet"},
+		{Reason: "NodeUnreachable"},
+		{Reason: "Pulled"},
+	}
+	assert.NoError(t, sink.ExportEventsWithError(&core.EventBatch{Timestamp: now, Events: events}))
+
+	assert.Len(t, node.exported(), 1)
+	assert.Equal(t, []*kube_api.Event{events[0], events[3]}, node.exported()[0].Events)
+	assert.Equal(t, now, node.exported()[0].Timestamp)
+	assert.Equal(t, []*kube_api.Event{events[1], events[4]}, pull.exported()[0].Events)
+	assert.Equal(t, []*kube_api.Event{events[2]}, fallback.exported()[0].Events)
+
+	// Sinks without matching events don't get empty batches.
+	sink.ExportEventsWithError(&core.EventBatch{Events: []*kube_api.Event{{Reason: "Pulled"}}})
+	assert.Len(t, node.exported(), 1)
+	assert.Len(t, fallback.exported(), 1)
+	assert.Len(t, pull.exported(), 2)
+}
+
+func TestRouteWithoutDefaultDropsUnmatched(t *testing.T) {
+	node := &fakeSink{name: "node", err: errFake}
+	sink := &routeSink{routes: []route{{reason: regexp.MustCompile("^(?:NodeNotReady)$"), sink: node}}}
+
+	err := sink.ExportEventsWithError(&core.EventBatch{Events: []*kube_api.Event{{Reason: "NodeNotReady"}, {Reason: "Other"}}})
+	assert.Error(t, err)
+	assert.Len(t, node.exported()[0].Events, 1)
+}
+
+func TestBuildRouteSink(t *testing.T) {
+	factory := NewSinkFactory()
+	var uri flags.Uri
+	assert.NoError(t, uri.Set("route:?match="+url.QueryEscape("Node.*=log")+"&default=log"))
+	sink, err := factory.Build(uri)
+	assert.NoError(t, err)
+	routes := sink.(*routeSink)
+	assert.Len(t, routes.routes, 1)
+	assert.True(t, routes.routes[0].reason.MatchString("NodeNotReady"))
+	assert.False(t, routes.routes[0].reason.MatchString("NotNodeNotReady"))
+	assert.NotNil(t, routes.defaultSink)
+
+	for _, invalid := range []string{"route:?default=log", "route:?match=log", "route:?match=" + url.QueryEscape("(=log"), "route:?match=" + url.QueryEscape("Node=unknown")} {
+		assert.NoError(t, uri.Set(invalid))
+		_, err := factory.Build(uri)
+		assert.Error(t, err, invalid)
+	}
+}
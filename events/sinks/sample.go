@@ -0,0 +1,116 @@
+// Copyright 2018 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sinks
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/url"
+	"strconv"
+
+	"github.com/golang/glog"
+	kube_api "k8s.io/api/core/v1"
+	"k8s.io/heapster/events/core"
+)
+
+// sampleSink forwards approximately rate of the events to the wrapped sink.
+// Events are sampled by hashing their identity, so the same event is either
+// always forwarded or always dropped.
+//
+// Usage:
+// --sink=sample:log:?rate=0.1
+// --sink=sample:kafka:?brokers=localhost:9092&rate=0.25&keys=namespace,reason
+type sampleSink struct {
+	sink   core.EventSink
+	fields []string
+	// Events whose identity hash is below the threshold are forwarded.
+	threshold uint64
+}
+
+func newSampleSink(sink core.EventSink, rate float64, fields []string) *sampleSink {
+	threshold := uint64(math.MaxUint64)
+	if rate < 1 {
+		threshold = uint64(rate * float64(math.MaxUint64))
+	}
+	return &sampleSink{
+		sink:      sink,
+		fields:    fields,
+		threshold: threshold,
+	}
+}
+
+func (this *SinkFactory) buildSampleSink(val *url.URL) (core.EventSink, error) {
+	child, opts, err := splitWrappedUri(val, "rate", "keys")
+	if err != nil {
+		return nil, err
+	}
+
+	if len(opts["rate"]) == 0 {
+		return nil, fmt.Errorf("sample sink needs a rate")
+	}
+	rate, err := strconv.ParseFloat(opts["rate"][0], 64)
+	if err != nil || rate <= 0 || rate > 1 {
+		return nil, fmt.Errorf("rate must be in (0, 1], got %q", opts["rate"][0])
+	}
+	fields := core.DefaultIdentityFields
+	if len(opts["keys"]) >= 1 {
+		if fields, err = core.ParseIdentityFields(opts["keys"][0]); err != nil {
+			return nil, err
+		}
+	}
+
+	sink, err := this.Build(child)
+	if err != nil {
+		return nil, err
+	}
+	return newSampleSink(sink, rate, fields), nil
+}
+
+func (this *sampleSink) Name() string {
+	return this.sink.Name()
+}
+
+func (this *sampleSink) Stop() {
+	this.sink.Stop()
+}
+
+func (this *sampleSink) WrappedSinks() []core.EventSink {
+	return []core.EventSink{this.sink}
+}
+
+func (this *sampleSink) ExportEvents(batch *core.EventBatch) {
+	if err := this.ExportEventsWithError(batch); err != nil {
+		glog.Warningf("Failed to export sampled events to %s: %v", this.sink.Name(), err)
+	}
+}
+
+func (this *sampleSink) ExportEventsWithError(batch *core.EventBatch) error {
+	return this.ExportEventsContext(context.Background(), batch)
+}
+
+func (this *sampleSink) ExportEventsContext(ctx context.Context, batch *core.EventBatch) error {
+	sampled := &core.EventBatch{
+		Timestamp: batch.Timestamp,
+		Events:    make([]*kube_api.Event, 0, len(batch.Events)),
+	}
+	for _, event := range batch.Events {
+		if core.IdentityHash(this.fields, event) <= this.threshold {
+			sampled.Events = append(sampled.Events, event)
+		}
+	}
+	glog.Infof("Sampled %d of %d events for %s, dropped %d", len(sampled.Events), len(batch.Events), this.sink.Name(), len(batch.Events)-len(sampled.Events))
+	return core.ExportEventsContext(ctx, this.sink, sampled)
+}
@@ -0,0 +1,74 @@
+// Copyright 2018 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sinks
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	kube_api "k8s.io/api/core/v1"
+	"k8s.io/heapster/common/flags"
+	"k8s.io/heapster/events/core"
+)
+
+func pullEvents(n int) []*kube_api.Event {
+	events := make([]*kube_api.Event, 0, n)
+	for i := 0; i < n; i++ {
+		events = append(events, &kube_api.Event{
+			Reason:         "Pulled",
+			Message:        fmt.Sprintf("Successfully pulled image %d", i),
+			InvolvedObject: kube_api.ObjectReference{Kind: "Pod", Namespace: "default", Name: fmt.Sprintf("web-%d", i)},
+		})
+	}
+	return events
+}
+
+func TestSampleIsDeterministic(t *testing.T) {
+	child := &fakeSink{name: "fake"}
+	sink := newSampleSink(child, 0.1, core.DefaultIdentityFields)
+	events := pullEvents(2000)
+
+	sink.ExportEventsWithError(&core.EventBatch{Events: events})
+	sink.ExportEventsWithError(&core.EventBatch{Events: events})
+
+	first, second := child.exported()[0].Events, child.exported()[1].Events
+	assert.Equal(t, first, second)
+	// Roughly 10% of the events are forwarded.
+	assert.InDelta(t, 200, len(first), 60)
+}
+
+func TestSampleRateOneForwardsEverything(t *testing.T) {
+	child := &fakeSink{name: "fake"}
+	sink := newSampleSink(child, 1, core.DefaultIdentityFields)
+	events := pullEvents(100)
+	sink.ExportEventsWithError(&core.EventBatch{Events: events})
+	assert.Equal(t, events, child.exported()[0].Events)
+}
+
+func TestBuildSampleSink(t *testing.T) {
+	factory := NewSinkFactory()
+	var uri flags.Uri
+	assert.NoError(t, uri.Set("sample:log:?rate=0.5&keys=namespace,reason"))
+	sink, err := factory.Build(uri)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"namespace", "reason"}, sink.(*sampleSink).fields)
+
+	for _, invalid := range []string{"sample:log:", "sample:log:?rate=0", "sample:log:?rate=1.5", "sample:log:?rate=0.5&keys=uid"} {
+		assert.NoError(t, uri.Set(invalid))
+		_, err := factory.Build(uri)
+		assert.Error(t, err, invalid)
+	}
+}
@@ -0,0 +1,220 @@
+// Copyright 2018 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sinks
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+	"k8s.io/heapster/common/flags"
+)
+
+// sinkConfig is the file given by --sink-config, listing sinks with their
+// options rather than as URIs, which keeps secrets out of the command line.
+// For example
+//
+//	sinks:
+//	- type: alertmanager
+//	  endpoint: http://alertmanager:9093
+//	  options:
+//	    endpoints: ["alertmanager-0:9093", "alertmanager-1:9093"]
+//	    label:
+//	      team: infra
+//	- type: kafka
+//	  options:
+//	    brokers:
+//	    - kafka-0:9092
+//	    - kafka-1:9092
+//	    eventstopic: events
+//	- uri: log:?format=json
+//
+// is the same as
+// --sink=alertmanager:http://alertmanager:9093?endpoints=...&label=team:infra
+// --sink=kafka:?brokers=kafka-0:9092&brokers=kafka-1:9092&eventstopic=events
+// --sink=log:?format=json
+//
+// Option values are given as in sink config files, see sinkConfigFile. The
+// sinks are built in addition to those of --sink; a sink given in both is
+// built twice.
+type sinkConfig struct {
+	Sinks   []sinkConfigEntry      `yaml:"sinks"`
+	Unknown map[string]interface{} `yaml:",inline"`
+}
+
+type sinkConfigEntry struct {
+	// URI is the sink in the --sink format, instead of type, endpoint and
+	// options.
+	URI      string                 `yaml:"uri"`
+	Type     string                 `yaml:"type"`
+	Endpoint string                 `yaml:"endpoint"`
+	Options  map[string]interface{} `yaml:"options"`
+	Unknown  map[string]interface{} `yaml:",inline"`
+}
+
+// ReadSinkConfig returns the sinks listed in the sink config file at path,
+// as URIs to build them from.
+func ReadSinkConfig(path string) (flags.Uris, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read sink config: %v", err)
+	}
+	var config sinkConfig
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("failed to parse sink config %s: %v", path, err)
+	}
+	lines := newConfigLines(data)
+	if keys := sortedKeys(config.Unknown); len(keys) > 0 {
+		return nil, configError(path, lines.find(keys[0], 0, -1), "unknown key %q, expected sinks", keys[0])
+	}
+
+	uris := make(flags.Uris, 0, len(config.Sinks))
+	for i, entry := range config.Sinks {
+		start, end := lines.entry(i)
+		if keys := sortedKeys(entry.Unknown); len(keys) > 0 {
+			return nil, configError(path, lines.find(keys[0], start, end), "unknown key %q in sink %d, expected uri, type, endpoint or options", keys[0], i+1)
+		}
+		if entry.URI != "" {
+			if entry.Type != "" || entry.Endpoint != "" || len(entry.Options) > 0 {
+				return nil, configError(path, start, "sink %d has both a uri and a type, endpoint or options", i+1)
+			}
+			var uri flags.Uri
+			if err := uri.Set(entry.URI); err != nil {
+				return nil, configError(path, lines.find("uri", start, end), "invalid uri of sink %d: %v", i+1, err)
+			}
+			if _, ok := lookupBuilder(uri.Key); !ok {
+				return nil, configError(path, lines.find("uri", start, end), "unknown sink type %q", uri.Key)
+			}
+			uris = append(uris, uri)
+			continue
+		}
+		if entry.Type == "" {
+			return nil, configError(path, start, "sink %d has neither a uri nor a type", i+1)
+		}
+		if _, ok := lookupBuilder(entry.Type); !ok {
+			return nil, configError(path, lines.find("type", start, end), "unknown sink type %q", entry.Type)
+		}
+		uri, err := url.Parse(entry.Endpoint)
+		if err != nil {
+			return nil, configError(path, lines.find("endpoint", start, end), "invalid endpoint of sink %d: %v", i+1, err)
+		}
+		opts := uri.Query()
+		for _, name := range sortedKeys(entry.Options) {
+			values, err := optionValues(entry.Options[name])
+			if err != nil {
+				return nil, configError(path, lines.find(name, start, end), "invalid option %s of sink %d: %v", name, i+1, err)
+			}
+			opts[name] = values
+		}
+		uri.RawQuery = opts.Encode()
+		uris = append(uris, flags.Uri{Key: entry.Type, Val: *uri})
+	}
+	return uris, nil
+}
+
+// configError prefixes the error with the file and, if known, the line.
+func configError(path string, line int, format string, args ...interface{}) error {
+	if line > 0 {
+		path = fmt.Sprintf("%s:%d", path, line)
+	}
+	return fmt.Errorf("%s: %s", path, fmt.Sprintf(format, args...))
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// configLines locates keys in a block style YAML file, as the decoder doesn't
+// tell where values come from. Lines are numbered from 1, 0 when not found.
+type configLines struct {
+	lines []string
+	// entries are the lines the items of the sinks list start on.
+	entries []int
+}
+
+func newConfigLines(data []byte) *configLines {
+	c := &configLines{lines: strings.Split(string(data), "\n")}
+	inSinks := false
+	indent := -1
+	for i, line := range c.lines {
+		trimmed := strings.TrimLeft(line, " ")
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		lineIndent := len(line) - len(trimmed)
+		if lineIndent == 0 && !strings.HasPrefix(trimmed, "-") {
+			inSinks = configKey(trimmed) == "sinks"
+			continue
+		}
+		if !inSinks || !strings.HasPrefix(trimmed, "-") {
+			continue
+		}
+		if indent < 0 {
+			indent = lineIndent
+		}
+		if lineIndent == indent {
+			c.entries = append(c.entries, i+1)
+		}
+	}
+	return c
+}
+
+// entry returns the lines of the nth item of the sinks list, end excluded,
+// or 0 and -1 when not found.
+func (c *configLines) entry(n int) (int, int) {
+	if n >= len(c.entries) {
+		return 0, -1
+	}
+	if n+1 < len(c.entries) {
+		return c.entries[n], c.entries[n+1]
+	}
+	return c.entries[n], len(c.lines) + 1
+}
+
+// find returns the first line from start to end, end excluded, holding the
+// key. An end of -1 searches to the end of the file.
+func (c *configLines) find(key string, start, end int) int {
+	if start < 1 {
+		start = 1
+	}
+	if end < 0 {
+		end = len(c.lines) + 1
+	}
+	for i := start; i < end && i <= len(c.lines); i++ {
+		trimmed := strings.TrimLeft(c.lines[i-1], " ")
+		trimmed = strings.TrimLeft(strings.TrimPrefix(trimmed, "-"), " ")
+		if configKey(trimmed) == key {
+			return i
+		}
+	}
+	return 0
+}
+
+// configKey returns the key of a "key: value" line.
+func configKey(line string) string {
+	i := strings.Index(line, ":")
+	if i < 0 {
+		return ""
+	}
+	return strings.Trim(strings.TrimSpace(line[:i]), `"'`)
+}
@@ -0,0 +1,156 @@
+// Copyright 2018 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sinks
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/heapster/common/flags"
+	"k8s.io/heapster/events/core"
+	"k8s.io/heapster/events/sinks/alertmanager"
+	"k8s.io/heapster/events/sinks/dingtalk"
+)
+
+// buildPair builds the sinks of both uris, stopped at the end of the test.
+func buildPair(t *testing.T, want, got flags.Uri) (core.EventSink, core.EventSink) {
+	wantSink, err := NewSinkFactory().Build(want)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	gotSink, err := NewSinkFactory().Build(got)
+	if !assert.NoError(t, err) {
+		wantSink.Stop()
+		t.FailNow()
+	}
+	return wantSink, gotSink
+}
+
+func TestReadSinkConfig(t *testing.T) {
+	configured, err := ReadSinkConfig("testdata/sinks.yaml")
+	assert.NoError(t, err)
+
+	var equivalent flags.Uris
+	for _, uri := range []string{
+		"alertmanager:http://alertmanager:9093?cluster=production&endpoints=alertmanager-0:9093,alertmanager-1:9093" +
+			"&dedup_keys=kind,namespace,name,reason&label=env:prod&label=team:infra&batch_size=20",
+		"dingtalk:https://oapi.dingtalk.com/robot/send?access_token=token-a&access_token=token-b" +
+			"&at_mobiles=13800000000,13900000000&level=Normal&msg_type=markdown",
+		"kafka:?brokers=kafka-0:9092&brokers=kafka-1:9092&eventstopic=events&compression=gzip",
+		"log:?format=json",
+	} {
+		assert.NoError(t, equivalent.Set(uri))
+	}
+
+	if !assert.Len(t, configured, len(equivalent)) {
+		return
+	}
+	for i, uri := range configured {
+		assert.Equal(t, equivalent[i].Key, uri.Key)
+		assert.Equal(t, equivalent[i].Val.Scheme, uri.Val.Scheme, uri.Key)
+		assert.Equal(t, equivalent[i].Val.Host, uri.Val.Host, uri.Key)
+		assert.Equal(t, equivalent[i].Val.Path, uri.Val.Path, uri.Key)
+	}
+	// Lists become repeated options, which sinks also accept for the
+	// comma-separated ones.
+	assert.Equal(t, []string{"alertmanager-0:9093", "alertmanager-1:9093"}, configured[0].Val.Query()["endpoints"])
+	assert.Equal(t, []string{"env:prod", "team:infra"}, configured[0].Val.Query()["label"])
+	// The kafka sink needs a broker to be built, so only its options are compared.
+	assert.Equal(t, equivalent[2].Val.Query(), configured[2].Val.Query())
+	assert.Equal(t, equivalent[3], configured[3])
+
+	want, got := buildPair(t, equivalent[0], configured[0])
+	defer want.Stop()
+	defer got.Stop()
+	wantAm, gotAm := want.(*alertmanager.AlertmanagerSink), got.(*alertmanager.AlertmanagerSink)
+	assert.Len(t, gotAm.Endpoints, 3)
+	assert.Equal(t, wantAm.Endpoints, gotAm.Endpoints)
+	assert.Equal(t, wantAm.Cluster, gotAm.Cluster)
+	assert.Equal(t, wantAm.DedupKeys, gotAm.DedupKeys)
+	assert.Equal(t, wantAm.StaticLabels, gotAm.StaticLabels)
+	assert.Equal(t, wantAm.BatchSize, gotAm.BatchSize)
+
+	want, got = buildPair(t, equivalent[1], configured[1])
+	defer want.Stop()
+	defer got.Stop()
+	wantDing, gotDing := want.(*dingtalk.DingTalkSink), got.(*dingtalk.DingTalkSink)
+	assert.Equal(t, []string{"13800000000", "13900000000"}, gotDing.AtMobiles)
+	assert.Equal(t, wantDing.AtMobiles, gotDing.AtMobiles)
+	assert.Equal(t, wantDing.Tokens, gotDing.Tokens)
+	assert.Equal(t, wantDing.Level, gotDing.Level)
+	assert.Equal(t, wantDing.MsgType, gotDing.MsgType)
+}
+
+func TestReadInvalidSinkConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sink-config")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "sinks.yaml")
+
+	_, err = ReadSinkConfig(path)
+	assert.Error(t, err)
+
+	tests := []struct {
+		config string
+		err    string
+	}{
+		{
+			config: "sink:\n- type: log\n",
+			err:    path + `:1: unknown key "sink", expected sinks`,
+		},
+		{
+			config: "sinks:\n- type: log\n- type: kafka\n  option:\n    brokers: kafka:9092\n",
+			err:    path + `:4: unknown key "option" in sink 2, expected uri, type, endpoint or options`,
+		},
+		{
+			config: "sinks:\n- type: log\n- endpoint: http://alertmanager:9093\n",
+			err:    path + `:3: sink 2 has neither a uri nor a type`,
+		},
+		{
+			config: "sinks:\n- type: log\n- uri: log\n  options:\n    format: json\n",
+			err:    path + `:3: sink 2 has both a uri and a type, endpoint or options`,
+		},
+		{
+			config: "sinks:\n- type: log\n- uri: ':log'\n",
+			err:    path + `:3: invalid uri of sink 2: missing uri key in ':log'`,
+		},
+		{
+			config: "sinks:\n- type: log\n- uri: carrier-pigeon:?coop=3\n",
+			err:    path + `:3: unknown sink type "carrier-pigeon"`,
+		},
+		{
+			config: "sinks:\n- type: log\n\n- type: carrier-pigeon\n",
+			err:    path + `:4: unknown sink type "carrier-pigeon"`,
+		},
+		{
+			config: "sinks:\n- type: kafka\n  options:\n    eventstopic: events\n    brokers: [[\"kafka:9092\"]]\n",
+			err:    path + `:5: invalid option brokers of sink 1: unsupported value [kafka:9092]`,
+		},
+		{
+			config: "sinks:\n  type: log\n",
+			err:    "failed to parse sink config " + path + ": yaml: unmarshal errors:\n  line 2: cannot unmarshal !!map into []sinks.sinkConfigEntry",
+		},
+	}
+	for _, test := range tests {
+		assert.NoError(t, ioutil.WriteFile(path, []byte(test.config), 0644))
+		_, err := ReadSinkConfig(path)
+		if assert.Error(t, err, test.config) {
+			assert.Equal(t, test.err, err.Error(), test.config)
+		}
+	}
+}
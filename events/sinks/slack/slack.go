@@ -0,0 +1,274 @@
+// Copyright 2018 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package slack
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/facebookarchive/inmem"
+	"github.com/golang/glog"
+	"k8s.io/api/core/v1"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/heapster/events/core"
+	"k8s.io/heapster/version"
+)
+
+const (
+	SLACK_SINK           = "SlackSink"
+	WARNING              = core.LevelWarning
+	NORMAL               = core.LevelNormal
+	CONTENT_TYPE_JSON    = "application/json"
+	MAX_RECORDER         = 500
+	DEFAULT_DEDUP_WINDOW = 5 * time.Minute
+	DEFAULT_TIMEOUT      = 5 * time.Second
+
+	COLOR_WARNING = "#d50200"
+	COLOR_NORMAL  = "#2fa44f"
+	COLOR_UNKNOWN = "#808080"
+)
+
+/*
+*
+slack msg struct
+*/
+type SlackMsg struct {
+	Channel     string            `json:"channel,omitempty"`
+	Attachments []SlackAttachment `json:"attachments"`
+}
+
+type SlackAttachment struct {
+	Fallback string       `json:"fallback"`
+	Color    string       `json:"color"`
+	Title    string       `json:"title"`
+	Text     string       `json:"text"`
+	Fields   []SlackField `json:"fields,omitempty"`
+	Ts       int64        `json:"ts,omitempty"`
+}
+
+type SlackField struct {
+	Title string `json:"title"`
+	Value string `json:"value"`
+	Short bool   `json:"short"`
+}
+
+/*
+*
+slack sink usage
+--sink:slack:https://hooks.slack.com/services/[webhook_path]?channel=%23alerts&level=Warning
+
+channel: optional channel overriding the webhook default. Note that a literal '#' starts the URI fragment, so it should be escaped as %23.
+level: Normal or Warning. The event level greater than global level will emit.
+dedup_window: how long repeats of an event are not sent again, 5m by default.
+timeout: how long a message may take to be sent, 5s by default.
+user_agent: the User-Agent header sent, heapster-events/<version> by default.
+*/
+type SlackSink struct {
+	Endpoint    string
+	Channel     string
+	Level       int
+	DedupWindow time.Duration
+	Timeout     time.Duration
+	UserAgent   string
+
+	recorder inmem.Cache
+	client   *http.Client
+	// exports tracks the batches being sent, for Stop to wait for.
+	exports sync.WaitGroup
+}
+
+func (s *SlackSink) Name() string {
+	return SLACK_SINK
+}
+
+// Stop waits for the messages being sent, which take no longer than the
+// timeout each.
+func (s *SlackSink) Stop() {
+	s.exports.Wait()
+}
+
+func (s *SlackSink) ExportEvents(batch *core.EventBatch) {
+	if err := s.ExportEventsWithError(batch); err != nil {
+		glog.Errorf("failed to send events to slack: %v", err)
+	}
+}
+
+// ExportEventsWithError sends a message for every qualifying event not sent
+// within the dedup window, returning the aggregated errors.
+func (s *SlackSink) ExportEventsWithError(batch *core.EventBatch) error {
+	s.exports.Add(1)
+	defer s.exports.Done()
+	var errs []error
+	for _, event := range batch.Events {
+		if !s.isEventLevelDangerous(event.Type) {
+			continue
+		}
+		key := generateKey(event)
+		if _, ok := s.recorder.Get(key); ok {
+			continue
+		}
+		if err := s.Post(event); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		// if send success ，then add recoreder
+		s.recorder.Add(key, 1, time.Now().Add(s.DedupWindow))
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+func (s *SlackSink) isEventLevelDangerous(level string) bool {
+	return core.IsLevelAtLeast(level, s.Level)
+}
+
+func (s *SlackSink) Post(event *v1.Event) error {
+	msg := createMsgFromEvent(s.Channel, event)
+
+	msg_bytes, err := json.Marshal(msg)
+	if err != nil {
+		glog.Warningf("failed to marshal msg %v", msg)
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, s.Endpoint, bytes.NewBuffer(msg_bytes))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", CONTENT_TYPE_JSON)
+	req.Header.Set("User-Agent", s.UserAgent)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send msg to slack: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to send msg to slack: status %s", resp.Status)
+	}
+	return nil
+}
+
+func getColor(level string) string {
+	switch level {
+	case v1.EventTypeWarning:
+		return COLOR_WARNING
+	case v1.EventTypeNormal:
+		return COLOR_NORMAL
+	default:
+		return COLOR_UNKNOWN
+	}
+}
+
+func createMsgFromEvent(channel string, event *v1.Event) *SlackMsg {
+	title := fmt.Sprintf("[%s] %s", event.Type, event.Reason)
+	attachment := SlackAttachment{
+		Fallback: fmt.Sprintf("%s: %s", title, event.Message),
+		Color:    getColor(event.Type),
+		Title:    title,
+		Text:     event.Message,
+		Fields: []SlackField{
+			{Title: "Namespace", Value: event.Namespace, Short: true},
+			{Title: "Object", Value: fmt.Sprintf("%s/%s", event.InvolvedObject.Kind, event.InvolvedObject.Name), Short: true},
+		},
+	}
+	if !event.LastTimestamp.IsZero() {
+		attachment.Ts = event.LastTimestamp.Unix()
+	}
+	return &SlackMsg{
+		Channel:     channel,
+		Attachments: []SlackAttachment{attachment},
+	}
+}
+
+func NewSlackSink(uri *url.URL) (*SlackSink, error) {
+	s := &SlackSink{
+		Level:       WARNING,
+		DedupWindow: DEFAULT_DEDUP_WINDOW,
+		Timeout:     DEFAULT_TIMEOUT,
+		UserAgent:   version.UserAgent("events"),
+		recorder:    inmem.NewLocked(MAX_RECORDER),
+	}
+	if len(uri.Host) == 0 {
+		return nil, fmt.Errorf("you must provide slack webhook url")
+	}
+	scheme := uri.Scheme
+	if scheme == "" {
+		scheme = "https"
+	}
+	s.Endpoint = fmt.Sprintf("%s://%s%s", scheme, uri.Host, uri.Path)
+
+	opts := uri.Query()
+
+	// An unescaped '#' in channel=#alerts&level=Warning starts the fragment,
+	// so recover the channel and the remaining options from it.
+	if len(opts["channel"]) >= 1 && opts["channel"][0] == "" && uri.Fragment != "" {
+		parts := strings.SplitN(uri.Fragment, "&", 2)
+		opts.Set("channel", "#"+parts[0])
+		if len(parts) > 1 {
+			rest, err := url.ParseQuery(parts[1])
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse slack sink options: %v", err)
+			}
+			for k, v := range rest {
+				opts[k] = v
+			}
+		}
+	}
+
+	if len(opts["channel"]) >= 1 {
+		s.Channel = opts["channel"][0]
+	}
+
+	if len(opts["level"]) >= 1 {
+		level, err := core.ParseLevel(opts["level"][0])
+		if err != nil {
+			return nil, err
+		}
+		s.Level = level
+	}
+
+	if len(opts["user_agent"]) >= 1 && opts["user_agent"][0] != "" {
+		s.UserAgent = opts["user_agent"][0]
+	}
+
+	if len(opts["dedup_window"]) >= 1 {
+		window, err := time.ParseDuration(opts["dedup_window"][0])
+		if err != nil || window < 0 {
+			return nil, fmt.Errorf("dedup_window must be a non-negative duration, got %q", opts["dedup_window"][0])
+		}
+		s.DedupWindow = window
+	}
+
+	if len(opts["timeout"]) >= 1 {
+		timeout, err := time.ParseDuration(opts["timeout"][0])
+		if err != nil || timeout <= 0 {
+			return nil, fmt.Errorf("timeout must be a positive duration, got %q", opts["timeout"][0])
+		}
+		s.Timeout = timeout
+	}
+	s.client = &http.Client{Timeout: s.Timeout}
+
+	return s, nil
+}
+
+func generateKey(event *v1.Event) string {
+	return core.IdentityKey(core.DefaultIdentityFields, event)
+}
@@ -0,0 +1,249 @@
+// Copyright 2018 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package slack
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/api/core/v1"
+	"k8s.io/heapster/events/core"
+	"k8s.io/heapster/version"
+)
+
+func TestNewSlackSink(t *testing.T) {
+	uri, _ := url.Parse("https://hooks.slack.com/services/T000/B000/XXXX?channel=#alerts&level=Normal")
+	sink, err := NewSlackSink(uri)
+	assert.NoError(t, err)
+	assert.Equal(t, "https://hooks.slack.com/services/T000/B000/XXXX", sink.Endpoint)
+	assert.Equal(t, "#alerts", sink.Channel)
+	assert.Equal(t, NORMAL, sink.Level)
+	assert.Equal(t, DEFAULT_DEDUP_WINDOW, sink.DedupWindow)
+	assert.Equal(t, DEFAULT_TIMEOUT, sink.client.Timeout)
+
+	uri, _ = url.Parse("https://hooks.slack.com/services/T000/B000/XXXX?channel=%23ops&dedup_window=1m&timeout=2s")
+	sink, err = NewSlackSink(uri)
+	assert.NoError(t, err)
+	assert.Equal(t, "#ops", sink.Channel)
+	assert.Equal(t, WARNING, sink.Level)
+	assert.Equal(t, time.Minute, sink.DedupWindow)
+	assert.Equal(t, 2*time.Second, sink.client.Timeout)
+
+	for _, invalid := range []string{
+		"?channel=%23ops",
+		"https://hooks.slack.com/services/T000/B000/XXXX?dedup_window=soon",
+		"https://hooks.slack.com/services/T000/B000/XXXX?dedup_window=-1m",
+		"https://hooks.slack.com/services/T000/B000/XXXX?timeout=0s",
+	} {
+		uri, _ = url.Parse(invalid)
+		_, err = NewSlackSink(uri)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestInvalidLevel(t *testing.T) {
+	for _, level := range []string{"Warnig", "warning", "Error"} {
+		uri, _ := url.Parse("https://hooks.slack.com/services/T000/B000/XXXX?level=" + level)
+		_, err := NewSlackSink(uri)
+		assert.Error(t, err, level)
+	}
+}
+
+func TestCreateMsgFromEvent(t *testing.T) {
+	event := &v1.Event{
+		Type:           v1.EventTypeWarning,
+		Reason:         "BackOff",
+		Message:        "Back-off restarting failed container",
+		InvolvedObject: v1.ObjectReference{Kind: "Pod", Name: "web-0"},
+	}
+	msg := createMsgFromEvent("#alerts", event)
+	assert.Equal(t, "#alerts", msg.Channel)
+	assert.Len(t, msg.Attachments, 1)
+	assert.Equal(t, COLOR_WARNING, msg.Attachments[0].Color)
+	assert.Equal(t, "[Warning] BackOff", msg.Attachments[0].Title)
+	assert.Equal(t, "Pod/web-0", msg.Attachments[0].Fields[1].Value)
+
+	event.Type = v1.EventTypeNormal
+	assert.Equal(t, COLOR_NORMAL, createMsgFromEvent("", event).Attachments[0].Color)
+}
+
+func TestExportEventsFiltersAndDedups(t *testing.T) {
+	var mutex sync.Mutex
+	var received []SlackMsg
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var msg SlackMsg
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&msg))
+		mutex.Lock()
+		received = append(received, msg)
+		mutex.Unlock()
+	}))
+	defer server.Close()
+
+	uri, _ := url.Parse(server.URL + "/services/hook")
+	sink, err := NewSlackSink(uri)
+	assert.NoError(t, err)
+
+	warning := &v1.Event{Type: v1.EventTypeWarning, Reason: "BackOff", Message: "restarting"}
+	normal := &v1.Event{Type: v1.EventTypeNormal, Reason: "Pulled", Message: "pulled image"}
+	sink.ExportEvents(&core.EventBatch{Events: []*v1.Event{warning, normal}})
+	sink.ExportEvents(&core.EventBatch{Events: []*v1.Event{warning}})
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	assert.Len(t, received, 1)
+	assert.Equal(t, "restarting", received[0].Attachments[0].Text)
+}
+
+func TestDedupWindow(t *testing.T) {
+	var received int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&received, 1)
+	}))
+	defer server.Close()
+
+	// Without a dedup window, repeats are sent again.
+	uri, _ := url.Parse(server.URL + "/services/hook?dedup_window=0s")
+	sink, err := NewSlackSink(uri)
+	assert.NoError(t, err)
+	warning := &v1.Event{Type: v1.EventTypeWarning, Reason: "BackOff", Message: "restarting"}
+	sink.ExportEvents(&core.EventBatch{Events: []*v1.Event{warning}})
+	sink.ExportEvents(&core.EventBatch{Events: []*v1.Event{warning}})
+	assert.Equal(t, int32(2), atomic.LoadInt32(&received))
+}
+
+func TestTimeout(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	uri, _ := url.Parse(server.URL + "/services/hook?timeout=50ms")
+	sink, err := NewSlackSink(uri)
+	assert.NoError(t, err)
+	warning := &v1.Event{Type: v1.EventTypeWarning, Reason: "BackOff", Message: "restarting"}
+	start := time.Now()
+	assert.Error(t, sink.ExportEventsWithError(&core.EventBatch{Events: []*v1.Event{warning}}))
+	assert.True(t, time.Since(start) < 5*time.Second)
+
+	// Messages that timed out aren't recorded, so they are sent again.
+	_, ok := sink.recorder.Get(generateKey(warning))
+	assert.False(t, ok)
+}
+
+func TestExportEventsFailure(t *testing.T) {
+	var status int32 = http.StatusInternalServerError
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(int(atomic.LoadInt32(&status)))
+	}))
+	defer server.Close()
+
+	uri, _ := url.Parse(server.URL + "/services/hook")
+	sink, err := NewSlackSink(uri)
+	assert.NoError(t, err)
+	assert.True(t, core.ReportsErrors(sink))
+
+	event := &v1.Event{Type: v1.EventTypeWarning, Reason: "BackOff", Message: "failing"}
+	assert.Error(t, sink.ExportEventsWithError(&core.EventBatch{Events: []*v1.Event{event}}))
+
+	// Failed events are not recorded, so they are retried with the next batch.
+	assert.Equal(t, 0, sink.recorder.Len())
+	atomic.StoreInt32(&status, http.StatusOK)
+	assert.NoError(t, sink.ExportEventsWithError(&core.EventBatch{Events: []*v1.Event{event}}))
+	assert.Equal(t, 1, sink.recorder.Len())
+}
+
+func TestGenerateKey(t *testing.T) {
+	event := &v1.Event{
+		Type:           v1.EventTypeWarning,
+		Reason:         "BackOff",
+		Message:        "Back-off restarting failed container",
+		InvolvedObject: v1.ObjectReference{Kind: "Pod", Namespace: "default", Name: "web-0"},
+	}
+	assert.Equal(t, core.IdentityKey(core.DefaultIdentityFields, event), generateKey(event))
+
+	// Events are told apart by the object they are about, not by their own
+	// name.
+	other := *event
+	other.InvolvedObject.Name = "web-1"
+	assert.NotEqual(t, generateKey(event), generateKey(&other))
+	renamed := *event
+	renamed.Name = "web-0.15a2b3c4d5e6f7a8"
+	assert.Equal(t, generateKey(event), generateKey(&renamed))
+}
+
+func TestStopWaitsForExports(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+	}))
+	defer server.Close()
+
+	uri, _ := url.Parse(server.URL + "/services/hook")
+	sink, err := NewSlackSink(uri)
+	assert.NoError(t, err)
+
+	exported := make(chan error, 1)
+	go func() {
+		exported <- sink.ExportEventsWithError(&core.EventBatch{Events: []*v1.Event{
+			{Type: v1.EventTypeWarning, Reason: "BackOff", Message: "restarting"},
+		}})
+	}()
+	<-started
+
+	stopped := make(chan struct{})
+	go func() {
+		sink.Stop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+		t.Fatal("Stop returned while a message was being sent")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(release)
+	<-stopped
+	assert.NoError(t, <-exported)
+}
+
+func TestUserAgentOption(t *testing.T) {
+	userAgent := make(chan string, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userAgent <- r.UserAgent()
+	}))
+	defer server.Close()
+
+	uri, _ := url.Parse(server.URL + "/services/hook")
+	sink, err := NewSlackSink(uri)
+	assert.NoError(t, err)
+	assert.Equal(t, version.UserAgent("events"), sink.UserAgent)
+
+	uri, _ = url.Parse(server.URL + "/services/hook?user_agent=audit/1.0")
+	sink, err = NewSlackSink(uri)
+	assert.NoError(t, err)
+	assert.NoError(t, sink.Post(&v1.Event{Type: v1.EventTypeWarning, Reason: "BackOff", Message: "restarting"}))
+	assert.Equal(t, "audit/1.0", <-userAgent)
+}
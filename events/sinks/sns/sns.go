@@ -0,0 +1,230 @@
+// Copyright 2018 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sns
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	awssns "github.com/aws/aws-sdk-go/service/sns"
+	"github.com/aws/aws-sdk-go/service/sns/snsiface"
+	"github.com/facebookarchive/inmem"
+	"github.com/golang/glog"
+	"k8s.io/api/core/v1"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/heapster/events/core"
+)
+
+const (
+	SNS_SINK             = "SNSSink"
+	WARNING              = core.LevelWarning
+	NORMAL               = core.LevelNormal
+	MAX_RECORDER         = 500
+	DEFAULT_DEDUP_WINDOW = 5 * time.Minute
+
+	// Message attributes subscribers can filter on.
+	ATTRIBUTE_REASON    = "reason"
+	ATTRIBUTE_NAMESPACE = "namespace"
+	ATTRIBUTE_KIND      = "kind"
+	ATTRIBUTE_LEVEL     = "level"
+)
+
+// SNSMessage is the JSON message published for an event.
+type SNSMessage struct {
+	Namespace      string    `json:"namespace,omitempty"`
+	Kind           string    `json:"kind,omitempty"`
+	Name           string    `json:"name,omitempty"`
+	Level          string    `json:"level"`
+	Reason         string    `json:"reason"`
+	Message        string    `json:"message"`
+	Count          int32     `json:"count"`
+	FirstTimestamp time.Time `json:"firstTimestamp"`
+	LastTimestamp  time.Time `json:"lastTimestamp"`
+	Host           string    `json:"host,omitempty"`
+}
+
+/*
+sns sink usage
+--sink=sns:?region=us-east-1&topic_arn=arn:aws:sns:us-east-1:123456789012:events&level=Warning
+
+topic_arn: the ARN of the topic events are published to, required.
+region: the region of the topic, taken from topic_arn by default.
+level: Normal or Warning. The event level greater than global level will emit.
+dedup_window: how long repeats of an event are not sent again, 5m by default.
+Credentials are taken from the default AWS credential chain: the environment,
+the shared credentials file or the instance role.
+*/
+type SNSSink struct {
+	TopicARN    string
+	Region      string
+	Level       int
+	DedupWindow time.Duration
+
+	client   snsiface.SNSAPI
+	recorder inmem.Cache
+}
+
+func (s *SNSSink) Name() string {
+	return SNS_SINK
+}
+
+func (s *SNSSink) Stop() {
+	//do nothing
+}
+
+func (s *SNSSink) ExportEvents(batch *core.EventBatch) {
+	if err := s.ExportEventsWithError(batch); err != nil {
+		glog.Errorf("failed to publish events to sns: %v", err)
+	}
+}
+
+// ExportEventsWithError publishes every qualifying event not sent within the
+// dedup window, returning the aggregated errors.
+func (s *SNSSink) ExportEventsWithError(batch *core.EventBatch) error {
+	var errs []error
+	for _, event := range batch.Events {
+		if !s.isEventLevelDangerous(event.Type) {
+			continue
+		}
+		key := core.IdentityKey(core.DefaultIdentityFields, event)
+		if _, ok := s.recorder.Get(key); ok {
+			continue
+		}
+		if err := s.Publish(event); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		// if send success ，then add recoreder
+		s.recorder.Add(key, 1, time.Now().Add(s.DedupWindow))
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+func (s *SNSSink) isEventLevelDangerous(level string) bool {
+	return core.IsLevelAtLeast(level, s.Level)
+}
+
+func (s *SNSSink) Publish(event *v1.Event) error {
+	msg_bytes, err := json.Marshal(createMsgFromEvent(event))
+	if err != nil {
+		glog.Warningf("failed to marshal sns message for event %v", event)
+		return err
+	}
+
+	_, err = s.client.Publish(&awssns.PublishInput{
+		TopicArn:          aws.String(s.TopicARN),
+		Message:           aws.String(string(msg_bytes)),
+		MessageAttributes: createAttributes(event),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to publish event to sns: %v", err)
+	}
+	return nil
+}
+
+func createMsgFromEvent(event *v1.Event) *SNSMessage {
+	return &SNSMessage{
+		Namespace:      event.InvolvedObject.Namespace,
+		Kind:           event.InvolvedObject.Kind,
+		Name:           event.InvolvedObject.Name,
+		Level:          event.Type,
+		Reason:         event.Reason,
+		Message:        event.Message,
+		Count:          event.Count,
+		FirstTimestamp: event.FirstTimestamp.UTC(),
+		LastTimestamp:  event.LastTimestamp.UTC(),
+		Host:           event.Source.Host,
+	}
+}
+
+// createAttributes returns the message attributes of the event. SNS rejects
+// empty attribute values, so those are left out.
+func createAttributes(event *v1.Event) map[string]*awssns.MessageAttributeValue {
+	attributes := make(map[string]*awssns.MessageAttributeValue)
+	for name, value := range map[string]string{
+		ATTRIBUTE_REASON:    event.Reason,
+		ATTRIBUTE_NAMESPACE: event.InvolvedObject.Namespace,
+		ATTRIBUTE_KIND:      event.InvolvedObject.Kind,
+		ATTRIBUTE_LEVEL:     event.Type,
+	} {
+		if value == "" {
+			continue
+		}
+		attributes[name] = &awssns.MessageAttributeValue{
+			DataType:    aws.String("String"),
+			StringValue: aws.String(value),
+		}
+	}
+	return attributes
+}
+
+// regionFromARN returns the region of an ARN, arn:partition:service:region:account:resource.
+func regionFromARN(arn string) string {
+	parts := strings.SplitN(arn, ":", 6)
+	if len(parts) != 6 || parts[0] != "arn" {
+		return ""
+	}
+	return parts[3]
+}
+
+func NewSNSSink(uri *url.URL) (*SNSSink, error) {
+	s := &SNSSink{
+		Level:       WARNING,
+		DedupWindow: DEFAULT_DEDUP_WINDOW,
+		recorder:    inmem.NewLocked(MAX_RECORDER),
+	}
+	opts := uri.Query()
+
+	if len(opts["topic_arn"]) >= 1 && opts["topic_arn"][0] != "" {
+		s.TopicARN = opts["topic_arn"][0]
+	} else {
+		return nil, fmt.Errorf("you must provide sns topic_arn")
+	}
+
+	if len(opts["region"]) >= 1 && opts["region"][0] != "" {
+		s.Region = opts["region"][0]
+	} else if s.Region = regionFromARN(s.TopicARN); s.Region == "" {
+		return nil, fmt.Errorf("you must provide sns region, it can't be taken from topic_arn %q", s.TopicARN)
+	}
+
+	if len(opts["level"]) >= 1 {
+		level, err := core.ParseLevel(opts["level"][0])
+		if err != nil {
+			return nil, err
+		}
+		s.Level = level
+	}
+
+	if len(opts["dedup_window"]) >= 1 {
+		window, err := time.ParseDuration(opts["dedup_window"][0])
+		if err != nil || window < 0 {
+			return nil, fmt.Errorf("dedup_window must be a non-negative duration, got %q", opts["dedup_window"][0])
+		}
+		s.DedupWindow = window
+	}
+
+	sess, err := session.NewSession(&aws.Config{Region: aws.String(s.Region)})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create aws session: %v", err)
+	}
+	s.client = awssns.New(sess)
+
+	return s, nil
+}
@@ -0,0 +1,112 @@
+// Copyright 2018 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sns
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	awssns "github.com/aws/aws-sdk-go/service/sns"
+	"github.com/aws/aws-sdk-go/service/sns/snsiface"
+	"github.com/facebookarchive/inmem"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/api/core/v1"
+	"k8s.io/heapster/events/core"
+)
+
+type fakeSNS struct {
+	snsiface.SNSAPI
+	err       error
+	published []*awssns.PublishInput
+}
+
+func (f *fakeSNS) Publish(input *awssns.PublishInput) (*awssns.PublishOutput, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	f.published = append(f.published, input)
+	return &awssns.PublishOutput{MessageId: aws.String("1")}, nil
+}
+
+func TestNewSNSSink(t *testing.T) {
+	uri, _ := url.Parse("?topic_arn=arn:aws:sns:eu-west-1:123456789012:events&level=Normal&dedup_window=1m")
+	sink, err := NewSNSSink(uri)
+	assert.NoError(t, err)
+	assert.Equal(t, "eu-west-1", sink.Region)
+	assert.Equal(t, NORMAL, sink.Level)
+	assert.Equal(t, time.Minute, sink.DedupWindow)
+
+	uri, _ = url.Parse("?region=us-east-1&topic_arn=arn:aws:sns:eu-west-1:123456789012:events")
+	sink, err = NewSNSSink(uri)
+	assert.NoError(t, err)
+	assert.Equal(t, "us-east-1", sink.Region)
+	assert.Equal(t, WARNING, sink.Level)
+
+	for _, invalid := range []string{"?region=us-east-1", "?topic_arn=events", "?topic_arn=arn:aws:sns:eu-west-1:1:events&dedup_window=soon"} {
+		uri, _ = url.Parse(invalid)
+		_, err = NewSNSSink(uri)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestInvalidLevel(t *testing.T) {
+	for _, level := range []string{"Warnig", "warning", "Error"} {
+		uri, _ := url.Parse("?topic_arn=arn:aws:sns:eu-west-1:123456789012:events&level=" + level)
+		_, err := NewSNSSink(uri)
+		assert.Error(t, err, level)
+	}
+}
+
+func TestExportEvents(t *testing.T) {
+	client := &fakeSNS{}
+	sink := &SNSSink{
+		TopicARN:    "arn:aws:sns:eu-west-1:123456789012:events",
+		Level:       WARNING,
+		DedupWindow: time.Minute,
+		client:      client,
+		recorder:    inmem.NewLocked(MAX_RECORDER),
+	}
+
+	warning := &v1.Event{Type: v1.EventTypeWarning, Reason: "BackOff", Message: "restarting",
+		InvolvedObject: v1.ObjectReference{Kind: "Pod", Namespace: "default", Name: "web-0"}}
+	normal := &v1.Event{Type: v1.EventTypeNormal, Reason: "Pulled", Message: "pulled image"}
+	assert.NoError(t, sink.ExportEventsWithError(&core.EventBatch{Events: []*v1.Event{warning, normal, warning}}))
+
+	// The normal event is below the level and the repeat is deduplicated.
+	assert.Len(t, client.published, 1)
+	input := client.published[0]
+	assert.Equal(t, sink.TopicARN, *input.TopicArn)
+	assert.Equal(t, "BackOff", *input.MessageAttributes[ATTRIBUTE_REASON].StringValue)
+	assert.Equal(t, "default", *input.MessageAttributes[ATTRIBUTE_NAMESPACE].StringValue)
+
+	var msg SNSMessage
+	assert.NoError(t, json.Unmarshal([]byte(*input.Message), &msg))
+	assert.Equal(t, "restarting", msg.Message)
+	assert.Equal(t, "web-0", msg.Name)
+
+	// Failed events are published again the next time.
+	client.err = fmt.Errorf("throttled")
+	other := &v1.Event{Type: v1.EventTypeWarning, Reason: "Failed", Message: "failed"}
+	assert.Error(t, sink.ExportEventsWithError(&core.EventBatch{Events: []*v1.Event{other}}))
+	client.err = nil
+	assert.NoError(t, sink.ExportEventsWithError(&core.EventBatch{Events: []*v1.Event{other}}))
+	assert.Len(t, client.published, 2)
+	// Empty attribute values are left out.
+	assert.NotContains(t, client.published[1].MessageAttributes, ATTRIBUTE_NAMESPACE)
+}
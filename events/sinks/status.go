@@ -0,0 +1,152 @@
+// Copyright 2018 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sinks
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"k8s.io/heapster/events/core"
+)
+
+// Results of the exports to a sink, as reported in SinkStatus.
+const (
+	ExportSucceeded = "success"
+	ExportFailed    = "failure"
+	ExportTimedOut  = "timeout"
+	// ExportDropped is the result of batches dropped because the sink was
+	// still busy with an earlier export.
+	ExportDropped = "dropped"
+	// ExportUnknown is the result of exports that completed in time to sinks
+	// that don't report whether they failed.
+	ExportUnknown = "unknown"
+)
+
+// SinkStatus describes a sink of the sink manager and how its exports went.
+type SinkStatus struct {
+	Name string `json:"name"`
+	// URI is the URI the sink was built from, secrets redacted.
+	URI                 string     `json:"uri,omitempty"`
+	LastExportTime      *time.Time `json:"lastExportTime,omitempty"`
+	LastSuccessTime     *time.Time `json:"lastSuccessTime,omitempty"`
+	LastExportResult    string     `json:"lastExportResult,omitempty"`
+	LastError           string     `json:"lastError,omitempty"`
+	ConsecutiveFailures int        `json:"consecutiveFailures"`
+	// ReportsErrors tells whether the sink reports failed exports. If it
+	// doesn't, only timeouts count as failures and the health policy leaves
+	// it out.
+	ReportsErrors bool `json:"reportsErrors"`
+	// QueueDepth is the number of batches queued for the sink, nil if the
+	// manager doesn't queue batches.
+	QueueDepth    *int `json:"queueDepth,omitempty"`
+	QueueCapacity int  `json:"queueCapacity,omitempty"`
+
+	sink core.EventSink
+	// started is when the manager started exporting to the sink.
+	started time.Time
+}
+
+// Sink returns the sink described.
+func (this *SinkStatus) Sink() core.EventSink {
+	return this.sink
+}
+
+// SinkStatusReporter is implemented by the sink manager, which records the
+// result of every export.
+type SinkStatusReporter interface {
+	SinkStatuses() []SinkStatus
+}
+
+// sinkStatus records the exports to a sink. It is locked only to record
+// and read the results, never during exports.
+type sinkStatus struct {
+	sync.Mutex
+	reportsErrors bool
+	started       time.Time
+	lastExport    time.Time
+	lastSuccess   time.Time
+	result        string
+	err           string
+	failures      int
+}
+
+func newSinkStatus(reportsErrors bool) *sinkStatus {
+	return &sinkStatus{reportsErrors: reportsErrors, started: time.Now()}
+}
+
+func (this *sinkStatus) record(err error) {
+	result := ExportSucceeded
+	switch {
+	case err == context.DeadlineExceeded:
+		result = ExportTimedOut
+	case err != nil:
+		result = ExportFailed
+	case !this.reportsErrors:
+		result = ExportUnknown
+	}
+	this.recordResult(result, err)
+}
+
+func (this *sinkStatus) recordResult(result string, err error) {
+	this.Lock()
+	defer this.Unlock()
+	this.lastExport = time.Now()
+	this.result = result
+	this.err = ""
+	if err != nil {
+		this.err = err.Error()
+	}
+	switch result {
+	case ExportSucceeded:
+		this.lastSuccess = this.lastExport
+		this.failures = 0
+	case ExportUnknown:
+		this.failures = 0
+	default:
+		this.failures++
+	}
+}
+
+// SinkStatuses returns the status of every sink.
+func (this *sinkManager) SinkStatuses() []SinkStatus {
+	sinkHolders := this.holders()
+	statuses := make([]SinkStatus, 0, len(sinkHolders))
+	for _, sh := range sinkHolders {
+		status := SinkStatus{Name: sh.sink.Name(), sink: sh.sink}
+		sh.status.Lock()
+		status.started = sh.status.started
+		if !sh.status.lastExport.IsZero() {
+			lastExport := sh.status.lastExport
+			status.LastExportTime = &lastExport
+		}
+		if !sh.status.lastSuccess.IsZero() {
+			lastSuccess := sh.status.lastSuccess
+			status.LastSuccessTime = &lastSuccess
+		}
+		status.LastExportResult = sh.status.result
+		status.LastError = sh.status.err
+		status.ConsecutiveFailures = sh.status.failures
+		status.ReportsErrors = sh.status.reportsErrors
+		sh.status.Unlock()
+		if sh.queue != nil {
+			depth := sh.queue.len()
+			status.QueueDepth = &depth
+			status.QueueCapacity = sh.queue.depth
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
@@ -0,0 +1,240 @@
+// Copyright 2018 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package teams
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/facebookarchive/inmem"
+	"github.com/golang/glog"
+	"k8s.io/api/core/v1"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/heapster/events/core"
+	"k8s.io/heapster/version"
+)
+
+const (
+	TEAMS_SINK           = "TeamsSink"
+	WARNING              = core.LevelWarning
+	NORMAL               = core.LevelNormal
+	CONTENT_TYPE_JSON    = "application/json"
+	MAX_RECORDER         = 500
+	DEFAULT_DEDUP_WINDOW = 5 * time.Minute
+	DEFAULT_TIMEOUT      = 5 * time.Second
+
+	MESSAGE_CARD_TYPE    = "MessageCard"
+	MESSAGE_CARD_CONTEXT = "https://schema.org/extensions"
+
+	COLOR_WARNING = "d50200"
+	COLOR_NORMAL  = "2fa44f"
+	COLOR_UNKNOWN = "808080"
+)
+
+/*
+teams msg struct, see
+https://docs.microsoft.com/en-us/outlook/actionable-messages/message-card-reference
+*/
+type TeamsMsg struct {
+	Type       string         `json:"@type"`
+	Context    string         `json:"@context"`
+	ThemeColor string         `json:"themeColor"`
+	Summary    string         `json:"summary"`
+	Title      string         `json:"title"`
+	Text       string         `json:"text"`
+	Sections   []TeamsSection `json:"sections,omitempty"`
+}
+
+type TeamsSection struct {
+	Facts []TeamsFact `json:"facts"`
+}
+
+type TeamsFact struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+/*
+teams sink usage
+--sink=teams:https://outlook.office.com/webhook/[webhook_path]?level=Warning
+
+level: Normal or Warning. The event level greater than global level will emit.
+dedup_window: how long repeats of an event are not sent again, 5m by default.
+timeout: how long a message may take to be sent, 5s by default.
+user_agent: the User-Agent header sent, heapster-events/<version> by default.
+*/
+type TeamsSink struct {
+	Endpoint    string
+	Level       int
+	DedupWindow time.Duration
+	Timeout     time.Duration
+	UserAgent   string
+
+	recorder inmem.Cache
+	client   *http.Client
+}
+
+func (t *TeamsSink) Name() string {
+	return TEAMS_SINK
+}
+
+func (t *TeamsSink) Stop() {
+	//do nothing
+}
+
+func (t *TeamsSink) ExportEvents(batch *core.EventBatch) {
+	if err := t.ExportEventsWithError(batch); err != nil {
+		glog.Errorf("failed to send events to teams: %v", err)
+	}
+}
+
+// ExportEventsWithError sends a message for every qualifying event not sent
+// within the dedup window, returning the aggregated errors.
+func (t *TeamsSink) ExportEventsWithError(batch *core.EventBatch) error {
+	var errs []error
+	for _, event := range batch.Events {
+		if !t.isEventLevelDangerous(event.Type) {
+			continue
+		}
+		key := generateKey(event)
+		if _, ok := t.recorder.Get(key); ok {
+			continue
+		}
+		if err := t.Post(event); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		// if send success ，then add recoreder
+		t.recorder.Add(key, 1, time.Now().Add(t.DedupWindow))
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+func (t *TeamsSink) isEventLevelDangerous(level string) bool {
+	return core.IsLevelAtLeast(level, t.Level)
+}
+
+func (t *TeamsSink) Post(event *v1.Event) error {
+	msg := createMsgFromEvent(event)
+
+	msg_bytes, err := json.Marshal(msg)
+	if err != nil {
+		glog.Warningf("failed to marshal msg %v", msg)
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, t.Endpoint, bytes.NewBuffer(msg_bytes))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", CONTENT_TYPE_JSON)
+	req.Header.Set("User-Agent", t.UserAgent)
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send msg to teams: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to send msg to teams: status %s", resp.Status)
+	}
+	return nil
+}
+
+func getColor(level string) string {
+	switch level {
+	case v1.EventTypeWarning:
+		return COLOR_WARNING
+	case v1.EventTypeNormal:
+		return COLOR_NORMAL
+	default:
+		return COLOR_UNKNOWN
+	}
+}
+
+func createMsgFromEvent(event *v1.Event) *TeamsMsg {
+	title := fmt.Sprintf("[%s] %s", event.Type, event.Reason)
+	facts := []TeamsFact{
+		{Name: "Namespace", Value: event.Namespace},
+		{Name: "Object", Value: fmt.Sprintf("%s/%s", event.InvolvedObject.Kind, event.InvolvedObject.Name)},
+	}
+	if !event.LastTimestamp.IsZero() {
+		facts = append(facts, TeamsFact{Name: "Timestamp", Value: event.LastTimestamp.UTC().Format(time.RFC3339)})
+	}
+	return &TeamsMsg{
+		Type:       MESSAGE_CARD_TYPE,
+		Context:    MESSAGE_CARD_CONTEXT,
+		ThemeColor: getColor(event.Type),
+		Summary:    fmt.Sprintf("%s: %s", title, event.Message),
+		Title:      title,
+		Text:       event.Message,
+		Sections:   []TeamsSection{{Facts: facts}},
+	}
+}
+
+func NewTeamsSink(uri *url.URL) (*TeamsSink, error) {
+	t := &TeamsSink{
+		Level:       WARNING,
+		DedupWindow: DEFAULT_DEDUP_WINDOW,
+		Timeout:     DEFAULT_TIMEOUT,
+		UserAgent:   version.UserAgent("events"),
+		recorder:    inmem.NewLocked(MAX_RECORDER),
+	}
+	if len(uri.Host) == 0 {
+		return nil, fmt.Errorf("you must provide teams webhook url")
+	}
+	scheme := uri.Scheme
+	if scheme == "" {
+		scheme = "https"
+	}
+	t.Endpoint = fmt.Sprintf("%s://%s%s", scheme, uri.Host, uri.Path)
+
+	opts := uri.Query()
+
+	if len(opts["level"]) >= 1 {
+		t.Level = core.EventLevel(opts["level"][0])
+	}
+
+	if len(opts["user_agent"]) >= 1 && opts["user_agent"][0] != "" {
+		t.UserAgent = opts["user_agent"][0]
+	}
+
+	if len(opts["dedup_window"]) >= 1 {
+		window, err := time.ParseDuration(opts["dedup_window"][0])
+		if err != nil || window < 0 {
+			return nil, fmt.Errorf("dedup_window must be a non-negative duration, got %q", opts["dedup_window"][0])
+		}
+		t.DedupWindow = window
+	}
+
+	if len(opts["timeout"]) >= 1 {
+		timeout, err := time.ParseDuration(opts["timeout"][0])
+		if err != nil || timeout <= 0 {
+			return nil, fmt.Errorf("timeout must be a positive duration, got %q", opts["timeout"][0])
+		}
+		t.Timeout = timeout
+	}
+	t.client = &http.Client{Timeout: t.Timeout}
+
+	return t, nil
+}
+
+func generateKey(event *v1.Event) string {
+	return core.IdentityKey(core.DefaultIdentityFields, event)
+}
@@ -0,0 +1,134 @@
+// Copyright 2018 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package teams
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/api/core/v1"
+	"k8s.io/heapster/events/core"
+)
+
+func TestNewTeamsSink(t *testing.T) {
+	uri, _ := url.Parse("https://outlook.office.com/webhook/abc/IncomingWebhook/def?level=Normal&dedup_window=1m")
+	sink, err := NewTeamsSink(uri)
+	assert.NoError(t, err)
+	assert.Equal(t, "https://outlook.office.com/webhook/abc/IncomingWebhook/def", sink.Endpoint)
+	assert.Equal(t, NORMAL, sink.Level)
+	assert.Equal(t, time.Minute, sink.DedupWindow)
+	assert.Equal(t, DEFAULT_TIMEOUT, sink.client.Timeout)
+
+	uri, _ = url.Parse("https://outlook.office.com/webhook/abc/IncomingWebhook/def?timeout=2s")
+	sink, err = NewTeamsSink(uri)
+	assert.NoError(t, err)
+	assert.Equal(t, 2*time.Second, sink.client.Timeout)
+
+	for _, invalid := range []string{
+		"?level=Warning",
+		"https://outlook.office.com/webhook?dedup_window=soon",
+		"https://outlook.office.com/webhook?timeout=0s",
+	} {
+		uri, _ = url.Parse(invalid)
+		_, err = NewTeamsSink(uri)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestCreateMsgFromEvent(t *testing.T) {
+	event := &v1.Event{
+		Type:           v1.EventTypeWarning,
+		Reason:         "BackOff",
+		Message:        "Back-off restarting failed container",
+		InvolvedObject: v1.ObjectReference{Kind: "Pod", Name: "web-0"},
+	}
+	msg := createMsgFromEvent(event)
+	assert.Equal(t, MESSAGE_CARD_TYPE, msg.Type)
+	assert.Equal(t, COLOR_WARNING, msg.ThemeColor)
+	assert.Equal(t, "[Warning] BackOff", msg.Title)
+	assert.Equal(t, "Back-off restarting failed container", msg.Text)
+	assert.Equal(t, "Pod/web-0", msg.Sections[0].Facts[1].Value)
+
+	event.Type = v1.EventTypeNormal
+	assert.Equal(t, COLOR_NORMAL, createMsgFromEvent(event).ThemeColor)
+}
+
+func TestExportEventsFiltersAndDedups(t *testing.T) {
+	var mutex sync.Mutex
+	var received []TeamsMsg
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var msg TeamsMsg
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&msg))
+		mutex.Lock()
+		received = append(received, msg)
+		mutex.Unlock()
+	}))
+	defer server.Close()
+
+	uri, _ := url.Parse(server.URL + "/webhook/hook")
+	sink, err := NewTeamsSink(uri)
+	assert.NoError(t, err)
+
+	warning := &v1.Event{Type: v1.EventTypeWarning, Reason: "BackOff", Message: "restarting"}
+	normal := &v1.Event{Type: v1.EventTypeNormal, Reason: "Pulled", Message: "pulled image"}
+	sink.ExportEvents(&core.EventBatch{Events: []*v1.Event{warning, normal}})
+	sink.ExportEvents(&core.EventBatch{Events: []*v1.Event{warning}})
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	assert.Len(t, received, 1)
+	assert.Equal(t, "restarting", received[0].Text)
+}
+
+func TestExportEventsFailure(t *testing.T) {
+	var status int32 = http.StatusBadRequest
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&status) == 0 {
+			<-release
+			return
+		}
+		w.WriteHeader(int(atomic.LoadInt32(&status)))
+	}))
+	defer server.Close()
+	defer close(release)
+
+	uri, _ := url.Parse(server.URL + "/webhook/hook?timeout=50ms")
+	sink, err := NewTeamsSink(uri)
+	assert.NoError(t, err)
+	assert.True(t, core.ReportsErrors(sink))
+
+	event := &v1.Event{Type: v1.EventTypeWarning, Reason: "BackOff", Message: "failing"}
+	assert.Error(t, sink.ExportEventsWithError(&core.EventBatch{Events: []*v1.Event{event}}))
+
+	// Hanging requests time out.
+	atomic.StoreInt32(&status, 0)
+	start := time.Now()
+	assert.Error(t, sink.ExportEventsWithError(&core.EventBatch{Events: []*v1.Event{event}}))
+	assert.True(t, time.Since(start) < 5*time.Second)
+
+	// Failed events are not recorded, so they are retried with the next batch.
+	assert.Equal(t, 0, sink.recorder.Len())
+	atomic.StoreInt32(&status, http.StatusOK)
+	assert.NoError(t, sink.ExportEventsWithError(&core.EventBatch{Events: []*v1.Event{event}}))
+	assert.Equal(t, 1, sink.recorder.Len())
+}
@@ -0,0 +1,87 @@
+// Copyright 2018 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sinks
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"time"
+
+	"k8s.io/heapster/events/core"
+)
+
+// exportTimeoutOption may be given to sinks whose exports can be cancelled to
+// override the export timeout of the sink manager, e.g.
+// --sink=elasticsearch:http://es:9200?export_timeout=45s.
+const exportTimeoutOption = "export_timeout"
+
+// exportTimeoutSink bounds the exports of a sink by its own timeout.
+type exportTimeoutSink struct {
+	sink    core.EventSink
+	timeout time.Duration
+}
+
+// withExportTimeout wraps the sink if the uri has the export_timeout option.
+func withExportTimeout(sink core.EventSink, val *url.URL) (core.EventSink, error) {
+	opts := val.Query()
+	if len(opts[exportTimeoutOption]) == 0 {
+		return sink, nil
+	}
+	timeout, err := time.ParseDuration(opts[exportTimeoutOption][0])
+	if err != nil || timeout <= 0 {
+		return nil, fmt.Errorf("%s must be a positive duration, got %q", exportTimeoutOption, opts[exportTimeoutOption][0])
+	}
+	if !core.SupportsContext(sink) {
+		sink.Stop()
+		return nil, fmt.Errorf("%s isn't supported by the %s sink, its exports can't be cancelled", exportTimeoutOption, sink.Name())
+	}
+	return &exportTimeoutSink{sink: sink, timeout: timeout}, nil
+}
+
+// exportTimeout returns the timeout of exports to the sink, the given
+// default unless the sink has its own.
+func exportTimeout(sink core.EventSink, defaultTimeout time.Duration) time.Duration {
+	if s, ok := sink.(*exportTimeoutSink); ok {
+		return s.timeout
+	}
+	return defaultTimeout
+}
+
+func (this *exportTimeoutSink) Name() string {
+	return this.sink.Name()
+}
+
+func (this *exportTimeoutSink) Stop() {
+	this.sink.Stop()
+}
+
+func (this *exportTimeoutSink) WrappedSinks() []core.EventSink {
+	return []core.EventSink{this.sink}
+}
+
+func (this *exportTimeoutSink) ExportEvents(batch *core.EventBatch) {
+	this.ExportEventsContext(context.Background(), batch)
+}
+
+func (this *exportTimeoutSink) ExportEventsWithError(batch *core.EventBatch) error {
+	return this.ExportEventsContext(context.Background(), batch)
+}
+
+func (this *exportTimeoutSink) ExportEventsContext(ctx context.Context, batch *core.EventBatch) error {
+	ctx, cancel := context.WithTimeout(ctx, this.timeout)
+	defer cancel()
+	return core.ExportEventsContext(ctx, this.sink, batch)
+}
@@ -0,0 +1,117 @@
+// Copyright 2018 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sinks
+
+import (
+	"context"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	kube_api "k8s.io/api/core/v1"
+	"k8s.io/heapster/common/flags"
+	"k8s.io/heapster/events/core"
+	"k8s.io/heapster/events/util"
+)
+
+// blockingSink exports until its context is done.
+type blockingSink struct {
+	fakeSink
+}
+
+func (s *blockingSink) ExportEventsContext(ctx context.Context, batch *core.EventBatch) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestExportTimeoutWinsOverDefault(t *testing.T) {
+	slow := &exportTimeoutSink{sink: util.NewDummySink("slow", 30*time.Second), timeout: time.Second}
+	manager, _ := NewEventSinkManager([]core.EventSink{slow}, 20*time.Second, time.Second, 0)
+
+	// The second and third batches wait for the slow sink for a second each,
+	// not for the default 20 seconds.
+	elapsed := doThreeBatches(manager)
+	if elapsed > 4*time.Second {
+		t.Fatalf("3xExportEvents took too long: %s", elapsed)
+	}
+	if elapsed < 2*time.Second-500*time.Millisecond {
+		t.Fatalf("3xExportEvents took too short: %s", elapsed)
+	}
+	assert.Equal(t, 1, slow.sink.(*util.DummySink).GetExportCount())
+
+	// The export itself is bounded by the timeout too.
+	blocking := &exportTimeoutSink{sink: &blockingSink{fakeSink{name: "blocking"}}, timeout: 100 * time.Millisecond}
+	start := time.Now()
+	assert.Equal(t, context.DeadlineExceeded, blocking.ExportEventsContext(context.Background(), &core.EventBatch{}))
+	assert.True(t, time.Since(start) < time.Second)
+}
+
+func TestExportTimeoutOfWrappers(t *testing.T) {
+	Register("blocking-fake", func(uri *url.URL) (core.EventSink, error) {
+		return &blockingSink{fakeSink{name: "blocking"}}, nil
+	})
+	batch := &core.EventBatch{Events: []*kube_api.Event{{Reason: "NodeNotReady"}}}
+	for _, value := range []string{
+		"route:?match=" + url.QueryEscape("Node.*=blocking-fake") + "&export_timeout=100ms",
+		"route:?match=" + url.QueryEscape("Node.*=blocking-fake:?export_timeout=100ms"),
+		"sample:blocking-fake:?rate=1&export_timeout=100ms",
+		"circuitbreaker:blocking-fake:?export_timeout=100ms",
+		"maxbatch:blocking-fake:?maxbatch=10&export_timeout=100ms",
+	} {
+		var uri flags.Uri
+		assert.NoError(t, uri.Set(value))
+		sink, err := NewSinkFactory().Build(uri)
+		if !assert.NoError(t, err, value) {
+			continue
+		}
+		start := time.Now()
+		err = core.ExportEventsContext(context.Background(), sink, batch)
+		assert.Error(t, err, value)
+		assert.Contains(t, err.Error(), context.DeadlineExceeded.Error(), value)
+		assert.True(t, time.Since(start) < time.Second, value)
+	}
+}
+
+func TestBuildWithExportTimeout(t *testing.T) {
+	factory := NewSinkFactory()
+	tests := []struct {
+		uri      string
+		expected time.Duration
+	}{
+		{"log", DefaultSinkExportEventsTimeout},
+		{"log:?export_timeout=45s", 45 * time.Second},
+		{"log:?export_timeout=5s&minlevel=Warning", 5 * time.Second},
+		{"maxbatch:log:?maxbatch=10&export_timeout=5s", 5 * time.Second},
+	}
+	for _, test := range tests {
+		var uri flags.Uri
+		assert.NoError(t, uri.Set(test.uri))
+		sink, err := factory.Build(uri)
+		assert.NoError(t, err, test.uri)
+		assert.Equal(t, test.expected, exportTimeout(sink, DefaultSinkExportEventsTimeout), test.uri)
+	}
+
+	// Exports of sinks that can't be cancelled couldn't be bounded.
+	Register("uncancellable-fake", func(uri *url.URL) (core.EventSink, error) {
+		return &fakeSink{name: "uncancellable"}, nil
+	})
+	for _, invalid := range []string{"log:?export_timeout=0s", "log:?export_timeout=soon", "uncancellable-fake:?export_timeout=5s", "sample:uncancellable-fake:?rate=0.5&export_timeout=5s"} {
+		var uri flags.Uri
+		assert.NoError(t, uri.Set(invalid))
+		_, err := factory.Build(uri)
+		assert.Error(t, err, invalid)
+	}
+}
@@ -0,0 +1,59 @@
+// Copyright 2018 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sinks
+
+import (
+	"fmt"
+	"io"
+
+	"k8s.io/heapster/common/flags"
+	"k8s.io/heapster/events/core"
+)
+
+// ValidateAll builds every sink and checks that those implementing
+// core.EventSinkHealthChecker reach what they export to. It returns an error
+// per uri, nil for the sinks that passed. The sinks built are stopped.
+func (this *SinkFactory) ValidateAll(uris flags.Uris) []error {
+	errs := make([]error, len(uris))
+	for i, uri := range uris {
+		sink, err := this.Build(uri)
+		if err != nil {
+			errs[i] = err
+			continue
+		}
+		if checker, ok := sink.(core.EventSinkHealthChecker); ok {
+			if err := checker.HealthCheck(); err != nil {
+				errs[i] = fmt.Errorf("health check failed: %v", err)
+			}
+		}
+		sink.Stop()
+	}
+	return errs
+}
+
+// PrintValidation writes a PASS or FAIL line per sink validated by
+// ValidateAll and tells whether all of them passed.
+func PrintValidation(w io.Writer, uris flags.Uris, errs []error) bool {
+	passed := true
+	for i, uri := range uris {
+		if errs[i] != nil {
+			fmt.Fprintf(w, "FAIL %s: %v\n", uri.Key, errs[i])
+			passed = false
+			continue
+		}
+		fmt.Fprintf(w, "PASS %s\n", uri.Key)
+	}
+	return passed
+}
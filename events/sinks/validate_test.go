@@ -0,0 +1,64 @@
+// Copyright 2018 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sinks
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/heapster/common/flags"
+)
+
+func TestValidateAll(t *testing.T) {
+	alertmanager := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer alertmanager.Close()
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	down.Close()
+
+	var uris flags.Uris
+	for _, uri := range []string{
+		"log",
+		"alertmanager:" + alertmanager.URL + "?cluster=test",
+		"unknown:foo",
+		"alertmanager:" + alertmanager.URL + "?cluster=test&batch_size=zero",
+		"alertmanager:" + down.URL + "?cluster=test",
+	} {
+		assert.NoError(t, uris.Set(uri))
+	}
+
+	errs := NewSinkFactory().ValidateAll(uris)
+	assert.Len(t, errs, len(uris))
+	assert.NoError(t, errs[0])
+	assert.NoError(t, errs[1])
+	assert.EqualError(t, errs[2], "Sink not recognized: unknown")
+	assert.Error(t, errs[3])
+	assert.Contains(t, errs[4].Error(), "health check failed")
+
+	var out bytes.Buffer
+	assert.False(t, PrintValidation(&out, uris, errs))
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	assert.Len(t, lines, len(uris))
+	assert.Equal(t, "PASS log", lines[0])
+	assert.Equal(t, "PASS alertmanager", lines[1])
+	assert.Equal(t, "FAIL unknown: Sink not recognized: unknown", lines[2])
+	assert.True(t, strings.HasPrefix(lines[4], "FAIL alertmanager: health check failed"))
+
+	out.Reset()
+	assert.True(t, PrintValidation(&out, uris[:2], errs[:2]))
+}
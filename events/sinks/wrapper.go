@@ -0,0 +1,58 @@
+// Copyright 2018 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sinks
+
+import (
+	"fmt"
+	"net/url"
+
+	"k8s.io/heapster/common/flags"
+)
+
+// splitWrappedUri splits the value of a wrapper sink uri such as
+// "circuitbreaker:alertmanager:http://am:9093?cluster=prod&threshold=5" into
+// the uri of the wrapped sink and the options that belong to the wrapper.
+// The wrapper's own options are removed from the query of the wrapped sink,
+// as are minlevel and export_timeout, which Build applies to the wrapper as a
+// whole.
+func splitWrappedUri(val *url.URL, own ...string) (flags.Uri, url.Values, error) {
+	query := val.Query()
+	opts := url.Values{}
+	for _, name := range append(own, minLevelOption, exportTimeoutOption) {
+		if values, found := query[name]; found {
+			opts[name] = values
+			delete(query, name)
+		}
+	}
+
+	key, rest := val.Scheme, val.Opaque
+	if key == "" {
+		// A wrapped sink without a value, e.g. "log?threshold=5".
+		key, rest = val.Path, ""
+	}
+	if key == "" {
+		return flags.Uri{}, nil, fmt.Errorf("missing wrapped sink in %q", val.String())
+	}
+	child := key + ":" + rest
+	if len(query) > 0 {
+		child += "?" + query.Encode()
+	}
+
+	var uri flags.Uri
+	if err := uri.Set(child); err != nil {
+		return flags.Uri{}, nil, err
+	}
+	return uri, opts, nil
+}
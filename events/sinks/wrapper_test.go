@@ -0,0 +1,117 @@
+// Copyright 2018 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sinks
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/heapster/common/flags"
+	"k8s.io/heapster/events/core"
+)
+
+// fakeSink records exported batches and fails while err is set.
+type fakeSink struct {
+	sync.Mutex
+	name    string
+	err     error
+	batches []*core.EventBatch
+	stopped bool
+}
+
+func (f *fakeSink) Name() string {
+	return f.name
+}
+
+func (f *fakeSink) Stop() {
+	f.Lock()
+	defer f.Unlock()
+	f.stopped = true
+}
+
+func (f *fakeSink) ExportEvents(batch *core.EventBatch) {
+	f.ExportEventsWithError(batch)
+}
+
+func (f *fakeSink) ExportEventsWithError(batch *core.EventBatch) error {
+	f.Lock()
+	defer f.Unlock()
+	f.batches = append(f.batches, batch)
+	return f.err
+}
+
+func (f *fakeSink) setErr(err error) {
+	f.Lock()
+	defer f.Unlock()
+	f.err = err
+}
+
+func (f *fakeSink) exported() []*core.EventBatch {
+	f.Lock()
+	defer f.Unlock()
+	return f.batches
+}
+
+var errFake = errors.New("fake export failure")
+
+func TestSplitWrappedUri(t *testing.T) {
+	tests := []struct {
+		in       string
+		own      []string
+		wantKey  string
+		wantVal  string
+		wantOpts map[string]string
+	}{
+		{
+			in:       "circuitbreaker:alertmanager:http://am:9093/api/v1/alerts?cluster=prod&threshold=3",
+			own:      []string{"threshold", "cooldown"},
+			wantKey:  "alertmanager",
+			wantVal:  "http://am:9093/api/v1/alerts?cluster=prod",
+			wantOpts: map[string]string{"threshold": "3"},
+		},
+		{
+			in:       "sample:log:?rate=0.1",
+			own:      []string{"rate"},
+			wantKey:  "log",
+			wantVal:  "",
+			wantOpts: map[string]string{"rate": "0.1"},
+		},
+		{
+			in:       "sample:log?rate=0.1",
+			own:      []string{"rate"},
+			wantKey:  "log",
+			wantVal:  "",
+			wantOpts: map[string]string{"rate": "0.1"},
+		},
+	}
+	for _, test := range tests {
+		var uri flags.Uri
+		assert.NoError(t, uri.Set(test.in))
+		child, opts, err := splitWrappedUri(&uri.Val, test.own...)
+		assert.NoError(t, err, test.in)
+		assert.Equal(t, test.wantKey, child.Key, test.in)
+		assert.Equal(t, test.wantVal, child.Val.String(), test.in)
+		for name, value := range test.wantOpts {
+			assert.Equal(t, value, opts.Get(name), test.in)
+		}
+	}
+
+	var uri flags.Uri
+	assert.NoError(t, uri.Set("sample:?rate=0.1"))
+	_, _, err := splitWrappedUri(&uri.Val, "rate")
+	assert.Error(t, err)
+}
@@ -0,0 +1,116 @@
+// Copyright 2018 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package tracing records spans of the eventer's sink pipeline and exports
+// them via OTLP. Until an exporter is set, starting a span does nothing, so
+// the instrumentation costs next to nothing when tracing is disabled.
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+)
+
+// Exporter receives finished spans.
+type Exporter interface {
+	ExportSpan(*Span)
+}
+
+// exporter is set once on startup, before the pipeline runs.
+var exporter Exporter
+
+// SetExporter sets the exporter finished spans are passed to. A nil exporter
+// disables tracing. It must be called before any span is started.
+func SetExporter(e Exporter) {
+	exporter = e
+}
+
+// Enabled returns whether spans are recorded.
+func Enabled() bool {
+	return exporter != nil
+}
+
+// Span is a single timed operation. A nil *Span is valid and records nothing.
+type Span struct {
+	Name         string
+	TraceID      string
+	SpanID       string
+	ParentSpanID string
+	Start        time.Time
+	End          time.Time
+	Attributes   map[string]interface{}
+	Err          error
+
+	exporter Exporter
+}
+
+type spanKey struct{}
+
+// FromContext returns the span carried by ctx, or nil.
+func FromContext(ctx context.Context) *Span {
+	span, _ := ctx.Value(spanKey{}).(*Span)
+	return span
+}
+
+// StartSpan starts a span named name, as a child of the span carried by ctx
+// if there is one. The returned context carries the new span. If tracing is
+// disabled ctx is returned as is with a nil span.
+func StartSpan(ctx context.Context, name string) (context.Context, *Span) {
+	e := exporter
+	if e == nil {
+		return ctx, nil
+	}
+	span := &Span{
+		Name:       name,
+		SpanID:     randomID(8),
+		Start:      time.Now(),
+		Attributes: map[string]interface{}{},
+		exporter:   e,
+	}
+	if parent := FromContext(ctx); parent != nil {
+		span.TraceID = parent.TraceID
+		span.ParentSpanID = parent.SpanID
+	} else {
+		span.TraceID = randomID(16)
+	}
+	return context.WithValue(ctx, spanKey{}, span), span
+}
+
+// SetAttribute sets an attribute of the span. Values should be strings,
+// ints, int64s, float64s or bools.
+func (s *Span) SetAttribute(key string, value interface{}) {
+	if s == nil {
+		return
+	}
+	s.Attributes[key] = value
+}
+
+// Finish ends the span, marking it failed if err is not nil, and hands it
+// to the exporter.
+func (s *Span) Finish(err error) {
+	if s == nil {
+		return
+	}
+	s.End = time.Now()
+	s.Err = err
+	s.exporter.ExportSpan(s)
+}
+
+func randomID(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,125 @@
+// Copyright 2018 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeExporter struct {
+	spans []*Span
+}
+
+func (f *fakeExporter) ExportSpan(span *Span) {
+	f.spans = append(f.spans, span)
+}
+
+func TestDisabled(t *testing.T) {
+	SetExporter(nil)
+	ctx := context.Background()
+	spanCtx, span := StartSpan(ctx, "test")
+	assert.Nil(t, span)
+	assert.Equal(t, ctx, spanCtx)
+	// Must not panic.
+	span.SetAttribute("key", "value")
+	span.Finish(errors.New("failed"))
+}
+
+func TestStartSpan(t *testing.T) {
+	exporter := &fakeExporter{}
+	SetExporter(exporter)
+	defer SetExporter(nil)
+
+	ctx, parent := StartSpan(context.Background(), "parent")
+	_, child := StartSpan(ctx, "child")
+	child.SetAttribute("events", 3)
+	child.Finish(errors.New("failed"))
+	parent.Finish(nil)
+
+	assert.Len(t, exporter.spans, 2)
+	assert.Equal(t, child, exporter.spans[0])
+	assert.Len(t, parent.TraceID, 32)
+	assert.Len(t, parent.SpanID, 16)
+	assert.Equal(t, "", parent.ParentSpanID)
+	assert.Equal(t, parent.TraceID, child.TraceID)
+	assert.Equal(t, parent.SpanID, child.ParentSpanID)
+	assert.NotEqual(t, parent.SpanID, child.SpanID)
+	assert.Equal(t, 3, child.Attributes["events"])
+	assert.EqualError(t, child.Err, "failed")
+	assert.Nil(t, parent.Err)
+}
+
+func TestNewOTLPExporter(t *testing.T) {
+	for endpoint, expected := range map[string]string{
+		"collector:4318":                 "http://collector:4318/v1/traces",
+		"https://collector:4318":         "https://collector:4318/v1/traces",
+		"http://collector:4318/otlp/v1/": "http://collector:4318/otlp/v1/",
+	} {
+		e, err := NewOTLPExporter(endpoint, "eventer")
+		assert.NoError(t, err, endpoint)
+		assert.Equal(t, expected, e.Endpoint)
+		e.Stop()
+	}
+
+	for _, endpoint := range []string{"ftp://collector", "http://"} {
+		_, err := NewOTLPExporter(endpoint, "eventer")
+		assert.Error(t, err, endpoint)
+	}
+}
+
+func TestOTLPExport(t *testing.T) {
+	var received []otlpRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, OTLP_TRACES_PATH, r.URL.Path)
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		body, _ := ioutil.ReadAll(r.Body)
+		var req otlpRequest
+		assert.NoError(t, json.Unmarshal(body, &req))
+		received = append(received, req)
+	}))
+	defer server.Close()
+
+	e, err := NewOTLPExporter(server.URL, "eventer")
+	assert.NoError(t, err)
+	SetExporter(e)
+	defer SetExporter(nil)
+
+	_, span := StartSpan(context.Background(), "sink.export")
+	span.SetAttribute("sink", "alertmanager")
+	span.Finish(errors.New("timeout"))
+	// Stop sends the spans still queued.
+	e.Stop()
+
+	assert.Len(t, received, 1)
+	resource := received[0].ResourceSpans[0]
+	assert.Equal(t, "service.name", resource.Resource.Attributes[0].Key)
+	assert.Equal(t, "eventer", *resource.Resource.Attributes[0].Value.StringValue)
+	spans := resource.ScopeSpans[0].Spans
+	assert.Len(t, spans, 1)
+	assert.Equal(t, "sink.export", spans[0].Name)
+	assert.Equal(t, span.TraceID, spans[0].TraceID)
+	assert.Equal(t, otlpStatusError, spans[0].Status.Code)
+	assert.Equal(t, "timeout", spans[0].Status.Message)
+	assert.Equal(t, "sink", spans[0].Attributes[0].Key)
+	assert.Equal(t, "alertmanager", *spans[0].Attributes[0].Value.StringValue)
+}
@@ -42,6 +42,9 @@ type SinkFactory struct {
 }
 
 func (this *SinkFactory) Build(uri flags.Uri) (core.DataSink, error) {
+	if err := flags.ResolveOptions(&uri.Val); err != nil {
+		return nil, err
+	}
 	switch uri.Key {
 	case "elasticsearch":
 		return elasticsearch.NewElasticSearchSink(&uri.Val)
@@ -87,7 +90,7 @@ func (this *SinkFactory) BuildAll(uris flags.Uris, historicalUri string, disable
 	for _, uri := range uris {
 		sink, err := this.Build(uri)
 		if err != nil {
-			glog.Errorf("Failed to create %v sink: %v", uri, err)
+			glog.Errorf("Failed to create %s sink: %v", uri.Redacted(), err)
 			continue
 		}
 		if uri.Key == "metric" {
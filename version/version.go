@@ -29,3 +29,13 @@ var GitCommit string
 func VersionInfo() string {
 	return fmt.Sprintf("version: %s\ncommit: %s", HeapsterVersion, GitCommit)
 }
+
+// UserAgent returns the User-Agent sent by the given heapster component,
+// e.g. "heapster-events/v1.5.0".
+func UserAgent(component string) string {
+	version := HeapsterVersion
+	if version == "" {
+		version = "unknown"
+	}
+	return fmt.Sprintf("heapster-%s/%s", component, version)
+}